@@ -3,41 +3,65 @@ package buffer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/wal"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
+var bufferLog = logger.For("buffer")
+
 const (
-	defaultBufferSize  = 1000
 	defaultFlushSize   = 50
 	defaultFlushPeriod = 30 * time.Second
-	maxRetries         = 3
+	defaultChunkSize   = 1000
+	// maxChunkSize is the server's limit of events per batch
+	maxChunkSize = 10000
 )
 
-// Event represents a generic buffered event
+// Event represents a generic buffered event. ID and Seq let the server
+// recognise events it already stored when a batch is sent again.
 type Event struct {
+	ID        string          `json:"id"`
+	Seq       uint64          `json:"seq"`
 	Type      string          `json:"type"`
 	Timestamp time.Time       `json:"timestamp"`
 	Data      json.RawMessage `json:"data"`
 }
 
-// EventBuffer buffers events and flushes them to server
+// poster sends a batch; *httpclient.Client in production
+type poster interface {
+	PostJSON(ctx context.Context, endpoint string, payload interface{}) error
+}
+
+// EventBuffer persists events in a write-ahead log and flushes them to the
+// server. Events are removed from disk only after the server stored them.
 type EventBuffer struct {
-	client       *httpclient.Client
+	client       poster
+	sink         io.Writer
 	endpoint     string
-	buffer       []Event
-	bufferFile   string
-	maxSize      int
+	wal          *wal.WAL
+	seq          *sequence
 	flushSize    int
+	chunkSize    int
+	maxSize      atomic.Int64
+	rejected     atomic.Uint64
 	flushPeriod  time.Duration
-	mu           sync.Mutex
+	flushMu      sync.Mutex
 	stopChan     chan struct{}
+	stopOnce     sync.Once
+	done         chan struct{}
 	flushTrigger chan struct{}
 }
 
@@ -46,22 +70,42 @@ type Config struct {
 	Client      *httpclient.Client
 	Endpoint    string
 	BufferDir   string
-	MaxSize     int
 	FlushSize   int
 	FlushPeriod time.Duration
+	// ChunkSize is the number of events sent per request
+	ChunkSize int
+	// MaxSize caps the events held in memory at once while flushing; it
+	// limits ChunkSize and can be lowered at runtime with SetMaxSize
+	MaxSize int
+	// Sink, when set, receives the events as JSON lines instead of the
+	// server; used by the agent's dry-run mode
+	Sink io.Writer
+
+	// Write-ahead log settings, see package wal for defaults
+	SegmentBytes int64
+	MaxDiskBytes int64
+	Sync         wal.SyncPolicy
+	SyncInterval time.Duration
+	DropPolicy   wal.DropPolicy
 }
 
 // NewEventBuffer creates a new event buffer
 func NewEventBuffer(cfg Config) (*EventBuffer, error) {
-	if cfg.MaxSize == 0 {
-		cfg.MaxSize = defaultBufferSize
-	}
 	if cfg.FlushSize == 0 {
 		cfg.FlushSize = defaultFlushSize
 	}
 	if cfg.FlushPeriod == 0 {
 		cfg.FlushPeriod = defaultFlushPeriod
 	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = defaultChunkSize
+	}
+	if cfg.ChunkSize > maxChunkSize {
+		cfg.ChunkSize = maxChunkSize
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = cfg.ChunkSize
+	}
 
 	// Create buffer directory
 	if cfg.BufferDir == "" {
@@ -71,30 +115,50 @@ func NewEventBuffer(cfg Config) (*EventBuffer, error) {
 		return nil, fmt.Errorf("failed to create buffer directory: %w", err)
 	}
 
-	bufferFile := filepath.Join(cfg.BufferDir, "events.json")
+	seq, err := newSequence(filepath.Join(cfg.BufferDir, "sequence"))
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := wal.Open(wal.Options{
+		Dir:          filepath.Join(cfg.BufferDir, "wal"),
+		SegmentBytes: cfg.SegmentBytes,
+		MaxBytes:     cfg.MaxDiskBytes,
+		Sync:         cfg.Sync,
+		SyncInterval: cfg.SyncInterval,
+		Drop:         cfg.DropPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
 
 	eb := &EventBuffer{
 		client:       cfg.Client,
+		sink:         cfg.Sink,
 		endpoint:     cfg.Endpoint,
-		bufferFile:   bufferFile,
-		maxSize:      cfg.MaxSize,
+		wal:          w,
+		seq:          seq,
 		flushSize:    cfg.FlushSize,
+		chunkSize:    cfg.ChunkSize,
 		flushPeriod:  cfg.FlushPeriod,
-		buffer:       make([]Event, 0, cfg.MaxSize),
 		stopChan:     make(chan struct{}),
+		done:         make(chan struct{}),
 		flushTrigger: make(chan struct{}, 1),
 	}
+	eb.maxSize.Store(int64(cfg.MaxSize))
 
-	// Load existing buffered events from disk
-	if err := eb.loadFromDisk(); err != nil {
-		log.Printf("Warning: failed to load buffered events: %v", err)
+	// Move events buffered by older agents into the log
+	if err := eb.migrateLegacyFile(filepath.Join(cfg.BufferDir, "events.json")); err != nil {
+		bufferLog.Warn("Failed to load buffered events", zap.Error(err))
 	}
 
 	return eb, nil
 }
 
-// Start begins periodic flushing
+// Start begins periodic flushing. When it returns the final flush is done
+// and the log is closed.
 func (eb *EventBuffer) Start(ctx context.Context) {
+	defer close(eb.done)
 	ticker := time.NewTicker(eb.flushPeriod)
 	defer ticker.Stop()
 	defer eb.saveOnShutdown()
@@ -102,12 +166,15 @@ func (eb *EventBuffer) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Event buffer shutting down...")
+			bufferLog.Info("Event buffer shutting down")
 			return
 		case <-eb.stopChan:
-			log.Println("Event buffer stop signal received")
+			bufferLog.Info("Event buffer stop signal received")
 			return
 		case <-ticker.C:
+			if err := eb.wal.Sync(); err != nil {
+				bufferLog.Warn("Failed to sync event log", zap.Error(err))
+			}
 			eb.Flush(ctx)
 		case <-eb.flushTrigger:
 			eb.Flush(ctx)
@@ -115,120 +182,207 @@ func (eb *EventBuffer) Start(ctx context.Context) {
 	}
 }
 
-// Stop stops the buffer
-func (eb *EventBuffer) Stop() {
-	close(eb.stopChan)
+// Stop stops the buffer and waits until Start has flushed the remaining
+// events and closed the log, or ctx is done
+func (eb *EventBuffer) Stop(ctx context.Context) error {
+	eb.stopOnce.Do(func() { close(eb.stopChan) })
+	select {
+	case <-eb.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("event buffer still flushing: %w", ctx.Err())
+	}
 }
 
-// Add adds an event to buffer
-func (eb *EventBuffer) Add(eventType string, data interface{}) error {
-	eb.mu.Lock()
-	defer eb.mu.Unlock()
+// Done is closed when Start has returned and the log files are released
+func (eb *EventBuffer) Done() <-chan struct{} {
+	return eb.done
+}
 
+// Add appends an event to the log
+func (eb *EventBuffer) Add(eventType string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
+	seq, err := eb.seq.Next()
+	if err != nil {
+		return err
+	}
+
 	event := Event{
+		ID:        uuid.NewString(),
+		Seq:       seq,
 		Type:      eventType,
 		Timestamp: time.Now(),
 		Data:      jsonData,
 	}
-
-	// Add to buffer
-	eb.buffer = append(eb.buffer, event)
-
-	// Save to disk if buffer is getting large
-	if len(eb.buffer) >= eb.maxSize/2 {
-		if err := eb.saveToDisk(); err != nil {
-			log.Printf("Warning: failed to save buffer to disk: %v", err)
-		}
+	if err := eb.append(event); err != nil {
+		return err
 	}
 
 	// Trigger flush if buffer is full
-	if len(eb.buffer) >= eb.flushSize {
-		select {
-		case eb.flushTrigger <- struct{}{}:
-		default:
-		}
+	if eb.wal.Len() >= eb.flushSize {
+		eb.triggerFlush()
 	}
 
 	return nil
 }
 
-// Flush sends buffered events to server
+func (eb *EventBuffer) append(event Event) error {
+	record, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if _, err := eb.wal.Append(record); err != nil {
+		return fmt.Errorf("failed to buffer event: %w", err)
+	}
+	return nil
+}
+
+func (eb *EventBuffer) triggerFlush() {
+	select {
+	case eb.flushTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// Flush sends buffered events to the server in chunks of ChunkSize, oldest
+// first. Each chunk is removed from the log as soon as the server confirms
+// it; on the first failure the rest stays on disk for the next flush.
+// Events added while a request is in flight are sent by a later chunk.
+//
+// A chunk the server refuses as too large (413) is split in half. For other
+// 4xx answers the chunk is split until the rejected event is found, which is
+// then dropped so it cannot block the events behind it.
 func (eb *EventBuffer) Flush(ctx context.Context) error {
-	eb.mu.Lock()
-	if len(eb.buffer) == 0 {
-		eb.mu.Unlock()
-		return nil
+	eb.flushMu.Lock()
+	defer eb.flushMu.Unlock()
+
+	limit := eb.chunkLimit()
+	chunk := limit
+	sent := 0
+loop:
+	for ctx.Err() == nil {
+		records, err := eb.wal.Read(chunk)
+		if err != nil {
+			// Records before the damaged one are still sent
+			bufferLog.Warn("Failed to read event log", zap.Error(err))
+		}
+		if len(records) == 0 {
+			break loop
+		}
+
+		err = eb.send(ctx, records)
+		switch {
+		case err == nil:
+			if err := eb.wal.Ack(records[len(records)-1].Index); err != nil {
+				bufferLog.Warn("Failed to acknowledge flushed events", zap.Error(err))
+			}
+			sent += len(records)
+			if len(records) < chunk {
+				break loop
+			}
+			// Grow back after a split
+			chunk = min(chunk*2, limit)
+		case isRejected(err) && len(records) > 1:
+			chunk = len(records) / 2
+		case isRejected(err):
+			bufferLog.Warn("Server rejected event, dropping it", zap.String("event_id", eventID(records[0].Data)), zap.Error(err))
+			eb.rejected.Add(1)
+			if err := eb.wal.Ack(records[0].Index); err != nil {
+				bufferLog.Warn("Failed to acknowledge rejected event", zap.Error(err))
+			}
+		default:
+			bufferLog.Warn("Failed to flush events to server", zap.Int("sent_before_failure", sent), zap.Error(err))
+			return err
+		}
 	}
 
-	// Take snapshot of current buffer
-	eventsToSend := make([]Event, len(eb.buffer))
-	copy(eventsToSend, eb.buffer)
-	eb.mu.Unlock()
+	if sent > 0 {
+		bufferLog.Info("Flushed events to server", zap.Int("events", sent))
+	}
+	return ctx.Err()
+}
 
-	// Try to send events
-	payload := map[string]interface{}{
-		"events": eventsToSend,
+// isRejected reports whether the server refused the content of a chunk (400
+// or 413), as opposed to failing for reasons unrelated to the events such as
+// authentication, where nothing may be dropped
+func isRejected(err error) bool {
+	var statusErr *httpclient.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
 	}
+	return statusErr.StatusCode == http.StatusBadRequest ||
+		statusErr.StatusCode == http.StatusRequestEntityTooLarge
+}
 
-	err := eb.client.PostJSON(ctx, eb.endpoint, payload)
-	if err != nil {
-		log.Printf("Failed to flush events to server: %v", err)
-		// Save to disk for later retry
-		eb.mu.Lock()
-		if err := eb.saveToDisk(); err != nil {
-			log.Printf("Failed to save buffer to disk: %v", err)
-		}
-		eb.mu.Unlock()
-		return err
+// send posts one chunk of records, or writes it to the sink
+func (eb *EventBuffer) send(ctx context.Context, records []wal.Record) error {
+	if eb.sink != nil {
+		return eb.writeSink(records)
 	}
 
-	// Success - clear buffer
-	eb.mu.Lock()
-	eb.buffer = eb.buffer[:0]
-	eb.mu.Unlock()
+	eventsToSend := make([]json.RawMessage, len(records))
+	for i, r := range records {
+		eventsToSend[i] = r.Data
+	}
 
-	// Remove buffer file
-	if err := os.Remove(eb.bufferFile); err != nil && !os.IsNotExist(err) {
-		log.Printf("Warning: failed to remove buffer file: %v", err)
+	payload := map[string]interface{}{
+		"events": eventsToSend,
 	}
+	return eb.client.PostJSON(ctx, eb.endpoint, payload)
+}
 
-	log.Printf("Successfully flushed %d events to server", len(eventsToSend))
+// writeSink writes one event per line
+func (eb *EventBuffer) writeSink(records []wal.Record) error {
+	for _, r := range records {
+		line := append(append(make([]byte, 0, len(r.Data)+1), r.Data...), '\n')
+		if _, err := eb.sink.Write(line); err != nil {
+			return fmt.Errorf("failed to write events: %w", err)
+		}
+	}
 	return nil
 }
 
-// Size returns current buffer size
-func (eb *EventBuffer) Size() int {
-	eb.mu.Lock()
-	defer eb.mu.Unlock()
-	return len(eb.buffer)
+// eventID returns the ID of a buffered event for logging
+func eventID(record []byte) string {
+	var e struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(record, &e)
+	return e.ID
 }
 
-// saveToDisk saves buffer to disk (called with lock held)
-func (eb *EventBuffer) saveToDisk() error {
-	if len(eb.buffer) == 0 {
-		return nil
+// SetMaxSize changes how many events a flush holds in memory at once.
+// The next flush uses the new size.
+func (eb *EventBuffer) SetMaxSize(n int) {
+	if n < 1 {
+		n = 1
 	}
+	eb.maxSize.Store(int64(n))
+}
 
-	data, err := json.Marshal(eb.buffer)
-	if err != nil {
-		return fmt.Errorf("failed to marshal buffer: %w", err)
-	}
+// chunkLimit is the number of events read per request
+func (eb *EventBuffer) chunkLimit() int {
+	return min(eb.chunkSize, int(eb.maxSize.Load()))
+}
 
-	if err := os.WriteFile(eb.bufferFile, data, 0600); err != nil {
-		return fmt.Errorf("failed to write buffer file: %w", err)
-	}
+// Size returns the number of events waiting to be sent
+func (eb *EventBuffer) Size() int {
+	return eb.wal.Len()
+}
 
-	return nil
+// Dropped returns how many events were lost: discarded because the disk
+// quota was reached or rejected by the server
+func (eb *EventBuffer) Dropped() uint64 {
+	return eb.wal.Dropped() + eb.rejected.Load()
 }
 
-// loadFromDisk loads buffer from disk
-func (eb *EventBuffer) loadFromDisk() error {
-	data, err := os.ReadFile(eb.bufferFile)
+// migrateLegacyFile appends the events of the old single-file buffer to the log
+func (eb *EventBuffer) migrateLegacyFile(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -238,30 +392,49 @@ func (eb *EventBuffer) loadFromDisk() error {
 
 	var events []Event
 	if err := json.Unmarshal(data, &events); err != nil {
+		// Keep the file for inspection instead of retrying it on every start
+		if rerr := os.Rename(path, path+".corrupt"); rerr != nil {
+			bufferLog.Warn("Failed to move corrupt buffer file", zap.Error(rerr))
+		}
 		return fmt.Errorf("failed to unmarshal buffer: %w", err)
 	}
 
-	eb.mu.Lock()
-	defer eb.mu.Unlock()
-
-	// Limit loaded events to maxSize
-	if len(events) > eb.maxSize {
-		events = events[len(events)-eb.maxSize:]
+	for _, event := range events {
+		// Events buffered by older agents have no ID yet
+		if event.ID == "" {
+			seq, err := eb.seq.Next()
+			if err != nil {
+				return err
+			}
+			event.ID = uuid.NewString()
+			event.Seq = seq
+		}
+		if err := eb.append(event); err != nil {
+			return err
+		}
+	}
+	if err := eb.wal.Sync(); err != nil {
+		return err
 	}
 
-	eb.buffer = events
-	log.Printf("Loaded %d buffered events from disk", len(events))
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove buffer file: %w", err)
+	}
+	bufferLog.Info("Loaded buffered events from disk", zap.Int("events", len(events)))
 
 	return nil
 }
 
-// saveOnShutdown saves buffer to disk before shutdown
+// saveOnShutdown tries a last flush and closes the log; unsent events stay on disk
 func (eb *EventBuffer) saveOnShutdown() {
-	eb.mu.Lock()
-	defer eb.mu.Unlock()
+	defer func() {
+		if err := eb.wal.Close(); err != nil {
+			bufferLog.Error("Failed to close event log", zap.Error(err))
+		}
+	}()
 
-	if len(eb.buffer) == 0 {
-		log.Println("Event buffer is empty, nothing to save")
+	if eb.wal.Len() == 0 {
+		bufferLog.Info("Event buffer is empty, nothing to save")
 		return
 	}
 
@@ -269,21 +442,10 @@ func (eb *EventBuffer) saveOnShutdown() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Unlock during network call
-	eb.mu.Unlock()
-	err := eb.Flush(ctx)
-	eb.mu.Lock()
-
-	if err == nil {
-		log.Println("Successfully flushed events before shutdown")
+	if err := eb.Flush(ctx); err == nil && eb.wal.Len() == 0 {
+		bufferLog.Info("Flushed events before shutdown")
 		return
 	}
 
-	// Server unavailable - save to disk
-	log.Printf("Server unavailable, saving %d events to disk", len(eb.buffer))
-	if err := eb.saveToDisk(); err != nil {
-		log.Printf("ERROR: Failed to save buffer to disk: %v", err)
-	} else {
-		log.Printf("Successfully saved %d events to %s", len(eb.buffer), eb.bufferFile)
-	}
+	bufferLog.Warn("Server unavailable, events kept on disk", zap.Int("events", eb.wal.Len()))
 }
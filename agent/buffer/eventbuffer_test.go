@@ -0,0 +1,211 @@
+package buffer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+)
+
+// fakeServer accepts at most limit events per request and rejects events of type "bad"
+type fakeServer struct {
+	limit    int
+	down     bool
+	requests int
+	received []string
+}
+
+func (f *fakeServer) PostJSON(ctx context.Context, endpoint string, payload interface{}) error {
+	events := payload.(map[string]interface{})["events"].([]json.RawMessage)
+	f.requests++
+	if f.down {
+		return errors.New("connection refused")
+	}
+	if len(events) > f.limit {
+		return &httpclient.StatusError{StatusCode: http.StatusRequestEntityTooLarge}
+	}
+	var ids []string
+	for _, raw := range events {
+		var e Event
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		if e.Type == "bad" {
+			return &httpclient.StatusError{StatusCode: http.StatusBadRequest}
+		}
+		ids = append(ids, e.Type)
+	}
+	f.received = append(f.received, ids...)
+	return nil
+}
+
+func newTestBuffer(t *testing.T, server *fakeServer, chunkSize int) *EventBuffer {
+	t.Helper()
+	eb, err := NewEventBuffer(Config{BufferDir: t.TempDir(), FlushSize: 1000, ChunkSize: chunkSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eb.client = server
+	t.Cleanup(func() { eb.wal.Close() })
+	return eb
+}
+
+func TestFlushSplitsChunksAndKeepsFailures(t *testing.T) {
+	server := &fakeServer{limit: 3, down: true}
+	eb := newTestBuffer(t, server, 10)
+	for i := 0; i < 7; i++ {
+		if err := eb.Add("ok", map[string]int{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := eb.Flush(context.Background()); err == nil {
+		t.Fatal("expected the flush to fail while the server is down")
+	}
+	if eb.Size() != 7 {
+		t.Fatalf("failed events must stay buffered, %d left", eb.Size())
+	}
+
+	server.down = false
+	if err := eb.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.received) != 7 || eb.Size() != 0 {
+		t.Fatalf("expected all 7 events delivered in smaller chunks, got %d, %d left", len(server.received), eb.Size())
+	}
+}
+
+func TestFlushDropsOnlyRejectedEvent(t *testing.T) {
+	server := &fakeServer{limit: 100}
+	eb := newTestBuffer(t, server, 10)
+	for _, eventType := range []string{"ok", "ok", "bad", "ok", "ok"} {
+		if err := eb.Add(eventType, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := eb.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.received) != 4 || eb.Size() != 0 {
+		t.Fatalf("expected 4 delivered and nothing left, got %v and %d left", server.received, eb.Size())
+	}
+	if eb.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", eb.Dropped())
+	}
+}
+
+func TestSetMaxSizeLimitsChunks(t *testing.T) {
+	server := &fakeServer{limit: 100}
+	eb := newTestBuffer(t, server, 10)
+	for i := 0; i < 6; i++ {
+		if err := eb.Add("ok", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eb.SetMaxSize(2)
+	if err := eb.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.requests != 3 || len(server.received) != 6 {
+		t.Fatalf("expected 6 events in 3 requests, got %d in %d", len(server.received), server.requests)
+	}
+}
+
+func TestFlushWritesSinkAsJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	eb, err := NewEventBuffer(Config{BufferDir: t.TempDir(), FlushSize: 1000, ChunkSize: 2, Sink: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eb.wal.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := eb.Add("usb", map[string]int{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := eb.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), out.String())
+	}
+	for i, line := range lines {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %d is not an event: %v", i, err)
+		}
+		if e.Type != "usb" || e.ID == "" {
+			t.Errorf("line %d = %+v", i, e)
+		}
+	}
+	if eb.Size() != 0 {
+		t.Errorf("Size = %d after flush, want 0", eb.Size())
+	}
+}
+
+// blockingServer holds every request until release is closed
+type blockingServer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingServer) PostJSON(ctx context.Context, endpoint string, payload interface{}) error {
+	close(b.started)
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestStopWaitsForFinalFlush(t *testing.T) {
+	eb, err := NewEventBuffer(Config{BufferDir: t.TempDir(), FlushSize: 1000, FlushPeriod: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &blockingServer{started: make(chan struct{}), release: make(chan struct{})}
+	eb.client = server
+	if err := eb.Add("usb", map[string]string{"device_id": "USB\\1"}); err != nil {
+		t.Fatal(err)
+	}
+	go eb.Start(context.Background())
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- eb.Stop(context.Background()) }()
+
+	<-server.started
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while the final flush was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(server.release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-eb.Done():
+	default:
+		t.Fatal("Done must be closed once Stop returned")
+	}
+
+	// Stopping again returns at once
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := eb.Stop(ctx); err != nil {
+		t.Errorf("second Stop = %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package buffer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// seqBlock is how many sequence numbers are reserved per disk write
+const seqBlock = 1000
+
+// sequence hands out per-agent sequence numbers that keep increasing across
+// restarts. The file stores the end of the reserved block, so after a crash
+// numbers skip ahead instead of being reused.
+type sequence struct {
+	mu       sync.Mutex
+	file     string
+	next     uint64
+	reserved uint64
+}
+
+func newSequence(file string) (*sequence, error) {
+	s := &sequence{file: file, next: 1}
+
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read sequence file: %w", err)
+	}
+	if err == nil {
+		n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence file: %w", err)
+		}
+		s.next = n + 1
+	}
+	s.reserved = s.next - 1
+
+	return s, nil
+}
+
+// Next returns the next sequence number
+func (s *sequence) Next() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next > s.reserved {
+		end := s.reserved + seqBlock
+		tmp := s.file + ".tmp"
+		if err := os.WriteFile(tmp, []byte(strconv.FormatUint(end, 10)), 0600); err != nil {
+			return 0, fmt.Errorf("failed to write sequence file: %w", err)
+		}
+		if err := os.Rename(tmp, s.file); err != nil {
+			return 0, fmt.Errorf("failed to write sequence file: %w", err)
+		}
+		s.reserved = end
+	}
+
+	n := s.next
+	s.next++
+	return n, nil
+}
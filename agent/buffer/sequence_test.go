@@ -0,0 +1,37 @@
+package buffer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSequenceContinuesAfterRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sequence")
+
+	s, err := newSequence(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(1); want <= 3; want++ {
+		got, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("expected %d, got %d", want, got)
+		}
+	}
+
+	// Unused numbers of the reserved block are skipped, never reused
+	s, err = newSequence(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != seqBlock+1 {
+		t.Fatalf("expected %d after restart, got %d", seqBlock+1, got)
+	}
+}
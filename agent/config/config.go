@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,13 +16,18 @@ type Config struct {
 	USBMonitoring      USBMonitoringConfig      `yaml:"usb_monitoring"`
 	FileMonitoring     FileMonitoringConfig     `yaml:"file_monitoring"`
 	Performance        PerformanceConfig        `yaml:"performance"`
+	Buffer             BufferConfig             `yaml:"buffer"`
 	Logging            LoggingConfig            `yaml:"logging"`
+	Security           SecurityConfig           `yaml:"security"`
+	AutoUpdate         AutoUpdateConfig         `yaml:"auto_update"`
 }
 
 type AgentConfig struct {
 	ComputerName string       `yaml:"computer_name"`
 	APIKey       string       `yaml:"api_key"`
 	Server       ServerConfig `yaml:"server"`
+	// HeartbeatSeconds is how often the agent reports its inventory and health
+	HeartbeatSeconds int `yaml:"heartbeat_interval_seconds"`
 }
 
 type ServerConfig struct {
@@ -29,6 +35,8 @@ type ServerConfig struct {
 	TimeoutSeconds int    `yaml:"timeout_seconds"`
 	RetryAttempts  int    `yaml:"retry_attempts"`
 	RetryDelay     int    `yaml:"retry_delay_seconds"`
+	// Compression of event batches: none, gzip or zstd
+	Compression string `yaml:"compression"`
 }
 
 type ActivityMonitoringConfig struct {
@@ -80,13 +88,51 @@ type PerformanceConfig struct {
 	EventBufferSize    int `yaml:"event_buffer_size"`
 }
 
+// BufferConfig controls the on-disk write-ahead log that holds events until
+// the server confirms them
+type BufferConfig struct {
+	Dir             string `yaml:"dir"`
+	SegmentSizeMB   int    `yaml:"segment_size_mb"`
+	MaxDiskMB       int    `yaml:"max_disk_mb"`
+	Fsync           string `yaml:"fsync"` // always, interval or never
+	FsyncIntervalMS int    `yaml:"fsync_interval_ms"`
+	DropPolicy      string `yaml:"drop_policy"` // oldest or newest, when max_disk_mb is reached
+	ChunkSize       int    `yaml:"chunk_size"`  // events per upload request
+}
+
 type LoggingConfig struct {
 	Level      string `yaml:"level"`
 	File       string `yaml:"file"`
 	MaxSizeMB  int    `yaml:"max_size_mb"`
 	MaxBackups int    `yaml:"max_backups"`
+	// ShipToServer sends WARN and higher lines to the server
+	ShipToServer bool `yaml:"ship_to_server"`
+}
+
+type SecurityConfig struct {
+	// EncryptTraffic requires an https server URL
+	EncryptTraffic bool `yaml:"encrypt_traffic"`
+	// VerifyServerCertificate is on unless the file turns it off explicitly
+	VerifyServerCertificate bool `yaml:"verify_server_certificate"`
+	AllowRemoteConfig       bool `yaml:"allow_remote_config"`
+	// RemoteConfigPollSeconds is how often the server is asked for config changes
+	RemoteConfigPollSeconds int `yaml:"remote_config_poll_seconds"`
 }
 
+type AutoUpdateConfig struct {
+	Enabled            bool `yaml:"enabled"`
+	CheckIntervalHours int  `yaml:"check_interval_hours"`
+	// UpdateURL defaults to the server's /api/agent/update
+	UpdateURL string `yaml:"update_url"`
+	// PublicKey is the base64 ed25519 key builds are signed with
+	PublicKey string `yaml:"public_key"`
+	// ConfirmTimeoutMinutes is how long a new version has to send a
+	// heartbeat before the previous binary is restored
+	ConfirmTimeoutMinutes int `yaml:"confirm_timeout_minutes"`
+}
+
+// Load reads the config file, applies defaults and validates the result.
+// Validation problems are returned together as *ValidationError.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -95,18 +141,129 @@ func Load(path string) (*Config, error) {
 
 	expanded := os.ExpandEnv(string(data))
 
-	var cfg Config
+	// Booleans that default to true are set before parsing, the file overrides them
+	cfg := Config{
+		Security: SecurityConfig{VerifyServerCertificate: true},
+	}
 	if err := yaml.Unmarshal([]byte(expanded), &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
-	// Set defaults
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// applyDefaults fills every unset (zero) value. Large copy thresholds are
+// left alone: 0 turns that threshold off.
+func (cfg *Config) applyDefaults() {
 	if cfg.Agent.ComputerName == "" {
 		cfg.Agent.ComputerName = os.Getenv("COMPUTERNAME")
 	}
+	if cfg.Agent.ComputerName == "" {
+		cfg.Agent.ComputerName, _ = os.Hostname()
+	}
+	if cfg.Agent.HeartbeatSeconds == 0 {
+		cfg.Agent.HeartbeatSeconds = 60
+	}
+
+	server := &cfg.Agent.Server
+	if server.TimeoutSeconds == 0 {
+		server.TimeoutSeconds = 30
+	}
+	if server.RetryAttempts == 0 {
+		server.RetryAttempts = 3
+	}
+	if server.RetryDelay == 0 {
+		server.RetryDelay = 5
+	}
+	if server.Compression == "" {
+		server.Compression = "gzip"
+	}
+
 	if cfg.ActivityMonitoring.IntervalSeconds == 0 {
 		cfg.ActivityMonitoring.IntervalSeconds = 30
 	}
+	if cfg.ActivityMonitoring.IdleThresholdSeconds == 0 {
+		cfg.ActivityMonitoring.IdleThresholdSeconds = 300
+	}
 
-	return &cfg, nil
+	if cfg.Screenshots.IntervalMinutes == 0 {
+		cfg.Screenshots.IntervalMinutes = 15
+	}
+	if cfg.Screenshots.Quality == 0 {
+		cfg.Screenshots.Quality = 75
+	}
+	if cfg.Screenshots.MaxSizeKB == 0 {
+		cfg.Screenshots.MaxSizeKB = 500
+	}
+
+	if cfg.Keylogger.BufferSizeChars == 0 {
+		cfg.Keylogger.BufferSizeChars = 1000
+	}
+	if cfg.Keylogger.SendIntervalMin == 0 {
+		cfg.Keylogger.SendIntervalMin = 5
+	}
+
+	if cfg.Performance.MaxMemoryMB == 0 {
+		cfg.Performance.MaxMemoryMB = 100
+	}
+	if cfg.Performance.MaxCPUPercent == 0 {
+		cfg.Performance.MaxCPUPercent = 10
+	}
+	if cfg.Performance.ScreenshotMaxQueue == 0 {
+		cfg.Performance.ScreenshotMaxQueue = 10
+	}
+	if cfg.Performance.EventBufferSize == 0 {
+		cfg.Performance.EventBufferSize = 1000
+	}
+
+	if cfg.Buffer.Dir == "" {
+		cfg.Buffer.Dir = "buffer"
+	}
+	if cfg.Buffer.SegmentSizeMB == 0 {
+		cfg.Buffer.SegmentSizeMB = 4
+	}
+	if cfg.Buffer.MaxDiskMB == 0 {
+		cfg.Buffer.MaxDiskMB = 256
+	}
+	if cfg.Buffer.Fsync == "" {
+		cfg.Buffer.Fsync = "interval"
+	}
+	if cfg.Buffer.FsyncIntervalMS == 0 {
+		cfg.Buffer.FsyncIntervalMS = 1000
+	}
+	if cfg.Buffer.DropPolicy == "" {
+		cfg.Buffer.DropPolicy = "oldest"
+	}
+	if cfg.Buffer.ChunkSize == 0 {
+		cfg.Buffer.ChunkSize = 1000
+	}
+
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = "info"
+	}
+	if cfg.Logging.MaxSizeMB == 0 {
+		cfg.Logging.MaxSizeMB = 50
+	}
+	if cfg.Logging.MaxBackups == 0 {
+		cfg.Logging.MaxBackups = 5
+	}
+
+	if cfg.Security.RemoteConfigPollSeconds == 0 {
+		cfg.Security.RemoteConfigPollSeconds = 300
+	}
+
+	if cfg.AutoUpdate.CheckIntervalHours == 0 {
+		cfg.AutoUpdate.CheckIntervalHours = 24
+	}
+	if cfg.AutoUpdate.ConfirmTimeoutMinutes == 0 {
+		cfg.AutoUpdate.ConfirmTimeoutMinutes = 10
+	}
+	if cfg.AutoUpdate.UpdateURL == "" && cfg.Agent.Server.URL != "" {
+		cfg.AutoUpdate.UpdateURL = strings.TrimRight(cfg.Agent.Server.URL, "/") + "/api/agent/update"
+	}
 }
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadString(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestSampleConfigLoads(t *testing.T) {
+	cfg, err := Load("../config.yaml")
+	if err != nil {
+		t.Fatalf("sample config: %v", err)
+	}
+	if !cfg.Security.VerifyServerCertificate || cfg.AutoUpdate.CheckIntervalHours != 24 {
+		t.Errorf("security/auto_update not parsed: %+v %+v", cfg.Security, cfg.AutoUpdate)
+	}
+}
+
+func TestLoadAppliesDefaults(t *testing.T) {
+	cfg, err := loadString(t, "agent:\n  server:\n    url: http://server:5000/\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := cfg.Agent.Server
+	if server.TimeoutSeconds != 30 || server.RetryAttempts != 3 || server.RetryDelay != 5 || server.Compression != "gzip" {
+		t.Errorf("server defaults = %+v", server)
+	}
+	if cfg.Screenshots.Quality != 75 || cfg.Performance.MaxCPUPercent != 10 || cfg.Logging.Level != "info" {
+		t.Errorf("section defaults not applied: %+v %+v %+v", cfg.Screenshots, cfg.Performance, cfg.Logging)
+	}
+	if !cfg.Security.VerifyServerCertificate {
+		t.Error("certificate verification must default to on")
+	}
+	if cfg.AutoUpdate.UpdateURL != "http://server:5000/api/agent/update" {
+		t.Errorf("update url = %q", cfg.AutoUpdate.UpdateURL)
+	}
+	if cfg.Agent.ComputerName == "" {
+		t.Error("computer name not defaulted")
+	}
+}
+
+func TestLoadAggregatesFieldErrors(t *testing.T) {
+	_, err := loadString(t, `
+agent:
+  server:
+    url: "not a url"
+    compression: brotli
+screenshots:
+  quality: 101
+activity_monitoring:
+  interval_seconds: -5
+security:
+  verify_server_certificate: false
+`)
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v, want *ValidationError", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, fe := range verr.Errors {
+		fields[fe.Field] = true
+	}
+	for _, want := range []string{"agent.server.url", "agent.server.compression", "screenshots.quality", "activity_monitoring.interval_seconds"} {
+		if !fields[want] {
+			t.Errorf("missing error for %s in %v", want, verr)
+		}
+	}
+	if len(verr.Errors) != 4 {
+		t.Errorf("got %d errors, want 4: %v", len(verr.Errors), verr)
+	}
+}
+
+func TestEncryptTrafficRequiresHTTPS(t *testing.T) {
+	_, err := loadString(t, "agent:\n  server:\n    url: http://server\nsecurity:\n  encrypt_traffic: true\n")
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Errors[0].Field != "security.encrypt_traffic" {
+		t.Fatalf("err = %v", err)
+	}
+
+	if _, err := loadString(t, "agent:\n  server:\n    url: https://server\nsecurity:\n  encrypt_traffic: true\n"); err != nil {
+		t.Errorf("https url rejected: %v", err)
+	}
+}
+
+func TestAutoUpdateRequiresPublicKey(t *testing.T) {
+	_, err := loadString(t, "agent:\n  server:\n    url: http://server\nauto_update:\n  enabled: true\n")
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Field != "auto_update.public_key" {
+		t.Fatalf("err = %v", err)
+	}
+
+	key := "O2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik="
+	if _, err := loadString(t, "agent:\n  server:\n    url: http://server\nauto_update:\n  enabled: true\n  public_key: "+key+"\n"); err != nil {
+		t.Errorf("valid key rejected: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+// RemoteConfig is the per-computer config served by GET /api/agent/config.
+// It overrides the matching settings of the local config file.
+type RemoteConfig struct {
+	Version     string `json:"version"`
+	Screenshots struct {
+		Enabled         bool `json:"enabled"`
+		IntervalMinutes int  `json:"interval_minutes"`
+	} `json:"screenshots"`
+	Keylogger struct {
+		Enabled bool `json:"enabled"`
+	} `json:"keylogger"`
+	USBMonitoring struct {
+		Enabled bool `json:"enabled"`
+	} `json:"usb_monitoring"`
+	FileMonitoring struct {
+		Enabled              bool `json:"enabled"`
+		LargeCopyThresholdMB int  `json:"large_copy_threshold_mb"`
+	} `json:"file_monitoring"`
+}
+
+// WithRemote returns a copy of cfg with the remote settings applied.
+// Zero intervals and thresholds keep the local value. A RemoteConfig without
+// a version means the computer is not configured on the server and keeps
+// the local config as is.
+func (cfg *Config) WithRemote(rc RemoteConfig) *Config {
+	out := *cfg
+	if rc.Version == "" {
+		return &out
+	}
+
+	out.Screenshots.Enabled = rc.Screenshots.Enabled
+	if rc.Screenshots.IntervalMinutes > 0 {
+		out.Screenshots.IntervalMinutes = rc.Screenshots.IntervalMinutes
+	}
+	out.Keylogger.Enabled = rc.Keylogger.Enabled
+	out.USBMonitoring.Enabled = rc.USBMonitoring.Enabled
+	out.FileMonitoring.Enabled = rc.FileMonitoring.Enabled
+	if rc.FileMonitoring.LargeCopyThresholdMB > 0 {
+		out.FileMonitoring.LargeCopyThresholdMB = rc.FileMonitoring.LargeCopyThresholdMB
+	}
+
+	return &out
+}
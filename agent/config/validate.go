@@ -0,0 +1,169 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxChunkSize is the server's limit of events per batch
+const maxChunkSize = 10000
+
+// FieldError is an invalid value, Field is its YAML path
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists every invalid value of a config
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("invalid config (%d errors): %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// validator collects field errors
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) positive(field string, value int) {
+	if value <= 0 {
+		v.add(field, "must be greater than 0, got %d", value)
+	}
+}
+
+func (v *validator) between(field string, value, min, max int) {
+	if value < min || value > max {
+		v.add(field, "must be between %d and %d, got %d", min, max, value)
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) httpURL(field, value string) *url.URL {
+	if value == "" {
+		v.add(field, "is required")
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.add(field, "is not a valid URL: %v", err)
+		return nil
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		v.add(field, "must be an http or https URL, got %q", value)
+		return nil
+	}
+	if u.Host == "" {
+		v.add(field, "has no host: %q", value)
+		return nil
+	}
+	return u
+}
+
+// Validate checks the values of a defaulted config and returns a
+// *ValidationError listing all problems, or nil
+func (cfg *Config) Validate() error {
+	v := &validator{}
+
+	serverURL := v.httpURL("agent.server.url", cfg.Agent.Server.URL)
+	v.positive("agent.server.timeout_seconds", cfg.Agent.Server.TimeoutSeconds)
+	v.between("agent.server.retry_attempts", cfg.Agent.Server.RetryAttempts, 0, 10)
+	v.positive("agent.server.retry_delay_seconds", cfg.Agent.Server.RetryDelay)
+	v.oneOf("agent.server.compression", cfg.Agent.Server.Compression, "none", "gzip", "zstd")
+	v.positive("agent.heartbeat_interval_seconds", cfg.Agent.HeartbeatSeconds)
+
+	v.positive("activity_monitoring.interval_seconds", cfg.ActivityMonitoring.IntervalSeconds)
+	// Idle is tracked in whole minutes and a session counts as offline after 30
+	v.between("activity_monitoring.idle_threshold_seconds", cfg.ActivityMonitoring.IdleThresholdSeconds, 60, 30*60)
+
+	v.positive("screenshots.interval_minutes", cfg.Screenshots.IntervalMinutes)
+	v.between("screenshots.quality", cfg.Screenshots.Quality, 1, 100)
+	v.positive("screenshots.max_size_kb", cfg.Screenshots.MaxSizeKB)
+
+	v.positive("keylogger.buffer_size_chars", cfg.Keylogger.BufferSizeChars)
+	v.positive("keylogger.send_interval_minutes", cfg.Keylogger.SendIntervalMin)
+
+	if cfg.USBMonitoring.Enabled && cfg.USBMonitoring.ShadowCopyEnabled && cfg.USBMonitoring.ShadowCopyDest == "" {
+		v.add("usb_monitoring.shadow_copy_destination", "is required when shadow_copy_enabled is set")
+	}
+
+	if cfg.FileMonitoring.LargeCopyThresholdMB < 0 {
+		v.add("file_monitoring.large_copy_threshold_mb", "must not be negative, got %d", cfg.FileMonitoring.LargeCopyThresholdMB)
+	}
+	if cfg.FileMonitoring.LargeCopyFileCount < 0 {
+		v.add("file_monitoring.large_copy_file_count", "must not be negative, got %d", cfg.FileMonitoring.LargeCopyFileCount)
+	}
+	if cfg.FileMonitoring.Enabled {
+		if len(cfg.FileMonitoring.MonitoredLocations) == 0 {
+			v.add("file_monitoring.monitored_locations", "must list at least one location")
+		}
+		if cfg.FileMonitoring.AlertOnLargeCopy &&
+			cfg.FileMonitoring.LargeCopyThresholdMB == 0 && cfg.FileMonitoring.LargeCopyFileCount == 0 {
+			v.add("file_monitoring.alert_on_large_copy", "needs large_copy_threshold_mb or large_copy_file_count")
+		}
+	}
+
+	v.positive("performance.max_memory_mb", cfg.Performance.MaxMemoryMB)
+	v.between("performance.max_cpu_percent", cfg.Performance.MaxCPUPercent, 1, 100)
+	v.positive("performance.screenshot_max_queue", cfg.Performance.ScreenshotMaxQueue)
+	v.positive("performance.event_buffer_size", cfg.Performance.EventBufferSize)
+
+	v.positive("buffer.segment_size_mb", cfg.Buffer.SegmentSizeMB)
+	if cfg.Buffer.MaxDiskMB < cfg.Buffer.SegmentSizeMB {
+		v.add("buffer.max_disk_mb", "must be at least segment_size_mb (%d), got %d", cfg.Buffer.SegmentSizeMB, cfg.Buffer.MaxDiskMB)
+	}
+	v.oneOf("buffer.fsync", cfg.Buffer.Fsync, "always", "interval", "never")
+	v.positive("buffer.fsync_interval_ms", cfg.Buffer.FsyncIntervalMS)
+	v.oneOf("buffer.drop_policy", cfg.Buffer.DropPolicy, "oldest", "newest")
+	v.between("buffer.chunk_size", cfg.Buffer.ChunkSize, 1, maxChunkSize)
+
+	v.oneOf("logging.level", cfg.Logging.Level, "debug", "info", "warn", "error")
+	v.positive("logging.max_size_mb", cfg.Logging.MaxSizeMB)
+	v.positive("logging.max_backups", cfg.Logging.MaxBackups)
+
+	v.positive("security.remote_config_poll_seconds", cfg.Security.RemoteConfigPollSeconds)
+	if cfg.Security.EncryptTraffic && serverURL != nil && serverURL.Scheme != "https" {
+		v.add("security.encrypt_traffic", "requires an https agent.server.url")
+	}
+
+	if cfg.AutoUpdate.Enabled {
+		v.positive("auto_update.check_interval_hours", cfg.AutoUpdate.CheckIntervalHours)
+		v.httpURL("auto_update.update_url", cfg.AutoUpdate.UpdateURL)
+		v.positive("auto_update.confirm_timeout_minutes", cfg.AutoUpdate.ConfirmTimeoutMinutes)
+		if cfg.AutoUpdate.PublicKey == "" {
+			v.add("auto_update.public_key", "is required when auto_update is enabled")
+		} else if key, err := base64.StdEncoding.DecodeString(cfg.AutoUpdate.PublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+			v.add("auto_update.public_key", "must be a base64 ed25519 public key")
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build windows || linux
+// +build windows linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
+	"github.com/ctolnik/Office-Monitor/agent/config"
+	"go.uber.org/zap"
+)
+
+// setupDryRun routes the event buffer to a JSONL sink instead of the server.
+// The buffer gets a throwaway directory so events an installed agent left in
+// the real buffer are not consumed. The returned func closes the sink.
+func setupDryRun(cfg *config.Config, bufferConfig *buffer.Config, output string) (func(), error) {
+	var sink io.Writer = os.Stdout
+	var file *os.File
+	if output != "-" {
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", output, err)
+		}
+		file = f
+		sink = f
+	}
+
+	dir, err := os.MkdirTemp("", "agent-dry-run-")
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+	}
+
+	bufferConfig.BufferDir = dir
+	bufferConfig.Sink = sink
+	// Show events promptly instead of collecting a batch
+	bufferConfig.FlushSize = 1
+	bufferConfig.FlushPeriod = time.Second
+
+	// Screenshots are uploaded by the monitor itself, not through the buffer
+	if cfg.Screenshots.Enabled {
+		mainLog.Info("Dry run: screenshot capture is disabled")
+		cfg.Screenshots.Enabled = false
+	}
+
+	if file != nil {
+		mainLog.Info("DRY RUN: events are written to a file, nothing is sent to the server", zap.String("output", output))
+	} else {
+		mainLog.Info("DRY RUN: events are written to stdout, nothing is sent to the server")
+	}
+
+	return func() {
+		if file != nil {
+			file.Close()
+		}
+		os.RemoveAll(dir)
+	}, nil
+}
@@ -4,8 +4,14 @@ go 1.24.5
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	golang.org/x/sys v0.37.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/sony/gobreaker v1.0.0 // indirect
+require (
+	github.com/sony/gobreaker v1.0.0
+	go.uber.org/zap v1.27.0
+)
+
+require go.uber.org/multierr v1.10.0 // indirect
@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package governor
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and system time consumed by the process
+func processCPUTime() (time.Duration, error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, err
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package governor
+
+import (
+	"errors"
+	"time"
+)
+
+func processCPUTime() (time.Duration, error) {
+	return 0, errors.New("process CPU time not supported on this platform")
+}
@@ -0,0 +1,205 @@
+// Package governor keeps the agent within the CPU and memory budget of the
+// performance section. Over budget it degrades the agent one level per
+// sample and restores it once usage stays well below the limits.
+package governor
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"go.uber.org/zap"
+)
+
+var governorLog = logger.For("governor")
+
+// Level is the degradation in effect. Levels are cumulative: pausing the
+// keylogger also keeps screenshots slowed down and queues shrunk.
+type Level int
+
+const (
+	LevelNormal Level = iota
+	LevelSlowScreenshots
+	LevelShrinkQueues
+	LevelPauseKeylogger
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelNormal:
+		return "normal"
+	case LevelSlowScreenshots:
+		return "slow_screenshots"
+	case LevelShrinkQueues:
+		return "shrink_queues"
+	case LevelPauseKeylogger:
+		return "pause_keylogger"
+	}
+	return fmt.Sprintf("level_%d", int(l))
+}
+
+const (
+	defaultInterval = 10 * time.Second
+	// Usage must stay below this share of the limits for calmSamples in a
+	// row before a level is lifted
+	calmRatio   = 0.8
+	calmSamples = 3
+)
+
+// Usage is one sample of the agent's own resource use
+type Usage struct {
+	MemoryMB   float64
+	CPUPercent float64 // of all cores
+}
+
+// Status is the governor state reported in heartbeats
+type Status struct {
+	Level  Level
+	Reason string
+	Usage  Usage
+}
+
+// Options configures a Governor
+type Options struct {
+	MaxMemoryMB   int
+	MaxCPUPercent int
+	Interval      time.Duration
+	// OnChange applies a new level; it is called from the governor goroutine
+	OnChange func(Level)
+}
+
+// Governor samples the process and adjusts the degradation level
+type Governor struct {
+	opts Options
+
+	// sampling state, owned by Run
+	lastCPU  time.Duration
+	lastWall time.Time
+	calm     int
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a governor; Run starts sampling
+func New(opts Options) *Governor {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	return &Governor{opts: opts}
+}
+
+// Run samples every interval until ctx is cancelled
+func (g *Governor) Run(ctx context.Context) {
+	governorLog.Info("Resource governor started", zap.Int("max_memory_mb", g.opts.MaxMemoryMB), zap.Int("max_cpu_percent", g.opts.MaxCPUPercent))
+
+	ticker := time.NewTicker(g.opts.Interval)
+	defer ticker.Stop()
+
+	g.sample() // CPU baseline
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if u, ok := g.sample(); ok {
+				g.observe(u)
+			}
+		}
+	}
+}
+
+// Status returns the current level and the last sample
+func (g *Governor) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
+
+// sample measures memory held by the Go runtime and CPU time since the last
+// sample. ok is false for the first sample and when CPU time is unavailable.
+func (g *Governor) sample() (Usage, bool) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	u := Usage{MemoryMB: float64(ms.Sys-ms.HeapReleased) / (1 << 20)}
+
+	cpu, err := processCPUTime()
+	now := time.Now()
+	if err != nil {
+		return u, false
+	}
+	prevCPU, prevWall := g.lastCPU, g.lastWall
+	g.lastCPU, g.lastWall = cpu, now
+	if prevWall.IsZero() {
+		return u, false
+	}
+
+	wall := now.Sub(prevWall)
+	if wall > 0 {
+		u.CPUPercent = 100 * float64(cpu-prevCPU) / float64(wall) / float64(runtime.NumCPU())
+	}
+	return u, true
+}
+
+// observe moves one level up when a limit is exceeded and one level down
+// after calmSamples samples well below both limits
+func (g *Governor) observe(u Usage) {
+	maxMem, maxCPU := float64(g.opts.MaxMemoryMB), float64(g.opts.MaxCPUPercent)
+
+	var reasons []string
+	if maxMem > 0 && u.MemoryMB > maxMem {
+		reasons = append(reasons, fmt.Sprintf("memory %.0fMB > %dMB", u.MemoryMB, g.opts.MaxMemoryMB))
+	}
+	if maxCPU > 0 && u.CPUPercent > maxCPU {
+		reasons = append(reasons, fmt.Sprintf("cpu %.1f%% > %d%%", u.CPUPercent, g.opts.MaxCPUPercent))
+	}
+
+	g.mu.Lock()
+	prev := g.status.Level
+	next := prev
+	switch {
+	case len(reasons) > 0:
+		g.calm = 0
+		if next < LevelPauseKeylogger {
+			next++
+		}
+		g.status.Reason = strings.Join(reasons, ", ")
+	case (maxMem <= 0 || u.MemoryMB < maxMem*calmRatio) && (maxCPU <= 0 || u.CPUPercent < maxCPU*calmRatio):
+		g.calm++
+		if g.calm >= calmSamples && next > LevelNormal {
+			g.calm = 0
+			next--
+		}
+	default:
+		g.calm = 0
+	}
+	if next == LevelNormal {
+		g.status.Reason = ""
+	}
+	g.status.Level = next
+	g.status.Usage = u
+	reason := g.status.Reason
+	g.mu.Unlock()
+
+	// Give memory back to the OS instead of waiting for the scavenger
+	if len(reasons) > 0 && maxMem > 0 && u.MemoryMB > maxMem {
+		debug.FreeOSMemory()
+	}
+
+	if next == prev {
+		return
+	}
+	if next > prev {
+		governorLog.Warn("Over resource budget, degrading", zap.String("reason", reason), zap.Stringer("level", next))
+	} else {
+		governorLog.Info("Usage back to normal, restoring", zap.Stringer("level", next))
+	}
+	if g.opts.OnChange != nil {
+		g.opts.OnChange(next)
+	}
+}
@@ -0,0 +1,55 @@
+package governor
+
+import "testing"
+
+func TestObserveEscalatesAndRecovers(t *testing.T) {
+	var changes []Level
+	g := New(Options{MaxMemoryMB: 100, MaxCPUPercent: 20, OnChange: func(l Level) { changes = append(changes, l) }})
+
+	over := Usage{MemoryMB: 50, CPUPercent: 35}
+	for i := 0; i < 5; i++ {
+		g.observe(over)
+	}
+	st := g.Status()
+	if st.Level != LevelPauseKeylogger {
+		t.Fatalf("level = %s, want %s", st.Level, LevelPauseKeylogger)
+	}
+	if st.Reason != "cpu 35.0% > 20%" {
+		t.Errorf("reason = %q", st.Reason)
+	}
+
+	// Between 80% and 100% of the budget holds the level
+	for i := 0; i < calmSamples; i++ {
+		g.observe(Usage{MemoryMB: 90, CPUPercent: 5})
+	}
+	if g.Status().Level != LevelPauseKeylogger {
+		t.Fatalf("level lifted while close to the budget")
+	}
+
+	calm := Usage{MemoryMB: 40, CPUPercent: 5}
+	for i := 0; i < calmSamples*int(LevelPauseKeylogger); i++ {
+		g.observe(calm)
+	}
+	st = g.Status()
+	if st.Level != LevelNormal || st.Reason != "" {
+		t.Fatalf("status = %+v, want normal", st)
+	}
+
+	want := []Level{LevelSlowScreenshots, LevelShrinkQueues, LevelPauseKeylogger, LevelShrinkQueues, LevelSlowScreenshots, LevelNormal}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestObserveWithoutLimits(t *testing.T) {
+	g := New(Options{})
+	g.observe(Usage{MemoryMB: 4096, CPUPercent: 100})
+	if g.Status().Level != LevelNormal {
+		t.Fatal("governor throttled without limits")
+	}
+}
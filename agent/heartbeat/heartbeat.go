@@ -0,0 +1,151 @@
+// Package heartbeat periodically reports the agent version, inventory and
+// health to the server so offline agents can be detected.
+package heartbeat
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
+)
+
+var heartbeatLog = logger.For("heartbeat")
+
+const endpoint = "/api/agents/heartbeat"
+
+// Payload is the body of POST /api/agents/heartbeat
+type Payload struct {
+	ComputerName   string   `json:"computer_name"`
+	Username       string   `json:"username"`
+	Version        string   `json:"version"`
+	OSBuild        string   `json:"os_build"`
+	IPAddresses    []string `json:"ip_addresses"`
+	UptimeSeconds  int64    `json:"uptime_seconds"`
+	Monitors       []string `json:"monitors"`
+	BufferSize     int      `json:"buffer_size"`
+	BufferDropped  uint64   `json:"buffer_dropped"`
+	CircuitBreaker string   `json:"circuit_breaker"`
+	ConfigVersion  string   `json:"config_version,omitempty"`
+	// Resource governor state, see the governor package
+	ThrottleLevel  int     `json:"throttle_level"`
+	ThrottleReason string  `json:"throttle_reason,omitempty"`
+	MemoryMB       int     `json:"memory_mb"`
+	CPUPercent     float64 `json:"cpu_percent"`
+	// State and restart count of every configured monitor
+	MonitorStatus []supervisor.Status `json:"monitor_status"`
+}
+
+// CollectFunc fills in the parts of the payload owned by the caller
+// (monitors, buffer backlog, config version). Static fields are set by the sender.
+type CollectFunc func(p *Payload)
+
+// Sender posts a heartbeat on start and then on an interval
+type Sender struct {
+	client   *httpclient.Client
+	interval time.Duration
+	base     Payload
+	started  time.Time
+	collect  CollectFunc
+
+	onSuccess func()
+}
+
+// New creates a heartbeat sender
+func New(client *httpclient.Client, computerName, username, version string, interval time.Duration, collect CollectFunc) *Sender {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Sender{
+		client:   client,
+		interval: interval,
+		base: Payload{
+			ComputerName: computerName,
+			Username:     username,
+			Version:      version,
+			OSBuild:      OSBuild(),
+		},
+		started: time.Now(),
+		collect: collect,
+	}
+}
+
+// OnSuccess registers fn to be called by Run after each accepted heartbeat.
+// Must be called before Run.
+func (s *Sender) OnSuccess(fn func()) {
+	s.onSuccess = fn
+}
+
+// Run sends a heartbeat immediately and then every interval until ctx is cancelled
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Send(ctx); err != nil {
+			if ctx.Err() == nil {
+				heartbeatLog.Warn("Heartbeat failed", zap.Error(err))
+			}
+		} else if s.onSuccess != nil {
+			s.onSuccess()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send posts a single heartbeat
+func (s *Sender) Send(ctx context.Context) error {
+	return s.client.PostJSON(ctx, endpoint, s.Payload())
+}
+
+// Payload builds the current heartbeat
+func (s *Sender) Payload() Payload {
+	p := s.base
+	p.IPAddresses = LocalIPs()
+	p.UptimeSeconds = int64(time.Since(s.started).Seconds())
+	p.CircuitBreaker = s.client.BreakerState()
+	if s.collect != nil {
+		s.collect(&p)
+	}
+	if p.Monitors == nil {
+		p.Monitors = []string{}
+	}
+	return p
+}
+
+// LocalIPs returns the unicast addresses of interfaces that are up, skipping loopback
+func LocalIPs() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return []string{}
+	}
+
+	ips := make([]string, 0)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
@@ -0,0 +1,46 @@
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+)
+
+func TestSendPostsPayload(t *testing.T) {
+	var got Payload
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := httpclient.NewClient(httpclient.Config{ServerURL: srv.URL})
+	s := New(client, "PC-01", "ivanov", "1.0.0", 0, func(p *Payload) {
+		p.Monitors = []string{"usb", "files"}
+		p.BufferSize = 42
+		p.ConfigVersion = "abc123"
+	})
+
+	if err := s.Send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != endpoint {
+		t.Fatalf("unexpected path %s", path)
+	}
+	if got.ComputerName != "PC-01" || got.Username != "ivanov" || got.Version != "1.0.0" || got.OSBuild == "" {
+		t.Fatalf("unexpected identity: %+v", got)
+	}
+	if got.BufferSize != 42 || len(got.Monitors) != 2 || got.ConfigVersion != "abc123" {
+		t.Fatalf("collected fields missing: %+v", got)
+	}
+	if got.CircuitBreaker != "closed" || got.IPAddresses == nil {
+		t.Fatalf("unexpected health fields: %+v", got)
+	}
+}
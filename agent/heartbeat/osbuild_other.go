@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package heartbeat
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// OSBuild returns the OS name and kernel release, e.g. "linux 6.1.0-18-amd64"
+func OSBuild() string {
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return runtime.GOOS
+	}
+	return runtime.GOOS + " " + strings.TrimSpace(string(release))
+}
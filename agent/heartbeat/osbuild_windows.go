@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package heartbeat
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// OSBuild returns the Windows version and build number, e.g. "Windows 10.0.19045"
+func OSBuild() string {
+	v := windows.RtlGetVersion()
+	return fmt.Sprintf("Windows %d.%d.%d", v.MajorVersion, v.MinorVersion, v.BuildNumber)
+}
@@ -3,17 +3,38 @@ package httpclient
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/ctolnik/Office-Monitor/agent/logger"
 	"github.com/google/uuid"
 	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
 )
 
+var httpLog = logger.For("http")
+
+// ErrNotModified is returned by GetJSON when the server answers 304 for the given ETag
+var ErrNotModified = errors.New("not modified")
+
+// ErrNoContent is returned by GetJSON when the server answers 204: there is nothing to decode
+var ErrNoContent = errors.New("no content")
+
+// StatusError is a 4xx answer; such requests are not retried
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client error %d: %s", e.StatusCode, e.Body)
+}
+
 // Client represents an HTTP client with retry logic, circuit breaker, and authentication
 type Client struct {
 	serverURL      string
@@ -22,6 +43,9 @@ type Client struct {
 	retryAttempts  int
 	retryDelay     time.Duration
 	circuitBreaker *gobreaker.CircuitBreaker
+
+	compression      string
+	compressMinBytes int
 }
 
 // Config holds configuration for the HTTP client
@@ -31,6 +55,11 @@ type Config struct {
 	TimeoutSeconds int
 	RetryAttempts  int
 	RetryDelay     time.Duration
+	// Compression is the PostJSON body encoding: none, gzip or zstd
+	Compression      string
+	CompressMinBytes int
+	// InsecureSkipVerify accepts any server certificate (self-signed test servers)
+	InsecureSkipVerify bool
 }
 
 // NewClient creates a new HTTP client with circuit breaker
@@ -44,6 +73,12 @@ func NewClient(cfg Config) *Client {
 	if cfg.RetryDelay == 0 {
 		cfg.RetryDelay = 5 * time.Second
 	}
+	if cfg.Compression == "" {
+		cfg.Compression = CompressionNone
+	}
+	if cfg.CompressMinBytes == 0 {
+		cfg.CompressMinBytes = defaultCompressMinBytes
+	}
 
 	// Configure circuit breaker
 	cbSettings := gobreaker.Settings{
@@ -56,35 +91,53 @@ func NewClient(cfg Config) *Client {
 			return counts.Requests >= 3 && failureRatio >= 0.6
 		},
 		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-			log.Printf("Circuit breaker '%s' state changed: %s -> %s", name, from, to)
+			httpLog.Warn("Circuit breaker state changed",
+				zap.String("breaker", name),
+				zap.String("from", from.String()),
+				zap.String("to", to.String()))
 		},
 	}
 
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
 	return &Client{
-		serverURL:      cfg.ServerURL,
-		apiKey:         cfg.APIKey,
-		retryAttempts:  cfg.RetryAttempts,
-		retryDelay:     cfg.RetryDelay,
-		circuitBreaker: gobreaker.NewCircuitBreaker(cbSettings),
+		serverURL:        cfg.ServerURL,
+		apiKey:           cfg.APIKey,
+		retryAttempts:    cfg.RetryAttempts,
+		retryDelay:       cfg.RetryDelay,
+		circuitBreaker:   gobreaker.NewCircuitBreaker(cbSettings),
+		compression:      cfg.Compression,
+		compressMinBytes: cfg.CompressMinBytes,
 		httpClient: &http.Client{
-			Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second,
+			Timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+			Transport: transport,
 		},
 	}
 }
 
-// PostJSON sends a POST request with JSON body (protected by circuit breaker)
+// PostJSON sends a POST request with JSON body (protected by circuit breaker).
+// The body is compressed with the configured Compression. A 4xx answer is
+// returned as *StatusError.
 func (c *Client) PostJSON(ctx context.Context, endpoint string, payload interface{}) error {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
+	body, encoding, err := c.compressBody(jsonData)
+	if err != nil {
+		return err
+	}
+
 	url := c.serverURL + endpoint
 
 	var lastErr error
 	for attempt := 0; attempt <= c.retryAttempts; attempt++ {
 		if attempt > 0 {
-			log.Printf("Retrying request to %s (attempt %d/%d)", endpoint, attempt, c.retryAttempts)
+			httpLog.Info("Retrying request", zap.String("endpoint", endpoint), zap.Int("attempt", attempt), zap.Int("attempts", c.retryAttempts))
 
 			select {
 			case <-ctx.Done():
@@ -94,7 +147,7 @@ func (c *Client) PostJSON(ctx context.Context, endpoint string, payload interfac
 			}
 		}
 
-		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 		if err != nil {
 			lastErr = fmt.Errorf("failed to create request: %w", err)
 			continue
@@ -104,6 +157,9 @@ func (c *Client) PostJSON(ctx context.Context, endpoint string, payload interfac
 		requestID := uuid.New().String()
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("X-Request-ID", requestID)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
 		if c.apiKey != "" {
 			req.Header.Set("X-API-Key", c.apiKey)
 		}
@@ -116,11 +172,11 @@ func (c *Client) PostJSON(ctx context.Context, endpoint string, payload interfac
 
 		if err != nil {
 			lastErr = fmt.Errorf("[request_id=%s] request failed after %v: %w", requestID, duration, err)
-			log.Printf("%v", lastErr)
+			httpLog.Warn("Request failed", zap.String("endpoint", endpoint), zap.Error(lastErr))
 			continue
 		}
 
-		body, _ := io.ReadAll(resp.Body)
+		respBody, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
 
 		// Get server's request ID (may be same or server-generated)
@@ -130,20 +186,25 @@ func (c *Client) PostJSON(ctx context.Context, endpoint string, payload interfac
 		}
 
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			log.Printf("[request_id=%s] POST %s succeeded (%d) after %v", requestID, endpoint, resp.StatusCode, duration)
+			httpLog.Debug("POST succeeded",
+				zap.String("request_id", requestID),
+				zap.String("endpoint", endpoint),
+				zap.Int("status", resp.StatusCode),
+				zap.Duration("duration", duration))
 			return nil
 		}
 
 		if resp.StatusCode >= 500 {
 			// Server error - retry
-			lastErr = fmt.Errorf("[request_id=%s] server error %d after %v: %s", requestID, resp.StatusCode, duration, string(body))
-			log.Printf("%v", lastErr)
+			lastErr = fmt.Errorf("[request_id=%s] server error %d after %v: %s", requestID, resp.StatusCode, duration, string(respBody))
+			httpLog.Warn("Server error", zap.String("endpoint", endpoint), zap.Error(lastErr))
 			continue
 		}
 
 		// Client error (4xx) - don't retry
-		err = fmt.Errorf("[request_id=%s] client error %d after %v: %s", requestID, resp.StatusCode, duration, string(body))
-		log.Printf("%v", err)
+		err = fmt.Errorf("[request_id=%s] after %v: %w", requestID, duration,
+			&StatusError{StatusCode: resp.StatusCode, Body: string(respBody)})
+		httpLog.Warn("Request rejected", zap.String("endpoint", endpoint), zap.Error(err))
 		return err
 	}
 
@@ -157,7 +218,7 @@ func (c *Client) PostMultipart(ctx context.Context, endpoint string, body io.Rea
 	var lastErr error
 	for attempt := 0; attempt <= c.retryAttempts; attempt++ {
 		if attempt > 0 {
-			log.Printf("Retrying multipart request to %s (attempt %d/%d)", endpoint, attempt, c.retryAttempts)
+			httpLog.Info("Retrying multipart request", zap.String("endpoint", endpoint), zap.Int("attempt", attempt), zap.Int("attempts", c.retryAttempts))
 
 			select {
 			case <-ctx.Done():
@@ -203,6 +264,77 @@ func (c *Client) PostMultipart(ctx context.Context, endpoint string, body io.Rea
 	return fmt.Errorf("multipart request failed after %d attempts: %w", c.retryAttempts, lastErr)
 }
 
+// GetJSON fetches endpoint and decodes the JSON response into out (protected by circuit breaker).
+// A non-empty etag is sent as If-None-Match; ErrNotModified is returned on 304
+// and ErrNoContent on 204. The ETag of the response is returned on success.
+func (c *Client) GetJSON(ctx context.Context, endpoint, etag string, out interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.serverURL+endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Request-ID", uuid.New().String())
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := c.executeWithCircuitBreaker(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return etag, ErrNotModified
+	case resp.StatusCode == http.StatusNoContent:
+		return "", ErrNoContent
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("GET %s failed with status %d: %s", endpoint, resp.StatusCode, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// Get fetches an absolute URL with the API key (protected by circuit breaker).
+// Only 2xx answers are returned and the caller closes the body; a 4xx answer
+// is returned as *StatusError.
+func (c *Client) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("X-Request-ID", uuid.New().String())
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.executeWithCircuitBreaker(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		return nil, fmt.Errorf("GET %s failed with status %d: %s", req.URL.Path, resp.StatusCode, string(body))
+	}
+
+	return resp, nil
+}
+
 // Ping checks if the server is reachable
 func (c *Client) Ping(ctx context.Context) error {
 	url := c.serverURL + "/health"
@@ -225,6 +357,11 @@ func (c *Client) Ping(ctx context.Context) error {
 	return nil
 }
 
+// BreakerState returns the circuit breaker state ("closed", "half-open" or "open")
+func (c *Client) BreakerState() string {
+	return c.circuitBreaker.State().String()
+}
+
 // executeWithCircuitBreaker wraps HTTP request execution with circuit breaker protection
 func (c *Client) executeWithCircuitBreaker(req *http.Request) (*http.Response, error) {
 	result, err := c.circuitBreaker.Execute(func() (interface{}, error) {
@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported request body encodings
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// defaultCompressMinBytes skips compression of bodies too small to benefit
+const defaultCompressMinBytes = 1024
+
+// zstdEncoder is safe for concurrent EncodeAll calls
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+
+// compressBody encodes data with the configured algorithm and returns the
+// Content-Encoding to send; an empty encoding means data is sent as is
+func (c *Client) compressBody(data []byte) ([]byte, string, error) {
+	if len(data) < c.compressMinBytes {
+		return data, "", nil
+	}
+
+	switch c.compression {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, "", fmt.Errorf("failed to gzip body: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", fmt.Errorf("failed to gzip body: %w", err)
+		}
+		return buf.Bytes(), CompressionGzip, nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/4)), CompressionZstd, nil
+	default:
+		return data, "", nil
+	}
+}
@@ -0,0 +1,84 @@
+package httpclient
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// decodingServer decodes the request body like the server's middleware and
+// records the encoding and payload
+type decodingServer struct {
+	encoding string
+	payload  map[string]string
+}
+
+func (s *decodingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.encoding = r.Header.Get("Content-Encoding")
+
+	var body io.Reader = r.Body
+	switch s.encoding {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+
+	if err := json.NewDecoder(body).Decode(&s.payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestPostJSONCompressionRoundTrip(t *testing.T) {
+	large := strings.Repeat("event ", 1000)
+
+	tests := []struct {
+		name        string
+		compression string
+		text        string
+		encoding    string
+	}{
+		{"gzip", CompressionGzip, large, CompressionGzip},
+		{"zstd", CompressionZstd, large, CompressionZstd},
+		{"none", CompressionNone, large, ""},
+		{"small bodies are sent as is", CompressionZstd, "event", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &decodingServer{}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			client := NewClient(Config{ServerURL: ts.URL, Compression: tt.compression, RetryAttempts: 1})
+			if err := client.PostJSON(context.Background(), "/api/events/batch", map[string]string{"text": tt.text}); err != nil {
+				t.Fatal(err)
+			}
+			if srv.encoding != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", srv.encoding, tt.encoding)
+			}
+			if srv.payload["text"] != tt.text {
+				t.Errorf("payload not decoded intact: %d bytes", len(srv.payload["text"]))
+			}
+		})
+	}
+}
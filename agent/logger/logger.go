@@ -1,118 +1,140 @@
+// Package logger is the agent's structured logger. Components get a zap
+// logger tagged with their name from For; Init points every one of them at
+// the rotating log file, so loggers created before Init follow it as well.
 package logger
 
 import (
-	"fmt"
-	"io"
-	"log"
 	"os"
-	"path/filepath"
-	"sync"
-)
-
-// Level represents log level
-type Level int
+	"sync/atomic"
 
-const (
-	LevelDebug Level = iota
-	LevelInfo
-	LevelWarn
-	LevelError
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// Options configures the log output
+type Options struct {
+	Level string
+	// File is the log file; empty logs to stderr
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
 var (
-	currentLevel = LevelInfo
-	mu           sync.RWMutex
-)
+	level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
 
-// SetLevel sets the minimum log level
-func SetLevel(level Level) {
-	mu.Lock()
-	defer mu.Unlock()
-	currentLevel = level
-}
+	// current is the core every component logger writes to
+	current atomic.Pointer[zapcore.Core]
+)
 
-// SetOutput sets log output writer
-func SetOutput(w io.Writer) {
-	log.SetOutput(w)
+func init() {
+	setCore(newCore(zapcore.Lock(os.Stderr)))
 }
 
-// Init initializes logging to file
-func Init(logPath string) error {
-	// Create log directory
-	logDir := filepath.Dir(logPath)
-	if logDir != "" && logDir != "." {
-		if err := os.MkdirAll(logDir, 0755); err != nil {
-			return fmt.Errorf("failed to create log directory: %w", err)
+// Init sets the level and switches the output to a size-rotated file.
+// Output written by the standard log package is redirected as well.
+func Init(opts Options) error {
+	SetLevel(opts.Level)
+	if opts.File != "" {
+		f, err := NewRotatingFile(opts.File, int64(opts.MaxSizeMB)<<20, opts.MaxBackups)
+		if err != nil {
+			return err
 		}
+		setCore(newCore(f))
 	}
+	zap.RedirectStdLog(For("stdlog"))
+	return nil
+}
 
-	// Open log file
-	f, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return fmt.Errorf("failed to open log file: %w", err)
+// For returns the logger of a component. Every line carries the component
+// field, so one agent's log can be filtered by subsystem.
+func For(component string) *zap.Logger {
+	return zap.New(&proxyCore{}, zap.AddCaller()).With(zap.String("component", component))
+}
+
+// SetLevel changes the minimum level of the log file. Unknown names mean info.
+func SetLevel(name string) {
+	level.SetLevel(ParseLevel(name))
+}
+
+// ParseLevel parses a level from logging.level
+func ParseLevel(s string) zapcore.Level {
+	switch s {
+	case "debug":
+		return zapcore.DebugLevel
+	case "warn", "warning":
+		return zapcore.WarnLevel
+	case "error":
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.InfoLevel
 	}
+}
 
-	// Set output to file only (no console)
-	log.SetOutput(f)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+// Tee sends log entries to another core as well, e.g. a Shipper
+func Tee(core zapcore.Core) {
+	setCore(zapcore.NewTee(*current.Load(), core))
+}
 
-	return nil
+// Sync flushes buffered log entries
+func Sync() {
+	_ = (*current.Load()).Sync()
 }
 
-// Debug logs debug message
-func Debug(format string, v ...interface{}) {
-	mu.RLock()
-	defer mu.RUnlock()
-	if currentLevel <= LevelDebug {
-		log.Printf("[DEBUG] "+format, v...)
-	}
+func setCore(core zapcore.Core) {
+	current.Store(&core)
 }
 
-// Info logs info message
-func Info(format string, v ...interface{}) {
-	mu.RLock()
-	defer mu.RUnlock()
-	if currentLevel <= LevelInfo {
-		log.Printf("[INFO] "+format, v...)
-	}
+// newCore writes JSON lines in the same shape as the server log
+func newCore(w zapcore.WriteSyncer) zapcore.Core {
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+		MessageKey:    "msg",
+		LevelKey:      "level",
+		TimeKey:       "ts",
+		CallerKey:     "caller",
+		StacktraceKey: "stacktrace",
+		EncodeTime:    zapcore.ISO8601TimeEncoder,
+		EncodeLevel:   zapcore.LowercaseLevelEncoder,
+		EncodeCaller:  zapcore.ShortCallerEncoder,
+	})
+	return zapcore.NewCore(enc, w, level)
 }
 
-// Warn logs warning message
-func Warn(format string, v ...interface{}) {
-	mu.RLock()
-	defer mu.RUnlock()
-	if currentLevel <= LevelWarn {
-		log.Printf("[WARN] "+format, v...)
-	}
+// proxyCore forwards to the current core, so a logger obtained from For
+// keeps working after Init or Tee swap the output
+type proxyCore struct {
+	fields []zapcore.Field
 }
 
-// Error logs error message
-func Error(format string, v ...interface{}) {
-	mu.RLock()
-	defer mu.RUnlock()
-	if currentLevel <= LevelError {
-		log.Printf("[ERROR] "+format, v...)
+func (p *proxyCore) target() zapcore.Core {
+	core := *current.Load()
+	if len(p.fields) > 0 {
+		core = core.With(p.fields)
 	}
+	return core
 }
 
-// Fatal logs fatal error and exits
-func Fatal(format string, v ...interface{}) {
-	log.Printf("[FATAL] "+format, v...)
-	os.Exit(1)
+func (p *proxyCore) Enabled(l zapcore.Level) bool {
+	return (*current.Load()).Enabled(l)
 }
 
-// ParseLevel parses log level from string
-func ParseLevel(s string) Level {
-	switch s {
-	case "debug":
-		return LevelDebug
-	case "info":
-		return LevelInfo
-	case "warn", "warning":
-		return LevelWarn
-	case "error":
-		return LevelError
-	default:
-		return LevelInfo
+func (p *proxyCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(p.fields)+len(fields))
+	merged = append(merged, p.fields...)
+	return &proxyCore{fields: append(merged, fields...)}
+}
+
+func (p *proxyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !p.Enabled(ent.Level) {
+		return ce
 	}
+	return p.target().Check(ent, ce)
+}
+
+func (p *proxyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return p.target().Write(ent, fields)
+}
+
+func (p *proxyCore) Sync() error {
+	return (*current.Load()).Sync()
 }
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	// Leftover from a larger max_backups
+	os.WriteFile(path+".3", []byte("old"), 0644)
+
+	r, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("backup beyond max_backups kept")
+	}
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for p, content := range want {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), data, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("more than max_backups files kept")
+	}
+}
+
+func TestComponentLoggerFollowsInit(t *testing.T) {
+	defer setCore(*current.Load())
+	defer SetLevel("info")
+
+	log := For("usb")
+	path := filepath.Join(t.TempDir(), "agent.log")
+	if err := Init(Options{Level: "warn", File: path, MaxSizeMB: 1, MaxBackups: 1}); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("filtered")
+	log.Warn("device blocked", zap.String("device_id", "USB\\1"))
+	Sync()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("log = %q", data)
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["msg"] != "device blocked" || line["level"] != "warn" || line["component"] != "usb" || line["device_id"] != "USB\\1" {
+		t.Errorf("line = %v", line)
+	}
+}
+
+type fakePoster struct {
+	fail     bool
+	payloads []shipPayload
+}
+
+func (f *fakePoster) PostJSON(ctx context.Context, endpoint string, payload interface{}) error {
+	if f.fail {
+		return errors.New("offline")
+	}
+	f.payloads = append(f.payloads, payload.(shipPayload))
+	return nil
+}
+
+func TestShipperSendsWarnings(t *testing.T) {
+	poster := &fakePoster{fail: true}
+	s := NewShipper(poster, "PC-01")
+	log := zap.New(s.Core()).With(zap.String("component", "wal"))
+
+	log.Info("not shipped")
+	log.Error("segment corrupt", zap.Int("segment", 3))
+	if err := s.Flush(context.Background()); err == nil {
+		t.Fatal("flush succeeded while offline")
+	}
+
+	poster.fail = false
+	log.Warn("disk almost full")
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(poster.payloads) != 1 {
+		t.Fatalf("payloads = %d", len(poster.payloads))
+	}
+	p := poster.payloads[0]
+	if p.ComputerName != "PC-01" || len(p.Entries) != 2 {
+		t.Fatalf("payload = %+v", p)
+	}
+	e := p.Entries[0]
+	if e.Message != "segment corrupt" || e.Level != zapcore.ErrorLevel.String() || e.Component != "wal" || e.Fields["segment"] != int64(3) {
+		t.Errorf("entry = %+v", e)
+	}
+	if p.Entries[1].Message != "disk almost full" {
+		t.Errorf("entries out of order: %+v", p.Entries)
+	}
+}
@@ -0,0 +1,192 @@
+package logger
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	shipEndpoint   = "/api/agent/logs"
+	shipInterval   = 30 * time.Second
+	shipBatchSize  = 100
+	shipMaxPending = 1000
+)
+
+// Poster sends a JSON payload to the server; *httpclient.Client implements it
+type Poster interface {
+	PostJSON(ctx context.Context, endpoint string, payload interface{}) error
+}
+
+// Entry is a log line shipped to the server
+type Entry struct {
+	Time      time.Time              `json:"timestamp"`
+	Level     string                 `json:"level"`
+	Component string                 `json:"component"`
+	Message   string                 `json:"message"`
+	Caller    string                 `json:"caller,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+type shipPayload struct {
+	ComputerName string  `json:"computer_name"`
+	Entries      []Entry `json:"entries"`
+	// Dropped counts entries lost since the last accepted batch
+	Dropped uint64 `json:"dropped"`
+}
+
+// Shipper collects WARN and higher entries and posts them to the server in
+// batches. Entries that cannot be sent stay queued up to a limit, so an
+// outage costs the oldest lines, not the agent's memory.
+type Shipper struct {
+	client       Poster
+	computerName string
+	interval     time.Duration
+	wake         chan struct{}
+
+	mu      sync.Mutex
+	pending []Entry
+	dropped uint64
+}
+
+// NewShipper creates a shipper; add it with Tee and start Run
+func NewShipper(client Poster, computerName string) *Shipper {
+	return &Shipper{
+		client:       client,
+		computerName: computerName,
+		interval:     shipInterval,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Core returns the zap core that feeds the shipper
+func (s *Shipper) Core() zapcore.Core {
+	return &shipCore{s: s}
+}
+
+// Run sends batches until ctx is cancelled. Entries logged during shutdown
+// are sent by a final Flush.
+func (s *Shipper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		s.Flush(ctx)
+	}
+}
+
+// Flush sends everything queued. On failure the entries are queued again.
+func (s *Shipper) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	entries, dropped := s.pending, s.dropped
+	s.pending, s.dropped = nil, 0
+	s.mu.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	err := s.client.PostJSON(ctx, shipEndpoint, shipPayload{
+		ComputerName: s.computerName,
+		Entries:      entries,
+		Dropped:      dropped,
+	})
+	if err != nil {
+		s.mu.Lock()
+		s.dropped += dropped
+		s.requeue(entries)
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// requeue puts a failed batch back in front of newer entries
+func (s *Shipper) requeue(entries []Entry) {
+	merged := append(entries, s.pending...)
+	if over := len(merged) - shipMaxPending; over > 0 {
+		merged = merged[over:]
+		s.dropped += uint64(over)
+	}
+	s.pending = merged
+}
+
+func (s *Shipper) add(e Entry) {
+	s.mu.Lock()
+	if len(s.pending) >= shipMaxPending {
+		s.pending = s.pending[1:]
+		s.dropped++
+	}
+	s.pending = append(s.pending, e)
+	full := len(s.pending) >= shipBatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// shipCore turns zap entries into Entry values
+type shipCore struct {
+	s      *Shipper
+	fields []zapcore.Field
+}
+
+func (c *shipCore) Enabled(l zapcore.Level) bool {
+	return l >= zapcore.WarnLevel
+}
+
+func (c *shipCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	merged = append(merged, c.fields...)
+	return &shipCore{s: c.s, fields: append(merged, fields...)}
+}
+
+func (c *shipCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *shipCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	e := Entry{
+		Time:    ent.Time,
+		Level:   ent.Level.String(),
+		Message: ent.Message,
+	}
+	if ent.Caller.Defined {
+		e.Caller = ent.Caller.TrimmedPath()
+	}
+	if component, ok := enc.Fields["component"].(string); ok {
+		e.Component = component
+		delete(enc.Fields, "component")
+	}
+	if len(enc.Fields) > 0 {
+		e.Fields = enc.Fields
+	}
+	c.s.add(e)
+	return nil
+}
+
+func (c *shipCore) Sync() error {
+	return nil
+}
@@ -1,225 +1,284 @@
-//go:build windows
-// +build windows
+//go:build windows || linux
+// +build windows linux
 
 package main
 
 import (
         "context"
         "flag"
-        "log"
         "os"
         "os/signal"
         "syscall"
+        "time"
 
         "github.com/ctolnik/Office-Monitor/agent/buffer"
         "github.com/ctolnik/Office-Monitor/agent/config"
+        "github.com/ctolnik/Office-Monitor/agent/governor"
+        "github.com/ctolnik/Office-Monitor/agent/heartbeat"
         "github.com/ctolnik/Office-Monitor/agent/httpclient"
         "github.com/ctolnik/Office-Monitor/agent/logger"
-        "github.com/ctolnik/Office-Monitor/agent/monitoring"
+        "github.com/ctolnik/Office-Monitor/agent/remoteconfig"
+        "github.com/ctolnik/Office-Monitor/agent/updater"
+        "github.com/ctolnik/Office-Monitor/agent/wal"
+        "go.uber.org/zap"
 )
 
 var (
-        configPath = flag.String("config", "config.yaml", "Path to config file")
-        version    = "1.0.0"
+        configPath   = flag.String("config", "config.yaml", "Path to config file")
+        dryRun       = flag.Bool("dry-run", false, "Write events to a local JSONL sink instead of the server")
+        dryRunOutput = flag.String("dry-run-output", "-", "File for -dry-run events, - for stdout")
+        selfTest     = flag.Bool("selftest", false, "Check the config and server connection, print a report and exit")
+        version      = "1.0.0"
 )
 
+var mainLog = logger.For("main")
+
+// monitorStopTimeout bounds the ordered monitor shutdown before the event buffer stops
+const monitorStopTimeout = 10 * time.Second
+
+// bufferStopTimeout bounds the final flush (5s) and closing the event log
+const bufferStopTimeout = 10 * time.Second
+
 func main() {
         flag.Parse()
 
-        log.Printf("Employee Monitoring Agent v%s starting...", version)
+        if *selfTest {
+                os.Exit(runSelfTest(*configPath, os.Stdout))
+        }
+
+        mainLog.Info("Employee Monitoring Agent starting", zap.String("version", version))
+
+        // Count the starts of a freshly installed build before anything that can
+        // fail, so one that dies during startup is still rolled back. This runs
+        // before the event buffer is opened, so the respawned previous version
+        // is the only process using it.
+        if !*dryRun {
+                rolledBack, err := updater.CountStart("", version)
+                if err != nil {
+                        mainLog.Warn("Failed to check the update state", zap.Error(err))
+                }
+                if rolledBack {
+                        exe, _ := os.Executable()
+                        mainLog.Info("Starting the previous version", zap.String("executable", exe))
+                        if err := updater.Respawn(exe); err != nil {
+                                mainLog.Fatal("Failed to start the previous version", zap.Error(err))
+                        }
+                        return
+                }
+        }
 
         // Load configuration
         cfg, err := config.Load(*configPath)
         if err != nil {
-                log.Fatalf("Failed to load config: %v", err)
+                mainLog.Fatal("Failed to load config", zap.Error(err))
         }
 
-        // Initialize file logging
-        if cfg.Logging.File != "" {
-                if err := logger.Init(cfg.Logging.File); err != nil {
-                        log.Printf("WARNING: Failed to initialize file logging: %v", err)
-                        log.Println("Continuing with console logging only")
-                } else {
-                        log.Printf("Logging to file: %s", cfg.Logging.File)
-                }
+        // Switch to the leveled, size-rotated log file
+        defer logger.Sync()
+        if err := logger.Init(logger.Options{
+                Level:      cfg.Logging.Level,
+                File:       cfg.Logging.File,
+                MaxSizeMB:  cfg.Logging.MaxSizeMB,
+                MaxBackups: cfg.Logging.MaxBackups,
+        }); err != nil {
+                mainLog.Warn("Failed to initialize file logging, continuing with console logging only", zap.Error(err))
+        } else if cfg.Logging.File != "" {
+                mainLog.Info("Logging to file", zap.String("file", cfg.Logging.File), zap.String("level", cfg.Logging.Level))
         }
 
-        log.Printf("Computer: %s, User: %s", cfg.Agent.ComputerName, os.Getenv("USERNAME"))
-        log.Printf("Server: %s", cfg.Agent.Server.URL)
+        mainLog.Info("Agent identity",
+                zap.String("computer", cfg.Agent.ComputerName),
+                zap.String("user", currentUsername()),
+                zap.String("server", cfg.Agent.Server.URL))
 
         // Initialize HTTP client
-        httpClient := httpclient.NewClient(httpclient.Config{
-                ServerURL:      cfg.Agent.Server.URL,
-                APIKey:         cfg.Agent.APIKey,
-                TimeoutSeconds: 30,
-                RetryAttempts:  3,
-        })
+        httpClient := httpclient.NewClient(httpClientConfig(cfg))
+
+        // Ship warnings and errors so agent failures show up on the server
+        var logShipper *logger.Shipper
+        if cfg.Logging.ShipToServer && !*dryRun {
+                logShipper = logger.NewShipper(httpClient, cfg.Agent.ComputerName)
+                logger.Tee(logShipper.Core())
+        }
+
+        bufferConfig := buffer.Config{
+                Client:       httpClient,
+                Endpoint:     "/api/events/batch",
+                BufferDir:    cfg.Buffer.Dir,
+                SegmentBytes: int64(cfg.Buffer.SegmentSizeMB) << 20,
+                MaxDiskBytes: int64(cfg.Buffer.MaxDiskMB) << 20,
+                Sync:         wal.SyncPolicy(cfg.Buffer.Fsync),
+                SyncInterval: time.Duration(cfg.Buffer.FsyncIntervalMS) * time.Millisecond,
+                DropPolicy:   wal.DropPolicy(cfg.Buffer.DropPolicy),
+                ChunkSize:    cfg.Buffer.ChunkSize,
+                MaxSize:      cfg.Performance.EventBufferSize,
+        }
+
+        if *dryRun {
+                closeSink, err := setupDryRun(cfg, &bufferConfig, *dryRunOutput)
+                if err != nil {
+                        mainLog.Fatal("Failed to set up dry run", zap.Error(err))
+                }
+                defer closeSink()
+        }
 
         // Initialize event buffer
-        eventBuffer, err := buffer.NewEventBuffer(buffer.Config{
-                Client:    httpClient,
-                Endpoint:  "/api/events/batch",
-                BufferDir: "buffer",
-        })
+        eventBuffer, err := buffer.NewEventBuffer(bufferConfig)
         if err != nil {
-                log.Fatalf("Failed to create event buffer: %v", err)
+                mainLog.Fatal("Failed to create event buffer", zap.Error(err))
         }
 
         // Start event buffer in background
         ctx, cancel := context.WithCancel(context.Background())
         defer cancel()
         go eventBuffer.Start(ctx)
-
-        // Initialize activity tracker with idle detection
-        var activityTracker *monitoring.ActivityTracker
-        if cfg.ActivityMonitoring.Enabled {
-                idleThresholdMin := cfg.ActivityMonitoring.IdleThresholdSeconds / 60
-                if idleThresholdMin == 0 {
-                        idleThresholdMin = 5
-                }
-                activityTracker = monitoring.NewActivityTracker(
-                        cfg.Agent.Server.URL,
-                        cfg.Agent.ComputerName,
-                        os.Getenv("USERNAME"),
-                        idleThresholdMin,
-                        cfg.ActivityMonitoring.IntervalSeconds,
-                )
-                if err := activityTracker.Start(); err != nil {
-                        log.Printf("WARNING: Activity tracking failed to start: %v", err)
-                } else {
-                        log.Printf("Activity tracking: ENABLED (idle threshold: %dm, poll interval: %ds)",
-                                idleThresholdMin, cfg.ActivityMonitoring.IntervalSeconds)
-                }
-        } else {
-                log.Println("Activity tracking: DISABLED")
+        if logShipper != nil {
+                go logShipper.Run(ctx)
         }
 
-        // Initialize USB monitor
-        var usbMonitor *monitoring.USBMonitor
-        if cfg.USBMonitoring.Enabled {
-                usbMonitor = monitoring.NewUSBMonitor(
-                        cfg.Agent.Server.URL,
-                        cfg.Agent.ComputerName,
-                        os.Getenv("USERNAME"),
-                        cfg.USBMonitoring.ShadowCopyEnabled,
-                        cfg.USBMonitoring.ShadowCopyDest,
-                        cfg.USBMonitoring.CopyFileExtensions,
-                        cfg.USBMonitoring.ExcludePatterns,
-                        eventBuffer,
-                )
-                if err := usbMonitor.Start(); err != nil {
-                        log.Printf("WARNING: USB monitoring failed to start: %v", err)
-                } else {
-                        log.Println("USB monitoring: ENABLED")
-                        if cfg.USBMonitoring.ShadowCopyEnabled {
-                                log.Printf("Shadow copy: ENABLED -> %s", cfg.USBMonitoring.ShadowCopyDest)
-                        }
-                }
-        } else {
-                log.Println("USB monitoring: DISABLED")
-        }
+        // Services that watch or reconfigure the monitors stop before them
+        svcCtx, svcCancel := context.WithCancel(ctx)
+        defer svcCancel()
 
-        // Initialize screenshot capture
-        var screenshotMonitor *monitoring.ScreenshotMonitor
-        if cfg.Screenshots.Enabled {
-                screenshotMonitor = monitoring.NewScreenshotMonitor(
-                        cfg.Agent.Server.URL,
-                        cfg.Agent.ComputerName,
-                        os.Getenv("USERNAME"),
-                        cfg.Screenshots.IntervalMinutes,
-                        cfg.Screenshots.Quality,
-                        cfg.Screenshots.MaxSizeKB,
-                        cfg.Screenshots.CaptureOnlyActive,
-                        cfg.Screenshots.UploadImmediately,
+        // Start monitors from the local config; crashed ones are restarted with backoff
+        monitors := newMonitorSet(ctx, eventBuffer, httpClient)
+        monitors.apply(cfg)
+        go monitors.run(svcCtx)
+
+        // Keep the agent within the performance budget by degrading monitors
+        resourceGovernor := governor.New(governor.Options{
+                MaxMemoryMB:   cfg.Performance.MaxMemoryMB,
+                MaxCPUPercent: cfg.Performance.MaxCPUPercent,
+                OnChange:      monitors.setThrottle,
+        })
+        go resourceGovernor.Run(svcCtx)
+
+        // Pull per-computer overrides from the server and apply them without restart
+        var poller *remoteconfig.Poller
+        if cfg.Security.AllowRemoteConfig && !*dryRun {
+                poller = remoteconfig.New(
                         httpClient,
+                        cfg.Agent.ComputerName,
+                        time.Duration(cfg.Security.RemoteConfigPollSeconds)*time.Second,
+                        func(rc config.RemoteConfig) error {
+                                next := cfg.WithRemote(rc)
+                                if err := next.Validate(); err != nil {
+                                        return err
+                                }
+                                return monitors.apply(next)
+                        },
                 )
-                if err := screenshotMonitor.Start(); err != nil {
-                        log.Printf("WARNING: Screenshot capture failed to start: %v", err)
-                } else {
-                        log.Printf("Screenshot capture: ENABLED (interval: %dm, quality: %d)", 
-                                cfg.Screenshots.IntervalMinutes, cfg.Screenshots.Quality)
-                }
+                go poller.Run(svcCtx)
         } else {
-                log.Println("Screenshot capture: DISABLED")
+                mainLog.Info("Remote config: DISABLED")
         }
 
-        // Initialize file monitoring
-        var fileMonitor *monitoring.FileMonitor
-        if cfg.FileMonitoring.Enabled {
-                fileMonitor = monitoring.NewFileMonitor(
-                        cfg.Agent.Server.URL,
-                        cfg.Agent.ComputerName,
-                        os.Getenv("USERNAME"),
-                        cfg.FileMonitoring.MonitoredLocations,
-                        cfg.FileMonitoring.LargeCopyThresholdMB,
-                        cfg.FileMonitoring.LargeCopyFileCount,
-                        cfg.FileMonitoring.DetectExternalCopy,
-                        eventBuffer,
-                )
-                if err := fileMonitor.Start(); err != nil {
-                        log.Printf("WARNING: File monitoring failed to start: %v", err)
+        // Report version, inventory and health so the server can tell when the agent goes offline
+        heartbeatSender := heartbeat.New(
+                httpClient,
+                cfg.Agent.ComputerName,
+                currentUsername(),
+                version,
+                time.Duration(cfg.Agent.HeartbeatSeconds)*time.Second,
+                func(p *heartbeat.Payload) {
+                        p.Monitors = monitors.running()
+                        p.MonitorStatus = monitors.status()
+                        p.BufferSize = eventBuffer.Size()
+                        p.BufferDropped = eventBuffer.Dropped()
+                        gs := resourceGovernor.Status()
+                        p.ThrottleLevel = int(gs.Level)
+                        p.ThrottleReason = gs.Reason
+                        p.MemoryMB = int(gs.Usage.MemoryMB)
+                        p.CPUPercent = gs.Usage.CPUPercent
+                        if poller != nil {
+                                p.ConfigVersion = poller.AppliedVersion()
+                        }
+                },
+        )
+
+        // Install signed builds from the server. A new version is confirmed by
+        // its first accepted heartbeat and rolled back otherwise.
+        restartChan := make(chan struct{}, 1)
+        var agentUpdater *updater.Updater
+        if cfg.AutoUpdate.Enabled && !*dryRun {
+                agentUpdater, err = newUpdater(cfg, httpClient, func() {
+                        select {
+                        case restartChan <- struct{}{}:
+                        default:
+                        }
+                })
+                if err != nil {
+                        mainLog.Warn("Auto-update disabled", zap.Error(err))
                 } else {
-                        log.Println("File monitoring: ENABLED")
-                        log.Printf("Monitoring %d locations, thresholds: %dMB / %d files",
-                                len(cfg.FileMonitoring.MonitoredLocations),
-                                cfg.FileMonitoring.LargeCopyThresholdMB,
-                                cfg.FileMonitoring.LargeCopyFileCount)
+                        heartbeatSender.OnSuccess(agentUpdater.Confirm)
+                        go agentUpdater.Run(svcCtx)
                 }
         } else {
-                log.Println("File monitoring: DISABLED")
+                mainLog.Info("Auto-update: DISABLED")
         }
 
-        // Initialize keylogger
-        var keylogger *monitoring.Keylogger
-        if cfg.Keylogger.Enabled {
-                log.Println("WARNING: Keylogger enabled - ensure legal compliance!")
-                keylogger = monitoring.NewKeylogger(
-                        cfg.Agent.Server.URL,
-                        cfg.Agent.ComputerName,
-                        os.Getenv("USERNAME"),
-                        cfg.Keylogger.MonitoredProcesses,
-                        cfg.Keylogger.BufferSizeChars,
-                        cfg.Keylogger.SendIntervalMin,
-                        eventBuffer,
-                )
-                if err := keylogger.Start(); err != nil {
-                        log.Printf("WARNING: Keylogger failed to start: %v", err)
-                } else {
-                        log.Printf("Keylogger: ENABLED (processes: %v)", cfg.Keylogger.MonitoredProcesses)
-                }
-        } else {
-                log.Println("Keylogger: DISABLED")
+        if !*dryRun {
+                go heartbeatSender.Run(svcCtx)
         }
 
-        log.Println("Agent is running. Press Ctrl+C to stop.")
+        mainLog.Info("Agent is running. Press Ctrl+C to stop.")
 
         // Wait for interrupt signal
         sigChan := make(chan os.Signal, 1)
         signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-        <-sigChan
+        restart := false
+        select {
+        case <-sigChan:
+        case <-restartChan:
+                restart = true
+        }
 
-        log.Println("Shutting down...")
+        mainLog.Info("Shutting down")
 
-        // Cleanup
-        if activityTracker != nil {
-                activityTracker.Stop()
-        }
-        if usbMonitor != nil {
-                usbMonitor.Stop()
+        // Cleanup: services first, then the monitors in reverse start order,
+        // so nothing feeds the event buffer once it stops
+        svcCancel()
+        stopCtx, stopCancel := context.WithTimeout(context.Background(), monitorStopTimeout)
+        if err := monitors.shutdown(stopCtx); err != nil {
+                mainLog.Warn("Monitors did not stop cleanly", zap.Error(err))
         }
-        if fileMonitor != nil {
-                fileMonitor.Stop()
-        }
-        if screenshotMonitor != nil {
-                screenshotMonitor.Stop()
+        stopCancel()
+
+        // The dry-run sink is closed on return, write out what the monitors produced
+        if *dryRun {
+                eventBuffer.Flush(ctx)
         }
-        if keylogger != nil {
-                keylogger.Stop()
+
+        // Stop event buffer and wait for the last flush, so the process does not
+        // exit while the log is still written
+        bufferCtx, bufferCancel := context.WithTimeout(context.Background(), bufferStopTimeout)
+        if err := eventBuffer.Stop(bufferCtx); err != nil {
+                mainLog.Warn("Event buffer did not stop in time", zap.Error(err))
         }
-        
-        // Stop event buffer and flush remaining events
-        eventBuffer.Stop()
+        bufferCancel()
         cancel()  // Stop background goroutine
 
-        log.Println("Agent stopped.")
+        // Send warnings logged during shutdown
+        if logShipper != nil {
+                shipCtx, shipCancel := context.WithTimeout(context.Background(), 5*time.Second)
+                logShipper.Flush(shipCtx)
+                shipCancel()
+        }
+
+        mainLog.Info("Agent stopped")
+
+        // Start the binary the updater put in place only once this process released
+        // the buffer, so two processes never write the same log segments
+        if restart {
+                select {
+                case <-eventBuffer.Done():
+                default:
+                        mainLog.Warn("Waiting for the event buffer to close before restarting")
+                        <-eventBuffer.Done()
+                }
+                mainLog.Info("Restarting", zap.String("executable", agentUpdater.Executable()))
+                if err := updater.Respawn(agentUpdater.Executable()); err != nil {
+                        mainLog.Error("Failed to restart agent", zap.Error(err))
+                }
+        }
 }
@@ -1,5 +1,5 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !linux
+// +build !windows,!linux
 
 package main
 
@@ -9,6 +9,6 @@ import (
 )
 
 func main() {
-	fmt.Fprintln(os.Stderr, "Error: This agent is only supported on Windows")
+	fmt.Fprintln(os.Stderr, "Error: This agent is only supported on Windows and Linux")
 	os.Exit(1)
 }
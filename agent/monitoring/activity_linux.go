@@ -0,0 +1,255 @@
+//go:build linux
+// +build linux
+
+package monitoring
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// backgroundProcesses draw on behalf of other programs or run for the whole
+// session, so their CPU use says nothing about what the user works with
+var backgroundProcesses = map[string]bool{
+	"Xorg":            true,
+	"Xwayland":        true,
+	"gnome-shell":     true,
+	"mutter":          true,
+	"kwin_x11":        true,
+	"kwin_wayland":    true,
+	"plasmashell":     true,
+	"xfwm4":           true,
+	"weston":          true,
+	"sway":            true,
+	"pipewire":        true,
+	"pulseaudio":      true,
+	"wireplumber":     true,
+	"ibus-daemon":     true,
+	"dbus-daemon":     true,
+	"gsd-xsettings":   true,
+	"xdg-desktop-por": true,
+}
+
+// foregroundProbe remembers the CPU time of graphical processes between
+// polls. There is no foreground window API that works on both X11 and
+// Wayland, so the graphical process of the session user that used the most
+// CPU since the previous poll is taken as the foreground one.
+type foregroundProbe struct {
+	uid       int
+	cpuTicks  map[int]uint64
+	graphical map[int]bool
+	last      string
+}
+
+// getIdleTimeSec reads the idle hint of the active logind session. Desktop
+// environments set it for both X11 and Wayland sessions.
+func (at *ActivityTracker) getIdleTimeSec() int {
+	// The session user is remembered for foregroundApp, which runs right after
+	at.probe.uid = -1
+
+	props, err := activeSessionProperties("IdleHint", "IdleSinceHint", "User")
+	if err != nil {
+		return 0
+	}
+
+	if uid, err := strconv.Atoi(props["User"]); err == nil {
+		at.probe.uid = uid
+	}
+
+	return idleSecondsFromHint(props, time.Now())
+}
+
+// foregroundApp returns the most active graphical process of the session
+// user. Window titles are not available, so the title is always empty.
+func (at *ActivityTracker) foregroundApp() (string, string) {
+	uid := at.probe.uid
+	if uid < 0 {
+		uid = os.Getuid()
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return "unknown", ""
+	}
+
+	self := os.Getpid()
+	ticks := make(map[int]uint64)
+	graphical := make(map[int]bool)
+	best, bestDelta := 0, uint64(0)
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != uid {
+			continue
+		}
+
+		isGraphical, known := at.probe.graphical[pid]
+		if !known {
+			isGraphical = hasDisplayEnv(pid) && !backgroundProcesses[procComm(pid)]
+		}
+		graphical[pid] = isGraphical
+		if !isGraphical {
+			continue
+		}
+
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue
+		}
+		t, err := parseProcStatTicks(string(stat))
+		if err != nil {
+			continue
+		}
+		ticks[pid] = t
+
+		if prev, ok := at.probe.cpuTicks[pid]; ok && t > prev && t-prev > bestDelta {
+			best, bestDelta = pid, t-prev
+		}
+	}
+
+	at.probe.cpuTicks = ticks
+	at.probe.graphical = graphical
+
+	if best == 0 {
+		// Nothing ran since the last poll: the user is still in the same app
+		if at.probe.last != "" {
+			return at.probe.last, ""
+		}
+		return "unknown", ""
+	}
+
+	at.probe.last = procName(best)
+	return at.probe.last, ""
+}
+
+// activeSessionProperties asks logind for properties of the agent's own
+// session, or of the active session on seat0 when the agent runs outside one
+func activeSessionProperties(names ...string) (map[string]string, error) {
+	session := os.Getenv("XDG_SESSION_ID")
+	if session == "" {
+		out, err := exec.Command("loginctl", "show-seat", "seat0", "-p", "ActiveSession", "--value").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find active session: %w", err)
+		}
+		session = strings.TrimSpace(string(out))
+		if session == "" {
+			return nil, fmt.Errorf("no active session on seat0")
+		}
+	}
+
+	args := []string{"show-session", session}
+	for _, name := range names {
+		args = append(args, "-p", name)
+	}
+	out, err := exec.Command("loginctl", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", session, err)
+	}
+
+	return parseLoginctlProperties(string(out)), nil
+}
+
+// parseLoginctlProperties parses the Key=Value lines printed by loginctl show-*
+func parseLoginctlProperties(out string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// idleSecondsFromHint converts IdleHint/IdleSinceHint (microseconds since
+// the epoch) to the number of seconds the session has been idle
+func idleSecondsFromHint(props map[string]string, now time.Time) int {
+	if props["IdleHint"] != "yes" {
+		return 0
+	}
+
+	since, err := strconv.ParseInt(props["IdleSinceHint"], 10, 64)
+	if err != nil || since <= 0 {
+		return 0
+	}
+
+	idle := now.Sub(time.UnixMicro(since))
+	if idle < 0 {
+		return 0
+	}
+	return int(idle.Seconds())
+}
+
+// parseProcStatTicks returns utime+stime from the contents of /proc/<pid>/stat
+func parseProcStatTicks(stat string) (uint64, error) {
+	// The command name may contain spaces and parentheses, the fields start after the last ')'
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("malformed stat")
+	}
+
+	fields := strings.Fields(stat[end+1:])
+	// fields[0] is the state (field 3), utime and stime are fields 14 and 15
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("malformed stat")
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return utime + stime, nil
+}
+
+func hasDisplayEnv(pid int) bool {
+	environ, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return false
+	}
+
+	for _, kv := range bytes.Split(environ, []byte{0}) {
+		if bytes.HasPrefix(kv, []byte("DISPLAY=")) || bytes.HasPrefix(kv, []byte("WAYLAND_DISPLAY=")) {
+			return true
+		}
+	}
+	return false
+}
+
+func procComm(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// procName prefers the executable name, comm is cut to 15 characters
+func procName(pid int) string {
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		return filepath.Base(strings.TrimSuffix(exe, " (deleted)"))
+	}
+	if comm := procComm(pid); comm != "" {
+		return comm
+	}
+	return "unknown"
+}
@@ -1,10 +1,13 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !linux
+// +build !windows,!linux
 
 package monitoring
 
 import (
+        "context"
         "fmt"
+
+        "github.com/ctolnik/Office-Monitor/agent/buffer"
 )
 
 // ActivityTracker monitors active window and process (stub for non-Windows)
@@ -14,14 +17,17 @@ type ActivityTracker struct {
 
 // NewActivityTracker creates a new activity tracker (stub)
 // Signature matches Windows implementation for cross-platform compatibility
-func NewActivityTracker(serverURL, computerName, username string, idleThresholdMin, pollIntervalSec int) *ActivityTracker {
+func NewActivityTracker(computerName, username string, idleThresholdMin, pollIntervalSec int, trackTitles, trackProcesses bool, eventBuffer *buffer.EventBuffer) *ActivityTracker {
         return &ActivityTracker{
                 stopChan: make(chan struct{}),
         }
 }
 
+// Name identifies the tracker in the supervisor (stub)
+func (t *ActivityTracker) Name() string { return "activity" }
+
 // Start begins monitoring activity (stub)
-func (t *ActivityTracker) Start() error {
+func (t *ActivityTracker) Start(ctx context.Context) error {
         return fmt.Errorf("activity tracking not supported on non-Windows platforms")
 }
 
@@ -31,3 +37,8 @@ func (t *ActivityTracker) Stop() {
                 close(t.stopChan)
         }
 }
+
+// Health reports the tracker state (stub)
+func (t *ActivityTracker) Health() error {
+        return nil
+}
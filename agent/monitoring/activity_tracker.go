@@ -0,0 +1,290 @@
+//go:build windows || linux
+// +build windows linux
+
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
+)
+
+var activityLog = logger.For("activity")
+
+type ActivityState string
+
+const (
+	StateActive  ActivityState = "active"
+	StateIdle    ActivityState = "idle"
+	StateOffline ActivityState = "offline"
+)
+
+type ActivitySegment struct {
+	TimestampStart time.Time     `json:"timestamp_start"`
+	TimestampEnd   time.Time     `json:"timestamp_end"`
+	DurationSec    uint32        `json:"duration_sec"`
+	State          ActivityState `json:"state"`
+	ComputerName   string        `json:"computer_name"`
+	Username       string        `json:"username"`
+	ProcessName    string        `json:"process_name"`
+	WindowTitle    string        `json:"window_title"`
+	SessionID      string        `json:"session_id"`
+}
+
+type ActivityTracker struct {
+	computerName     string
+	username         string
+	enabled          bool
+	idleThresholdMin int
+	pollIntervalSec  int
+	trackTitles      bool
+	trackProcesses   bool
+	stopChan         chan struct{}
+	wg               sync.WaitGroup
+	mu               sync.RWMutex
+	currentSegment   *ActivitySegment
+	sessionID        string
+	eventBuffer      *buffer.EventBuffer
+	probe            foregroundProbe
+	ctx              context.Context
+	// lastPoll is the unix time of the last completed poll, for Health
+	lastPoll atomic.Int64
+}
+
+// NewActivityTracker creates a tracker. Without trackTitles or trackProcesses
+// the window title or process name is left out of the segments sent.
+func NewActivityTracker(computerName, username string, idleThresholdMin, pollIntervalSec int, trackTitles, trackProcesses bool, eventBuffer *buffer.EventBuffer) *ActivityTracker {
+	sessionID := fmt.Sprintf("%s-%d", computerName, time.Now().Unix())
+
+	return &ActivityTracker{
+		computerName:     computerName,
+		username:         username,
+		enabled:          true,
+		idleThresholdMin: idleThresholdMin,
+		pollIntervalSec:  pollIntervalSec,
+		trackTitles:      trackTitles,
+		trackProcesses:   trackProcesses,
+		stopChan:         make(chan struct{}),
+		sessionID:        sessionID,
+		eventBuffer:      eventBuffer,
+	}
+}
+
+// Name identifies the tracker in the supervisor and the heartbeat
+func (at *ActivityTracker) Name() string { return "activity" }
+
+func (at *ActivityTracker) Start(ctx context.Context) error {
+	at.ctx = ctx
+	at.lastPoll.Store(time.Now().Unix())
+	activityLog.Info("ActivityTracker started",
+		zap.Int("idle_threshold_min", at.idleThresholdMin),
+		zap.Int("poll_interval_sec", at.pollIntervalSec))
+
+	at.wg.Add(1)
+	go at.trackActivity()
+
+	return nil
+}
+
+func (at *ActivityTracker) Stop() {
+	activityLog.Info("Stopping ActivityTracker")
+	close(at.stopChan)
+	at.wg.Wait()
+
+	at.flushCurrentSegment()
+	activityLog.Info("ActivityTracker stopped")
+}
+
+// Health fails when polling has stalled for three intervals
+func (at *ActivityTracker) Health() error {
+	stalled := time.Since(time.Unix(at.lastPoll.Load(), 0))
+	if limit := 3 * time.Duration(at.pollIntervalSec) * time.Second; stalled > limit {
+		return fmt.Errorf("no activity poll for %v", stalled.Round(time.Second))
+	}
+	return nil
+}
+
+func (at *ActivityTracker) trackActivity() {
+	defer at.wg.Done()
+	defer supervisor.Recover(at.ctx)
+
+	ticker := time.NewTicker(time.Duration(at.pollIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-at.stopChan:
+			return
+		case <-ticker.C:
+			at.checkAndUpdateState()
+			at.lastPoll.Store(time.Now().Unix())
+		}
+	}
+}
+
+func (at *ActivityTracker) checkAndUpdateState() {
+	idleTime := at.getIdleTimeSec()
+	currentState := at.determineState(idleTime)
+
+	processName, windowTitle := at.foregroundApp()
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if at.currentSegment == nil {
+		at.startNewSegment(currentState, processName, windowTitle)
+		return
+	}
+
+	if at.shouldSwitchSegment(currentState, processName, windowTitle) {
+		at.finalizeCurrentSegment()
+		at.startNewSegment(currentState, processName, windowTitle)
+	} else {
+		at.currentSegment.TimestampEnd = time.Now()
+		at.currentSegment.DurationSec = uint32(at.currentSegment.TimestampEnd.Sub(at.currentSegment.TimestampStart).Seconds())
+	}
+}
+
+func (at *ActivityTracker) determineState(idleTimeSec int) ActivityState {
+	idleThresholdSec := at.idleThresholdMin * 60
+	offlineThresholdSec := 30 * 60
+
+	if idleTimeSec < idleThresholdSec {
+		return StateActive
+	} else if idleTimeSec < offlineThresholdSec {
+		return StateIdle
+	}
+	return StateOffline
+}
+
+func (at *ActivityTracker) shouldSwitchSegment(newState ActivityState, newProcess, newTitle string) bool {
+	if at.currentSegment.State != newState {
+		return true
+	}
+
+	if newState == StateActive {
+		if at.currentSegment.ProcessName != newProcess {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (at *ActivityTracker) startNewSegment(state ActivityState, processName, windowTitle string) {
+	now := time.Now()
+
+	at.currentSegment = &ActivitySegment{
+		TimestampStart: now,
+		TimestampEnd:   now,
+		DurationSec:    0,
+		State:          state,
+		ComputerName:   at.computerName,
+		Username:       at.username,
+		ProcessName:    processName,
+		WindowTitle:    windowTitle,
+		SessionID:      at.sessionID,
+	}
+}
+
+func (at *ActivityTracker) finalizeCurrentSegment() {
+	if at.currentSegment == nil {
+		return
+	}
+
+	at.currentSegment.TimestampEnd = time.Now()
+	at.currentSegment.DurationSec = uint32(at.currentSegment.TimestampEnd.Sub(at.currentSegment.TimestampStart).Seconds())
+
+	if at.currentSegment.DurationSec > 0 {
+		at.sendSegment(at.currentSegment)
+	}
+}
+
+func (at *ActivityTracker) flushCurrentSegment() {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	at.finalizeCurrentSegment()
+	at.currentSegment = nil
+}
+
+func (at *ActivityTracker) sendSegment(segment *ActivitySegment) {
+	segment.WindowTitle = at.parseWindowTitle(segment.ProcessName, segment.WindowTitle)
+	if !at.trackTitles {
+		segment.WindowTitle = ""
+	}
+	if !at.trackProcesses {
+		segment.ProcessName = ""
+	}
+
+	// Buffered so segments of offline periods are sent once the server is back
+	if at.eventBuffer == nil {
+		activityLog.Error("Failed to send activity segment", zap.Error(errNoEventBuffer))
+		return
+	}
+	if err := at.eventBuffer.Add("segment", segment); err != nil {
+		activityLog.Error("Failed to buffer activity segment", zap.Error(err))
+	}
+}
+
+func (at *ActivityTracker) parseWindowTitle(processName, windowTitle string) string {
+	processLower := strings.ToLower(processName)
+
+	if strings.Contains(processLower, "chrome") ||
+		strings.Contains(processLower, "firefox") ||
+		strings.Contains(processLower, "msedge") {
+		return at.extractBrowserInfo(windowTitle)
+	}
+
+	return windowTitle
+}
+
+func (at *ActivityTracker) extractBrowserInfo(title string) string {
+	parts := strings.Split(title, " - ")
+	if len(parts) < 2 {
+		return title
+	}
+
+	pageName := parts[0]
+
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := strings.TrimSpace(parts[i])
+
+		if strings.Contains(part, "Chrome") ||
+			strings.Contains(part, "Firefox") ||
+			strings.Contains(part, "Edge") ||
+			strings.Contains(part, "Mozilla") {
+			continue
+		}
+
+		if strings.Contains(part, ".") &&
+			!strings.Contains(part, " ") &&
+			(strings.HasPrefix(part, "www.") ||
+				strings.Contains(part, "://") ||
+				len(strings.Split(part, ".")) >= 2) {
+
+			url := part
+			if strings.Contains(url, "://") {
+				urlParts := strings.Split(url, "://")
+				if len(urlParts) == 2 {
+					url = urlParts[1]
+				}
+			}
+
+			url = strings.Split(url, "/")[0]
+			url = strings.Split(url, "?")[0]
+
+			return fmt.Sprintf("%s — %s", pageName, url)
+		}
+	}
+
+	return title
+}
@@ -0,0 +1,50 @@
+package monitoring
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoEventBuffer is returned when a monitor was created without an event
+// buffer. Events always go through the buffer so they survive server outages.
+var errNoEventBuffer = errors.New("event buffer not configured")
+
+type FileActivity struct {
+	Location       string
+	FileCount      int
+	TotalSizeBytes int64
+	StartTime      time.Time
+	Files          []string
+}
+
+type FileEvent struct {
+	Timestamp       time.Time `json:"timestamp"`
+	ComputerName    string    `json:"computer_name"`
+	Username        string    `json:"username"`
+	SourcePath      string    `json:"source_path"`
+	DestinationPath string    `json:"destination_path"`
+	FileSize        int64     `json:"file_size"`
+	FileCount       int       `json:"file_count"`
+	OperationType   string    `json:"operation_type"` // large_copy, external_copy
+	IsUSBTarget     bool      `json:"is_usb_target"`
+}
+
+type USBDevice struct {
+	DeviceID     string    `json:"device_id"`
+	DeviceName   string    `json:"device_name"`
+	DeviceType   string    `json:"device_type"`
+	VolumeSerial string    `json:"volume_serial"`
+	DriveLetter  string    `json:"drive_letter"`
+	ConnectedAt  time.Time `json:"connected_at"`
+}
+
+type USBEvent struct {
+	Timestamp    time.Time `json:"timestamp"`
+	ComputerName string    `json:"computer_name"`
+	Username     string    `json:"username"`
+	DeviceID     string    `json:"device_id"`
+	DeviceName   string    `json:"device_name"`
+	DeviceType   string    `json:"device_type"`
+	EventType    string    `json:"event_type"` // connected, disconnected
+	VolumeSerial string    `json:"volume_serial"`
+}
@@ -0,0 +1,176 @@
+//go:build linux
+// +build linux
+
+package monitoring
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// A file counts once it is fully written or moved in; IN_CREATE is only
+// needed to start watching new subdirectories
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE
+
+type inotifyEvent struct {
+	wd   int32
+	mask uint32
+	name string
+}
+
+func (m *FileMonitor) monitorLocation(location string) {
+	fileLog.Info("Monitoring location", zap.String("location", location))
+
+	// Expand environment variables
+	location = os.ExpandEnv(location)
+
+	// Check if path exists
+	if _, err := os.Stat(location); os.IsNotExist(err) {
+		fileLog.Warn("Location does not exist", zap.String("location", location))
+		return
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		fileLog.Error("Failed to initialize inotify", zap.String("location", location), zap.Error(err))
+		return
+	}
+	defer unix.Close(fd)
+
+	// inotify is not recursive, every directory of the tree gets its own watch
+	watches := make(map[int32]string)
+	m.watchTree(fd, location, location, watches, false)
+
+	buf := make([]byte, 64*1024)
+	pollFds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		default:
+		}
+
+		// Poll with a timeout so Stop is noticed without closing the descriptor under Read
+		ready, err := unix.Poll(pollFds, 1000)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			fileLog.Warn("inotify poll error", zap.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		if ready == 0 {
+			continue
+		}
+
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			fileLog.Warn("inotify read error", zap.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		for _, event := range parseInotifyEvents(buf[:n]) {
+			m.handleInotifyEvent(fd, location, event, watches)
+		}
+	}
+}
+
+func (m *FileMonitor) handleInotifyEvent(fd int, location string, event inotifyEvent, watches map[int32]string) {
+	if event.mask&unix.IN_Q_OVERFLOW != 0 {
+		fileLog.Warn("inotify queue overflow, some file activity was missed", zap.String("location", location))
+		return
+	}
+
+	dir, ok := watches[event.wd]
+	if !ok {
+		return
+	}
+	if event.mask&unix.IN_IGNORED != 0 {
+		// The directory was removed or unmounted
+		delete(watches, event.wd)
+		return
+	}
+
+	fullPath := filepath.Join(dir, event.name)
+
+	if event.mask&unix.IN_ISDIR != 0 {
+		// Files copied into a new directory may land before its watch exists
+		m.watchTree(fd, location, fullPath, watches, event.mask&unix.IN_CREATE != 0)
+		return
+	}
+
+	if event.mask&(unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO) == 0 {
+		return
+	}
+
+	if fileInfo, err := os.Stat(fullPath); err == nil && fileInfo.Mode().IsRegular() {
+		m.recordFileActivity(location, fullPath, fileInfo.Size())
+	}
+}
+
+// watchTree adds a watch for root and every directory below it. With
+// recordExisting the files already present are counted as new activity.
+func (m *FileMonitor) watchTree(fd int, location, root string, watches map[int32]string, recordExisting bool) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip errors
+		}
+
+		if !d.IsDir() {
+			if recordExisting && d.Type().IsRegular() {
+				if info, err := d.Info(); err == nil {
+					m.recordFileActivity(location, path, info.Size())
+				}
+			}
+			return nil
+		}
+
+		wd, err := unix.InotifyAddWatch(fd, path, inotifyMask)
+		if err != nil {
+			if errors.Is(err, unix.ENOSPC) {
+				fileLog.Warn("inotify watch limit reached, raise fs.inotify.max_user_watches", zap.String("path", path))
+				return filepath.SkipAll
+			}
+			return nil
+		}
+		watches[int32(wd)] = path
+		return nil
+	})
+}
+
+// parseInotifyEvents splits a read from an inotify descriptor into events
+func parseInotifyEvents(buf []byte) []inotifyEvent {
+	var events []inotifyEvent
+
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+		end := offset + unix.SizeofInotifyEvent + nameLen
+		if end > len(buf) {
+			break
+		}
+
+		events = append(events, inotifyEvent{
+			wd:   int32(binary.NativeEndian.Uint32(buf[offset:])),
+			mask: binary.NativeEndian.Uint32(buf[offset+4:]),
+			// The name is padded with NUL bytes to an aligned length
+			name: strings.TrimRight(string(buf[offset+unix.SizeofInotifyEvent:end]), "\x00"),
+		})
+		offset = end
+	}
+
+	return events
+}
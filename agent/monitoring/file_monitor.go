@@ -0,0 +1,201 @@
+//go:build windows || linux
+// +build windows linux
+
+package monitoring
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
+)
+
+var fileLog = logger.For("files")
+
+type FileMonitor struct {
+	computerName         string
+	username             string
+	enabled              bool
+	monitoredLocations   []string
+	largeCopyThresholdMB int
+	largeCopyFileCount   int
+	detectExternalCopy   bool
+	stopChan             chan bool
+	mu                   sync.RWMutex
+	activityBuffer       map[string]*FileActivity
+	lastAlertTime        time.Time
+	alertCooldownSec     int
+	eventBuffer          *buffer.EventBuffer
+}
+
+func NewFileMonitor(computerName, username string, monitoredLocations []string, largeCopyThresholdMB, largeCopyFileCount int, detectExternalCopy bool, eventBuffer *buffer.EventBuffer) *FileMonitor {
+	return &FileMonitor{
+		computerName:         computerName,
+		username:             username,
+		enabled:              true,
+		monitoredLocations:   monitoredLocations,
+		largeCopyThresholdMB: largeCopyThresholdMB,
+		largeCopyFileCount:   largeCopyFileCount,
+		detectExternalCopy:   detectExternalCopy,
+		stopChan:             make(chan bool),
+		activityBuffer:       make(map[string]*FileActivity),
+		alertCooldownSec:     60,
+		eventBuffer:          eventBuffer,
+	}
+}
+
+// Name identifies the monitor in the supervisor and the heartbeat
+func (m *FileMonitor) Name() string { return "files" }
+
+func (m *FileMonitor) Start(ctx context.Context) error {
+	fileLog.Info("File Monitor started")
+
+	// Start monitoring each location
+	for _, location := range m.monitoredLocations {
+		go func() {
+			defer supervisor.Recover(ctx)
+			m.monitorLocation(location)
+		}()
+	}
+
+	// Start activity analyzer
+	go func() {
+		defer supervisor.Recover(ctx)
+		m.analyzeActivity()
+	}()
+
+	return nil
+}
+
+// Health is always nil: watch errors are logged and retried per location
+func (m *FileMonitor) Health() error {
+	return nil
+}
+
+func (m *FileMonitor) recordFileActivity(location, filePath string, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	activity, exists := m.activityBuffer[location]
+	if !exists {
+		activity = &FileActivity{
+			Location:  location,
+			StartTime: time.Now(),
+			Files:     make([]string, 0),
+		}
+		m.activityBuffer[location] = activity
+	}
+
+	activity.FileCount++
+	activity.TotalSizeBytes += size
+	activity.Files = append(activity.Files, filePath)
+
+	// Keep only last 1000 files in memory
+	if len(activity.Files) > 1000 {
+		activity.Files = activity.Files[len(activity.Files)-1000:]
+	}
+}
+
+func (m *FileMonitor) analyzeActivity() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.checkForLargeCopyActivity()
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+func (m *FileMonitor) checkForLargeCopyActivity() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Cooldown between alerts
+	if time.Since(m.lastAlertTime).Seconds() < float64(m.alertCooldownSec) {
+		return
+	}
+
+	for location, activity := range m.activityBuffer {
+		duration := time.Since(activity.StartTime).Seconds()
+		sizeMB := float64(activity.TotalSizeBytes) / 1024 / 1024
+
+		// Check thresholds
+		isLargeCopy := false
+
+		if m.largeCopyThresholdMB > 0 && sizeMB > float64(m.largeCopyThresholdMB) {
+			isLargeCopy = true
+		}
+
+		if m.largeCopyFileCount > 0 && activity.FileCount > m.largeCopyFileCount {
+			isLargeCopy = true
+		}
+
+		if isLargeCopy {
+			fileLog.Warn("Large copy detected",
+				zap.String("location", location),
+				zap.Int("files", activity.FileCount),
+				zap.Float64("size_mb", sizeMB),
+				zap.Float64("seconds", duration))
+
+			event := FileEvent{
+				Timestamp:       time.Now(),
+				ComputerName:    m.computerName,
+				Username:        m.username,
+				SourcePath:      location,
+				DestinationPath: "unknown",
+				FileSize:        activity.TotalSizeBytes,
+				FileCount:       activity.FileCount,
+				OperationType:   "large_copy",
+				IsUSBTarget:     false,
+			}
+
+			if err := m.sendEvent(event); err != nil {
+				fileLog.Error("Failed to send file event", zap.Error(err))
+			}
+
+			// Reset activity buffer for this location
+			delete(m.activityBuffer, location)
+			m.lastAlertTime = time.Now()
+		}
+	}
+
+	// Clean up old activities (older than 5 minutes)
+	for location, activity := range m.activityBuffer {
+		if time.Since(activity.StartTime) > 5*time.Minute {
+			delete(m.activityBuffer, location)
+		}
+	}
+}
+
+func (m *FileMonitor) sendEvent(event FileEvent) error {
+	if m.eventBuffer == nil {
+		return errNoEventBuffer
+	}
+	return m.eventBuffer.Add("file", event)
+}
+
+func (m *FileMonitor) Stop() {
+	m.enabled = false
+	close(m.stopChan)
+	fileLog.Info("File Monitor stopped")
+}
+
+func (m *FileMonitor) GetStats() map[string]*FileActivity {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make(map[string]*FileActivity)
+	for k, v := range m.activityBuffer {
+		stats[k] = v
+	}
+
+	return stats
+}
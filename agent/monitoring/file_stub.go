@@ -1,31 +1,34 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !linux
+// +build !windows,!linux
 
 package monitoring
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
 )
 
-// File monitoring is only supported on Windows
+// File monitoring is only supported on Windows and Linux
 type FileMonitor struct{}
 
-type FileActivity struct {
-	Location       string
-	FileCount      int
-	TotalSizeBytes int64
-}
-
-func NewFileMonitor(serverURL, computerName, username string, monitoredLocations []string, largeCopyThresholdMB, largeCopyFileCount int, detectExternalCopy bool) *FileMonitor {
+func NewFileMonitor(computerName, username string, monitoredLocations []string, largeCopyThresholdMB, largeCopyFileCount int, detectExternalCopy bool, eventBuffer *buffer.EventBuffer) *FileMonitor {
 	return &FileMonitor{}
 }
 
-func (m *FileMonitor) Start() error {
-	return fmt.Errorf("file monitoring is only supported on Windows")
+func (m *FileMonitor) Name() string { return "files" }
+
+func (m *FileMonitor) Start(ctx context.Context) error {
+	return fmt.Errorf("file monitoring is only supported on Windows and Linux")
 }
 
 func (m *FileMonitor) Stop() {}
 
+func (m *FileMonitor) Health() error {
+	return nil
+}
+
 func (m *FileMonitor) GetStats() map[string]*FileActivity {
 	return nil
 }
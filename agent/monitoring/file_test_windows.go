@@ -12,7 +12,6 @@ func TestFileMonitorCreation(t *testing.T) {
 	locations := []string{"C:\\Users", "C:\\Documents"}
 
 	monitor := NewFileMonitor(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		locations,
@@ -29,7 +28,6 @@ func TestFileMonitorCreation(t *testing.T) {
 
 func TestFileActivityTracking(t *testing.T) {
 	monitor := NewFileMonitor(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		[]string{"C:\\Test"},
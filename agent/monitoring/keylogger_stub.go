@@ -4,22 +4,34 @@
 package monitoring
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
 )
 
 type Keylogger struct {
 	enabled bool
 }
 
-func NewKeylogger(serverURL, computerName, username string, monitoredProcesses []string, bufferSizeChars, sendIntervalMin int) *Keylogger {
+func NewKeylogger(computerName, username string, monitoredProcesses []string, bufferSizeChars, sendIntervalMin int, eventBuffer *buffer.EventBuffer) *Keylogger {
 	return &Keylogger{
 		enabled: false,
 	}
 }
 
-func (k *Keylogger) Start() error {
+func (k *Keylogger) Name() string { return "keylogger" }
+
+func (k *Keylogger) Start(ctx context.Context) error {
 	return fmt.Errorf("keylogger not supported on non-Windows platforms")
 }
 
 func (k *Keylogger) Stop() {
 }
+
+func (k *Keylogger) Health() error {
+	return nil
+}
+
+func (k *Keylogger) SetPaused(paused bool) {
+}
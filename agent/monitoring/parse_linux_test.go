@@ -0,0 +1,104 @@
+//go:build linux
+// +build linux
+
+package monitoring
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestIdleSecondsFromHint(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	props := parseLoginctlProperties("IdleHint=yes\nIdleSinceHint=1699999700000000\nUser=1000\n")
+
+	if got := idleSecondsFromHint(props, now); got != 300 {
+		t.Errorf("idle = %d, want 300", got)
+	}
+	if props["User"] != "1000" {
+		t.Errorf("User = %q, want 1000", props["User"])
+	}
+
+	props["IdleHint"] = "no"
+	if got := idleSecondsFromHint(props, now); got != 0 {
+		t.Errorf("idle without hint = %d, want 0", got)
+	}
+}
+
+func TestParseProcStatTicks(t *testing.T) {
+	stat := "1234 (Web Content (x)) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 40 0 0 20 0 30 0 500 0 0"
+
+	got, err := parseProcStatTicks(stat)
+	if err != nil {
+		t.Fatalf("parseProcStatTicks: %v", err)
+	}
+	if got != 290 {
+		t.Errorf("ticks = %d, want 290", got)
+	}
+
+	if _, err := parseProcStatTicks("garbage"); err == nil {
+		t.Error("expected an error for malformed stat")
+	}
+}
+
+func TestParseInotifyEvents(t *testing.T) {
+	var buf []byte
+	appendEvent := func(wd int32, mask uint32, name string, padded int) {
+		header := make([]byte, unix.SizeofInotifyEvent)
+		binary.NativeEndian.PutUint32(header[0:], uint32(wd))
+		binary.NativeEndian.PutUint32(header[4:], mask)
+		binary.NativeEndian.PutUint32(header[12:], uint32(padded))
+		buf = append(buf, header...)
+		nameBuf := make([]byte, padded)
+		copy(nameBuf, name)
+		buf = append(buf, nameBuf...)
+	}
+	appendEvent(1, unix.IN_CLOSE_WRITE, "report.docx", 16)
+	appendEvent(2, unix.IN_CREATE|unix.IN_ISDIR, "new", 16)
+
+	events := parseInotifyEvents(buf)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].wd != 1 || events[0].name != "report.docx" || events[0].mask != unix.IN_CLOSE_WRITE {
+		t.Errorf("first event = %+v", events[0])
+	}
+	if events[1].name != "new" || events[1].mask&unix.IN_ISDIR == 0 {
+		t.Errorf("second event = %+v", events[1])
+	}
+
+	// A truncated trailing event is ignored
+	if got := parseInotifyEvents(buf[:len(buf)-4]); len(got) != 1 {
+		t.Errorf("got %d events from truncated buffer, want 1", len(got))
+	}
+}
+
+func TestParseUevent(t *testing.T) {
+	msg := []byte("add@/devices/pci0000:00/usb2/2-1/block/sdb/sdb1\x00ACTION=add\x00SUBSYSTEM=block\x00DEVNAME=sdb1\x00DEVTYPE=partition\x00")
+
+	env := parseUevent(msg)
+	if env["SUBSYSTEM"] != "block" || env["DEVNAME"] != "sdb1" || env["ACTION"] != "add" {
+		t.Errorf("unexpected uevent: %v", env)
+	}
+}
+
+func TestParseMountinfo(t *testing.T) {
+	mountinfo := `22 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw
+98 22 8:17 / /media/alice/USB\040DISK rw,nosuid,nodev shared:50 - vfat /dev/sdb1 rw
+99 22 8:17 / /mnt/second rw shared:51 - vfat /dev/sdb1 rw
+`
+	mounts := parseMountinfo(mountinfo)
+
+	if got := mounts["8:17"]; got != "/media/alice/USB DISK" {
+		t.Errorf("mount point = %q, want %q", got, "/media/alice/USB DISK")
+	}
+	if got := mounts["259:2"]; got != "/" {
+		t.Errorf("root mount = %q", got)
+	}
+	if got := unescapeUdevName(`My\x20Stick`); got != "My Stick" {
+		t.Errorf("udev name = %q", got)
+	}
+}
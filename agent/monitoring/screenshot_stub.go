@@ -4,22 +4,34 @@
 package monitoring
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
 )
 
 type ScreenshotMonitor struct {
 	enabled bool
 }
 
-func NewScreenshotMonitor(serverURL, computerName, username string, intervalMinutes, quality, maxSizeKB int, captureOnlyActive, uploadImmediately bool) *ScreenshotMonitor {
+func NewScreenshotMonitor(serverURL, computerName, username string, intervalMinutes, quality, maxSizeKB, maxQueue int, captureOnlyActive, uploadImmediately bool, httpClient *httpclient.Client) *ScreenshotMonitor {
 	return &ScreenshotMonitor{
 		enabled: false,
 	}
 }
 
-func (m *ScreenshotMonitor) Start() error {
+func (m *ScreenshotMonitor) Name() string { return "screenshots" }
+
+func (m *ScreenshotMonitor) Start(ctx context.Context) error {
 	return fmt.Errorf("screenshot monitoring not supported on non-Windows platforms")
 }
 
 func (m *ScreenshotMonitor) Stop() {
 }
+
+func (m *ScreenshotMonitor) Health() error {
+	return nil
+}
+
+func (m *ScreenshotMonitor) SetThrottle(factor, queueLimit int) {
+}
@@ -16,6 +16,7 @@ func TestScreenshotMonitorCreation(t *testing.T) {
 		15,
 		75,
 		500,
+		100,
 		true,
 		true,
 		nil, // httpClient
@@ -71,6 +72,7 @@ func TestGetForegroundWindowTitle(t *testing.T) {
 		15,
 		75,
 		500,
+		100,
 		false,
 		true,
 		nil, // httpClient
@@ -93,6 +95,7 @@ func TestScreenshotBuffering(t *testing.T) {
 		15,
 		75,
 		500,
+		100,
 		false,
 		false,
 		nil, // httpClient
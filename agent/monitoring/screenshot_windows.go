@@ -9,8 +9,8 @@ import (
 	"image"
 	"image/color"
 	"image/jpeg"
-	"log"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -18,8 +18,13 @@ import (
 	"bytes"
 
 	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
 )
 
+var screenshotLog = logger.For("screenshots")
+
 const (
 	SM_CXSCREEN    = 0
 	SM_CYSCREEN    = 1
@@ -63,8 +68,17 @@ type ScreenshotMonitor struct {
 	mu                sync.RWMutex
 	screenshotQueue   chan *ScreenshotData
 	maxQueueSize      int
+	// Set by the resource governor: capture on every slowdown-th tick and
+	// keep at most queueLimit screenshots waiting for upload
+	slowdown   atomic.Int32
+	queueLimit atomic.Int32
+	// Consecutive capture failures, reported by Health
+	failures atomic.Int32
 }
 
+// maxCaptureFailures consecutive failed captures make the monitor unhealthy
+const maxCaptureFailures = 5
+
 type ScreenshotData struct {
 	Timestamp    time.Time `json:"timestamp"`
 	ComputerName string    `json:"computer_name"`
@@ -76,9 +90,11 @@ type ScreenshotData struct {
 	ImageData    []byte    `json:"image_data"`
 }
 
-func NewScreenshotMonitor(serverURL, computerName, username string, intervalMinutes, quality, maxSizeKB int, captureOnlyActive, uploadImmediately bool, httpClient *httpclient.Client) *ScreenshotMonitor {
-	maxQueue := 100
-	return &ScreenshotMonitor{
+func NewScreenshotMonitor(serverURL, computerName, username string, intervalMinutes, quality, maxSizeKB, maxQueue int, captureOnlyActive, uploadImmediately bool, httpClient *httpclient.Client) *ScreenshotMonitor {
+	if maxQueue <= 0 {
+		maxQueue = 10
+	}
+	m := &ScreenshotMonitor{
 		serverURL:         serverURL,
 		computerName:      computerName,
 		username:          username,
@@ -93,41 +109,85 @@ func NewScreenshotMonitor(serverURL, computerName, username string, intervalMinu
 		screenshotQueue:   make(chan *ScreenshotData, maxQueue),
 		maxQueueSize:      maxQueue,
 	}
+	m.slowdown.Store(1)
+	m.queueLimit.Store(int32(maxQueue))
+	return m
 }
 
-func (m *ScreenshotMonitor) Start() error {
-	log.Printf("Screenshot Monitor started (interval: %d minutes, quality: %d, immediate: %v)",
-		m.intervalMinutes, m.quality, m.uploadImmediately)
+// SetThrottle slows capture down by factor (1 = configured interval) and
+// limits the upload queue, dropping the oldest queued screenshots above it
+func (m *ScreenshotMonitor) SetThrottle(factor, queueLimit int) {
+	if factor < 1 {
+		factor = 1
+	}
+	if queueLimit < 1 || queueLimit > m.maxQueueSize {
+		queueLimit = m.maxQueueSize
+	}
+	m.slowdown.Store(int32(factor))
+	m.queueLimit.Store(int32(queueLimit))
+
+	for len(m.screenshotQueue) > queueLimit {
+		select {
+		case <-m.screenshotQueue:
+		default:
+			return
+		}
+	}
+}
+
+// Name identifies the monitor in the supervisor and the heartbeat
+func (m *ScreenshotMonitor) Name() string { return "screenshots" }
+
+func (m *ScreenshotMonitor) Start(ctx context.Context) error {
+	screenshotLog.Info("Screenshot Monitor started",
+		zap.Int("interval_min", m.intervalMinutes),
+		zap.Int("quality", m.quality),
+		zap.Bool("upload_immediately", m.uploadImmediately))
 
 	m.wg.Add(1)
-	go m.captureLoop()
+	go m.captureLoop(ctx)
 
 	if !m.uploadImmediately {
 		m.wg.Add(1)
-		go m.uploadWorker()
+		go m.uploadWorker(ctx)
 	}
 
 	return nil
 }
 
+// Health fails after several captures in a row failed, e.g. when the
+// session lost access to the desktop
+func (m *ScreenshotMonitor) Health() error {
+	if n := m.failures.Load(); n >= maxCaptureFailures {
+		return fmt.Errorf("%d screenshot captures failed in a row", n)
+	}
+	return nil
+}
+
 func (m *ScreenshotMonitor) Stop() {
-	log.Println("Stopping Screenshot Monitor...")
+	screenshotLog.Info("Stopping Screenshot Monitor")
 	close(m.stopChan)
 	m.wg.Wait()
-	log.Println("Screenshot Monitor stopped")
+	screenshotLog.Info("Screenshot Monitor stopped")
 }
 
-func (m *ScreenshotMonitor) captureLoop() {
+func (m *ScreenshotMonitor) captureLoop(ctx context.Context) {
 	defer m.wg.Done()
+	defer supervisor.Recover(ctx)
 
 	ticker := time.NewTicker(time.Duration(m.intervalMinutes) * time.Minute)
 	defer ticker.Stop()
 
 	m.captureAndSend()
 
+	ticks := 0
 	for {
 		select {
 		case <-ticker.C:
+			ticks++
+			if ticks%int(m.slowdown.Load()) != 0 {
+				continue
+			}
 			m.captureAndSend()
 		case <-m.stopChan:
 			return
@@ -138,9 +198,11 @@ func (m *ScreenshotMonitor) captureLoop() {
 func (m *ScreenshotMonitor) captureAndSend() {
 	screenshot, err := m.captureScreenshot()
 	if err != nil {
-		log.Printf("Failed to capture screenshot: %v", err)
+		m.failures.Add(1)
+		screenshotLog.Error("Failed to capture screenshot", zap.Error(err))
 		return
 	}
+	m.failures.Store(0)
 
 	if screenshot == nil {
 		return
@@ -148,19 +210,24 @@ func (m *ScreenshotMonitor) captureAndSend() {
 
 	if m.uploadImmediately {
 		if err := m.sendScreenshot(screenshot); err != nil {
-			log.Printf("Failed to send screenshot: %v", err)
+			screenshotLog.Error("Failed to send screenshot", zap.Error(err))
 		}
 	} else {
+		if len(m.screenshotQueue) >= int(m.queueLimit.Load()) {
+			screenshotLog.Warn("Screenshot queue full, dropping screenshot")
+			return
+		}
 		select {
 		case m.screenshotQueue <- screenshot:
 		default:
-			log.Printf("Screenshot queue full, dropping oldest screenshot")
+			screenshotLog.Warn("Screenshot queue full, dropping screenshot")
 		}
 	}
 }
 
-func (m *ScreenshotMonitor) uploadWorker() {
+func (m *ScreenshotMonitor) uploadWorker(ctx context.Context) {
 	defer m.wg.Done()
+	defer supervisor.Recover(ctx)
 
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -201,7 +268,7 @@ func (m *ScreenshotMonitor) uploadWorker() {
 					if len(batch) > 0 {
 						m.uploadBatch(batch)
 					}
-					log.Println("Screenshot upload worker finished (queue drained)")
+					screenshotLog.Info("Screenshot upload worker finished (queue drained)")
 					return
 				}
 			}
@@ -210,11 +277,11 @@ func (m *ScreenshotMonitor) uploadWorker() {
 }
 
 func (m *ScreenshotMonitor) uploadBatch(screenshots []*ScreenshotData) {
-	log.Printf("Uploading batch of %d screenshots", len(screenshots))
+	screenshotLog.Info("Uploading batch of screenshots", zap.Int("count", len(screenshots)))
 
 	for _, screenshot := range screenshots {
 		if err := m.sendScreenshot(screenshot); err != nil {
-			log.Printf("Failed to send screenshot %s: %v", screenshot.ScreenshotID, err)
+			screenshotLog.Error("Failed to send screenshot", zap.String("screenshot_id", screenshot.ScreenshotID), zap.Error(err))
 		}
 	}
 }
@@ -241,7 +308,7 @@ func (m *ScreenshotMonitor) captureScreenshot() (*ScreenshotData, error) {
 	sizeKB := len(imageData) / 1024
 
 	if m.maxSizeKB > 0 && sizeKB > m.maxSizeKB {
-		log.Printf("Screenshot too large: %d KB (max: %d KB), skipping", sizeKB, m.maxSizeKB)
+		screenshotLog.Warn("Screenshot too large, skipping", zap.Int("size_kb", sizeKB), zap.Int("max_kb", m.maxSizeKB))
 		return nil, nil
 	}
 
@@ -258,7 +325,10 @@ func (m *ScreenshotMonitor) captureScreenshot() (*ScreenshotData, error) {
 		ImageData:    imageData,
 	}
 
-	log.Printf("Screenshot captured: %s (size: %d KB, window: %s)", screenshotID, sizeKB, windowTitle)
+	screenshotLog.Debug("Screenshot captured",
+		zap.String("screenshot_id", screenshotID),
+		zap.Int("size_kb", sizeKB),
+		zap.String("window", windowTitle))
 
 	return screenshot, nil
 }
@@ -0,0 +1,321 @@
+//go:build linux
+// +build linux
+
+package monitoring
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// udev creates the /dev/disk links a moment after the kernel uevent
+	udevSettleDelay = 1 * time.Second
+	// Desktops mount a drive shortly after it appears; shadow copy waits this long
+	mountWaitTimeout = 60 * time.Second
+	// Rescan interval in case uevents are not available
+	usbRescanInterval = 30 * time.Second
+)
+
+// getRemovableDrives lists USB attached block devices by name ("sdb1"): the
+// partitions of each disk, or the disk itself when it is not partitioned
+func (m *USBMonitor) getRemovableDrives() []string {
+	var drives []string
+
+	disks, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+
+	for _, disk := range disks {
+		name := disk.Name()
+
+		devPath, err := filepath.EvalSymlinks(filepath.Join("/sys/block", name))
+		if err != nil || !strings.Contains(devPath, "/usb") {
+			continue
+		}
+
+		// Card readers without a card report a size of 0
+		if size, _ := os.ReadFile(filepath.Join(devPath, "size")); strings.TrimSpace(string(size)) == "0" {
+			continue
+		}
+
+		entries, err := os.ReadDir(devPath)
+		if err != nil {
+			continue
+		}
+
+		partitions := 0
+		for _, entry := range entries {
+			if _, err := os.Stat(filepath.Join(devPath, entry.Name(), "partition")); err == nil {
+				drives = append(drives, entry.Name())
+				partitions++
+			}
+		}
+		if partitions == 0 {
+			drives = append(drives, name)
+		}
+	}
+
+	return drives
+}
+
+func (m *USBMonitor) getDriveInfo(name string) *USBDevice {
+	devPath, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", name))
+	if err != nil {
+		return nil
+	}
+
+	// The filesystem UUID of FAT and exFAT drives is the volume serial Windows reports
+	serial := strings.ToUpper(strings.ReplaceAll(diskLinkName("/dev/disk/by-uuid", name), "-", ""))
+	if serial == "" {
+		serial = usbSerial(devPath)
+	}
+	if serial == "" {
+		serial = strings.ToUpper(name)
+	}
+
+	deviceName := diskLinkName("/dev/disk/by-label", name)
+	if deviceName == "" {
+		diskPath := devPath
+		if _, err := os.Stat(filepath.Join(devPath, "partition")); err == nil {
+			diskPath = filepath.Dir(devPath)
+		}
+		model, _ := os.ReadFile(filepath.Join(diskPath, "device", "model"))
+		deviceName = strings.TrimSpace(string(model))
+	}
+
+	device := &USBDevice{
+		DeviceID:     "USB_" + serial,
+		DeviceName:   deviceName,
+		DeviceType:   "removable_disk",
+		VolumeSerial: serial,
+		DriveLetter:  mountPoint(name),
+		ConnectedAt:  time.Now(),
+	}
+
+	if device.DeviceName == "" {
+		device.DeviceName = "USB Drive"
+	}
+
+	return device
+}
+
+// monitorDriveChanges rescans the drives on every block device uevent
+func (m *USBMonitor) monitorDriveChanges() {
+	uevents := make(chan struct{}, 1)
+	go func() {
+		defer supervisor.Recover(m.ctx)
+		m.listenUevents(uevents)
+	}()
+
+	ticker := time.NewTicker(usbRescanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-uevents:
+			select {
+			case <-m.stopChan:
+				return
+			case <-time.After(udevSettleDelay):
+			}
+			m.syncDrives()
+		case <-ticker.C:
+			m.syncDrives()
+		}
+	}
+}
+
+// listenUevents signals block device changes from the kernel uevent netlink socket
+func (m *USBMonitor) listenUevents(changed chan<- struct{}) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		usbLog.Warn("uevent socket unavailable, polling USB drives", zap.Duration("interval", usbRescanInterval), zap.Error(err))
+		return
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		usbLog.Warn("uevent socket unavailable, polling USB drives", zap.Duration("interval", usbRescanInterval), zap.Error(err))
+		return
+	}
+
+	// A receive timeout lets the loop notice Stop
+	timeout := unix.Timeval{Sec: 1}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		usbLog.Warn("Failed to set uevent socket timeout", zap.Error(err))
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		default:
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			usbLog.Warn("uevent receive error", zap.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		if parseUevent(buf[:n])["SUBSYSTEM"] != "block" {
+			continue
+		}
+
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// driveRoot waits for the drive to be mounted and returns the mount point
+func (m *USBMonitor) driveRoot(drive string, device *USBDevice) string {
+	deadline := time.Now().Add(mountWaitTimeout)
+
+	for {
+		if root := mountPoint(drive); root != "" {
+			m.mu.Lock()
+			device.DriveLetter = root
+			m.mu.Unlock()
+			return root
+		}
+
+		if time.Now().After(deadline) {
+			return ""
+		}
+
+		select {
+		case <-m.stopChan:
+			return ""
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// parseUevent parses a kernel uevent message: a "action@devpath" header
+// followed by NUL separated KEY=VALUE pairs
+func parseUevent(msg []byte) map[string]string {
+	env := make(map[string]string)
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		key, value, ok := strings.Cut(string(field), "=")
+		if ok {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// mountPoint returns where the block device is mounted, or "" if it is not
+func mountPoint(name string) string {
+	dev, err := os.ReadFile(filepath.Join("/sys/class/block", name, "dev"))
+	if err != nil {
+		return ""
+	}
+
+	mountinfo, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+
+	return parseMountinfo(string(mountinfo))[strings.TrimSpace(string(dev))]
+}
+
+// parseMountinfo maps "major:minor" to the first mount point of the device
+func parseMountinfo(mountinfo string) map[string]string {
+	mounts := make(map[string]string)
+
+	for _, line := range strings.Split(mountinfo, "\n") {
+		// id parent major:minor root mountpoint options ...
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		if _, exists := mounts[fields[2]]; !exists {
+			mounts[fields[2]] = unescapeMountPath(fields[4])
+		}
+	}
+
+	return mounts
+}
+
+// unescapeMountPath decodes the \NNN octal escapes of spaces and other
+// special characters in mountinfo paths
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// diskLinkName finds the udev link in dir (by-uuid, by-label) that points to
+// the block device and returns its decoded name
+func diskLinkName(dir, name string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err == nil && filepath.Base(target) == name {
+			return unescapeUdevName(entry.Name())
+		}
+	}
+	return ""
+}
+
+// unescapeUdevName decodes the \xNN escapes udev uses in link names
+func unescapeUdevName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && name[i+1] == 'x' {
+			if v, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// usbSerial returns the serial number of the USB device the block device belongs to
+func usbSerial(devPath string) string {
+	for dir := devPath; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if serial, err := os.ReadFile(filepath.Join(dir, "serial")); err == nil {
+			return strings.ToUpper(strings.TrimSpace(string(serial)))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,305 @@
+//go:build windows || linux
+// +build windows linux
+
+package monitoring
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
+)
+
+var usbLog = logger.For("usb")
+
+type USBMonitor struct {
+	computerName      string
+	username          string
+	enabled           bool
+	shadowCopyEnabled bool
+	shadowCopyDest    string
+	copyExtensions    []string
+	excludePatterns   []string
+	connectedDevices  map[string]*USBDevice
+	mu                sync.RWMutex
+	eventBuffer       *buffer.EventBuffer
+	stopChan          chan struct{}
+	ctx               context.Context
+}
+
+func NewUSBMonitor(computerName, username string, shadowCopyEnabled bool, shadowCopyDest string, copyExtensions, excludePatterns []string, eventBuffer *buffer.EventBuffer) *USBMonitor {
+	return &USBMonitor{
+		computerName:      computerName,
+		username:          username,
+		enabled:           true,
+		shadowCopyEnabled: shadowCopyEnabled,
+		shadowCopyDest:    shadowCopyDest,
+		copyExtensions:    copyExtensions,
+		excludePatterns:   excludePatterns,
+		connectedDevices:  make(map[string]*USBDevice),
+		eventBuffer:       eventBuffer,
+		stopChan:          make(chan struct{}),
+	}
+}
+
+// Name identifies the monitor in the supervisor and the heartbeat
+func (m *USBMonitor) Name() string { return "usb" }
+
+func (m *USBMonitor) Start(ctx context.Context) error {
+	usbLog.Info("USB Monitor started")
+	m.ctx = ctx
+
+	// Initial scan for already connected USB drives
+	m.scanExistingDrives()
+
+	// Start monitoring for new connections
+	go func() {
+		defer supervisor.Recover(ctx)
+		m.monitorDriveChanges()
+	}()
+
+	return nil
+}
+
+// Health is always nil: drive scans are retried on every tick
+func (m *USBMonitor) Health() error {
+	return nil
+}
+
+func (m *USBMonitor) scanExistingDrives() {
+	drives := m.getRemovableDrives()
+	for _, drive := range drives {
+		device := m.getDriveInfo(drive)
+		if device != nil {
+			m.mu.Lock()
+			m.connectedDevices[drive] = device
+			m.mu.Unlock()
+
+			usbLog.Info("Found existing USB drive", zap.String("drive", device.DriveLetter), zap.String("device", device.DeviceName))
+		}
+	}
+}
+
+// syncDrives compares the removable drives with the known ones and reports
+// connections and disconnections
+func (m *USBMonitor) syncDrives() {
+	currentDrives := m.getRemovableDrives()
+	currentMap := make(map[string]bool)
+
+	for _, drive := range currentDrives {
+		currentMap[drive] = true
+
+		m.mu.RLock()
+		_, exists := m.connectedDevices[drive]
+		m.mu.RUnlock()
+
+		if !exists {
+			device := m.getDriveInfo(drive)
+			if device != nil {
+				m.handleDeviceConnected(drive, device)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	for drive, device := range m.connectedDevices {
+		if !currentMap[drive] {
+			m.handleDeviceDisconnected(device)
+			delete(m.connectedDevices, drive)
+		}
+	}
+	m.mu.Unlock()
+}
+
+func (m *USBMonitor) handleDeviceConnected(drive string, device *USBDevice) {
+	m.mu.Lock()
+	m.connectedDevices[drive] = device
+	m.mu.Unlock()
+
+	usbLog.Info("USB device connected",
+		zap.String("device", device.DeviceName),
+		zap.String("drive", device.DriveLetter),
+		zap.String("serial", device.VolumeSerial))
+
+	// Send event to server
+	event := USBEvent{
+		Timestamp:    time.Now(),
+		ComputerName: m.computerName,
+		Username:     m.username,
+		DeviceID:     device.DeviceID,
+		DeviceName:   device.DeviceName,
+		DeviceType:   device.DeviceType,
+		EventType:    "connected",
+		VolumeSerial: device.VolumeSerial,
+	}
+
+	if err := m.sendEvent(event); err != nil {
+		usbLog.Error("Failed to send USB connection event", zap.Error(err))
+	}
+
+	// Start shadow copy if enabled
+	if m.shadowCopyEnabled {
+		go func() {
+			defer supervisor.Recover(m.ctx)
+			m.shadowCopyDrive(drive, device)
+		}()
+	}
+}
+
+func (m *USBMonitor) handleDeviceDisconnected(device *USBDevice) {
+	usbLog.Info("USB device disconnected", zap.String("device", device.DeviceName), zap.String("drive", device.DriveLetter))
+
+	event := USBEvent{
+		Timestamp:    time.Now(),
+		ComputerName: m.computerName,
+		Username:     m.username,
+		DeviceID:     device.DeviceID,
+		DeviceName:   device.DeviceName,
+		DeviceType:   device.DeviceType,
+		EventType:    "disconnected",
+		VolumeSerial: device.VolumeSerial,
+	}
+
+	if err := m.sendEvent(event); err != nil {
+		usbLog.Error("Failed to send USB disconnection event", zap.Error(err))
+	}
+}
+
+func (m *USBMonitor) shadowCopyDrive(drive string, device *USBDevice) {
+	root := m.driveRoot(drive, device)
+	if root == "" {
+		usbLog.Warn("Shadow copy skipped, device is not mounted", zap.String("device", device.DeviceName), zap.String("device_id", device.DeviceID))
+		return
+	}
+
+	usbLog.Info("Starting shadow copy", zap.String("source", root), zap.String("destination", m.shadowCopyDest))
+
+	destPath := filepath.Join(m.shadowCopyDest, m.computerName, device.VolumeSerial, time.Now().Format("2006-01-02_150405"))
+
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		usbLog.Error("Failed to create shadow copy directory", zap.String("path", destPath), zap.Error(err))
+		return
+	}
+
+	fileCount := 0
+	totalSize := int64(0)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip errors
+		}
+
+		if info.IsDir() {
+			// Check exclude patterns
+			for _, pattern := range m.excludePatterns {
+				if matched, _ := filepath.Match(pattern, info.Name()); matched {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+
+		// Check if file extension is in copy list (if specified)
+		if len(m.copyExtensions) > 0 {
+			ext := strings.ToLower(filepath.Ext(path))
+			found := false
+			for _, allowedExt := range m.copyExtensions {
+				if ext == strings.ToLower(allowedExt) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil
+			}
+		}
+
+		// Check exclude patterns for files
+		for _, pattern := range m.excludePatterns {
+			if matched, _ := filepath.Match(pattern, info.Name()); matched {
+				return nil
+			}
+		}
+
+		// Copy file
+		relPath, _ := filepath.Rel(root, path)
+		destFile := filepath.Join(destPath, relPath)
+
+		if err := os.MkdirAll(filepath.Dir(destFile), 0755); err != nil {
+			return nil
+		}
+
+		if err := m.copyFile(path, destFile); err != nil {
+			usbLog.Warn("Failed to copy file", zap.String("path", path), zap.Error(err))
+			return nil
+		}
+
+		fileCount++
+		totalSize += info.Size()
+
+		if fileCount%100 == 0 {
+			usbLog.Info("Shadow copy progress", zap.Int("files", fileCount), zap.Float64("size_mb", float64(totalSize)/1024/1024))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		usbLog.Error("Shadow copy error", zap.Error(err))
+	}
+
+	usbLog.Info("Shadow copy completed",
+		zap.Int("files", fileCount),
+		zap.Float64("size_mb", float64(totalSize)/1024/1024),
+		zap.String("destination", destPath))
+}
+
+func (m *USBMonitor) copyFile(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	_, err = io.Copy(destination, source)
+	return err
+}
+
+func (m *USBMonitor) sendEvent(event USBEvent) error {
+	if m.eventBuffer == nil {
+		return errNoEventBuffer
+	}
+	return m.eventBuffer.Add("usb", event)
+}
+
+func (m *USBMonitor) Stop() {
+	m.enabled = false
+	close(m.stopChan)
+	usbLog.Info("USB Monitor stopped")
+}
+
+func (m *USBMonitor) GetConnectedDevices() []*USBDevice {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make([]*USBDevice, 0, len(m.connectedDevices))
+	for _, device := range m.connectedDevices {
+		devices = append(devices, device)
+	}
+
+	return devices
+}
@@ -1,35 +1,34 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !linux
+// +build !windows,!linux
 
 package monitoring
 
 import (
+	"context"
 	"fmt"
-	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
 )
 
-// USB monitoring is only supported on Windows
+// USB monitoring is only supported on Windows and Linux
 type USBMonitor struct{}
 
-type USBDevice struct {
-	DeviceID     string
-	DeviceName   string
-	DeviceType   string
-	VolumeSerial string
-	DriveLetter  string
-	ConnectedAt  time.Time
-}
-
-func NewUSBMonitor(serverURL, computerName, username string, shadowCopyEnabled bool, shadowCopyDest string, copyExtensions, excludePatterns []string) *USBMonitor {
+func NewUSBMonitor(computerName, username string, shadowCopyEnabled bool, shadowCopyDest string, copyExtensions, excludePatterns []string, eventBuffer *buffer.EventBuffer) *USBMonitor {
 	return &USBMonitor{}
 }
 
-func (m *USBMonitor) Start() error {
-	return fmt.Errorf("USB monitoring is only supported on Windows")
+func (m *USBMonitor) Name() string { return "usb" }
+
+func (m *USBMonitor) Start(ctx context.Context) error {
+	return fmt.Errorf("USB monitoring is only supported on Windows and Linux")
 }
 
 func (m *USBMonitor) Stop() {}
 
+func (m *USBMonitor) Health() error {
+	return nil
+}
+
 func (m *USBMonitor) GetConnectedDevices() []*USBDevice {
 	return nil
 }
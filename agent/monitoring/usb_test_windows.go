@@ -10,7 +10,6 @@ import (
 
 func TestUSBMonitorCreation(t *testing.T) {
 	monitor := NewUSBMonitor(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		false,
@@ -27,7 +26,6 @@ func TestUSBMonitorCreation(t *testing.T) {
 
 func TestUSBMonitorWithShadowCopy(t *testing.T) {
 	monitor := NewUSBMonitor(
-		"http://localhost:5000",
 		"TEST-PC",
 		"testuser",
 		true,
@@ -0,0 +1,350 @@
+//go:build windows || linux
+// +build windows linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/buffer"
+	"github.com/ctolnik/Office-Monitor/agent/config"
+	"github.com/ctolnik/Office-Monitor/agent/governor"
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"github.com/ctolnik/Office-Monitor/agent/monitoring"
+	"github.com/ctolnik/Office-Monitor/agent/supervisor"
+	"go.uber.org/zap"
+)
+
+var monitorsLog = logger.For("monitors")
+
+// monitorSet reconciles the supervised monitors with a config. Monitors
+// cannot be restarted after Stop, so a changed section replaces the monitor
+// with a new instance.
+type monitorSet struct {
+	mu          sync.Mutex // serializes apply
+	cfg         *config.Config
+	username    string
+	eventBuffer *buffer.EventBuffer
+	httpClient  *httpclient.Client
+	sup         *supervisor.Supervisor
+
+	// throttleMu guards the resource governor level and the performance
+	// section it is applied with. It is separate from mu because new
+	// instances are throttled from the supervisor while apply runs.
+	throttleMu sync.Mutex
+	throttle   governor.Level
+	perf       config.PerformanceConfig
+}
+
+func newMonitorSet(ctx context.Context, eventBuffer *buffer.EventBuffer, httpClient *httpclient.Client) *monitorSet {
+	s := &monitorSet{
+		username:    currentUsername(),
+		eventBuffer: eventBuffer,
+		httpClient:  httpClient,
+	}
+	// Restarted instances get the current throttle like new ones
+	s.sup = supervisor.New(ctx, supervisor.Options{OnStart: s.throttleMonitor})
+	return s
+}
+
+// run checks the health of the monitors until ctx is cancelled
+func (s *monitorSet) run(ctx context.Context) {
+	s.sup.Run(ctx)
+}
+
+// apply starts, stops or restarts monitors whose section differs from the
+// running config. Monitors that fail to start are reported in the error and
+// retried by the supervisor.
+func (s *monitorSet) apply(cfg *config.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.throttleMu.Lock()
+	s.perf = cfg.Performance
+	s.throttleMu.Unlock()
+
+	old := s.cfg
+	if old == nil {
+		old = &config.Config{}
+	}
+	changed := func(a, b interface{}) bool {
+		return s.cfg == nil || !reflect.DeepEqual(a, b)
+	}
+
+	var errs []error
+	if changed(old.ActivityMonitoring, cfg.ActivityMonitoring) {
+		errs = append(errs, s.applyActivity(cfg))
+	}
+	if changed(old.USBMonitoring, cfg.USBMonitoring) {
+		errs = append(errs, s.applyUSB(cfg))
+	}
+	if changed(old.Screenshots, cfg.Screenshots) {
+		errs = append(errs, s.applyScreenshots(cfg))
+	}
+	if changed(old.FileMonitoring, cfg.FileMonitoring) {
+		errs = append(errs, s.applyFiles(cfg))
+	}
+	if changed(old.Keylogger, cfg.Keylogger) {
+		errs = append(errs, s.applyKeylogger(cfg))
+	}
+
+	s.cfg = cfg
+	s.applyThrottle()
+	return errors.Join(errs...)
+}
+
+// setThrottle applies a resource governor level to the running monitors
+func (s *monitorSet) setThrottle(level governor.Level) {
+	s.throttleMu.Lock()
+	s.throttle = level
+	s.throttleMu.Unlock()
+	s.applyThrottle()
+}
+
+// throttleSettings derives the limits for the current level. The monitors
+// degrade cumulatively: slower screenshots, then smaller screenshot and
+// event queues, then a paused keylogger.
+func (s *monitorSet) throttleSettings() (slowdown, screenshotQueue, eventBatch int, pauseKeylogger bool) {
+	s.throttleMu.Lock()
+	defer s.throttleMu.Unlock()
+
+	perf, level := s.perf, s.throttle
+	slowdown, screenshotQueue, eventBatch = 1, perf.ScreenshotMaxQueue, perf.EventBufferSize
+	if level >= governor.LevelSlowScreenshots {
+		slowdown = 2
+	}
+	if level >= governor.LevelShrinkQueues {
+		screenshotQueue = max(1, perf.ScreenshotMaxQueue/4)
+		eventBatch = max(1, perf.EventBufferSize/4)
+	}
+	if level >= governor.LevelPauseKeylogger {
+		slowdown = 4
+	}
+	return slowdown, screenshotQueue, eventBatch, level >= governor.LevelPauseKeylogger
+}
+
+// applyThrottle applies the current level to the event buffer and every
+// running monitor
+func (s *monitorSet) applyThrottle() {
+	_, _, eventBatch, _ := s.throttleSettings()
+	if s.eventBuffer != nil && eventBatch > 0 {
+		s.eventBuffer.SetMaxSize(eventBatch)
+	}
+	for _, m := range s.sup.Running() {
+		s.throttleMonitor(m)
+	}
+}
+
+// throttleMonitor applies the current level to one monitor
+func (s *monitorSet) throttleMonitor(m supervisor.Monitor) {
+	slowdown, screenshotQueue, _, pauseKeylogger := s.throttleSettings()
+	switch m := m.(type) {
+	case *monitoring.ScreenshotMonitor:
+		m.SetThrottle(slowdown, screenshotQueue)
+	case *monitoring.Keylogger:
+		m.SetPaused(pauseKeylogger)
+	}
+}
+
+// running returns the names of the monitors that are currently started
+func (s *monitorSet) running() []string {
+	mons := s.sup.Running()
+	names := make([]string, 0, len(mons))
+	for _, m := range mons {
+		names = append(names, m.Name())
+	}
+	return names
+}
+
+// status returns the supervisor state of every configured monitor
+func (s *monitorSet) status() []supervisor.Status {
+	return s.sup.Status()
+}
+
+// shutdown stops the monitors in reverse start order; monitors still
+// running when ctx expires are named in the error
+func (s *monitorSet) shutdown(ctx context.Context) error {
+	return s.sup.Shutdown(ctx)
+}
+
+// start hands a monitor to the supervisor
+func (s *monitorSet) start(name string, newMonitor func() supervisor.Monitor) error {
+	return s.sup.Add(supervisor.Spec{Name: name, New: newMonitor})
+}
+
+func (s *monitorSet) applyActivity(cfg *config.Config) error {
+	s.sup.Remove("activity")
+	if !cfg.ActivityMonitoring.Enabled {
+		monitorsLog.Info("Activity tracking: DISABLED")
+		return nil
+	}
+
+	idleThresholdMin := cfg.ActivityMonitoring.IdleThresholdSeconds / 60
+	err := s.start("activity", func() supervisor.Monitor {
+		return monitoring.NewActivityTracker(
+			cfg.Agent.ComputerName,
+			s.username,
+			idleThresholdMin,
+			cfg.ActivityMonitoring.IntervalSeconds,
+			cfg.ActivityMonitoring.TrackWindowTitles,
+			cfg.ActivityMonitoring.TrackProcessNames,
+			s.eventBuffer,
+		)
+	})
+	if err != nil {
+		monitorsLog.Warn("Activity tracking failed to start", zap.Error(err))
+		return fmt.Errorf("activity tracking: %w", err)
+	}
+	monitorsLog.Info("Activity tracking: ENABLED",
+		zap.Int("idle_threshold_min", idleThresholdMin),
+		zap.Int("poll_interval_sec", cfg.ActivityMonitoring.IntervalSeconds))
+	return nil
+}
+
+func (s *monitorSet) applyUSB(cfg *config.Config) error {
+	s.sup.Remove("usb")
+	if !cfg.USBMonitoring.Enabled {
+		monitorsLog.Info("USB monitoring: DISABLED")
+		return nil
+	}
+
+	err := s.start("usb", func() supervisor.Monitor {
+		return monitoring.NewUSBMonitor(
+			cfg.Agent.ComputerName,
+			s.username,
+			cfg.USBMonitoring.ShadowCopyEnabled,
+			cfg.USBMonitoring.ShadowCopyDest,
+			cfg.USBMonitoring.CopyFileExtensions,
+			cfg.USBMonitoring.ExcludePatterns,
+			s.eventBuffer,
+		)
+	})
+	if err != nil {
+		monitorsLog.Warn("USB monitoring failed to start", zap.Error(err))
+		return fmt.Errorf("usb monitoring: %w", err)
+	}
+	monitorsLog.Info("USB monitoring: ENABLED")
+	if cfg.USBMonitoring.ShadowCopyEnabled {
+		monitorsLog.Info("Shadow copy: ENABLED", zap.String("destination", cfg.USBMonitoring.ShadowCopyDest))
+	}
+	return nil
+}
+
+func (s *monitorSet) applyScreenshots(cfg *config.Config) error {
+	s.sup.Remove("screenshots")
+	if !cfg.Screenshots.Enabled {
+		monitorsLog.Info("Screenshot capture: DISABLED")
+		return nil
+	}
+
+	err := s.start("screenshots", func() supervisor.Monitor {
+		return monitoring.NewScreenshotMonitor(
+			cfg.Agent.Server.URL,
+			cfg.Agent.ComputerName,
+			s.username,
+			cfg.Screenshots.IntervalMinutes,
+			cfg.Screenshots.Quality,
+			cfg.Screenshots.MaxSizeKB,
+			cfg.Performance.ScreenshotMaxQueue,
+			cfg.Screenshots.CaptureOnlyActive,
+			cfg.Screenshots.UploadImmediately,
+			s.httpClient,
+		)
+	})
+	if err != nil {
+		monitorsLog.Warn("Screenshot capture failed to start", zap.Error(err))
+		return fmt.Errorf("screenshot capture: %w", err)
+	}
+	monitorsLog.Info("Screenshot capture: ENABLED",
+		zap.Int("interval_min", cfg.Screenshots.IntervalMinutes),
+		zap.Int("quality", cfg.Screenshots.Quality))
+	return nil
+}
+
+func (s *monitorSet) applyFiles(cfg *config.Config) error {
+	s.sup.Remove("files")
+	if !cfg.FileMonitoring.Enabled {
+		monitorsLog.Info("File monitoring: DISABLED")
+		return nil
+	}
+
+	// Without alerts the activity is still tracked, no threshold is ever crossed
+	thresholdMB, thresholdCount := cfg.FileMonitoring.LargeCopyThresholdMB, cfg.FileMonitoring.LargeCopyFileCount
+	if !cfg.FileMonitoring.AlertOnLargeCopy {
+		thresholdMB, thresholdCount = 0, 0
+	}
+	err := s.start("files", func() supervisor.Monitor {
+		return monitoring.NewFileMonitor(
+			cfg.Agent.ComputerName,
+			s.username,
+			cfg.FileMonitoring.MonitoredLocations,
+			thresholdMB,
+			thresholdCount,
+			cfg.FileMonitoring.DetectExternalCopy,
+			s.eventBuffer,
+		)
+	})
+	if err != nil {
+		monitorsLog.Warn("File monitoring failed to start", zap.Error(err))
+		return fmt.Errorf("file monitoring: %w", err)
+	}
+	monitorsLog.Info("File monitoring: ENABLED",
+		zap.Int("locations", len(cfg.FileMonitoring.MonitoredLocations)),
+		zap.Int("threshold_mb", cfg.FileMonitoring.LargeCopyThresholdMB),
+		zap.Int("threshold_files", cfg.FileMonitoring.LargeCopyFileCount))
+	return nil
+}
+
+func (s *monitorSet) applyKeylogger(cfg *config.Config) error {
+	s.sup.Remove("keylogger")
+	if !cfg.Keylogger.Enabled {
+		monitorsLog.Info("Keylogger: DISABLED")
+		return nil
+	}
+
+	monitorsLog.Warn("Keylogger enabled - ensure legal compliance!")
+	err := s.start("keylogger", func() supervisor.Monitor {
+		return monitoring.NewKeylogger(
+			cfg.Agent.ComputerName,
+			s.username,
+			cfg.Keylogger.MonitoredProcesses,
+			cfg.Keylogger.BufferSizeChars,
+			cfg.Keylogger.SendIntervalMin,
+			s.eventBuffer,
+		)
+	})
+	if err != nil {
+		monitorsLog.Warn("Keylogger failed to start", zap.Error(err))
+		return fmt.Errorf("keylogger: %w", err)
+	}
+	monitorsLog.Info("Keylogger: ENABLED", zap.Strings("processes", cfg.Keylogger.MonitoredProcesses))
+	return nil
+}
+
+// httpClientConfig maps the server and security sections to the HTTP client
+func httpClientConfig(cfg *config.Config) httpclient.Config {
+	return httpclient.Config{
+		ServerURL:          cfg.Agent.Server.URL,
+		APIKey:             cfg.Agent.APIKey,
+		TimeoutSeconds:     cfg.Agent.Server.TimeoutSeconds,
+		RetryAttempts:      cfg.Agent.Server.RetryAttempts,
+		RetryDelay:         time.Duration(cfg.Agent.Server.RetryDelay) * time.Second,
+		Compression:        cfg.Agent.Server.Compression,
+		InsecureSkipVerify: !cfg.Security.VerifyServerCertificate,
+	}
+}
+
+// currentUsername returns the logged in user: USERNAME on Windows, USER on Linux
+func currentUsername() string {
+	if name := os.Getenv("USERNAME"); name != "" {
+		return name
+	}
+	return os.Getenv("USER")
+}
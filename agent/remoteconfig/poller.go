@@ -0,0 +1,155 @@
+// Package remoteconfig pulls the per-computer config from the server and
+// hands changes to the agent for hot reload.
+package remoteconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/config"
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"go.uber.org/zap"
+)
+
+var configLog = logger.For("remoteconfig")
+
+const (
+	configEndpoint  = "/api/agent/config"
+	appliedEndpoint = "/api/agent/config/applied"
+)
+
+// ApplyFunc applies a new remote config. A returned error is reported to the
+// server and the config is fetched and applied again on the next poll.
+type ApplyFunc func(rc config.RemoteConfig) error
+
+// Poller periodically fetches the remote config using ETags
+type Poller struct {
+	client       *httpclient.Client
+	computerName string
+	interval     time.Duration
+	apply        ApplyFunc
+
+	mu      sync.RWMutex
+	etag    string
+	applied string
+}
+
+// New creates a poller for the given computer
+func New(client *httpclient.Client, computerName string, interval time.Duration, apply ApplyFunc) *Poller {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return &Poller{
+		client:       client,
+		computerName: computerName,
+		interval:     interval,
+		apply:        apply,
+	}
+}
+
+// Run polls immediately and then every interval until ctx is cancelled
+func (p *Poller) Run(ctx context.Context) {
+	configLog.Info("Polling remote config", zap.Duration("interval", p.interval))
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			configLog.Warn("Remote config poll failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the config once and applies it if the version changed
+func (p *Poller) Poll(ctx context.Context) error {
+	p.mu.RLock()
+	etag, applied := p.etag, p.applied
+	p.mu.RUnlock()
+
+	var rc config.RemoteConfig
+	endpoint := configEndpoint + "?computer_name=" + url.QueryEscape(p.computerName)
+	newETag, err := p.client.GetJSON(ctx, endpoint, etag, &rc)
+	if errors.Is(err, httpclient.ErrNotModified) {
+		return nil
+	}
+	if errors.Is(err, httpclient.ErrNoContent) {
+		return p.unconfigured()
+	}
+	if err != nil {
+		return fmt.Errorf("fetch failed: %w", err)
+	}
+
+	if rc.Version != "" && rc.Version == applied {
+		p.setState(newETag, applied)
+		return nil
+	}
+
+	configLog.Info("Applying remote config", zap.String("version", rc.Version))
+	applyErr := p.apply(rc)
+	if applyErr == nil {
+		p.setState(newETag, rc.Version)
+	} else {
+		configLog.Error("Failed to apply remote config", zap.String("version", rc.Version), zap.Error(applyErr))
+	}
+
+	p.report(ctx, rc.Version, applyErr)
+	return nil
+}
+
+// unconfigured handles a computer without a config on the server: the local
+// config stays in effect, and is restored if a remote one was applied before
+func (p *Poller) unconfigured() error {
+	p.mu.RLock()
+	applied := p.applied
+	p.mu.RUnlock()
+	if applied == "" {
+		return nil
+	}
+
+	configLog.Info("Remote config removed, restoring local config", zap.String("version", applied))
+	if err := p.apply(config.RemoteConfig{}); err != nil {
+		return fmt.Errorf("failed to restore local config: %w", err)
+	}
+	p.setState("", "")
+	return nil
+}
+
+// AppliedVersion returns the last successfully applied version ("" before the first one)
+func (p *Poller) AppliedVersion() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.applied
+}
+
+func (p *Poller) setState(etag, applied string) {
+	p.mu.Lock()
+	p.etag = etag
+	p.applied = applied
+	p.mu.Unlock()
+}
+
+// report tells the server which version is now running
+func (p *Poller) report(ctx context.Context, version string, applyErr error) {
+	payload := map[string]string{
+		"computer_name": p.computerName,
+		"version":       version,
+	}
+	if applyErr != nil {
+		payload["error"] = applyErr.Error()
+	}
+	if err := p.client.PostJSON(ctx, appliedEndpoint, payload); err != nil {
+		configLog.Warn("Failed to report remote config version", zap.String("version", version), zap.Error(err))
+	}
+}
@@ -0,0 +1,188 @@
+package remoteconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ctolnik/Office-Monitor/agent/config"
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+)
+
+// configServer serves a remote config with ETag support and records reports
+type configServer struct {
+	mu sync.Mutex
+	// unconfigured answers 204 like the server for a computer without a config
+	unconfigured bool
+	rc           config.RemoteConfig
+	gets         int
+	reports      []map[string]string
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case configEndpoint:
+		s.gets++
+		if s.unconfigured {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		etag := `"` + s.rc.Version + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		json.NewEncoder(w).Encode(s.rc)
+	case appliedEndpoint:
+		var report map[string]string
+		json.NewDecoder(r.Body).Decode(&report)
+		s.reports = append(s.reports, report)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPollAppliesOnlyChangedVersions(t *testing.T) {
+	srv := &configServer{}
+	srv.rc.Version = "v1"
+	srv.rc.Screenshots.Enabled = true
+	srv.rc.Screenshots.IntervalMinutes = 10
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var applied []config.RemoteConfig
+	p := New(httpclient.NewClient(httpclient.Config{ServerURL: ts.URL}), "PC-01", 0,
+		func(rc config.RemoteConfig) error {
+			applied = append(applied, rc)
+			return nil
+		})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := p.Poll(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(applied) != 1 || p.AppliedVersion() != "v1" || applied[0].Screenshots.IntervalMinutes != 10 {
+		t.Fatalf("expected v1 applied once, got %+v (version %q)", applied, p.AppliedVersion())
+	}
+
+	srv.mu.Lock()
+	srv.rc.Version = "v2"
+	srv.rc.Keylogger.Enabled = true
+	srv.mu.Unlock()
+
+	if err := p.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || p.AppliedVersion() != "v2" || !applied[1].Keylogger.Enabled {
+		t.Fatalf("expected v2 applied, got %+v", applied)
+	}
+	if len(srv.reports) != 2 || srv.reports[1]["version"] != "v2" || srv.reports[1]["computer_name"] != "PC-01" {
+		t.Fatalf("unexpected reports: %+v", srv.reports)
+	}
+}
+
+func TestPollReportsApplyErrorAndRetries(t *testing.T) {
+	srv := &configServer{}
+	srv.rc.Version = "v1"
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	fail := true
+	p := New(httpclient.NewClient(httpclient.Config{ServerURL: ts.URL}), "PC-01", 0,
+		func(rc config.RemoteConfig) error {
+			if fail {
+				return errors.New("keylogger failed to start")
+			}
+			return nil
+		})
+
+	ctx := context.Background()
+	p.Poll(ctx)
+	if p.AppliedVersion() != "" || len(srv.reports) != 1 || srv.reports[0]["error"] == "" {
+		t.Fatalf("failed apply must be reported and not recorded: %q %+v", p.AppliedVersion(), srv.reports)
+	}
+
+	fail = false
+	p.Poll(ctx)
+	if p.AppliedVersion() != "v1" {
+		t.Fatalf("failed version must be retried, applied %q", p.AppliedVersion())
+	}
+}
+
+func TestWithRemoteOverridesLocalConfig(t *testing.T) {
+	local := &config.Config{}
+	local.Screenshots.IntervalMinutes = 15
+	local.Screenshots.Quality = 75
+	local.FileMonitoring.LargeCopyThresholdMB = 100
+
+	var rc config.RemoteConfig
+	rc.Version = "v1"
+	rc.Screenshots.Enabled = true
+	rc.FileMonitoring.Enabled = true
+	rc.FileMonitoring.LargeCopyThresholdMB = 50
+
+	eff := local.WithRemote(rc)
+	if !eff.Screenshots.Enabled || eff.Screenshots.IntervalMinutes != 15 || eff.Screenshots.Quality != 75 {
+		t.Fatalf("unexpected screenshots config: %+v", eff.Screenshots)
+	}
+	if eff.FileMonitoring.LargeCopyThresholdMB != 50 || local.FileMonitoring.LargeCopyThresholdMB != 100 {
+		t.Fatal("WithRemote must not modify the local config")
+	}
+}
+
+func TestUnconfiguredComputerKeepsLocalConfig(t *testing.T) {
+	srv := &configServer{unconfigured: true}
+	srv.rc.Version = "v1"
+	srv.rc.Keylogger.Enabled = true
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	local := &config.Config{}
+	local.Screenshots.Enabled = true
+	local.USBMonitoring.Enabled = false
+	local.FileMonitoring.Enabled = false
+	effective := local
+	p := New(httpclient.NewClient(httpclient.Config{ServerURL: ts.URL}), "PC-01", 0,
+		func(rc config.RemoteConfig) error {
+			effective = local.WithRemote(rc)
+			return nil
+		})
+
+	ctx := context.Background()
+	if err := p.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if effective != local || p.AppliedVersion() != "" || len(srv.reports) != 0 {
+		t.Fatalf("unconfigured computer must keep the local config, got %+v", effective)
+	}
+
+	// An admin configures the computer, then deletes its config again
+	srv.mu.Lock()
+	srv.unconfigured = false
+	srv.mu.Unlock()
+	p.Poll(ctx)
+	if !effective.Keylogger.Enabled || effective.Screenshots.Enabled {
+		t.Fatalf("remote config not applied: %+v", effective)
+	}
+
+	srv.mu.Lock()
+	srv.unconfigured = true
+	srv.mu.Unlock()
+	if err := p.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if effective.Keylogger.Enabled || !effective.Screenshots.Enabled || effective.USBMonitoring.Enabled ||
+		effective.FileMonitoring.Enabled || p.AppliedVersion() != "" {
+		t.Fatalf("local monitor settings not restored: %+v", effective)
+	}
+}
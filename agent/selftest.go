@@ -0,0 +1,169 @@
+//go:build windows || linux
+// +build windows linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/config"
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+)
+
+const (
+	checkPass = "PASS"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// checkResult is one line of the self-test report
+type checkResult struct {
+	name   string
+	status string
+	detail string
+}
+
+// runSelfTest checks the config and the server connection, writes a report
+// to w and returns the process exit code: 0 when nothing failed
+func runSelfTest(configPath string, w io.Writer) int {
+	fmt.Fprintf(w, "Employee Monitoring Agent v%s self-test\n\n", version)
+
+	var results []checkResult
+	cfg, err := config.Load(configPath)
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		// One line per invalid value
+		for _, fe := range verr.Errors {
+			results = append(results, checkResult{"config", checkFail, fe.Error()})
+		}
+	} else if err != nil {
+		results = append(results, checkResult{"config", checkFail, err.Error()})
+	} else {
+		results = append(results, checkResult{"config", checkPass, configPath})
+		results = append(results, configChecks(cfg)...)
+		results = append(results, pingCheck(cfg))
+	}
+
+	failed := 0
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %-20s %s\n", r.status, r.name, r.detail)
+		if r.status == checkFail {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "\n%d check(s) failed\n", failed)
+		return 1
+	}
+	fmt.Fprintln(w, "\nAll checks passed")
+	return 0
+}
+
+// configChecks validates the loaded config without contacting the server
+func configChecks(cfg *config.Config) []checkResult {
+	var results []checkResult
+
+	if err := checkServerURL(cfg.Agent.Server.URL); err != nil {
+		results = append(results, checkResult{"server url", checkFail, err.Error()})
+	} else {
+		results = append(results, checkResult{"server url", checkPass, cfg.Agent.Server.URL})
+	}
+
+	if cfg.Agent.APIKey == "" {
+		results = append(results, checkResult{"api key", checkFail, "agent.api_key is empty"})
+	} else {
+		results = append(results, checkResult{"api key", checkPass, "present"})
+	}
+
+	if err := checkWritableDir(cfg.Buffer.Dir); err != nil {
+		results = append(results, checkResult{"buffer dir", checkFail, err.Error()})
+	} else {
+		results = append(results, checkResult{"buffer dir", checkPass, cfg.Buffer.Dir})
+	}
+
+	if !cfg.FileMonitoring.Enabled {
+		results = append(results, checkResult{"monitored locations", checkSkip, "file monitoring disabled"})
+	} else if len(cfg.FileMonitoring.MonitoredLocations) == 0 {
+		results = append(results, checkResult{"monitored locations", checkFail, "no locations configured"})
+	} else {
+		for _, location := range cfg.FileMonitoring.MonitoredLocations {
+			// Expanded the same way the file monitor does
+			path := os.ExpandEnv(location)
+			if info, err := os.Stat(path); err != nil {
+				results = append(results, checkResult{"monitored location", checkFail, err.Error()})
+			} else if !info.IsDir() {
+				results = append(results, checkResult{"monitored location", checkFail, path + " is not a directory"})
+			} else {
+				results = append(results, checkResult{"monitored location", checkPass, path})
+			}
+		}
+	}
+
+	if !cfg.USBMonitoring.Enabled || !cfg.USBMonitoring.ShadowCopyEnabled {
+		results = append(results, checkResult{"shadow copy dest", checkSkip, "shadow copy disabled"})
+	} else if err := checkWritableDir(cfg.USBMonitoring.ShadowCopyDest); err != nil {
+		results = append(results, checkResult{"shadow copy dest", checkFail, err.Error()})
+	} else {
+		results = append(results, checkResult{"shadow copy dest", checkPass, cfg.USBMonitoring.ShadowCopyDest})
+	}
+
+	return results
+}
+
+// pingCheck asks the server's health endpoint
+func pingCheck(cfg *config.Config) checkResult {
+	if checkServerURL(cfg.Agent.Server.URL) != nil {
+		return checkResult{"server ping", checkSkip, "invalid server url"}
+	}
+
+	// Same TLS and timeout settings as the running agent, so the check fails
+	// where the agent would
+	client := httpclient.NewClient(httpClientConfig(cfg))
+
+	start := time.Now()
+	if err := client.Ping(context.Background()); err != nil {
+		return checkResult{"server ping", checkFail, err.Error()}
+	}
+	return checkResult{"server ping", checkPass, fmt.Sprintf("reachable in %v", time.Since(start).Round(time.Millisecond))}
+}
+
+func checkServerURL(raw string) error {
+	if raw == "" {
+		return errors.New("agent.server.url is empty")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s: missing host", raw)
+	}
+	return nil
+}
+
+// checkWritableDir creates dir if needed and writes a probe file into it
+func checkWritableDir(dir string) error {
+	if dir == "" {
+		return errors.New("path is empty")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	probe, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,98 @@
+//go:build windows || linux
+// +build windows linux
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSelfTestPasses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := writeConfig(t, `
+agent:
+  api_key: secret
+  server:
+    url: `+server.URL+`
+file_monitoring:
+  enabled: true
+  monitored_locations: ["`+dir+`"]
+buffer:
+  dir: `+filepath.Join(dir, "buffer")+`
+`)
+
+	var out strings.Builder
+	if code := runSelfTest(path, &out); code != 0 {
+		t.Fatalf("exit code %d, report:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "[PASS] server ping") {
+		t.Errorf("ping not reported:\n%s", out.String())
+	}
+}
+
+func TestSelfTestReportsFailures(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, `
+agent:
+  server:
+    url: "http://127.0.0.1:1"
+    timeout_seconds: 1
+file_monitoring:
+  enabled: true
+  large_copy_file_count: 10
+  monitored_locations: ["`+filepath.Join(dir, "missing")+`"]
+buffer:
+  dir: `+filepath.Join(dir, "buffer")+`
+`)
+
+	var out strings.Builder
+	if code := runSelfTest(path, &out); code != 1 {
+		t.Fatalf("exit code %d, want 1", code)
+	}
+	report := out.String()
+	for _, want := range []string{"[FAIL] api key", "[FAIL] monitored location", "[FAIL] server ping", "3 check(s) failed"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report misses %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestSelfTestListsInvalidValues(t *testing.T) {
+	path := writeConfig(t, `
+agent:
+  server:
+    url: "ftp://"
+screenshots:
+  quality: 150
+`)
+
+	var out strings.Builder
+	if code := runSelfTest(path, &out); code != 1 {
+		t.Fatalf("exit code %d, want 1", code)
+	}
+	report := out.String()
+	for _, want := range []string{"[FAIL] config               agent.server.url", "[FAIL] config               screenshots.quality"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report misses %q:\n%s", want, report)
+		}
+	}
+}
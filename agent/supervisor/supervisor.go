@@ -0,0 +1,425 @@
+// Package supervisor runs the agent's monitors. A monitor that panics, reports
+// a crash or fails its health check is stopped and replaced by a new instance
+// after an exponential backoff; the state of every monitor is reported in the
+// heartbeat.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"go.uber.org/zap"
+)
+
+var supervisorLog = logger.For("supervisor")
+
+// Monitor is a component the supervisor keeps running
+type Monitor interface {
+	Name() string
+	// Start launches the monitor. ctx carries the crash reporter used by
+	// Recover and ReportCrash and is cancelled once the monitor is stopped.
+	Start(ctx context.Context) error
+	Stop()
+	// Health returns an error while the monitor runs but does not work
+	Health() error
+}
+
+// Spec creates fresh instances of a monitor; a stopped monitor is never
+// started again
+type Spec struct {
+	Name string
+	New  func() Monitor
+}
+
+// Monitor states
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateStopped    = "stopped"
+)
+
+// Status is the state of one monitor
+type Status struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// Options configures a Supervisor
+type Options struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// A monitor that ran this long before crashing restarts after InitialBackoff again
+	StableAfter    time.Duration
+	HealthInterval time.Duration
+	// OnStart is called after every successful start, e.g. to re-apply throttling
+	OnStart func(Monitor)
+}
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	defaultStableAfter    = time.Minute
+	defaultHealthInterval = 30 * time.Second
+)
+
+type entry struct {
+	spec     Spec
+	mon      Monitor // nil while waiting for a restart
+	cancel   context.CancelFunc
+	gen      int // bumped on every start so late crash reports are ignored
+	state    string
+	restarts int
+	lastErr  string
+	since    time.Time
+	started  time.Time
+	backoff  time.Duration
+	timer    *time.Timer
+	// starting is set while Start runs; a crash reported in that window
+	// is kept in earlyCrash
+	starting   bool
+	earlyCrash error
+}
+
+// Supervisor owns a set of monitors
+type Supervisor struct {
+	ctx  context.Context
+	opts Options
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   []string // start order; Shutdown stops in reverse
+	closed  bool
+}
+
+// New creates a supervisor. Monitor contexts derive from ctx.
+func New(ctx context.Context, opts Options) *Supervisor {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaultInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.StableAfter <= 0 {
+		opts.StableAfter = defaultStableAfter
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = defaultHealthInterval
+	}
+	return &Supervisor{ctx: ctx, opts: opts, entries: make(map[string]*entry)}
+}
+
+// Add starts a monitor, replacing a running one with the same name. A failed
+// start is returned and retried with backoff like a crash.
+func (s *Supervisor) Add(spec Spec) error {
+	s.Remove(spec.Name)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("supervisor is shut down")
+	}
+	e := &entry{spec: spec, backoff: s.opts.InitialBackoff}
+	s.entries[spec.Name] = e
+	s.order = append(s.order, spec.Name)
+	s.mu.Unlock()
+
+	return s.start(spec.Name, 0)
+}
+
+// Remove stops a monitor and forgets it
+func (s *Supervisor) Remove(name string) {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.entries, name)
+	s.order = remove(s.order, name)
+	mon := s.detach(e)
+	s.mu.Unlock()
+
+	if mon != nil {
+		mon.Stop()
+	}
+}
+
+// Running returns the monitors currently running
+func (s *Supervisor) Running() []Monitor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Monitor, 0, len(s.order))
+	for _, name := range s.order {
+		if e := s.entries[name]; e.mon != nil {
+			out = append(out, e.mon)
+		}
+	}
+	return out
+}
+
+// Status returns the state of every monitor, sorted by name
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, Status{
+			Name:      e.spec.Name,
+			State:     e.state,
+			Restarts:  e.restarts,
+			LastError: e.lastErr,
+			Since:     e.since,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Run checks the health of the running monitors until ctx is cancelled
+func (s *Supervisor) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkHealth()
+		}
+	}
+}
+
+// Shutdown stops the monitors one by one in reverse start order. Monitors
+// not stopped when ctx expires are abandoned and named in the error.
+func (s *Supervisor) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	var mons []Monitor
+	for i := len(s.order) - 1; i >= 0; i-- {
+		if mon := s.detach(s.entries[s.order[i]]); mon != nil {
+			mons = append(mons, mon)
+		}
+	}
+	s.mu.Unlock()
+
+	var stuck []string
+	for _, mon := range mons {
+		// Past the deadline the rest is left running rather than stopped
+		// concurrently with whatever the caller shuts down next
+		if ctx.Err() != nil {
+			stuck = append(stuck, mon.Name())
+			continue
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer func() {
+				if r := recover(); r != nil {
+					supervisorLog.Error("Monitor panicked while stopping", zap.String("monitor", mon.Name()), zap.Any("panic", r))
+				}
+			}()
+			mon.Stop()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			stuck = append(stuck, mon.Name())
+		}
+	}
+
+	if len(stuck) > 0 {
+		return fmt.Errorf("monitors did not stop in time: %s", strings.Join(stuck, ", "))
+	}
+	return nil
+}
+
+// start creates and starts a new instance unless the entry was replaced or
+// a newer generation already runs
+func (s *Supervisor) start(name string, gen int) error {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if !ok || s.closed || e.gen != gen || e.mon != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	e.gen++
+	gen = e.gen
+	e.starting, e.earlyCrash = true, nil
+	ctx, cancel := context.WithCancel(withReporter(s.ctx, func(err error) { s.crashed(name, gen, err) }))
+	s.mu.Unlock()
+
+	mon := e.spec.New()
+	err := safeStart(ctx, mon)
+
+	s.mu.Lock()
+	e.starting = false
+	if cur, ok := s.entries[name]; !ok || cur != e || e.gen != gen || s.closed {
+		// Removed while starting
+		s.mu.Unlock()
+		cancel()
+		if err == nil {
+			mon.Stop()
+		}
+		return err
+	}
+	if err == nil && e.earlyCrash != nil {
+		err, e.earlyCrash = e.earlyCrash, nil
+		go mon.Stop()
+	}
+	if err != nil {
+		cancel()
+		s.scheduleRestart(e, err)
+		s.mu.Unlock()
+		return err
+	}
+	e.mon, e.cancel = mon, cancel
+	e.state, e.since, e.started = StateRunning, time.Now(), time.Now()
+	s.mu.Unlock()
+
+	if s.opts.OnStart != nil {
+		s.opts.OnStart(mon)
+	}
+	return nil
+}
+
+// crashed replaces a monitor that reported a crash
+func (s *Supervisor) crashed(name string, gen int, err error) {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if !ok || e.gen != gen || s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if e.mon == nil {
+		// Still starting; start picks the crash up
+		if e.starting {
+			e.earlyCrash = err
+		}
+		s.mu.Unlock()
+		return
+	}
+	supervisorLog.Error("Monitor crashed", zap.String("monitor", name), zap.Error(err))
+	if time.Since(e.started) >= s.opts.StableAfter {
+		e.backoff = s.opts.InitialBackoff
+	}
+	mon := s.detach(e)
+	s.scheduleRestart(e, err)
+	s.mu.Unlock()
+
+	// The crashed goroutine may still hold locks Stop needs
+	go func() {
+		defer func() { recover() }()
+		mon.Stop()
+	}()
+}
+
+func (s *Supervisor) checkHealth() {
+	type check struct {
+		name string
+		gen  int
+		mon  Monitor
+	}
+	s.mu.Lock()
+	checks := make([]check, 0, len(s.entries))
+	for name, e := range s.entries {
+		if e.mon != nil {
+			checks = append(checks, check{name, e.gen, e.mon})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range checks {
+		if err := c.mon.Health(); err != nil {
+			s.crashed(c.name, c.gen, fmt.Errorf("unhealthy: %w", err))
+		}
+	}
+}
+
+// scheduleRestart records the failure and starts a new instance after the
+// backoff, which doubles up to MaxBackoff. Called with s.mu held.
+func (s *Supervisor) scheduleRestart(e *entry, err error) {
+	delay := e.backoff
+	e.backoff = min(e.backoff*2, s.opts.MaxBackoff)
+	e.state, e.since, e.lastErr = StateRestarting, time.Now(), err.Error()
+	e.restarts++
+
+	name, gen := e.spec.Name, e.gen
+	supervisorLog.Warn("Restarting monitor", zap.String("monitor", name), zap.Duration("backoff", delay), zap.Int("restarts", e.restarts))
+	e.timer = time.AfterFunc(delay, func() { s.start(name, gen) })
+}
+
+// detach takes the running instance out of the entry. Called with s.mu held.
+func (s *Supervisor) detach(e *entry) Monitor {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	mon := e.mon
+	e.mon = nil
+	e.state, e.since = StateStopped, time.Now()
+	return mon
+}
+
+// safeStart turns a panic in Start into an error
+func safeStart(ctx context.Context, mon Monitor) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in Start: %v", r)
+		}
+	}()
+	return mon.Start(ctx)
+}
+
+func remove(names []string, name string) []string {
+	out := names[:0]
+	for _, n := range names {
+		if n != name {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+type reporterKey struct{}
+
+func withReporter(ctx context.Context, report func(error)) context.Context {
+	return context.WithValue(ctx, reporterKey{}, report)
+}
+
+// ReportCrash tells the supervisor that the monitor started with ctx stopped
+// working. Without a supervisor the error is only logged.
+func ReportCrash(ctx context.Context, err error) {
+	if ctx != nil {
+		if report, ok := ctx.Value(reporterKey{}).(func(error)); ok {
+			report(err)
+			return
+		}
+	}
+	supervisorLog.Error("Monitor crashed outside the supervisor", zap.Error(err))
+}
+
+// Recover must be deferred at the top of every monitor goroutine. It turns a
+// panic into a crash report instead of taking the agent down.
+func Recover(ctx context.Context) {
+	if r := recover(); r != nil {
+		ReportCrash(ctx, fmt.Errorf("panic: %v\n%s", r, debug.Stack()))
+	}
+}
@@ -0,0 +1,158 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeMonitor struct {
+	name     string
+	panicNow chan struct{}
+	block    chan struct{} // Stop waits on it when set
+	health   atomic.Value  // error
+	stopped  atomic.Bool
+}
+
+func (m *fakeMonitor) Name() string { return m.name }
+
+func (m *fakeMonitor) Start(ctx context.Context) error {
+	go func() {
+		defer Recover(ctx)
+		select {
+		case <-m.panicNow:
+			panic("boom")
+		case <-ctx.Done():
+		}
+	}()
+	return nil
+}
+
+func (m *fakeMonitor) Stop() {
+	if m.block != nil {
+		<-m.block
+	}
+	m.stopped.Store(true)
+}
+
+func (m *fakeMonitor) Health() error {
+	if err, ok := m.health.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// factory hands out fake monitors and remembers them
+type factory struct {
+	mu        sync.Mutex
+	instances []*fakeMonitor
+	started   chan *fakeMonitor
+}
+
+func newFactory() *factory {
+	return &factory{started: make(chan *fakeMonitor, 10)}
+}
+
+func (f *factory) spec(name string) Spec {
+	return Spec{Name: name, New: func() Monitor {
+		m := &fakeMonitor{name: name, panicNow: make(chan struct{})}
+		f.mu.Lock()
+		f.instances = append(f.instances, m)
+		f.mu.Unlock()
+		return m
+	}}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestSupervisor(f *factory) *Supervisor {
+	return New(context.Background(), Options{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+		HealthInterval: 10 * time.Millisecond,
+		OnStart: func(m Monitor) {
+			f.started <- m.(*fakeMonitor)
+		},
+	})
+}
+
+func TestPanicRestartsMonitor(t *testing.T) {
+	f := newFactory()
+	s := newTestSupervisor(f)
+	if err := s.Add(f.spec("usb")); err != nil {
+		t.Fatal(err)
+	}
+	first := <-f.started
+
+	close(first.panicNow)
+	second := <-f.started
+	if second == first {
+		t.Fatal("crashed instance was started again")
+	}
+	waitFor(t, "crashed instance to stop", first.stopped.Load)
+
+	st := s.Status()
+	if len(st) != 1 || st[0].State != StateRunning || st[0].Restarts != 1 || !strings.Contains(st[0].LastError, "panic: boom") {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestUnhealthyMonitorIsReplaced(t *testing.T) {
+	f := newFactory()
+	s := newTestSupervisor(f)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	s.Add(f.spec("keylogger"))
+	first := <-f.started
+	first.health.Store(errors.New("hook not installed"))
+
+	second := <-f.started
+	if second == first {
+		t.Fatal("unhealthy instance kept")
+	}
+	if st := s.Status(); !strings.Contains(st[0].LastError, "unhealthy: hook not installed") {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestShutdownStopsInReverseOrderWithDeadline(t *testing.T) {
+	f := newFactory()
+	s := newTestSupervisor(f)
+	s.Add(f.spec("activity"))
+	activity := <-f.started
+	s.Add(f.spec("screenshots"))
+	screenshots := <-f.started
+
+	// The last started monitor hangs in Stop and must not hold up the rest
+	screenshots.block = make(chan struct{})
+	defer close(screenshots.block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	if err == nil || !strings.Contains(err.Error(), "screenshots") {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if activity.stopped.Load() {
+		t.Error("activity stopped although the deadline passed first")
+	}
+
+	if err := s.Add(f.spec("usb")); err == nil {
+		t.Error("monitor added after shutdown")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build windows || linux
+// +build windows linux
+
+package main
+
+import (
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/config"
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+	"github.com/ctolnik/Office-Monitor/agent/updater"
+)
+
+// newUpdater creates the auto-updater from the auto_update section
+func newUpdater(cfg *config.Config, client *httpclient.Client, restart func()) (*updater.Updater, error) {
+	publicKey, err := updater.ParsePublicKey(cfg.AutoUpdate.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return updater.New(updater.Config{
+		Client:         client,
+		UpdateURL:      cfg.AutoUpdate.UpdateURL,
+		PublicKey:      publicKey,
+		ComputerName:   cfg.Agent.ComputerName,
+		Version:        version,
+		Interval:       time.Duration(cfg.AutoUpdate.CheckIntervalHours) * time.Hour,
+		ConfirmTimeout: time.Duration(cfg.AutoUpdate.ConfirmTimeoutMinutes) * time.Minute,
+		Restart:        restart,
+	})
+}
@@ -0,0 +1,52 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Manifest describes the build the server wants the agent to run
+type Manifest struct {
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Signature string `json:"signature"`
+	Channel   string `json:"channel"`
+	URL       string `json:"url"`
+}
+
+// message is the byte string the server signs. It must match the server's
+// release.Message.
+func (m Manifest) message() []byte {
+	return []byte(fmt.Sprintf("officemonitor-agent\n%s\n%s\n%s\n%s\n%d\n",
+		m.Version, m.OS, m.Arch, strings.ToLower(m.SHA256), m.Size))
+}
+
+// Verify checks the ed25519 signature of the manifest
+func (m Manifest) Verify(pub ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	if !ed25519.Verify(pub, m.message(), sig) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// ParsePublicKey decodes the base64 key from auto_update.public_key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not base64: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
@@ -0,0 +1,78 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// Install states kept in the state file
+const (
+	statePending    = "pending"   // swapped in, waiting for a heartbeat
+	stateConfirmed  = "confirmed" // new version heartbeated
+	stateRolledBack = "rolled_back"
+)
+
+// maxBadVersions bounds the list of versions that will not be installed again
+const maxBadVersions = 10
+
+// state survives the restart into a new binary
+type state struct {
+	Status      string    `json:"status"`
+	FromVersion string    `json:"from_version"`
+	Version     string    `json:"version"`
+	Starts      int       `json:"starts"`
+	InstalledAt time.Time `json:"installed_at"`
+	Error       string    `json:"error,omitempty"`
+	// Reported is set once the server acknowledged the current status
+	Reported    bool     `json:"reported"`
+	BadVersions []string `json:"bad_versions,omitempty"`
+}
+
+func loadState(path string) (*state, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &state{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// save writes the state atomically
+func (s *state) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *state) isBad(version string) bool {
+	for _, v := range s.BadVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *state) markBad(version string) {
+	if s.isBad(version) {
+		return
+	}
+	s.BadVersions = append(s.BadVersions, version)
+	if len(s.BadVersions) > maxBadVersions {
+		s.BadVersions = s.BadVersions[len(s.BadVersions)-maxBadVersions:]
+	}
+}
@@ -0,0 +1,508 @@
+// Package updater installs signed agent builds published by the server. A
+// new binary is swapped in next to the old one and rolled back when it does
+// not heartbeat within the confirm timeout or keeps failing to start.
+package updater
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"go.uber.org/zap"
+)
+
+var updateLog = logger.For("updater")
+
+const statusEndpoint = "/api/agent/update/status"
+
+// Statuses reported to the server
+const (
+	StatusInstalled  = "installed"
+	StatusConfirmed  = "confirmed"
+	StatusRolledBack = "rolled_back"
+	StatusFailed     = "failed"
+)
+
+// maxStarts is how often an unconfirmed version may start before it is rolled
+// back without waiting for the confirm timeout
+const maxStarts = 3
+
+// Config configures an Updater
+type Config struct {
+	Client       *httpclient.Client
+	UpdateURL    string
+	PublicKey    ed25519.PublicKey
+	ComputerName string
+	// Version is the version of the running binary
+	Version string
+	// Executable is the running binary; os.Executable() if empty
+	Executable     string
+	Interval       time.Duration
+	ConfirmTimeout time.Duration
+	// Restart is called once a new binary is in place (after an install or a
+	// rollback). The agent should shut down and call Respawn.
+	Restart func()
+}
+
+// Updater checks for new builds and manages the install state
+type Updater struct {
+	cfg       Config
+	updateURL *url.URL
+	exe       string
+	statePath string
+
+	mu        sync.Mutex
+	state     *state
+	confirmed chan struct{}
+}
+
+// New loads the install state kept next to the executable
+func New(cfg Config) (*Updater, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.ConfirmTimeout <= 0 {
+		cfg.ConfirmTimeout = 10 * time.Minute
+	}
+	if cfg.Restart == nil {
+		return nil, errors.New("restart callback is required")
+	}
+
+	updateURL, err := url.Parse(cfg.UpdateURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update url: %w", err)
+	}
+
+	exe, err := resolveExecutable(cfg.Executable)
+	if err != nil {
+		return nil, err
+	}
+
+	statePath := statePathFor(exe)
+	st, err := loadState(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", statePath, err)
+	}
+
+	return &Updater{
+		cfg:       cfg,
+		updateURL: updateURL,
+		exe:       exe,
+		statePath: statePath,
+		state:     st,
+		confirmed: make(chan struct{}),
+	}, nil
+}
+
+// resolveExecutable returns exe, or the running binary if empty, with
+// symlinks resolved
+func resolveExecutable(exe string) (string, error) {
+	if exe == "" {
+		var err error
+		if exe, err = os.Executable(); err != nil {
+			return "", fmt.Errorf("failed to locate executable: %w", err)
+		}
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+// statePathFor is the install state file kept next to the executable
+func statePathFor(exe string) string {
+	return filepath.Join(filepath.Dir(exe), "update-state.json")
+}
+
+// CountStart records a start of a version that waits for confirmation and
+// rolls it back once it started more than maxStarts times. The agent calls it
+// first thing, before loading the config, so a build that exits during
+// startup is rolled back too. exe is the running binary, os.Executable() if
+// empty. When it reports a rollback, the caller should start exe, which now
+// holds the previous version, and exit.
+func CountStart(exe, version string) (rolledBack bool, err error) {
+	if exe, err = resolveExecutable(exe); err != nil {
+		return false, err
+	}
+	statePath := statePathFor(exe)
+	s, err := loadState(statePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", statePath, err)
+	}
+	if s.Status != statePending || s.Version != version {
+		return false, nil
+	}
+
+	s.Starts++
+	if err := s.save(statePath); err != nil {
+		return false, fmt.Errorf("failed to save update state: %w", err)
+	}
+	if s.Starts <= maxStarts {
+		return false, nil
+	}
+	if err := restorePrevious(exe, s, statePath, fmt.Sprintf("started %d times without a heartbeat", s.Starts-1)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Executable is the binary to start after Restart
+func (u *Updater) Executable() string {
+	return u.exe
+}
+
+// Run finishes a pending install, then checks for updates every interval
+// until ctx is cancelled
+func (u *Updater) Run(ctx context.Context) {
+	pending, ok := u.resume(ctx)
+	if !ok {
+		return
+	}
+	if pending {
+		select {
+		case <-ctx.Done():
+			return
+		case <-u.confirmed:
+			u.reportState(ctx)
+		case <-time.After(u.cfg.ConfirmTimeout):
+			u.rollback(fmt.Sprintf("no heartbeat within %v", u.cfg.ConfirmTimeout))
+			return
+		}
+	}
+
+	updateLog.Info("Checking for updates", zap.Duration("interval", u.cfg.Interval))
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.Check(ctx); err != nil && ctx.Err() == nil {
+			updateLog.Warn("Update check failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Confirm marks a freshly installed version as good. It is called after every
+// successful heartbeat and does nothing unless an install is pending.
+func (u *Updater) Confirm() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.state.Status != statePending || u.state.Version != u.cfg.Version {
+		return
+	}
+	u.state.Status = stateConfirmed
+	u.state.Reported = false
+	if err := u.state.save(u.statePath); err != nil {
+		updateLog.Error("Failed to save update state", zap.Error(err))
+	}
+	os.Remove(u.exe + ".old")
+	updateLog.Info("Version confirmed", zap.String("version", u.cfg.Version))
+	close(u.confirmed)
+}
+
+// resume handles the state left by the previous run. It reports whether the
+// running version still waits for confirmation, and false as ok when the
+// agent is being rolled back.
+func (u *Updater) resume(ctx context.Context) (pending, ok bool) {
+	u.mu.Lock()
+	s := u.state
+	if s.Status == statePending {
+		if s.Version == u.cfg.Version {
+			// Starts were counted by CountStart before the config was loaded
+			starts := s.Starts
+			u.mu.Unlock()
+
+			if starts > maxStarts {
+				u.rollback(fmt.Sprintf("started %d times without a heartbeat", starts-1))
+				return false, false
+			}
+			updateLog.Info("Running new version, waiting for a heartbeat to confirm it", zap.String("version", s.Version))
+			return true, true
+		}
+
+		// The previous binary is running again, replaced outside the updater
+		s.Status = stateRolledBack
+		s.Error = fmt.Sprintf("agent started as version %s", u.cfg.Version)
+		s.markBad(s.Version)
+		s.Reported = false
+		if err := s.save(u.statePath); err != nil {
+			updateLog.Error("Failed to save update state", zap.Error(err))
+		}
+	}
+	u.mu.Unlock()
+
+	u.reportState(ctx)
+	return false, true
+}
+
+// Check asks the server for the build of this computer and installs it if
+// it is new. On success Restart has been called.
+func (u *Updater) Check(ctx context.Context) error {
+	m, err := u.fetchManifest(ctx)
+	if err != nil {
+		return fmt.Errorf("check failed: %w", err)
+	}
+	if m == nil || m.Version == u.cfg.Version {
+		return nil
+	}
+
+	u.mu.Lock()
+	bad := u.state.isBad(m.Version)
+	u.mu.Unlock()
+	if bad {
+		updateLog.Info("Skipping version, it was rolled back before", zap.String("version", m.Version))
+		return nil
+	}
+
+	if err := u.verify(m); err != nil {
+		u.report(ctx, u.cfg.Version, m.Version, StatusFailed, err.Error())
+		return fmt.Errorf("rejected version %s: %w", m.Version, err)
+	}
+
+	updateLog.Info("Installing version", zap.String("version", m.Version), zap.String("channel", m.Channel))
+	if err := u.install(ctx, m); err != nil {
+		u.report(ctx, u.cfg.Version, m.Version, StatusFailed, err.Error())
+		return fmt.Errorf("failed to install version %s: %w", m.Version, err)
+	}
+
+	u.report(ctx, u.cfg.Version, m.Version, StatusInstalled, "")
+	updateLog.Info("Version installed, restarting", zap.String("version", m.Version))
+	u.cfg.Restart()
+	return nil
+}
+
+// fetchManifest returns nil when the server has nothing to install
+func (u *Updater) fetchManifest(ctx context.Context) (*Manifest, error) {
+	ref := *u.updateURL
+	q := ref.Query()
+	q.Set("computer_name", u.cfg.ComputerName)
+	q.Set("os", runtime.GOOS)
+	q.Set("arch", runtime.GOARCH)
+	q.Set("version", u.cfg.Version)
+	ref.RawQuery = q.Encode()
+
+	resp, err := u.cfg.Client.Get(ctx, ref.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	var m Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return &m, nil
+}
+
+func (u *Updater) verify(m *Manifest) error {
+	if m.OS != runtime.GOOS || m.Arch != runtime.GOARCH {
+		return fmt.Errorf("build is for %s/%s", m.OS, m.Arch)
+	}
+	if m.Size <= 0 || m.URL == "" {
+		return errors.New("manifest has no download")
+	}
+	return m.Verify(u.cfg.PublicKey)
+}
+
+// install downloads the build next to the executable, checks it against the
+// signed hash and swaps it in, keeping the running binary as <exe>.old
+func (u *Updater) install(ctx context.Context, m *Manifest) error {
+	ref, err := url.Parse(m.URL)
+	if err != nil {
+		return fmt.Errorf("invalid download url: %w", err)
+	}
+
+	newPath := u.exe + ".new"
+	if err := u.download(ctx, u.updateURL.ResolveReference(ref).String(), newPath, m); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	oldPath := u.exe + ".old"
+	os.Remove(oldPath)
+	if err := os.Rename(u.exe, oldPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("failed to move the running binary: %w", err)
+	}
+	if err := os.Rename(newPath, u.exe); err != nil {
+		os.Rename(oldPath, u.exe)
+		os.Remove(newPath)
+		return fmt.Errorf("failed to move the new binary in place: %w", err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	next := *u.state
+	next.Status = statePending
+	next.FromVersion = u.cfg.Version
+	next.Version = m.Version
+	next.Starts = 0
+	next.InstalledAt = time.Now()
+	next.Error = ""
+	next.Reported = false
+	if err := next.save(u.statePath); err != nil {
+		// Without the state the new binary could not be rolled back
+		os.Rename(u.exe, newPath)
+		os.Rename(oldPath, u.exe)
+		os.Remove(newPath)
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	u.state = &next
+	return nil
+}
+
+func (u *Updater) download(ctx context.Context, rawURL, path string, m *Manifest) error {
+	resp, err := u.cfg.Client.Get(ctx, rawURL)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, m.Size+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	if n != m.Size {
+		return fmt.Errorf("downloaded %d bytes, expected %d", n, m.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != strings.ToLower(m.SHA256) {
+		return fmt.Errorf("sha256 mismatch: got %s", sum)
+	}
+	return nil
+}
+
+// rollback restores <exe>.old and restarts into it
+func (u *Updater) rollback(reason string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := restorePrevious(u.exe, u.state, u.statePath, reason); err != nil {
+		updateLog.Error("Cannot roll back", zap.Error(err))
+		return
+	}
+
+	// The previous version reports the rollback once it is running
+	u.cfg.Restart()
+}
+
+// restorePrevious moves exe to <exe>.bad, puts <exe>.old back in its place
+// and records the rollback in s
+func restorePrevious(exe string, s *state, statePath, reason string) error {
+	updateLog.Warn("Rolling back version", zap.String("version", s.Version), zap.String("reason", reason))
+
+	oldPath, badPath := exe+".old", exe+".bad"
+	if _, err := os.Stat(oldPath); err != nil {
+		return fmt.Errorf("previous binary is missing: %w", err)
+	}
+	os.Remove(badPath)
+	if err := os.Rename(exe, badPath); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, exe); err != nil {
+		os.Rename(badPath, exe)
+		return err
+	}
+
+	s.Status = stateRolledBack
+	s.Error = reason
+	s.markBad(s.Version)
+	s.Reported = false
+	if err := s.save(statePath); err != nil {
+		updateLog.Error("Failed to save update state", zap.Error(err))
+	}
+	return nil
+}
+
+// reportState sends the outcome of the last install if the server has not seen it yet
+func (u *Updater) reportState(ctx context.Context) {
+	u.mu.Lock()
+	s := *u.state
+	u.mu.Unlock()
+
+	var status string
+	switch {
+	case s.Reported:
+		return
+	case s.Status == stateConfirmed:
+		status = StatusConfirmed
+	case s.Status == stateRolledBack:
+		status = StatusRolledBack
+	default:
+		return
+	}
+
+	if !u.report(ctx, s.FromVersion, s.Version, status, s.Error) {
+		return
+	}
+	u.mu.Lock()
+	if u.state.Status == s.Status && u.state.Version == s.Version {
+		u.state.Reported = true
+		if err := u.state.save(u.statePath); err != nil {
+			updateLog.Error("Failed to save update state", zap.Error(err))
+		}
+	}
+	u.mu.Unlock()
+}
+
+func (u *Updater) report(ctx context.Context, from, version, status, errMsg string) bool {
+	payload := map[string]string{
+		"computer_name": u.cfg.ComputerName,
+		"from_version":  from,
+		"version":       version,
+		"status":        status,
+	}
+	if errMsg != "" {
+		payload["error"] = errMsg
+	}
+	if err := u.cfg.Client.PostJSON(ctx, statusEndpoint, payload); err != nil {
+		updateLog.Warn("Failed to report update status", zap.String("status", status), zap.String("version", version), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// Respawn starts the binary at path with the arguments of this process. It is
+// called after the agent shut down so the two processes never share the buffer.
+func Respawn(path string) error {
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
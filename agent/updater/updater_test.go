@@ -0,0 +1,290 @@
+package updater
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/httpclient"
+)
+
+// updateServer publishes one build and records status reports
+type updateServer struct {
+	mu       sync.Mutex
+	manifest *Manifest
+	binary   []byte
+	reports  []map[string]string
+}
+
+func (s *updateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/agent/update":
+		if s.manifest == nil || r.URL.Query().Get("version") == s.manifest.Version {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(s.manifest)
+	case "/api/agent/update/download":
+		w.Write(s.binary)
+	case statusEndpoint:
+		var report map[string]string
+		json.NewDecoder(r.Body).Decode(&report)
+		s.reports = append(s.reports, report)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *updateServer) statuses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.reports))
+	for i, r := range s.reports {
+		out[i] = r["status"]
+	}
+	return out
+}
+
+func signedManifest(t *testing.T, key ed25519.PrivateKey, version string, binary []byte) *Manifest {
+	t.Helper()
+	sum := sha256.Sum256(binary)
+	m := &Manifest{
+		Version: version,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		SHA256:  hex.EncodeToString(sum[:]),
+		Size:    int64(len(binary)),
+		Channel: "stable",
+		URL:     "/api/agent/update/download?version=" + version,
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, m.message()))
+	return m
+}
+
+type testEnv struct {
+	srv      *updateServer
+	ts       *httptest.Server
+	pub      ed25519.PublicKey
+	key      ed25519.PrivateKey
+	exe      string
+	restarts int
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &testEnv{srv: &updateServer{}, pub: pub, key: key}
+	env.ts = httptest.NewServer(env.srv)
+	t.Cleanup(env.ts.Close)
+
+	env.exe = filepath.Join(t.TempDir(), "agent")
+	writeFile(t, env.exe, "v1 binary")
+	return env
+}
+
+func (e *testEnv) updater(t *testing.T, version string) *Updater {
+	t.Helper()
+	u, err := New(Config{
+		Client:         httpclient.NewClient(httpclient.Config{ServerURL: e.ts.URL, RetryAttempts: 1}),
+		UpdateURL:      e.ts.URL + "/api/agent/update",
+		PublicKey:      e.pub,
+		ComputerName:   "PC-01",
+		Version:        version,
+		Executable:     e.exe,
+		ConfirmTimeout: time.Minute,
+		Restart:        func() { e.restarts++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMessageMatchesServerFormat(t *testing.T) {
+	m := Manifest{Version: "1.2.0", OS: "windows", Arch: "amd64", SHA256: "ABC", Size: 42}
+	want := "officemonitor-agent\n1.2.0\nwindows\namd64\nabc\n42\n"
+	if got := string(m.message()); got != want {
+		t.Fatalf("message = %q, want %q", got, want)
+	}
+}
+
+func TestCheckInstallsSignedBuild(t *testing.T) {
+	env := newTestEnv(t)
+	env.srv.binary = []byte("v2 binary")
+	env.srv.manifest = signedManifest(t, env.key, "2.0.0", env.srv.binary)
+
+	u := env.updater(t, "1.0.0")
+	if err := u.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, env.exe); got != "v2 binary" {
+		t.Errorf("executable = %q", got)
+	}
+	if got := readFile(t, env.exe+".old"); got != "v1 binary" {
+		t.Errorf("backup = %q", got)
+	}
+	if env.restarts != 1 {
+		t.Errorf("restarts = %d", env.restarts)
+	}
+	if s := env.srv.statuses(); len(s) != 1 || s[0] != StatusInstalled {
+		t.Errorf("reports = %v", s)
+	}
+
+	st, err := loadState(u.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != statePending || st.FromVersion != "1.0.0" || st.Version != "2.0.0" {
+		t.Errorf("state = %+v", st)
+	}
+}
+
+func TestCheckRejectsTamperedBuild(t *testing.T) {
+	env := newTestEnv(t)
+	env.srv.binary = []byte("v2 binary")
+	env.srv.manifest = signedManifest(t, env.key, "2.0.0", env.srv.binary)
+	env.srv.binary = []byte("v2 binarY")
+
+	u := env.updater(t, "1.0.0")
+	if err := u.Check(context.Background()); err == nil {
+		t.Fatal("tampered binary installed")
+	}
+
+	// A manifest signed by another key is rejected before downloading
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	env.srv.manifest = signedManifest(t, otherKey, "2.0.0", env.srv.binary)
+	if err := u.Check(context.Background()); err == nil {
+		t.Fatal("foreign signature accepted")
+	}
+
+	if got := readFile(t, env.exe); got != "v1 binary" {
+		t.Errorf("executable = %q", got)
+	}
+	for _, leftover := range []string{".new", ".old"} {
+		if _, err := os.Stat(env.exe + leftover); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", leftover)
+		}
+	}
+	if env.restarts != 0 {
+		t.Errorf("restarted after a failed install")
+	}
+	if s := env.srv.statuses(); len(s) != 2 || s[0] != StatusFailed || s[1] != StatusFailed {
+		t.Errorf("reports = %v", s)
+	}
+}
+
+func TestConfirmKeepsNewVersion(t *testing.T) {
+	env := newTestEnv(t)
+	writeFile(t, env.exe+".old", "v1 binary")
+	st := &state{Status: statePending, FromVersion: "1.0.0", Version: "2.0.0"}
+	if err := st.save(filepath.Join(filepath.Dir(env.exe), "update-state.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	u := env.updater(t, "2.0.0")
+	pending, ok := u.resume(context.Background())
+	if !pending || !ok {
+		t.Fatalf("resume = %v, %v", pending, ok)
+	}
+
+	u.Confirm()
+	u.reportState(context.Background())
+
+	if _, err := os.Stat(env.exe + ".old"); !os.IsNotExist(err) {
+		t.Error("backup kept after confirmation")
+	}
+	if s := env.srv.statuses(); len(s) != 1 || s[0] != StatusConfirmed {
+		t.Errorf("reports = %v", s)
+	}
+	if st, _ := loadState(u.statePath); st.Status != stateConfirmed || !st.Reported {
+		t.Errorf("state = %+v", st)
+	}
+}
+
+func TestCountStartRollsBackAfterRepeatedStarts(t *testing.T) {
+	env := newTestEnv(t)
+	writeFile(t, env.exe, "v2 binary")
+	writeFile(t, env.exe+".old", "v1 binary")
+	st := &state{Status: statePending, FromVersion: "1.0.0", Version: "2.0.0"}
+	if err := st.save(filepath.Join(filepath.Dir(env.exe), "update-state.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Starts that die before the updater runs are counted all the same
+	for i := 1; i <= maxStarts; i++ {
+		if rolledBack, err := CountStart(env.exe, "2.0.0"); rolledBack || err != nil {
+			t.Fatalf("start %d: rolled back %v, err %v", i, rolledBack, err)
+		}
+	}
+	if got := readFile(t, env.exe); got != "v2 binary" {
+		t.Fatalf("rolled back after %d starts", maxStarts)
+	}
+	rolledBack, err := CountStart(env.exe, "2.0.0")
+	if err != nil || !rolledBack {
+		t.Fatalf("rolled back %v, err %v", rolledBack, err)
+	}
+
+	if got := readFile(t, env.exe); got != "v1 binary" {
+		t.Errorf("executable = %q", got)
+	}
+	if got := readFile(t, env.exe+".bad"); got != "v2 binary" {
+		t.Errorf("bad binary = %q", got)
+	}
+
+	// The previous version's start is not counted
+	if rolledBack, err := CountStart(env.exe, "1.0.0"); rolledBack || err != nil {
+		t.Fatalf("previous version: rolled back %v, err %v", rolledBack, err)
+	}
+
+	// The restored version reports the rollback and never installs 2.0.0 again
+	env.srv.binary = []byte("v2 binary")
+	env.srv.manifest = signedManifest(t, env.key, "2.0.0", env.srv.binary)
+	old := env.updater(t, "1.0.0")
+	if _, ok := old.resume(context.Background()); !ok {
+		t.Fatal("previous version rolled back")
+	}
+	if err := old.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, env.exe); got != "v1 binary" {
+		t.Errorf("bad version reinstalled")
+	}
+	if s := env.srv.statuses(); len(s) != 1 || s[0] != StatusRolledBack {
+		t.Errorf("reports = %v", s)
+	}
+}
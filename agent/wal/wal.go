@@ -0,0 +1,528 @@
+// Package wal is the append-only, segmented write-ahead log behind the agent
+// event buffer. Every record is checksummed, so a crash in the middle of a
+// write only loses the torn record at the tail instead of the whole backlog.
+//
+// Records get a monotonically increasing index. The reader acknowledges the
+// last index the server stored; segments that are fully acknowledged are
+// deleted. The acknowledged index is persisted, and anything resent after a
+// crash is dropped by the server by event ID.
+//
+// On disk a segment is a sequence of records:
+//
+//	length  uint32 (little endian, payload bytes)
+//	crc32c  uint32 (little endian, of the payload)
+//	payload []byte
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/agent/logger"
+	"go.uber.org/zap"
+)
+
+var walLog = logger.For("wal")
+
+const (
+	headerSize     = 8
+	segmentExt     = ".wal"
+	ackFile        = "ack"
+	maxRecordBytes = 16 << 20
+
+	defaultSegmentBytes = 4 << 20
+	defaultMaxBytes     = 256 << 20
+	defaultSyncInterval = time.Second
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrFull is returned by Append when the quota is reached and the drop policy keeps old records
+var ErrFull = errors.New("wal: disk quota exceeded, record dropped")
+
+// ErrClosed is returned after Close
+var ErrClosed = errors.New("wal: closed")
+
+// SyncPolicy controls when appended records are fsynced
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // fsync after every record
+	SyncInterval SyncPolicy = "interval" // fsync at most once per SyncInterval
+	SyncNever    SyncPolicy = "never"    // leave it to the OS
+)
+
+// DropPolicy decides what goes when the disk quota is reached
+type DropPolicy string
+
+const (
+	DropOldest DropPolicy = "oldest" // delete the oldest segment
+	DropNewest DropPolicy = "newest" // reject the new record
+)
+
+// Options configures a WAL
+type Options struct {
+	Dir          string
+	SegmentBytes int64 // rotate the active segment at this size
+	MaxBytes     int64 // disk quota of all segments
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	Drop         DropPolicy
+}
+
+// Record is one entry of the log
+type Record struct {
+	Index uint64
+	Data  []byte
+}
+
+type segment struct {
+	path  string
+	first uint64 // index of the first record
+	count uint64
+	size  int64
+}
+
+func (s *segment) last() uint64 {
+	return s.first + s.count - 1
+}
+
+// WAL is safe for concurrent use
+type WAL struct {
+	opts Options
+
+	mu       sync.Mutex
+	segments []*segment // oldest first; the last one is active
+	active   *os.File
+	next     uint64 // index of the next record
+	acked    uint64 // records up to and including this index are acknowledged
+	size     int64  // bytes of all segments
+	dropped  uint64
+	lastSync time.Time
+	dirty    bool
+	closed   bool
+}
+
+// Open opens or creates the log in opts.Dir and recovers existing segments
+func Open(opts Options) (*WAL, error) {
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.MaxBytes < opts.SegmentBytes {
+		opts.SegmentBytes = opts.MaxBytes
+	}
+	if opts.Sync == "" {
+		opts.Sync = SyncInterval
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+	if opts.Drop == "" {
+		opts.Drop = DropOldest
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create wal directory: %w", err)
+	}
+
+	w := &WAL{opts: opts, next: 1, lastSync: time.Now()}
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// recover loads the acknowledged index and validates every segment.
+// A torn record at the end of the last segment is truncated away.
+func (w *WAL) recover() error {
+	if data, err := os.ReadFile(filepath.Join(w.opts.Dir, ackFile)); err == nil {
+		if n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			w.acked = n
+			w.next = n + 1
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read wal ack file: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(w.opts.Dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), segmentExt), 10, 64)
+		if err != nil {
+			walLog.Warn("Ignoring unexpected file", zap.String("path", path))
+			continue
+		}
+		w.segments = append(w.segments, &segment{path: path, first: first})
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i].first < w.segments[j].first })
+
+	for i, seg := range w.segments {
+		count, valid, err := scanSegment(seg.path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(seg.path)
+		if err != nil {
+			return err
+		}
+		if valid < info.Size() {
+			walLog.Warn("Segment is corrupt, truncating",
+				zap.String("segment", seg.path),
+				zap.Uint64("valid_records", count),
+				zap.Int64("truncated_bytes", info.Size()-valid))
+			if err := os.Truncate(seg.path, valid); err != nil {
+				return fmt.Errorf("failed to truncate corrupt segment: %w", err)
+			}
+		}
+		seg.count = count
+		seg.size = valid
+		w.size += valid
+
+		// Indexes stay unique even if an earlier segment lost records
+		if i > 0 && seg.first < w.segments[i-1].first+w.segments[i-1].count {
+			return fmt.Errorf("wal: overlapping segments %s and %s", w.segments[i-1].path, seg.path)
+		}
+		if seg.count > 0 && seg.last()+1 > w.next {
+			w.next = seg.last() + 1
+		}
+	}
+
+	w.deleteAcked()
+	return nil
+}
+
+// scanSegment returns the number of valid records and the offset after the last one
+func scanSegment(path string) (uint64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var count uint64
+	var offset int64
+	for {
+		data, err := readRecord(r)
+		if err != nil {
+			return count, offset, nil
+		}
+		count++
+		offset += headerSize + int64(len(data))
+	}
+}
+
+// readRecord reads one record; any error means the rest of the segment is unusable
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+	if n > maxRecordBytes {
+		return nil, fmt.Errorf("record length %d out of range", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(data, crcTable) != sum {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// Append writes one record and returns its index
+func (w *WAL) Append(data []byte) (uint64, error) {
+	if len(data) > maxRecordBytes {
+		return 0, fmt.Errorf("wal: record of %d bytes is too large", len(data))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	n := int64(headerSize + len(data))
+	for w.size+n > w.opts.MaxBytes {
+		if w.opts.Drop == DropNewest || len(w.segments) < 2 {
+			w.dropped++
+			return 0, ErrFull
+		}
+		w.dropOldest()
+	}
+
+	seg := w.activeSegment()
+	if seg == nil || seg.size+n > w.opts.SegmentBytes && seg.count > 0 {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+		seg = w.activeSegment()
+	}
+
+	buf := make([]byte, n)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(data, crcTable))
+	copy(buf[headerSize:], data)
+	if _, err := w.active.Write(buf); err != nil {
+		// Drop the partial write so the next record starts at a clean offset
+		_ = w.active.Truncate(seg.size)
+		return 0, fmt.Errorf("failed to append record: %w", err)
+	}
+
+	index := w.next
+	w.next++
+	seg.count++
+	seg.size += n
+	w.size += n
+	w.dirty = true
+
+	switch w.opts.Sync {
+	case SyncAlways:
+		if err := w.syncLocked(); err != nil {
+			return index, err
+		}
+	case SyncInterval:
+		if time.Since(w.lastSync) >= w.opts.SyncInterval {
+			if err := w.syncLocked(); err != nil {
+				return index, err
+			}
+		}
+	}
+
+	return index, nil
+}
+
+// Read returns up to max unacknowledged records, oldest first
+func (w *WAL) Read(max int) ([]Record, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var records []Record
+	for _, seg := range w.segments {
+		if len(records) >= max {
+			break
+		}
+		if seg.count == 0 || seg.last() <= w.acked {
+			continue
+		}
+
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return records, fmt.Errorf("failed to open segment: %w", err)
+		}
+		r := bufio.NewReader(f)
+		for i := uint64(0); i < seg.count && len(records) < max; i++ {
+			data, err := readRecord(r)
+			if err != nil {
+				f.Close()
+				return records, fmt.Errorf("failed to read %s: %w", seg.path, err)
+			}
+			if index := seg.first + i; index > w.acked {
+				records = append(records, Record{Index: index, Data: data})
+			}
+		}
+		f.Close()
+	}
+	return records, nil
+}
+
+// Ack marks every record up to and including index as delivered and deletes
+// segments that hold nothing else
+func (w *WAL) Ack(index uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if index <= w.acked {
+		return nil
+	}
+	if index >= w.next {
+		index = w.next - 1
+	}
+	w.acked = index
+
+	tmp := filepath.Join(w.opts.Dir, ackFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(index, 10)), 0600); err != nil {
+		return fmt.Errorf("failed to write wal ack file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(w.opts.Dir, ackFile)); err != nil {
+		return fmt.Errorf("failed to write wal ack file: %w", err)
+	}
+
+	w.deleteAcked()
+	return nil
+}
+
+// Len returns the number of unacknowledged records
+func (w *WAL) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var n uint64
+	for _, seg := range w.segments {
+		if seg.count == 0 || seg.last() <= w.acked {
+			continue
+		}
+		if seg.first > w.acked {
+			n += seg.count
+		} else {
+			n += seg.last() - w.acked
+		}
+	}
+	return int(n)
+}
+
+// Size returns the bytes used by all segments
+func (w *WAL) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Dropped returns how many records were lost to the disk quota since Open
+func (w *WAL) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// Sync flushes appended records to disk
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.syncLocked()
+}
+
+// Close syncs and closes the active segment
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.active == nil {
+		return nil
+	}
+	err := w.syncLocked()
+	if cerr := w.active.Close(); err == nil {
+		err = cerr
+	}
+	w.active = nil
+	return err
+}
+
+func (w *WAL) syncLocked() error {
+	w.lastSync = time.Now()
+	if !w.dirty || w.active == nil {
+		return nil
+	}
+	w.dirty = false
+	if err := w.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	return nil
+}
+
+// activeSegment returns the segment appended to, or nil before the first append
+func (w *WAL) activeSegment() *segment {
+	if w.active == nil || len(w.segments) == 0 {
+		return nil
+	}
+	return w.segments[len(w.segments)-1]
+}
+
+// rotate closes the active segment and starts a new one at the next index
+func (w *WAL) rotate() error {
+	if w.active != nil {
+		if err := w.syncLocked(); err != nil {
+			return err
+		}
+		if err := w.active.Close(); err != nil {
+			return fmt.Errorf("failed to close segment: %w", err)
+		}
+		w.active = nil
+	}
+
+	// An empty segment left by a previous run is reused instead of piling up
+	if n := len(w.segments); n > 0 && w.segments[n-1].count == 0 {
+		seg := w.segments[n-1]
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove empty segment: %w", err)
+		}
+		w.segments = w.segments[:n-1]
+	}
+
+	path := filepath.Join(w.opts.Dir, fmt.Sprintf("%020d%s", w.next, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	w.active = f
+	w.segments = append(w.segments, &segment{path: path, first: w.next})
+	return nil
+}
+
+// dropOldest deletes the oldest segment to make room, counting its unacknowledged records
+func (w *WAL) dropOldest() {
+	seg := w.segments[0]
+	if seg.count > 0 && seg.last() > w.acked {
+		lost := seg.count
+		if seg.first <= w.acked {
+			lost = seg.last() - w.acked
+		}
+		w.dropped += lost
+		walLog.Warn("Disk quota reached, dropping oldest events", zap.Int64("max_bytes", w.opts.MaxBytes), zap.Uint64("dropped", lost))
+	}
+	w.removeSegment(0)
+}
+
+// deleteAcked removes fully acknowledged segments; the active one is closed
+// first so the next append starts a fresh segment
+func (w *WAL) deleteAcked() {
+	for len(w.segments) > 0 {
+		seg := w.segments[0]
+		if seg.count > 0 && seg.last() > w.acked {
+			return
+		}
+		if seg.count == 0 && len(w.segments) == 1 {
+			return
+		}
+		if len(w.segments) == 1 && w.active != nil {
+			if err := w.active.Close(); err != nil {
+				walLog.Warn("Failed to close segment", zap.Error(err))
+			}
+			w.active = nil
+			w.dirty = false
+		}
+		w.removeSegment(0)
+	}
+}
+
+func (w *WAL) removeSegment(i int) {
+	seg := w.segments[i]
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		walLog.Warn("Failed to remove segment", zap.String("segment", seg.path), zap.Error(err))
+	}
+	w.size -= seg.size
+	w.segments = append(w.segments[:i], w.segments[i+1:]...)
+}
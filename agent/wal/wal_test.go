@@ -0,0 +1,158 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendN(t *testing.T, w *WAL, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := w.Append([]byte(fmt.Sprintf("event-%03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestAppendReadAckAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(Options{Dir: dir, SegmentBytes: 64, Sync: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, w, 10)
+	if files := segmentFiles(t, dir); len(files) < 2 {
+		t.Fatalf("expected rotation into several segments, got %d", len(files))
+	}
+
+	records, err := w.Read(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0].Index != 1 || string(records[3].Data) != "event-003" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if err := w.Ack(records[3].Index); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = Open(Options{Dir: dir, SegmentBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.Len() != 6 {
+		t.Fatalf("expected 6 pending records after restart, got %d", w.Len())
+	}
+	records, err = w.Read(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || records[0].Index != 5 || string(records[0].Data) != "event-004" {
+		t.Fatalf("unexpected records after restart: %+v", records)
+	}
+
+	index, err := w.Append([]byte("after restart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != 11 {
+		t.Fatalf("expected index 11 after restart, got %d", index)
+	}
+
+	if err := w.Ack(index); err != nil {
+		t.Fatal(err)
+	}
+	if w.Len() != 0 || len(segmentFiles(t, dir)) != 0 {
+		t.Fatalf("acknowledged segments must be deleted, %d left", len(segmentFiles(t, dir)))
+	}
+}
+
+func TestTornTailIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, w, 3)
+	w.Close()
+
+	// Simulate a crash in the middle of writing a fourth record
+	path := segmentFiles(t, dir)[0]
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{42, 0, 0, 0, 1, 2})
+	f.Close()
+
+	w, err = Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.Len() != 3 {
+		t.Fatalf("expected the 3 complete records to survive, got %d", w.Len())
+	}
+	if _, err := w.Append([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	records, err := w.Read(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || string(records[3].Data) != "next" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+}
+
+func TestQuotaDropPolicies(t *testing.T) {
+	// Each record is 8 header + 9 payload bytes
+	t.Run("oldest", func(t *testing.T) {
+		w, err := Open(Options{Dir: t.TempDir(), SegmentBytes: 34, MaxBytes: 68, Drop: DropOldest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		appendN(t, w, 6)
+
+		if w.Dropped() != 2 || w.Len() != 4 {
+			t.Fatalf("expected 2 dropped and 4 kept, got %d dropped and %d kept", w.Dropped(), w.Len())
+		}
+		records, _ := w.Read(10)
+		if string(records[0].Data) != "event-002" {
+			t.Fatalf("the oldest records must go first, got %q", records[0].Data)
+		}
+	})
+
+	t.Run("newest", func(t *testing.T) {
+		w, err := Open(Options{Dir: t.TempDir(), SegmentBytes: 34, MaxBytes: 68, Drop: DropNewest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		appendN(t, w, 4)
+
+		if _, err := w.Append([]byte("event-004")); !errors.Is(err, ErrFull) {
+			t.Fatalf("expected ErrFull, got %v", err)
+		}
+		if w.Dropped() != 1 || w.Len() != 4 {
+			t.Fatalf("expected 1 dropped and 4 kept, got %d dropped and %d kept", w.Dropped(), w.Len())
+		}
+	})
+}
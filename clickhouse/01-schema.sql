@@ -88,12 +88,25 @@ CREATE TABLE IF NOT EXISTS monitoring.usb_events (
     device_type String,
     event_type Enum('connected', 'disconnected'),
     volume_serial String,
-    event_date Date DEFAULT toDate(timestamp)
+    event_date Date DEFAULT toDate(timestamp),
+    received_at DateTime DEFAULT now(),
+    INDEX idx_received_at received_at TYPE minmax GRANULARITY 1
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMM(event_date)
 ORDER BY (computer_name, username, timestamp)
 TTL event_date + INTERVAL 180 DAY;
 
+-- USB devices already seen, for the new_usb_device alert rule
+CREATE TABLE IF NOT EXISTS monitoring.known_usb_devices (
+    device_id String,
+    first_seen DateTime64(3),
+    computer_name String,
+    username String,
+    device_name String,
+    registered_at DateTime DEFAULT now()
+) ENGINE = ReplacingMergeTree(registered_at)
+ORDER BY device_id;
+
 CREATE TABLE IF NOT EXISTS monitoring.screenshot_metadata (
     timestamp DateTime64(3),
     computer_name String,
@@ -110,10 +123,12 @@ ORDER BY (computer_name, username, timestamp)
 TTL event_date + INTERVAL 180 DAY;
 
 CREATE TABLE IF NOT EXISTS monitoring.alerts (
+    id UUID DEFAULT generateUUIDv4(),
     timestamp DateTime64(3),
     computer_name String,
     username String,
-    alert_type Enum('mass_file_copy', 'usb_connection', 'suspicious_process', 'large_upload'),
+    alert_type Enum8('mass_file_copy' = 1, 'usb_connection' = 2, 'suspicious_process' = 3, 'large_upload' = 4,
+                     'new_usb_device' = 5, 'large_file_copy' = 6, 'low_productivity' = 7),
     severity Enum('low', 'medium', 'high', 'critical'),
     description String,
     metadata String,
@@ -139,16 +154,125 @@ CREATE TABLE IF NOT EXISTS monitoring.agent_configs (
     large_copy_threshold_mb UInt32 DEFAULT 100,
     last_seen DateTime,
     agent_version String,
+    -- 0 for rows that only hold an API key: the agent keeps its local settings
+    configured UInt8 DEFAULT 1,
     updated_at DateTime DEFAULT now()
 ) ENGINE = ReplacingMergeTree(updated_at)
 ORDER BY computer_name;
 
+CREATE TABLE IF NOT EXISTS monitoring.agent_config_status (
+    computer_name String,
+    applied_version String,
+    applied_at DateTime,
+    error String DEFAULT '',
+    updated_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY computer_name
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.agent_registry (
+    computer_name String,
+    username String,
+    agent_version String,
+    os_build String,
+    ip_addresses Array(String),
+    uptime_seconds UInt64,
+    monitors Array(String),
+    buffer_size UInt32,
+    buffer_dropped UInt64 DEFAULT 0,
+    circuit_breaker LowCardinality(String),
+    config_version String DEFAULT '',
+    throttle_level UInt8 DEFAULT 0,
+    throttle_reason String DEFAULT '',
+    memory_mb UInt32 DEFAULT 0,
+    cpu_percent Float32 DEFAULT 0,
+    monitor_status String DEFAULT '',
+    last_heartbeat DateTime64(3)
+) ENGINE = ReplacingMergeTree(last_heartbeat)
+ORDER BY computer_name
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.ingested_events (
+    event_id String,
+    computer_name String,
+    seq UInt64,
+    event_type LowCardinality(String),
+    received_at DateTime
+) ENGINE = ReplacingMergeTree(received_at)
+ORDER BY event_id
+TTL received_at + INTERVAL 30 DAY
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.agent_builds (
+    version String,
+    os LowCardinality(String),
+    arch LowCardinality(String),
+    sha256 String,
+    size UInt64,
+    object_name String,
+    signature String,
+    notes String DEFAULT '',
+    uploaded_by String DEFAULT '',
+    uploaded_at DateTime DEFAULT now()
+) ENGINE = ReplacingMergeTree(uploaded_at)
+ORDER BY (version, os, arch)
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.agent_release_channels (
+    channel LowCardinality(String),
+    version String,
+    updated_at DateTime64(3) DEFAULT now64(3),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY channel
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.agent_groups (
+    name String,
+    channel LowCardinality(String),
+    computer_names Array(String),
+    is_deleted UInt8 DEFAULT 0,
+    updated_at DateTime64(3) DEFAULT now64(3),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY name
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.agent_update_status (
+    computer_name String,
+    from_version String DEFAULT '',
+    version String,
+    status Enum8('installed' = 1, 'confirmed' = 2, 'rolled_back' = 3, 'failed' = 4),
+    error String DEFAULT '',
+    updated_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY computer_name
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.agent_logs (
+    timestamp DateTime64(3),
+    computer_name String,
+    level LowCardinality(String),
+    component LowCardinality(String),
+    message String,
+    caller String DEFAULT '',
+    fields String DEFAULT '',
+    received_at DateTime
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (computer_name, timestamp)
+TTL toDateTime(timestamp) + INTERVAL 30 DAY
+SETTINGS index_granularity = 8192;
+
 CREATE TABLE IF NOT EXISTS monitoring.employees (
     username String,
     full_name String,
     department String,
+    team String DEFAULT '',
     position String,
     email String,
+    consent_given UInt8 DEFAULT 0,
+    consent_date Nullable(DateTime),
     is_active UInt8 DEFAULT 1,
     created_at DateTime DEFAULT now(),
     updated_at DateTime DEFAULT now()
@@ -203,6 +327,142 @@ CREATE TABLE IF NOT EXISTS monitoring.system_settings (
 ORDER BY key
 SETTINGS index_granularity = 8192;
 
+CREATE TABLE IF NOT EXISTS monitoring.alert_rules (
+    id UUID DEFAULT generateUUIDv4(),
+    name String,
+    description String DEFAULT '',
+    rule_type String,
+    severity Enum8('low' = 1, 'medium' = 2, 'high' = 3, 'critical' = 4),
+    enabled UInt8 DEFAULT 1,
+    cooldown_minutes UInt32 DEFAULT 60,
+    params String DEFAULT '{}',
+    is_deleted UInt8 DEFAULT 0,
+    created_at DateTime DEFAULT now(),
+    updated_at DateTime DEFAULT now(),
+    created_by String DEFAULT '',
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.alert_states (
+    alert_id UUID,
+    status Enum8('open' = 1, 'acknowledged' = 2, 'resolved' = 3, 'false_positive' = 4),
+    assignee String DEFAULT '',
+    acknowledged_by String DEFAULT '',
+    acknowledged_at Nullable(DateTime64(3)),
+    resolved_by String DEFAULT '',
+    resolved_at Nullable(DateTime64(3)),
+    resolution_notes String DEFAULT '',
+    updated_at DateTime64(3) DEFAULT now64(3),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY alert_id
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.alert_comments (
+    id UUID DEFAULT generateUUIDv4(),
+    alert_id UUID,
+    author String,
+    text String,
+    created_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = MergeTree()
+ORDER BY (alert_id, created_at)
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.notification_deliveries (
+    timestamp DateTime64(3),
+    alert_id String,
+    channel LowCardinality(String),
+    channel_type LowCardinality(String),
+    status Enum8('sent' = 1, 'failed' = 2, 'dropped' = 3),
+    attempts UInt8,
+    error String DEFAULT '',
+    duration_ms UInt32 DEFAULT 0,
+    event_date Date DEFAULT toDate(timestamp)
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(event_date)
+ORDER BY (timestamp, channel)
+TTL event_date + INTERVAL 90 DAY
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.report_schedules (
+    id UUID DEFAULT generateUUIDv4(),
+    name String,
+    cron String,
+    report_type LowCardinality(String),
+    target String,
+    department String DEFAULT '',
+    period LowCardinality(String),
+    granularity LowCardinality(String) DEFAULT 'day',
+    recipients Array(String),
+    enabled UInt8 DEFAULT 1,
+    is_deleted UInt8 DEFAULT 0,
+    created_at DateTime DEFAULT now(),
+    updated_at DateTime DEFAULT now(),
+    created_by String DEFAULT '',
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.report_runs (
+    id UUID,
+    schedule_id String,
+    schedule_name String,
+    trigger LowCardinality(String),
+    status Enum8('success' = 1, 'failed' = 2),
+    started_at DateTime64(3),
+    finished_at DateTime64(3),
+    period_start DateTime,
+    period_end DateTime,
+    recipients Array(String),
+    error String DEFAULT '',
+    event_date Date DEFAULT toDate(started_at)
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(event_date)
+ORDER BY (schedule_id, started_at)
+TTL event_date + INTERVAL 365 DAY
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.work_schedules (
+    username String,
+    work_start String,
+    work_end String,
+    work_days Array(UInt8),
+    is_deleted UInt8 DEFAULT 0,
+    updated_at DateTime DEFAULT now(),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY username
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.holidays (
+    date Date,
+    name String,
+    workday UInt8 DEFAULT 0,
+    is_deleted UInt8 DEFAULT 0,
+    updated_at DateTime DEFAULT now(),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY date
+SETTINGS index_granularity = 8192;
+
+CREATE TABLE IF NOT EXISTS monitoring.operator_users (
+    username String,
+    password_hash String,
+    full_name String DEFAULT '',
+    role Enum8('admin' = 1, 'hr_manager' = 2, 'department_head' = 3),
+    department String DEFAULT '',
+    is_active UInt8 DEFAULT 1,
+    created_at DateTime DEFAULT now(),
+    updated_at DateTime DEFAULT now(),
+    created_by String DEFAULT '',
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY username
+SETTINGS index_granularity = 8192;
+
 -- ============================================================================
 -- 3. Materialized Views
 -- ============================================================================
@@ -0,0 +1,530 @@
+// Package alerting evaluates alert rules against incoming agent events and
+// periodic aggregates, and writes matches to monitoring.alerts.
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+// Rule types. The rule type is also stored as the alert_type of generated alerts.
+const (
+	RuleUSBConnection     = "usb_connection"
+	RuleNewUSBDevice      = "new_usb_device"
+	RuleLargeFileCopy     = "large_file_copy"
+	RuleMassFileCopy      = "mass_file_copy"
+	RuleSuspiciousProcess = "suspicious_process"
+	RuleLowProductivity   = "low_productivity"
+)
+
+// RuleTypes lists all supported rule types
+var RuleTypes = []string{
+	RuleUSBConnection,
+	RuleNewUSBDevice,
+	RuleLargeFileCopy,
+	RuleMassFileCopy,
+	RuleSuspiciousProcess,
+	RuleLowProductivity,
+}
+
+// Severities lists the allowed alert severities
+var Severities = []string{"low", "medium", "high", "critical"}
+
+// Params holds the rule type specific options stored as JSON in alert_rules.params
+type Params struct {
+	EventTypes       []string `json:"event_types,omitempty"`        // usb_connection: connected/disconnected, empty = any
+	MinSizeMB        int      `json:"min_size_mb,omitempty"`        // large_file_copy, default 100
+	MinFiles         int      `json:"min_files,omitempty"`          // mass_file_copy, default 100
+	USBOnly          bool     `json:"usb_only,omitempty"`           // file rules: only copies to USB targets
+	Processes        []string `json:"processes,omitempty"`          // suspicious_process: names or glob patterns
+	Threshold        float64  `json:"threshold,omitempty"`          // low_productivity: percent, default productivity_threshold setting
+	MinActiveMinutes int      `json:"min_active_minutes,omitempty"` // low_productivity: ignore users with less activity today
+}
+
+// ParseParams decodes and validates the params JSON for a rule type
+func ParseParams(ruleType, raw string) (Params, error) {
+	var p Params
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			return p, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	switch ruleType {
+	case RuleLargeFileCopy:
+		if p.MinSizeMB <= 0 {
+			p.MinSizeMB = 100
+		}
+	case RuleMassFileCopy:
+		if p.MinFiles <= 0 {
+			p.MinFiles = 100
+		}
+	case RuleSuspiciousProcess:
+		for _, pattern := range p.Processes {
+			if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+				return p, fmt.Errorf("invalid process pattern %q", pattern)
+			}
+		}
+	case RuleLowProductivity:
+		if p.Threshold < 0 || p.Threshold > 100 {
+			return p, fmt.Errorf("threshold must be between 0 and 100")
+		}
+	}
+
+	return p, nil
+}
+
+// Store is the subset of the database used by the engine
+type Store interface {
+	GetAlertRules(ctx context.Context) ([]database.AlertRule, error)
+	GetSystemSettings(ctx context.Context) (map[string]string, error)
+	InsertAlert(ctx context.Context, alert *database.Alert) error
+	GetNewUSBDevices(ctx context.Context, since time.Time) ([]database.USBEvent, error)
+	AddKnownUSBDevices(ctx context.Context, devices []database.USBEvent) error
+	GetUserProductivity(ctx context.Context, start, end time.Time) ([]database.UserProductivity, error)
+}
+
+// Notifier receives every alert stored by the engine. Notify must not block.
+type Notifier interface {
+	Notify(ctx context.Context, alert database.Alert)
+}
+
+// Settings are the alert_on_* switches from system_settings
+type Settings struct {
+	AlertOnUSB             bool
+	AlertOnFileCopy        bool
+	AlertOnLowProductivity bool
+	ProductivityThreshold  float64
+}
+
+// usbCheckOverlap re-reads events received shortly before the last check, so
+// rows still in the ingest queue at that moment are not missed. Devices found
+// are recorded as known, so the overlap does not alert twice.
+const usbCheckOverlap = 5 * time.Minute
+
+type compiledRule struct {
+	database.AlertRule
+	params Params
+}
+
+// Engine evaluates rules. It is safe for concurrent use.
+type Engine struct {
+	store    Store
+	notifier Notifier
+	loc      *time.Location
+	refresh  time.Duration
+	now      func() time.Time
+
+	mu       sync.RWMutex
+	rules    []compiledRule
+	settings Settings
+	loadedAt time.Time
+
+	cooldownMu sync.Mutex
+	lastFired  map[string]time.Time
+
+	lastUSBCheck time.Time
+}
+
+// NewEngine creates an engine. loc defines "today" for daily aggregates.
+func NewEngine(store Store, loc *time.Location) *Engine {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Engine{
+		store:        store,
+		loc:          loc,
+		refresh:      time.Minute,
+		now:          time.Now,
+		lastFired:    make(map[string]time.Time),
+		lastUSBCheck: time.Now(),
+	}
+}
+
+// SetNotifier sets where stored alerts are pushed. Call before Run.
+func (e *Engine) SetNotifier(n Notifier) {
+	e.notifier = n
+}
+
+// Reload loads rules and settings from the store
+func (e *Engine) Reload(ctx context.Context) error {
+	rules, err := e.store.GetAlertRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load alert rules: %w", err)
+	}
+
+	raw, err := e.store.GetSystemSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		params, err := ParseParams(r.RuleType, r.Params)
+		if err != nil {
+			zapctx.Warn(ctx, "Skipping alert rule with invalid params", zap.String("rule_id", r.ID), zap.Error(err))
+			continue
+		}
+		compiled = append(compiled, compiledRule{AlertRule: r, params: params})
+	}
+
+	e.mu.Lock()
+	e.rules = compiled
+	e.settings = parseSettings(raw)
+	e.loadedAt = e.now()
+	e.mu.Unlock()
+
+	zapctx.Debug(ctx, "Alert rules loaded", zap.Int("enabled", len(compiled)))
+	return nil
+}
+
+// Invalidate forces a reload before the next evaluation
+func (e *Engine) Invalidate() {
+	e.mu.Lock()
+	e.loadedAt = time.Time{}
+	e.mu.Unlock()
+}
+
+// snapshot returns the current rules of the given types, reloading stale state
+func (e *Engine) snapshot(ctx context.Context, types ...string) ([]compiledRule, Settings) {
+	e.mu.RLock()
+	stale := e.now().Sub(e.loadedAt) >= e.refresh
+	e.mu.RUnlock()
+
+	if stale {
+		if err := e.Reload(ctx); err != nil {
+			zapctx.Warn(ctx, "Failed to reload alert rules, using cached", zap.Error(err))
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	matched := make([]compiledRule, 0)
+	for _, r := range e.rules {
+		for _, t := range types {
+			if r.RuleType == t {
+				matched = append(matched, r)
+				break
+			}
+		}
+	}
+	return matched, e.settings
+}
+
+// ObserveUSB evaluates USB rules for a stored USB event
+func (e *Engine) ObserveUSB(ctx context.Context, ev database.USBEvent) {
+	rules, settings := e.snapshot(ctx, RuleUSBConnection)
+	if !settings.AlertOnUSB {
+		return
+	}
+
+	for _, r := range rules {
+		if len(r.params.EventTypes) > 0 && !containsFold(r.params.EventTypes, ev.EventType) {
+			continue
+		}
+		e.fire(ctx, r, ev.ComputerName, ev.Username, ev.Timestamp, ev.DeviceID,
+			fmt.Sprintf("USB device %s %s", deviceLabel(ev), ev.EventType),
+			map[string]any{
+				"device_id":     ev.DeviceID,
+				"device_name":   ev.DeviceName,
+				"device_type":   ev.DeviceType,
+				"event_type":    ev.EventType,
+				"volume_serial": ev.VolumeSerial,
+			})
+	}
+}
+
+// ObserveFileCopy evaluates file copy rules for a stored file event
+func (e *Engine) ObserveFileCopy(ctx context.Context, ev database.FileCopyEvent) {
+	rules, settings := e.snapshot(ctx, RuleLargeFileCopy, RuleMassFileCopy)
+	if !settings.AlertOnFileCopy {
+		return
+	}
+
+	for _, r := range rules {
+		if r.params.USBOnly && ev.IsUSBTarget != 1 {
+			continue
+		}
+
+		var description string
+		switch r.RuleType {
+		case RuleLargeFileCopy:
+			if ev.FileSize < uint64(r.params.MinSizeMB)*1024*1024 {
+				continue
+			}
+			description = fmt.Sprintf("Copied %d MB to %s", ev.FileSize/(1024*1024), ev.DestinationPath)
+		case RuleMassFileCopy:
+			if int(ev.FileCount) < r.params.MinFiles {
+				continue
+			}
+			description = fmt.Sprintf("Copied %d files to %s", ev.FileCount, ev.DestinationPath)
+		}
+
+		e.fire(ctx, r, ev.ComputerName, ev.Username, ev.Timestamp, "", description,
+			map[string]any{
+				"source_path":      ev.SourcePath,
+				"destination_path": ev.DestinationPath,
+				"file_size":        ev.FileSize,
+				"file_count":       ev.FileCount,
+				"operation_type":   ev.OperationType,
+				"is_usb_target":    ev.IsUSBTarget == 1,
+			})
+	}
+}
+
+// ObserveProcess evaluates process rules for activity events and active segments
+func (e *Engine) ObserveProcess(ctx context.Context, ts time.Time, computerName, username, processName, windowTitle string) {
+	if processName == "" {
+		return
+	}
+
+	rules, _ := e.snapshot(ctx, RuleSuspiciousProcess)
+	name := strings.ToLower(processName)
+
+	for _, r := range rules {
+		for _, pattern := range r.params.Processes {
+			if ok, _ := path.Match(strings.ToLower(pattern), name); !ok {
+				continue
+			}
+			e.fire(ctx, r, computerName, username, ts, name,
+				fmt.Sprintf("Suspicious process %s is running", processName),
+				map[string]any{
+					"process_name": processName,
+					"window_title": windowTitle,
+					"pattern":      pattern,
+				})
+			break
+		}
+	}
+}
+
+// Run evaluates periodic aggregates every interval until ctx is done
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.EvaluateAggregates(ctx)
+		}
+	}
+}
+
+// EvaluateAggregates checks new USB devices and daily productivity.
+// Not safe for concurrent calls; Run calls it from a single goroutine.
+func (e *Engine) EvaluateAggregates(ctx context.Context) {
+	rules, settings := e.snapshot(ctx, RuleNewUSBDevice, RuleLowProductivity)
+	now := e.now()
+
+	var usbRules, productivityRules []compiledRule
+	for _, r := range rules {
+		switch r.RuleType {
+		case RuleNewUSBDevice:
+			usbRules = append(usbRules, r)
+		case RuleLowProductivity:
+			productivityRules = append(productivityRules, r)
+		}
+	}
+
+	if settings.AlertOnUSB && len(usbRules) > 0 {
+		devices, err := e.store.GetNewUSBDevices(ctx, e.lastUSBCheck.Add(-usbCheckOverlap))
+		if err != nil {
+			zapctx.Warn(ctx, "Failed to check new USB devices", zap.Error(err))
+		} else {
+			known := make([]database.USBEvent, 0, len(devices))
+			for _, d := range devices {
+				fired := true
+				for _, r := range usbRules {
+					fired = e.fire(ctx, r, d.ComputerName, d.Username, d.Timestamp, d.DeviceID,
+						fmt.Sprintf("New USB device %s seen for the first time", deviceLabel(d)),
+						map[string]any{
+							"device_id":     d.DeviceID,
+							"device_name":   d.DeviceName,
+							"device_type":   d.DeviceType,
+							"volume_serial": d.VolumeSerial,
+							"first_seen":    d.Timestamp,
+						}) && fired
+				}
+				if fired {
+					known = append(known, d)
+				}
+			}
+			// The cursor stays put while a device is unrecorded, so it is found again
+			if err := e.store.AddKnownUSBDevices(ctx, known); err != nil {
+				zapctx.Warn(ctx, "Failed to record known USB devices", zap.Error(err))
+			} else if len(known) == len(devices) {
+				e.lastUSBCheck = now
+			}
+		}
+	}
+
+	e.pruneCooldowns(now)
+
+	if settings.AlertOnLowProductivity && len(productivityRules) > 0 {
+		local := now.In(e.loc)
+		dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, e.loc)
+
+		stats, err := e.store.GetUserProductivity(ctx, dayStart, now)
+		if err != nil {
+			zapctx.Warn(ctx, "Failed to check productivity", zap.Error(err))
+			return
+		}
+
+		for _, r := range productivityRules {
+			threshold := r.params.Threshold
+			if threshold == 0 {
+				threshold = settings.ProductivityThreshold
+			}
+			minActive := uint64(r.params.MinActiveMinutes) * 60
+
+			for _, s := range stats {
+				if s.ActiveSeconds < minActive || s.Productivity >= threshold {
+					continue
+				}
+				e.fire(ctx, r, s.ComputerName, s.Username, now, dayStart.Format("2006-01-02"),
+					fmt.Sprintf("Productivity %.0f%% is below threshold %.0f%%", s.Productivity, threshold),
+					map[string]any{
+						"date":               dayStart.Format("2006-01-02"),
+						"productivity":       s.Productivity,
+						"threshold":          threshold,
+						"active_seconds":     s.ActiveSeconds,
+						"productive_seconds": s.ProductiveSeconds,
+					})
+			}
+		}
+	}
+}
+
+// pruneCooldowns forgets alerts whose cooldown has passed. Entries of rules
+// that were disabled or deleted are dropped as well.
+func (e *Engine) pruneCooldowns(now time.Time) {
+	e.mu.RLock()
+	cooldowns := make(map[string]time.Duration, len(e.rules))
+	for _, r := range e.rules {
+		cooldowns[r.ID] = time.Duration(r.CooldownMinutes) * time.Minute
+	}
+	e.mu.RUnlock()
+
+	e.cooldownMu.Lock()
+	defer e.cooldownMu.Unlock()
+	for key, last := range e.lastFired {
+		ruleID, _, _ := strings.Cut(key, "|")
+		cooldown, ok := cooldowns[ruleID]
+		if !ok || now.Sub(last) >= cooldown {
+			delete(e.lastFired, key)
+		}
+	}
+}
+
+// fire writes an alert unless the rule is in cooldown for this
+// computer/user/subject. It reports false only if the alert could not be stored.
+func (e *Engine) fire(ctx context.Context, r compiledRule, computerName, username string, ts time.Time, subject, description string, details map[string]any) bool {
+	key := r.ID + "|" + computerName + "|" + username + "|" + subject
+	now := e.now()
+
+	e.cooldownMu.Lock()
+	last, seen := e.lastFired[key]
+	if seen && now.Sub(last) < time.Duration(r.CooldownMinutes)*time.Minute {
+		e.cooldownMu.Unlock()
+		return true
+	}
+	e.lastFired[key] = now
+	e.cooldownMu.Unlock()
+
+	details["rule_id"] = r.ID
+	details["rule_name"] = r.Name
+	metadata, err := json.Marshal(details)
+	if err != nil {
+		metadata = []byte("{}")
+	}
+
+	if ts.IsZero() {
+		ts = now
+	}
+
+	alert := database.Alert{
+		Timestamp:    ts,
+		ComputerName: computerName,
+		Username:     username,
+		AlertType:    r.RuleType,
+		Severity:     r.Severity,
+		Description:  description,
+		Metadata:     string(metadata),
+	}
+
+	if err := e.store.InsertAlert(ctx, &alert); err != nil {
+		zapctx.Error(ctx, "Failed to insert alert", zap.Error(err), zap.String("rule_id", r.ID))
+		// Allow the next match to retry
+		e.cooldownMu.Lock()
+		delete(e.lastFired, key)
+		e.cooldownMu.Unlock()
+		return false
+	}
+
+	zapctx.Info(ctx, "Alert generated",
+		zap.String("rule", r.Name),
+		zap.String("severity", r.Severity),
+		zap.String("computer_name", computerName),
+		zap.String("username", username))
+
+	if e.notifier != nil {
+		e.notifier.Notify(ctx, alert)
+	}
+	return true
+}
+
+func parseSettings(raw map[string]string) Settings {
+	return Settings{
+		AlertOnUSB:             parseBool(raw["alert_on_usb_events"], true),
+		AlertOnFileCopy:        parseBool(raw["alert_on_file_copy"], true),
+		AlertOnLowProductivity: parseBool(raw["alert_on_low_productivity"], false),
+		ProductivityThreshold:  parseFloat(raw["productivity_threshold"], 70.0),
+	}
+}
+
+func parseBool(s string, def bool) bool {
+	if v, err := strconv.ParseBool(s); err == nil {
+		return v
+	}
+	return def
+}
+
+func parseFloat(s string, def float64) float64 {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func deviceLabel(ev database.USBEvent) string {
+	if ev.DeviceName != "" {
+		return ev.DeviceName
+	}
+	return ev.DeviceID
+}
@@ -0,0 +1,298 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	mu           sync.Mutex
+	rules        []database.AlertRule
+	settings     map[string]string
+	alerts       []database.Alert
+	newDevices   []database.USBEvent
+	knownDevices map[string]bool
+	usbSince     time.Time
+	productivity []database.UserProductivity
+	insertErr    error
+}
+
+func (f *fakeStore) GetAlertRules(ctx context.Context) ([]database.AlertRule, error) {
+	return f.rules, nil
+}
+
+func (f *fakeStore) GetSystemSettings(ctx context.Context) (map[string]string, error) {
+	return f.settings, nil
+}
+
+func (f *fakeStore) InsertAlert(ctx context.Context, alert *database.Alert) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.insertErr != nil {
+		return f.insertErr
+	}
+	f.alerts = append(f.alerts, *alert)
+	return nil
+}
+
+func (f *fakeStore) GetNewUSBDevices(ctx context.Context, since time.Time) ([]database.USBEvent, error) {
+	f.usbSince = since
+	devices := make([]database.USBEvent, 0)
+	for _, d := range f.newDevices {
+		if !f.knownDevices[d.DeviceID] {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func (f *fakeStore) AddKnownUSBDevices(ctx context.Context, devices []database.USBEvent) error {
+	if f.knownDevices == nil {
+		f.knownDevices = make(map[string]bool)
+	}
+	for _, d := range devices {
+		f.knownDevices[d.DeviceID] = true
+	}
+	return nil
+}
+
+func (f *fakeStore) GetUserProductivity(ctx context.Context, start, end time.Time) ([]database.UserProductivity, error) {
+	return f.productivity, nil
+}
+
+func testContext() context.Context {
+	return zapctx.WithLogger(context.Background(), zap.NewNop())
+}
+
+func rule(id, ruleType string, cooldown int, params string) database.AlertRule {
+	return database.AlertRule{
+		ID: id, Name: id, RuleType: ruleType, Severity: "high",
+		Enabled: true, CooldownMinutes: cooldown, Params: params,
+	}
+}
+
+func TestUSBRuleHonorsSettingAndCooldown(t *testing.T) {
+	ctx := testContext()
+	store := &fakeStore{
+		rules:    []database.AlertRule{rule("usb", RuleUSBConnection, 30, `{"event_types":["connected"]}`)},
+		settings: map[string]string{"alert_on_usb_events": "false"},
+	}
+	engine := NewEngine(store, time.UTC)
+	ev := database.USBEvent{ComputerName: "PC1", Username: "ivanov", DeviceID: "USB\\1", EventType: "connected"}
+
+	engine.ObserveUSB(ctx, ev)
+	if len(store.alerts) != 0 {
+		t.Fatalf("alert_on_usb_events=false must suppress alerts, got %d", len(store.alerts))
+	}
+
+	store.settings["alert_on_usb_events"] = "true"
+	engine.Invalidate()
+	engine.ObserveUSB(ctx, ev)
+	engine.ObserveUSB(ctx, ev)
+	engine.ObserveUSB(ctx, database.USBEvent{ComputerName: "PC1", Username: "ivanov", DeviceID: "USB\\1", EventType: "disconnected"})
+	if len(store.alerts) != 1 {
+		t.Fatalf("expected 1 alert within cooldown, got %d", len(store.alerts))
+	}
+
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(store.alerts[0].Metadata), &meta); err != nil {
+		t.Fatalf("metadata is not JSON: %v", err)
+	}
+	if meta["rule_id"] != "usb" || meta["device_id"] != "USB\\1" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+
+	// After the cooldown the rule fires again
+	engine.now = func() time.Time { return time.Now().Add(31 * time.Minute) }
+	engine.ObserveUSB(ctx, ev)
+	if len(store.alerts) != 2 {
+		t.Fatalf("expected alert after cooldown, got %d", len(store.alerts))
+	}
+}
+
+func TestFileCopyThresholds(t *testing.T) {
+	ctx := testContext()
+	store := &fakeStore{
+		rules: []database.AlertRule{
+			rule("large", RuleLargeFileCopy, 0, `{"min_size_mb":50,"usb_only":true}`),
+			rule("mass", RuleMassFileCopy, 0, `{}`),
+		},
+		settings: map[string]string{},
+	}
+	engine := NewEngine(store, time.UTC)
+
+	engine.ObserveFileCopy(ctx, database.FileCopyEvent{FileSize: 60 << 20, FileCount: 1, IsUSBTarget: 0})
+	if len(store.alerts) != 0 {
+		t.Fatalf("usb_only rule must ignore non-USB copies, got %d", len(store.alerts))
+	}
+
+	engine.ObserveFileCopy(ctx, database.FileCopyEvent{FileSize: 60 << 20, FileCount: 150, IsUSBTarget: 1})
+	if len(store.alerts) != 2 {
+		t.Fatalf("expected large and mass copy alerts, got %d", len(store.alerts))
+	}
+	if store.alerts[0].AlertType != RuleLargeFileCopy || store.alerts[1].AlertType != RuleMassFileCopy {
+		t.Errorf("unexpected alert types: %s, %s", store.alerts[0].AlertType, store.alerts[1].AlertType)
+	}
+}
+
+func TestSuspiciousProcessPattern(t *testing.T) {
+	ctx := testContext()
+	store := &fakeStore{
+		rules:    []database.AlertRule{rule("proc", RuleSuspiciousProcess, 0, `{"processes":["tor*.exe","anydesk.exe"]}`)},
+		settings: map[string]string{},
+	}
+	engine := NewEngine(store, time.UTC)
+
+	engine.ObserveProcess(ctx, time.Now(), "PC1", "ivanov", "chrome.exe", "")
+	engine.ObserveProcess(ctx, time.Now(), "PC1", "ivanov", "TorBrowser.exe", "")
+	engine.ObserveProcess(ctx, time.Now(), "PC1", "ivanov", "AnyDesk.exe", "")
+	if len(store.alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(store.alerts))
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	ctx := testContext()
+	store := &fakeStore{
+		rules: []database.AlertRule{
+			rule("newusb", RuleNewUSBDevice, 0, `{}`),
+			rule("prod", RuleLowProductivity, 1440, `{"min_active_minutes":60}`),
+		},
+		settings: map[string]string{"alert_on_low_productivity": "true", "productivity_threshold": "50"},
+		newDevices: []database.USBEvent{
+			{ComputerName: "PC1", Username: "ivanov", DeviceID: "USB\\NEW", DeviceName: "Flash"},
+		},
+		productivity: []database.UserProductivity{
+			{Username: "ivanov", ActiveSeconds: 7200, Productivity: 30},
+			{Username: "petrov", ActiveSeconds: 7200, Productivity: 80},
+			{Username: "sidorov", ActiveSeconds: 600, Productivity: 0},
+		},
+	}
+	engine := NewEngine(store, time.UTC)
+
+	engine.EvaluateAggregates(ctx)
+	engine.EvaluateAggregates(ctx)
+
+	var usb, prod int
+	for _, a := range store.alerts {
+		switch a.AlertType {
+		case RuleNewUSBDevice:
+			usb++
+		case RuleLowProductivity:
+			prod++
+			if a.Username != "ivanov" {
+				t.Errorf("unexpected low productivity alert for %s", a.Username)
+			}
+		}
+	}
+	// new_usb_device has no cooldown; the device is known after the first alert
+	if usb != 1 {
+		t.Errorf("new USB device alerts = %d, want 1", usb)
+	}
+	if prod != 1 {
+		t.Errorf("low productivity alerts = %d, want 1 (cooldown)", prod)
+	}
+}
+
+func TestNewUSBDeviceRetriedUntilAlertStored(t *testing.T) {
+	ctx := testContext()
+	store := &fakeStore{
+		rules:      []database.AlertRule{rule("newusb", RuleNewUSBDevice, 0, `{}`)},
+		settings:   map[string]string{},
+		newDevices: []database.USBEvent{{ComputerName: "PC1", Username: "ivanov", DeviceID: "USB\\NEW"}},
+		insertErr:  errors.New("clickhouse: connection refused"),
+	}
+	engine := NewEngine(store, time.UTC)
+	start := engine.lastUSBCheck
+
+	now := start.Add(time.Minute)
+	engine.now = func() time.Time { return now }
+	engine.EvaluateAggregates(ctx)
+	if store.knownDevices["USB\\NEW"] || !engine.lastUSBCheck.Equal(start) {
+		t.Fatal("device must stay unknown and the cursor in place when the alert is lost")
+	}
+	if want := start.Add(-usbCheckOverlap); !store.usbSince.Equal(want) {
+		t.Errorf("since = %v, want %v", store.usbSince, want)
+	}
+
+	store.insertErr = nil
+	engine.EvaluateAggregates(ctx)
+	if len(store.alerts) != 1 || !store.knownDevices["USB\\NEW"] || !engine.lastUSBCheck.Equal(now) {
+		t.Fatalf("alerts = %d, known = %v, cursor = %v", len(store.alerts), store.knownDevices, engine.lastUSBCheck)
+	}
+}
+
+func TestCooldownsArePruned(t *testing.T) {
+	ctx := testContext()
+	store := &fakeStore{
+		rules:    []database.AlertRule{rule("proc", RuleSuspiciousProcess, 30, `{"processes":["tor*.exe"]}`)},
+		settings: map[string]string{},
+	}
+	engine := NewEngine(store, time.UTC)
+	start := time.Now()
+	engine.now = func() time.Time { return start }
+
+	engine.ObserveProcess(ctx, start, "PC1", "ivanov", "tor.exe", "")
+	engine.lastFired["deleted|PC1|ivanov|tor.exe"] = start
+
+	engine.EvaluateAggregates(ctx)
+	if len(engine.lastFired) != 1 {
+		t.Fatalf("entries = %v, want only the one of the current rule", engine.lastFired)
+	}
+
+	engine.now = func() time.Time { return start.Add(30 * time.Minute) }
+	engine.EvaluateAggregates(ctx)
+	if len(engine.lastFired) != 0 {
+		t.Errorf("entries past the cooldown must be evicted, got %v", engine.lastFired)
+	}
+}
+
+func TestParseParamsValidation(t *testing.T) {
+	if _, err := ParseParams(RuleSuspiciousProcess, `{"processes":["[bad"]}`); err == nil {
+		t.Error("expected error for invalid glob")
+	}
+	if _, err := ParseParams(RuleLowProductivity, `{"threshold":150}`); err == nil {
+		t.Error("expected error for threshold > 100")
+	}
+	p, err := ParseParams(RuleLargeFileCopy, ``)
+	if err != nil || p.MinSizeMB != 100 {
+		t.Errorf("default min_size_mb = %d, err = %v", p.MinSizeMB, err)
+	}
+}
+
+type recordingNotifier struct {
+	alerts []database.Alert
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert database.Alert) {
+	n.alerts = append(n.alerts, alert)
+}
+
+func TestNotifierReceivesStoredAlerts(t *testing.T) {
+	ctx := testContext()
+	store := &fakeStore{
+		rules:    []database.AlertRule{rule("big", RuleLargeFileCopy, 0, `{"min_size_mb":10}`)},
+		settings: map[string]string{},
+	}
+	notifier := &recordingNotifier{}
+	engine := NewEngine(store, time.UTC)
+	engine.SetNotifier(notifier)
+
+	engine.ObserveFileCopy(ctx, database.FileCopyEvent{ComputerName: "PC1", Username: "ivanov", FileSize: 50 << 20})
+	engine.ObserveFileCopy(ctx, database.FileCopyEvent{ComputerName: "PC1", Username: "ivanov", FileSize: 1 << 20})
+
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifier.alerts))
+	}
+	if notifier.alerts[0].AlertType != RuleLargeFileCopy || notifier.alerts[0].Severity != "high" {
+		t.Fatalf("unexpected notification: %+v", notifier.alerts[0])
+	}
+}
@@ -0,0 +1,407 @@
+// Package attendance derives an employee's working day from activity
+// segments: arrival and departure, presence, breaks, and late arrivals,
+// early departures and overtime against the working schedule. Days are
+// computed in the location of the month passed to Build.
+package attendance
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+)
+
+// Day statuses
+const (
+	StatusPresent      = "present"        // working day with activity
+	StatusAbsent       = "absent"         // working day without activity
+	StatusDayOff       = "day_off"        // weekend without activity
+	StatusHoliday      = "holiday"        // holiday without activity
+	StatusWorkedDayOff = "worked_day_off" // activity on a weekend or holiday
+	StatusUpcoming     = "upcoming"       // not over yet and no activity so far
+)
+
+// Defaults when the working_hours_* settings are empty or invalid
+const (
+	DefaultStart = "09:00"
+	DefaultEnd   = "18:00"
+)
+
+// DefaultMinBreak is used when max_idle_time_minutes is not set
+const DefaultMinBreak = 15 * time.Minute
+
+// Schedule is a working day from Start to End on Days
+type Schedule struct {
+	Start time.Duration // since midnight
+	End   time.Duration
+	Days  [7]bool // indexed by time.Weekday
+}
+
+// NewSchedule parses HH:MM times and ISO weekdays (1 Monday .. 7 Sunday).
+// Without days the week is Monday to Friday.
+func NewSchedule(start, end string, days []int) (Schedule, error) {
+	var s Schedule
+	var err error
+	if s.Start, err = ParseClock(start); err != nil {
+		return s, fmt.Errorf("invalid start: %w", err)
+	}
+	if s.End, err = ParseClock(end); err != nil {
+		return s, fmt.Errorf("invalid end: %w", err)
+	}
+	if s.End <= s.Start {
+		return s, fmt.Errorf("end must be after start")
+	}
+
+	if len(days) == 0 {
+		days = []int{1, 2, 3, 4, 5}
+	}
+	for _, d := range days {
+		if d < 1 || d > 7 {
+			return s, fmt.Errorf("invalid weekday %d, use 1 (Monday) to 7 (Sunday)", d)
+		}
+		s.Days[d%7] = true
+	}
+	return s, nil
+}
+
+// DefaultSchedule is the company schedule from the working_hours_start and
+// working_hours_end settings, Monday to Friday
+func DefaultSchedule(settings map[string]string) Schedule {
+	s, err := NewSchedule(settings["working_hours_start"], settings["working_hours_end"], nil)
+	if err != nil {
+		s, _ = NewSchedule(DefaultStart, DefaultEnd, nil)
+	}
+	return s
+}
+
+// WorkDays returns the ISO weekdays of the schedule
+func (s Schedule) WorkDays() []int {
+	days := make([]int, 0, 7)
+	for d := 1; d <= 7; d++ {
+		if s.Days[d%7] {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// ParseClock parses a time of day like 09:00 or 9:30
+func ParseClock(s string) (time.Duration, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hours, err1 := strconv.Atoi(h)
+	minutes, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("%q is not a time of day (HH:MM)", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// FormatClock formats a time of day as HH:MM
+func FormatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// EmployeeSchedule is the employee's override, or the company schedule when
+// there is none or it no longer parses
+func EmployeeSchedule(company Schedule, override *database.WorkSchedule) (Schedule, bool) {
+	if override == nil {
+		return company, false
+	}
+	s, err := NewSchedule(override.WorkStart, override.WorkEnd, override.WorkDays)
+	if err != nil {
+		return company, false
+	}
+	return s, true
+}
+
+// MinBreak is the max_idle_time_minutes setting: the agent reports idle time
+// only after that long, so shorter gaps are not breaks
+func MinBreak(settings map[string]string) time.Duration {
+	if m, err := strconv.Atoi(settings["max_idle_time_minutes"]); err == nil && m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return DefaultMinBreak
+}
+
+// ScheduleInfo describes the schedule a timesheet was measured against
+type ScheduleInfo struct {
+	Start    string `json:"start"` // HH:MM
+	End      string `json:"end"`
+	WorkDays []int  `json:"work_days"` // 1 Monday .. 7 Sunday
+	Custom   bool   `json:"custom"`    // a per-employee override
+}
+
+// Info describes the schedule
+func (s Schedule) Info(custom bool) ScheduleInfo {
+	return ScheduleInfo{Start: FormatClock(s.Start), End: FormatClock(s.End), WorkDays: s.WorkDays(), Custom: custom}
+}
+
+// Calendar holds the holidays and transferred working days by date
+type Calendar map[string]database.Holiday
+
+// NewCalendar indexes holidays by their YYYY-MM-DD date
+func NewCalendar(holidays []database.Holiday) Calendar {
+	c := make(Calendar, len(holidays))
+	for _, h := range holidays {
+		c[h.Date] = h
+	}
+	return c
+}
+
+// Options tunes the derivation
+type Options struct {
+	// MinBreak is the shortest gap between activities counted as a break;
+	// shorter gaps count as presence
+	MinBreak time.Duration
+	// Now ends the data: later days are upcoming, and today is not judged
+	// absent or left early before the working day is over
+	Now time.Time
+}
+
+// Break is a gap in activity during a day
+type Break struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Seconds int64     `json:"seconds"`
+}
+
+// Day is one calendar day of a timesheet. Times are nil when there was no
+// activity or, for the schedule, on days off.
+type Day struct {
+	Date              string     `json:"date"`    // YYYY-MM-DD
+	Weekday           int        `json:"weekday"` // 1 Monday .. 7 Sunday
+	Status            string     `json:"status"`
+	Holiday           string     `json:"holiday,omitempty"`
+	ScheduledStart    *time.Time `json:"scheduled_start"`
+	ScheduledEnd      *time.Time `json:"scheduled_end"`
+	ScheduledSeconds  int64      `json:"scheduled_seconds"`
+	FirstActivity     *time.Time `json:"first_activity"`
+	LastActivity      *time.Time `json:"last_activity"`
+	PresenceSeconds   int64      `json:"presence_seconds"` // first to last activity without breaks
+	ActiveSeconds     int64      `json:"active_seconds"`
+	BreakSeconds      int64      `json:"break_seconds"`
+	Breaks            []Break    `json:"breaks"`
+	LateSeconds       int64      `json:"late_seconds"`
+	EarlyLeaveSeconds int64      `json:"early_leave_seconds"`
+	OvertimeSeconds   int64      `json:"overtime_seconds"` // presence outside the schedule
+}
+
+// Totals sums the days of a timesheet
+type Totals struct {
+	WorkDays          int   `json:"work_days"` // scheduled working days
+	PresentDays       int   `json:"present_days"`
+	AbsentDays        int   `json:"absent_days"`
+	WorkedDaysOff     int   `json:"worked_days_off"`
+	LateDays          int   `json:"late_days"`
+	EarlyLeaveDays    int   `json:"early_leave_days"`
+	ScheduledSeconds  int64 `json:"scheduled_seconds"`
+	PresenceSeconds   int64 `json:"presence_seconds"`
+	ActiveSeconds     int64 `json:"active_seconds"`
+	BreakSeconds      int64 `json:"break_seconds"`
+	LateSeconds       int64 `json:"late_seconds"`
+	EarlyLeaveSeconds int64 `json:"early_leave_seconds"`
+	OvertimeSeconds   int64 `json:"overtime_seconds"`
+}
+
+// Month is the attendance of one employee over a calendar month
+type Month struct {
+	Days   []Day  `json:"days"`
+	Totals Totals `json:"totals"`
+}
+
+// Timesheet is an employee's month with the schedule it was measured against
+type Timesheet struct {
+	database.AttendanceEmployee
+	Period   string       `json:"month"` // YYYY-MM
+	Schedule ScheduleInfo `json:"schedule"`
+	Month
+}
+
+type interval struct{ start, end time.Time }
+
+// Build derives the days of the month starting at month (in its location)
+// from one employee's segments
+func Build(month time.Time, segments []database.AttendanceSegment, s Schedule, cal Calendar, opts Options) Month {
+	if opts.MinBreak <= 0 {
+		opts.MinBreak = DefaultMinBreak
+	}
+	loc := month.Location()
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, loc)
+	next := first.AddDate(0, 1, 0)
+
+	active := make([]interval, 0, len(segments))
+	for _, seg := range segments {
+		if seg.End.After(seg.Start) {
+			active = append(active, interval{seg.Start, seg.End})
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].start.Before(active[j].start) })
+
+	var m Month
+	for day := first; day.Before(next); day = day.AddDate(0, 0, 1) {
+		d := buildDay(day, active, s, cal, opts)
+		m.Days = append(m.Days, d)
+		m.Totals.add(d)
+	}
+	return m
+}
+
+func buildDay(day time.Time, active []interval, s Schedule, cal Calendar, opts Options) Day {
+	end := day.AddDate(0, 0, 1)
+	date := day.Format("2006-01-02")
+	d := Day{Date: date, Weekday: (int(day.Weekday())+6)%7 + 1, Breaks: []Break{}}
+
+	working := s.Days[day.Weekday()]
+	if h, ok := cal[date]; ok {
+		working = h.Workday
+		d.Holiday = h.Name
+	}
+
+	var window interval
+	if working {
+		window = interval{clock(day, s.Start), clock(day, s.End)}
+		d.ScheduledStart, d.ScheduledEnd = &window.start, &window.end
+		d.ScheduledSeconds = seconds(window.end.Sub(window.start))
+	}
+
+	// Activity of the day, merged across overlapping segments of several computers
+	raw := clip(active, interval{day, end})
+	for _, iv := range merge(raw, 0) {
+		d.ActiveSeconds += seconds(iv.end.Sub(iv.start))
+	}
+	presence := merge(raw, opts.MinBreak)
+
+	finished := opts.Now.IsZero() || !opts.Now.Before(end) || (working && !opts.Now.Before(window.end))
+	switch {
+	case len(presence) == 0 && !opts.Now.IsZero() && !opts.Now.After(day):
+		d.Status = StatusUpcoming
+		return d
+	case len(presence) == 0 && working && !finished:
+		d.Status = StatusUpcoming
+		return d
+	case len(presence) == 0 && working:
+		d.Status = StatusAbsent
+		return d
+	case len(presence) == 0 && d.Holiday != "":
+		d.Status = StatusHoliday
+		return d
+	case len(presence) == 0:
+		d.Status = StatusDayOff
+		return d
+	case working:
+		d.Status = StatusPresent
+	default:
+		d.Status = StatusWorkedDayOff
+	}
+
+	firstActivity, lastActivity := presence[0].start, presence[len(presence)-1].end
+	d.FirstActivity, d.LastActivity = &firstActivity, &lastActivity
+	for i, iv := range presence {
+		d.PresenceSeconds += seconds(iv.end.Sub(iv.start))
+		if i > 0 {
+			b := Break{Start: presence[i-1].end, End: iv.start, Seconds: seconds(iv.start.Sub(presence[i-1].end))}
+			d.Breaks = append(d.Breaks, b)
+			d.BreakSeconds += b.Seconds
+		}
+	}
+
+	if !working {
+		d.OvertimeSeconds = d.PresenceSeconds
+		return d
+	}
+	scheduled := window.end.Sub(window.start)
+	d.LateSeconds = seconds(clamp(firstActivity.Sub(window.start), scheduled))
+	if finished {
+		d.EarlyLeaveSeconds = seconds(clamp(window.end.Sub(lastActivity), scheduled))
+	}
+	inside := clip(presence, window)
+	var insideSeconds int64
+	for _, iv := range inside {
+		insideSeconds += seconds(iv.end.Sub(iv.start))
+	}
+	d.OvertimeSeconds = d.PresenceSeconds - insideSeconds
+	return d
+}
+
+func (t *Totals) add(d Day) {
+	switch d.Status {
+	case StatusPresent:
+		t.PresentDays++
+	case StatusAbsent:
+		t.AbsentDays++
+	case StatusWorkedDayOff:
+		t.PresentDays++
+		t.WorkedDaysOff++
+	}
+	if d.ScheduledStart != nil {
+		t.WorkDays++
+	}
+	if d.LateSeconds > 0 {
+		t.LateDays++
+	}
+	if d.EarlyLeaveSeconds > 0 {
+		t.EarlyLeaveDays++
+	}
+	t.ScheduledSeconds += d.ScheduledSeconds
+	t.PresenceSeconds += d.PresenceSeconds
+	t.ActiveSeconds += d.ActiveSeconds
+	t.BreakSeconds += d.BreakSeconds
+	t.LateSeconds += d.LateSeconds
+	t.EarlyLeaveSeconds += d.EarlyLeaveSeconds
+	t.OvertimeSeconds += d.OvertimeSeconds
+}
+
+// clip cuts sorted intervals to the window
+func clip(intervals []interval, window interval) []interval {
+	out := make([]interval, 0)
+	for _, iv := range intervals {
+		if !iv.end.After(window.start) || !iv.start.Before(window.end) {
+			continue
+		}
+		if iv.start.Before(window.start) {
+			iv.start = window.start
+		}
+		if iv.end.After(window.end) {
+			iv.end = window.end
+		}
+		out = append(out, iv)
+	}
+	return out
+}
+
+// merge joins sorted intervals that overlap or are less than gap apart
+func merge(intervals []interval, gap time.Duration) []interval {
+	out := make([]interval, 0, len(intervals))
+	for _, iv := range intervals {
+		if n := len(out); n > 0 && (!iv.start.After(out[n-1].end) || iv.start.Sub(out[n-1].end) < gap) {
+			if iv.end.After(out[n-1].end) {
+				out[n-1].end = iv.end
+			}
+			continue
+		}
+		out = append(out, iv)
+	}
+	return out
+}
+
+// clock returns the time of day on day; time.Date keeps it right on DST changes
+func clock(day time.Time, d time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(d/time.Minute), 0, 0, day.Location())
+}
+
+func clamp(d, max time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
@@ -0,0 +1,126 @@
+package attendance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+)
+
+var msk = time.FixedZone("MSK", 3*3600)
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2025, 3, day, hour, minute, 0, 0, msk)
+}
+
+func seg(day, h1, m1, h2, m2 int) database.AttendanceSegment {
+	return database.AttendanceSegment{Username: "ivanov", Start: at(day, h1, m1), End: at(day, h2, m2)}
+}
+
+func TestBuildMonth(t *testing.T) {
+	s, err := NewSchedule("09:00", "18:00", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := NewCalendar([]database.Holiday{
+		{Date: "2025-03-01", Name: "Рабочая суббота", Workday: true},
+		{Date: "2025-03-08", Name: "Международный женский день"},
+	})
+	segments := []database.AttendanceSegment{
+		// Monday: late, a short gap, a lunch break and staying late
+		seg(3, 9, 20, 12, 0), seg(3, 12, 5, 13, 0), seg(3, 14, 0, 19, 30),
+		// Tuesday: early arrival and early departure
+		seg(4, 8, 30, 16, 0),
+		// Thursday: two computers at once
+		seg(6, 10, 0, 11, 0), seg(6, 10, 30, 11, 30),
+		// Saturday holiday
+		seg(8, 10, 0, 12, 0),
+	}
+	m := Build(at(1, 0, 0), segments, s, cal, Options{MinBreak: 15 * time.Minute, Now: at(20, 12, 0)})
+
+	if len(m.Days) != 31 {
+		t.Fatalf("%d days", len(m.Days))
+	}
+	day := func(n int) Day { return m.Days[n-1] }
+
+	mon := day(3)
+	if mon.Status != StatusPresent || !mon.FirstActivity.Equal(at(3, 9, 20)) || !mon.LastActivity.Equal(at(3, 19, 30)) {
+		t.Errorf("Monday = %+v", mon)
+	}
+	if mon.LateSeconds != 20*60 || mon.EarlyLeaveSeconds != 0 || mon.OvertimeSeconds != 90*60 {
+		t.Errorf("Monday late %d, early %d, overtime %d", mon.LateSeconds, mon.EarlyLeaveSeconds, mon.OvertimeSeconds)
+	}
+	if mon.PresenceSeconds != (3*60+40+5*60+30)*60 || mon.ActiveSeconds != (9*60+5)*60 {
+		t.Errorf("Monday presence %d, active %d", mon.PresenceSeconds, mon.ActiveSeconds)
+	}
+	if len(mon.Breaks) != 1 || !mon.Breaks[0].Start.Equal(at(3, 13, 0)) || mon.BreakSeconds != 3600 {
+		t.Errorf("Monday breaks = %+v", mon.Breaks)
+	}
+
+	if tue := day(4); tue.LateSeconds != 0 || tue.EarlyLeaveSeconds != 2*3600 || tue.OvertimeSeconds != 30*60 {
+		t.Errorf("Tuesday = %+v", tue)
+	}
+	if thu := day(6); thu.ActiveSeconds != 90*60 || thu.PresenceSeconds != 90*60 {
+		t.Errorf("Thursday active %d, presence %d", thu.ActiveSeconds, thu.PresenceSeconds)
+	}
+	if sat := day(1); sat.Status != StatusAbsent || sat.Holiday != "Рабочая суббота" || sat.ScheduledSeconds != 9*3600 {
+		t.Errorf("working Saturday = %+v", sat)
+	}
+	if hol := day(8); hol.Status != StatusWorkedDayOff || hol.OvertimeSeconds != 2*3600 || hol.ScheduledStart != nil {
+		t.Errorf("holiday = %+v", hol)
+	}
+	if sun := day(9); sun.Status != StatusDayOff {
+		t.Errorf("Sunday = %s", sun.Status)
+	}
+	if day(19).Status != StatusAbsent || day(20).Status != StatusUpcoming || day(21).Status != StatusUpcoming {
+		t.Errorf("statuses around now = %s, %s, %s", day(19).Status, day(20).Status, day(21).Status)
+	}
+
+	// 1 Mar plus 21 weekdays, 8 Mar falls on a Saturday
+	tot := m.Totals
+	if tot.WorkDays != 22 || tot.PresentDays != 4 || tot.WorkedDaysOff != 1 || tot.LateDays != 2 || tot.EarlyLeaveDays != 2 {
+		t.Errorf("totals = %+v", tot)
+	}
+	// Absent: 1, 5, 7, 10-14, 17-19 March
+	if tot.AbsentDays != 11 {
+		t.Errorf("absent days = %d", tot.AbsentDays)
+	}
+}
+
+func TestBuildTodayBeforeEndOfDay(t *testing.T) {
+	s, _ := NewSchedule("09:00", "18:00", nil)
+	m := Build(at(1, 0, 0), []database.AttendanceSegment{seg(17, 9, 0, 11, 0)}, s, nil, Options{Now: at(17, 11, 5)})
+	today := m.Days[16]
+	if today.Status != StatusPresent || today.EarlyLeaveSeconds != 0 {
+		t.Errorf("today = %+v, want no early departure yet", today)
+	}
+}
+
+func TestNewSchedule(t *testing.T) {
+	s, err := NewSchedule("8:30", "17:00", []int{1, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Start != 8*time.Hour+30*time.Minute || !s.Days[time.Saturday] || s.Days[time.Sunday] {
+		t.Errorf("schedule = %+v", s)
+	}
+	if got := s.WorkDays(); len(got) != 6 || got[5] != 6 {
+		t.Errorf("WorkDays = %v", got)
+	}
+	if FormatClock(s.Start) != "08:30" {
+		t.Errorf("FormatClock = %s", FormatClock(s.Start))
+	}
+
+	for _, tt := range [][2]string{{"18:00", "09:00"}, {"9", "18:00"}, {"09:00", "25:00"}, {"09:60", "18:00"}} {
+		if _, err := NewSchedule(tt[0], tt[1], nil); err == nil {
+			t.Errorf("NewSchedule(%q, %q) succeeded", tt[0], tt[1])
+		}
+	}
+	if _, err := NewSchedule("09:00", "18:00", []int{0}); err == nil {
+		t.Error("weekday 0 accepted")
+	}
+
+	if d := DefaultSchedule(map[string]string{"working_hours_start": "bogus"}); d.Start != 9*time.Hour || d.End != 18*time.Hour {
+		t.Errorf("DefaultSchedule = %+v", d)
+	}
+}
@@ -0,0 +1,91 @@
+// Package auth implements operator authentication for the dashboard API:
+// password hashing, signed session tokens and role checks.
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Operator roles
+const (
+	RoleAdmin          = "admin"
+	RoleHRManager      = "hr_manager"
+	RoleDepartmentHead = "department_head"
+)
+
+// ErrInvalidCredentials is returned when username or password don't match
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// IsValidRole reports whether role is one of the known operator roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleHRManager, RoleDepartmentHead:
+		return true
+	}
+	return false
+}
+
+// Principal is the authenticated operator acting on a request
+type Principal struct {
+	Username   string `json:"username"`
+	FullName   string `json:"full_name"`
+	Role       string `json:"role"`
+	Department string `json:"department,omitempty"`
+}
+
+// HasRole reports whether the principal has one of the given roles
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, r := range roles {
+		if p.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// DepartmentScoped reports whether the principal only sees its own department
+func (p *Principal) DepartmentScoped() bool {
+	return p.Role == RoleDepartmentHead
+}
+
+// CanViewDepartment reports whether employees of the given department are visible to the principal
+func (p *Principal) CanViewDepartment(department string) bool {
+	if !p.DepartmentScoped() {
+		return true
+	}
+	return p.Department != "" && p.Department == department
+}
+
+// principalKey holds the context key used for the acting operator
+type principalKey struct{}
+
+// WithPrincipal returns a new context derived from ctx that carries the acting operator
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the acting operator, or nil for unauthenticated contexts
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// HashPassword returns a bcrypt hash of the password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword compares a bcrypt hash with a plain password
+func CheckPassword(hash, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
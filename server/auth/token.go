@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens or bad signatures
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for expired or revoked tokens
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Claims is the payload of a session token (HS256 JWT)
+type Claims struct {
+	ID         string `json:"jti"`
+	Subject    string `json:"sub"`
+	Role       string `json:"role"`
+	Department string `json:"dept,omitempty"`
+	IssuedAt   int64  `json:"iat"`
+	ExpiresAt  int64  `json:"exp"`
+}
+
+// TokenManager issues and validates HS256 session tokens.
+// Logged out tokens are kept in a deny list until they expire.
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	revoked  map[string]time.Time
+	subjects map[string]int64
+}
+
+// NewTokenManager creates a token manager with the given signing secret and session TTL
+func NewTokenManager(secret []byte, ttl time.Duration) *TokenManager {
+	return &TokenManager{
+		secret:   secret,
+		ttl:      ttl,
+		revoked:  make(map[string]time.Time),
+		subjects: make(map[string]int64),
+	}
+}
+
+// TTL returns the session lifetime
+func (tm *TokenManager) TTL() time.Duration {
+	return tm.ttl
+}
+
+// Issue signs a new session token for the principal
+func (tm *TokenManager) Issue(p *Principal) (string, *Claims, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		ID:         hex.EncodeToString(id),
+		Subject:    p.Username,
+		Role:       p.Role,
+		Department: p.Department,
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  now.Add(tm.ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tm.sign(unsigned), claims, nil
+}
+
+// Parse validates the signature, expiry and revocation of a token
+func (tm *TokenManager) Parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+
+	expected := tm.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	tm.mu.Lock()
+	_, revoked := tm.revoked[claims.ID]
+	revokedBefore, subjectRevoked := tm.subjects[claims.Subject]
+	tm.mu.Unlock()
+	if revoked || (subjectRevoked && claims.IssuedAt <= revokedBefore) {
+		return nil, ErrTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// Revoke invalidates a token until its natural expiry
+func (tm *TokenManager) Revoke(claims *Claims) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range tm.revoked {
+		if now.After(exp) {
+			delete(tm.revoked, id)
+		}
+	}
+	tm.revoked[claims.ID] = time.Unix(claims.ExpiresAt, 0)
+}
+
+// RevokeSubject invalidates every token issued to the user so far
+// (used when an operator is deactivated or its role changes)
+func (tm *TokenManager) RevokeSubject(username string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.subjects[username] = time.Now().Unix()
+}
+
+func (tm *TokenManager) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, tm.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// tokenHeader is the base64url encoded {"alg":"HS256","typ":"JWT"}
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueAndParse(t *testing.T) {
+	tm := NewTokenManager([]byte("secret"), time.Hour)
+	p := &Principal{Username: "ivanov", Role: RoleDepartmentHead, Department: "Sales"}
+
+	token, issued, err := tm.Issue(p)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	claims, err := tm.Parse(token)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims.Subject != "ivanov" || claims.Role != RoleDepartmentHead || claims.Department != "Sales" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if claims.ID != issued.ID {
+		t.Errorf("token id = %q, want %q", claims.ID, issued.ID)
+	}
+}
+
+func TestParseRejectsTampering(t *testing.T) {
+	tm := NewTokenManager([]byte("secret"), time.Hour)
+	token, _, err := tm.Issue(&Principal{Username: "ivanov", Role: RoleHRManager})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	other := NewTokenManager([]byte("other"), time.Hour)
+	if _, err := other.Parse(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("foreign secret: err = %v, want ErrInvalidToken", err)
+	}
+
+	parts := strings.Split(token, ".")
+	forged, _, _ := tm.Issue(&Principal{Username: "ivanov", Role: RoleAdmin})
+	parts[1] = strings.Split(forged, ".")[1]
+	if _, err := tm.Parse(strings.Join(parts, ".")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("swapped payload: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestParseExpiredAndRevoked(t *testing.T) {
+	expired := NewTokenManager([]byte("secret"), -time.Second)
+	token, _, _ := expired.Issue(&Principal{Username: "ivanov", Role: RoleAdmin})
+	if _, err := expired.Parse(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expired: err = %v, want ErrTokenExpired", err)
+	}
+
+	tm := NewTokenManager([]byte("secret"), time.Hour)
+	token, claims, _ := tm.Issue(&Principal{Username: "ivanov", Role: RoleAdmin})
+	tm.Revoke(claims)
+	if _, err := tm.Parse(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("revoked: err = %v, want ErrTokenExpired", err)
+	}
+
+	token, _, _ = tm.Issue(&Principal{Username: "petrov", Role: RoleHRManager})
+	tm.RevokeSubject("petrov")
+	if _, err := tm.Parse(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("revoked subject: err = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestCanViewDepartment(t *testing.T) {
+	head := &Principal{Role: RoleDepartmentHead, Department: "Sales"}
+	if !head.CanViewDepartment("Sales") || head.CanViewDepartment("IT") {
+		t.Error("department head must only see own department")
+	}
+
+	noDept := &Principal{Role: RoleDepartmentHead}
+	if noDept.CanViewDepartment("") {
+		t.Error("department head without department must see nothing")
+	}
+
+	hr := &Principal{Role: RoleHRManager}
+	if !hr.CanViewDepartment("IT") {
+		t.Error("HR manager must see every department")
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := HashPassword("s3cret")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if err := CheckPassword(hash, "s3cret"); err != nil {
+		t.Errorf("CheckPassword(correct) = %v", err)
+	}
+	if err := CheckPassword(hash, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("CheckPassword(wrong) = %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/auth"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// agentComputerKey is the gin context key holding the computer name an agent key belongs to
+const agentComputerKey = "agent_computer_name"
+
+// agentKeyCache caches validated per-agent key hashes so ingest requests
+// don't hit ClickHouse on every call
+type agentKeyCache struct {
+	mu      sync.RWMutex
+	entries map[string]agentKeyEntry
+	ttl     time.Duration
+}
+
+type agentKeyEntry struct {
+	computerName string
+	cachedAt     time.Time
+}
+
+// newAgentKeyCache creates a key cache with specified TTL
+func newAgentKeyCache(ttl time.Duration) *agentKeyCache {
+	return &agentKeyCache{
+		entries: make(map[string]agentKeyEntry),
+		ttl:     ttl,
+	}
+}
+
+// Get returns the computer name for a cached key hash
+func (kc *agentKeyCache) Get(keyHash string) (string, bool) {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+
+	entry, ok := kc.entries[keyHash]
+	if !ok || time.Since(entry.cachedAt) >= kc.ttl {
+		return "", false
+	}
+	return entry.computerName, true
+}
+
+// Set caches a validated key hash
+func (kc *agentKeyCache) Set(keyHash, computerName string) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	kc.entries[keyHash] = agentKeyEntry{computerName: computerName, cachedAt: time.Now()}
+}
+
+// InvalidateComputer drops every cached key of a computer (after rotate/revoke)
+func (kc *agentKeyCache) InvalidateComputer(computerName string) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	for hash, entry := range kc.entries {
+		if entry.computerName == computerName {
+			delete(kc.entries, hash)
+		}
+	}
+}
+
+// generateAPIKey returns a new random API key (64 hex chars)
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashAPIKey returns the SHA-256 hex digest stored in agent_configs.api_key.
+// Plain keys are only ever shown once, when issued.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// isMasterAPIKey checks key against the global server.api_key
+func isMasterAPIKey(key string) bool {
+	if cfg.Server.APIKey == "" || key == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(cfg.Server.APIKey)) == 1
+}
+
+// findAgentByAPIKeyHash resolves a per-agent key hash to its computer, or ""
+// for unknown and revoked keys; tests replace it
+var findAgentByAPIKeyHash = func(ctx context.Context, keyHash string) (string, error) {
+	return db.FindAgentByAPIKeyHash(ctx, keyHash)
+}
+
+// agentAuthMiddleware validates X-API-Key on agent ingest endpoints.
+// Accepts the global key or a per-computer key issued via the admin API; the
+// handlers pin a per-computer key to its computer with agentComputerName.
+func agentAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		key := c.GetHeader("X-API-Key")
+
+		if key == "" {
+			if !cfg.Security.RequireAgentAuth {
+				c.Next()
+				return
+			}
+			zapctx.Warn(ctx, "Agent request without API key",
+				zap.String("path", c.FullPath()),
+				zap.String("remote_addr", c.ClientIP()))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+			return
+		}
+
+		if isMasterAPIKey(key) {
+			c.Next()
+			return
+		}
+
+		keyHash := hashAPIKey(key)
+		computerName, ok := agentKeys.Get(keyHash)
+		if !ok {
+			name, err := findAgentByAPIKeyHash(ctx, keyHash)
+			if err != nil {
+				zapctx.Error(ctx, "Failed to validate agent API key", zap.Error(err))
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication unavailable"})
+				return
+			}
+			if name == "" {
+				zapctx.Warn(ctx, "Agent request with invalid API key",
+					zap.String("path", c.FullPath()),
+					zap.String("remote_addr", c.ClientIP()))
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			agentKeys.Set(keyHash, name)
+			computerName = name
+		}
+
+		c.Set(agentComputerKey, computerName)
+		c.Next()
+	}
+}
+
+// sessionCookieName is the cookie carrying the operator session token (for <img> and downloads)
+const sessionCookieName = "om_session"
+
+// operatorAuthMiddleware authenticates dashboard operators by session token
+// (Authorization: Bearer or session cookie). The global X-API-Key acts as admin
+// for scripts and integrations.
+func operatorAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var principal *auth.Principal
+		if isMasterAPIKey(c.GetHeader("X-API-Key")) {
+			principal = &auth.Principal{Username: "api", Role: auth.RoleAdmin}
+		} else {
+			token := sessionToken(c)
+			if token == "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+				return
+			}
+
+			claims, err := sessions.Parse(token)
+			if err != nil {
+				zapctx.Debug(ctx, "Rejected session token", zap.Error(err), zap.String("path", c.FullPath()))
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired or invalid"})
+				return
+			}
+
+			principal = &auth.Principal{
+				Username:   claims.Subject,
+				Role:       claims.Role,
+				Department: claims.Department,
+			}
+			// Department scoping relies on a non-empty department
+			if principal.DepartmentScoped() && principal.Department == "" {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No department assigned to this operator"})
+				return
+			}
+			c.Set(sessionClaimsKey, claims)
+		}
+
+		ctx = auth.WithPrincipal(ctx, principal)
+		ctx = zapctx.WithFields(ctx, zap.String("actor", principal.Username))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// sessionClaimsKey is the gin context key holding the parsed session token
+const sessionClaimsKey = "session_claims"
+
+// sessionToken extracts the session token from the Authorization header or cookie
+func sessionToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	if cookie, err := c.Cookie(sessionCookieName); err == nil {
+		return cookie
+	}
+	return ""
+}
+
+// requireRole allows the request only for operators with one of the given roles
+func requireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := auth.FromContext(c.Request.Context())
+		if p == nil || !p.HasRole(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireEmployeeAccess checks that a department head only opens employees of its own department.
+// param is the route parameter holding the username.
+func requireEmployeeAccess(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorizeEmployee(c, c.Param(param)) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireComputerAccess checks the computer_name query parameter against the department of a department head
+func requireComputerAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		p := auth.FromContext(ctx)
+		computerName := c.Query("computer_name")
+		if p == nil || !p.DepartmentScoped() || computerName == "" {
+			c.Next()
+			return
+		}
+
+		ok, err := db.IsComputerInDepartment(ctx, computerName, p.Department)
+		if err != nil {
+			zapctx.Error(ctx, "Failed to check computer department", zap.Error(err), zap.String("computer_name", computerName))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			return
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access to this computer is not allowed"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorizeEmployee checks access to a single employee and writes the error response on failure
+func authorizeEmployee(c *gin.Context, username string) bool {
+	ctx := c.Request.Context()
+	p := auth.FromContext(ctx)
+	if p == nil || !p.DepartmentScoped() {
+		return true
+	}
+
+	department, err := db.GetEmployeeDepartment(ctx, username)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get employee department", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return false
+	}
+	if !p.CanViewDepartment(department) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access to this employee is not allowed"})
+		return false
+	}
+	return true
+}
+
+// visibleUsernames returns the set of usernames a department head may see.
+// The second value is false when the operator is not department-scoped (sees everyone).
+func visibleUsernames(ctx context.Context) (map[string]bool, bool, error) {
+	p := auth.FromContext(ctx)
+	if p == nil || !p.DepartmentScoped() {
+		return nil, false, nil
+	}
+
+	usernames, err := db.GetDepartmentUsernames(ctx, p.Department)
+	if err != nil {
+		return nil, true, err
+	}
+	allowed := make(map[string]bool, len(usernames))
+	for _, u := range usernames {
+		allowed[u] = true
+	}
+	return allowed, true, nil
+}
+
+// currentActor returns the username of the acting operator for created_by/updated_by fields
+func currentActor(ctx context.Context) string {
+	if p := auth.FromContext(ctx); p != nil {
+		return p.Username
+	}
+	return "system"
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/config"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// agentTestRouter serves an ingest-like endpoint that echoes the computer the
+// request is allowed to act for
+func agentTestRouter(t *testing.T, keys map[string]string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	prevCfg, prevKeys, prevFind := cfg, agentKeys, findAgentByAPIKeyHash
+	t.Cleanup(func() { cfg, agentKeys, findAgentByAPIKeyHash = prevCfg, prevKeys, prevFind })
+
+	cfg = &config.Config{}
+	cfg.Server.APIKey = "master-key"
+	cfg.Security.RequireAgentAuth = true
+	agentKeys = newAgentKeyCache(time.Minute)
+	findAgentByAPIKeyHash = func(ctx context.Context, keyHash string) (string, error) {
+		for key, computer := range keys {
+			if hashAPIKey(key) == keyHash {
+				return computer, nil
+			}
+		}
+		return "", nil
+	}
+
+	router := gin.New()
+	router.POST("/events", agentAuthMiddleware(), func(c *gin.Context) {
+		computerName, ok := agentComputerName(c, c.Query("computer_name"))
+		if !ok {
+			return
+		}
+		c.String(http.StatusOK, computerName)
+	})
+	return router
+}
+
+func agentRequest(router *gin.Engine, key, computer string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/events?computer_name="+computer, nil)
+	req = req.WithContext(zapctx.WithLogger(req.Context(), zap.NewNop()))
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAgentAuthMiddleware(t *testing.T) {
+	router := agentTestRouter(t, map[string]string{"pc1-key": "PC-001"})
+
+	tests := []struct {
+		name     string
+		key      string
+		computer string
+		status   int
+		body     string
+	}{
+		{"no key", "", "PC-001", http.StatusUnauthorized, ""},
+		{"unknown key", "bogus", "PC-001", http.StatusUnauthorized, ""},
+		{"master key claims any computer", "master-key", "PC-042", http.StatusOK, "PC-042"},
+		{"master key needs a computer", "master-key", "", http.StatusBadRequest, ""},
+		{"per-agent key", "pc1-key", "PC-001", http.StatusOK, "PC-001"},
+		{"per-agent key, other case", "pc1-key", "pc-001", http.StatusOK, "PC-001"},
+		{"per-agent key without a name", "pc1-key", "", http.StatusOK, "PC-001"},
+		{"per-agent key for another computer", "pc1-key", "PC-002", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := agentRequest(router, tt.key, tt.computer)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("computer = %q, want %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestAgentAuthMiddlewareRevokedKey(t *testing.T) {
+	keys := map[string]string{"pc1-key": "PC-001"}
+	router := agentTestRouter(t, keys)
+
+	if w := agentRequest(router, "pc1-key", "PC-001"); w.Code != http.StatusOK {
+		t.Fatalf("before revoke: status = %d", w.Code)
+	}
+
+	// Revoking drops the key from agent_configs and the cache
+	delete(keys, "pc1-key")
+	agentKeys.InvalidateComputer("PC-001")
+
+	if w := agentRequest(router, "pc1-key", "PC-001"); w.Code != http.StatusUnauthorized {
+		t.Errorf("after revoke: status = %d, want 401", w.Code)
+	}
+}
+
+func TestAgentAuthMiddlewareLookupFailure(t *testing.T) {
+	router := agentTestRouter(t, nil)
+	findAgentByAPIKeyHash = func(ctx context.Context, keyHash string) (string, error) {
+		return "", errors.New("clickhouse: connection refused")
+	}
+
+	w := agentRequest(router, "pc1-key", "PC-001")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "unavailable") {
+		t.Errorf("status = %d, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBatchRejectsEventsOfAnotherComputer(t *testing.T) {
+	router := agentTestRouter(t, map[string]string{"pc1-key": "PC-001"})
+	router.POST("/batch", agentAuthMiddleware(), receiveBatchEventsHandler)
+
+	body := `{"events":[
+		{"id":"e1","type":"usb","data":{"computer_name":"PC-001","device_id":"USB\\1"}},
+		{"id":"e2","type":"keyboard","data":{"computer_name":"PC-002","text":"forged"}}]}`
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	req = req.WithContext(zapctx.WithLogger(req.Context(), zap.NewNop()))
+	req.Header.Set("X-API-Key", "pc1-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 (%s)", w.Code, w.Body.String())
+	}
+}
@@ -8,53 +8,61 @@ import (
 	"github.com/ctolnik/Office-Monitor/server/database"
 )
 
-// DashboardCache holds cached dashboard statistics with TTL
+// DashboardCache holds cached dashboard statistics with TTL, one entry per
+// department scope ("" is the unscoped view)
 type DashboardCache struct {
-	mu       sync.RWMutex
+	mu      sync.RWMutex
+	entries map[string]dashboardEntry
+	ttl     time.Duration
+}
+
+type dashboardEntry struct {
 	stats    *database.DashboardStats
 	cachedAt time.Time
-	ttl      time.Duration
 }
 
 // NewDashboardCache creates a new dashboard cache with specified TTL
 func NewDashboardCache(ttl time.Duration) *DashboardCache {
 	return &DashboardCache{
-		ttl: ttl,
+		entries: make(map[string]dashboardEntry),
+		ttl:     ttl,
 	}
 }
 
-// Get returns cached stats if available and not expired, otherwise fetches fresh data
-func (dc *DashboardCache) Get(ctx context.Context, db *database.Database) (*database.DashboardStats, error) {
+// Get returns cached stats of the department if available and not expired,
+// otherwise fetches fresh data
+func (dc *DashboardCache) Get(ctx context.Context, db *database.Database, department string) (*database.DashboardStats, error) {
 	// Ensure context has logger to prevent zapctx panics
 	ctx = withLogger(ctx)
 
 	// Try read lock first
 	dc.mu.RLock()
-	if dc.stats != nil && time.Since(dc.cachedAt) < dc.ttl {
-		stats := dc.stats
-		dc.mu.RUnlock()
-		return stats, nil
-	}
+	entry, ok := dc.entries[department]
 	dc.mu.RUnlock()
+	if ok && time.Since(entry.cachedAt) < dc.ttl {
+		dashboardCacheRequests.Inc("hit")
+		return entry.stats, nil
+	}
 
 	// Cache miss or expired - fetch fresh data with write lock
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
 
 	// Double-check after acquiring write lock (another goroutine might have refreshed)
-	if dc.stats != nil && time.Since(dc.cachedAt) < dc.ttl {
-		return dc.stats, nil
+	if entry, ok := dc.entries[department]; ok && time.Since(entry.cachedAt) < dc.ttl {
+		dashboardCacheRequests.Inc("hit")
+		return entry.stats, nil
 	}
+	dashboardCacheRequests.Inc("miss")
 
 	// Fetch fresh data
-	stats, err := db.GetDashboardStats(ctx)
+	stats, err := db.GetDashboardStats(ctx, department)
 	if err != nil {
 		return nil, err
 	}
 
 	// Update cache
-	dc.stats = stats
-	dc.cachedAt = time.Now()
+	dc.entries[department] = dashboardEntry{stats: stats, cachedAt: time.Now()}
 
 	return stats, nil
 }
@@ -63,5 +71,5 @@ func (dc *DashboardCache) Get(ctx context.Context, db *database.Database) (*data
 func (dc *DashboardCache) Invalidate() {
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
-	dc.stats = nil
+	dc.entries = make(map[string]dashboardEntry)
 }
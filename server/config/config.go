@@ -12,6 +12,13 @@ type Config struct {
 	Database DatabaseConfig `yaml:"database"`
 	Storage  StorageConfig  `yaml:"storage"`
 	Logging  LoggingConfig  `yaml:"logging"`
+	Security SecurityConfig `yaml:"security"`
+	Auth     AuthConfig     `yaml:"auth"`
+	SMTP     SMTPConfig     `yaml:"smtp"`
+	Alerts   AlertsConfig   `yaml:"alerts"`
+	Ingest   IngestConfig   `yaml:"ingest"`
+	Updates  UpdatesConfig  `yaml:"updates"`
+	Reports  ReportsConfig  `yaml:"reports"`
 	// Monitoring MonitoringConfig `yaml:"monitoring"`
 }
 
@@ -49,6 +56,7 @@ type StorageConfig struct {
 type BucketsConfig struct {
 	Screenshots string `yaml:"screenshots"`
 	USBCopies   string `yaml:"usb_copies"`
+	AgentBuilds string `yaml:"agent_builds"`
 }
 
 type MonitoringConfig struct {
@@ -83,6 +91,112 @@ type FileCopyConfig struct {
 	AlertTimeWindowSeconds  int  `yaml:"alert_time_window_seconds"`
 }
 
+type SecurityConfig struct {
+	// RequireAgentAuth rejects ingest requests that carry no X-API-Key.
+	// Requests with an unknown key are rejected regardless of this flag.
+	RequireAgentAuth bool `yaml:"require_agent_auth"`
+	// AgentKeyCacheSeconds controls how long a validated per-agent key is cached.
+	AgentKeyCacheSeconds int `yaml:"agent_key_cache_seconds"`
+}
+
+type AuthConfig struct {
+	// JWTSecret signs operator session tokens. A random secret is generated
+	// on startup if empty, which logs everyone out on restart.
+	JWTSecret          string `yaml:"jwt_secret"`
+	SessionTTLMinutes  int    `yaml:"session_ttl_minutes"`
+	CookieSecure       bool   `yaml:"cookie_secure"`
+	BootstrapAdminUser string `yaml:"bootstrap_admin_user"`
+	BootstrapAdminPass string `yaml:"bootstrap_admin_password"`
+}
+
+// SMTPConfig is the outgoing mail server shared by email notifications and
+// scheduled reports
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	// TLS connects with implicit TLS (usually port 465). Otherwise STARTTLS
+	// is used when the server offers it.
+	TLS                bool `yaml:"tls"`
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	TimeoutSeconds     int  `yaml:"timeout_seconds"`
+}
+
+type AlertsConfig struct {
+	Notifications NotificationsConfig `yaml:"notifications"`
+}
+
+// NotificationsConfig controls delivery of alerts to external channels
+type NotificationsConfig struct {
+	QueueSize             int                         `yaml:"queue_size"`
+	Workers               int                         `yaml:"workers"`
+	MaxAttempts           int                         `yaml:"max_attempts"`
+	InitialBackoffSeconds int                         `yaml:"initial_backoff_seconds"`
+	MaxBackoffSeconds     int                         `yaml:"max_backoff_seconds"`
+	DashboardURL          string                      `yaml:"dashboard_url"` // used for links in messages
+	Channels              []NotificationChannelConfig `yaml:"channels"`
+}
+
+type NotificationChannelConfig struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"` // webhook, email, telegram
+	Enabled     bool   `yaml:"enabled"`
+	MinSeverity string `yaml:"min_severity"` // low, medium, high, critical
+
+	Webhook  WebhookChannelConfig  `yaml:"webhook"`
+	Email    EmailChannelConfig    `yaml:"email"`
+	Telegram TelegramChannelConfig `yaml:"telegram"`
+}
+
+type WebhookChannelConfig struct {
+	URL string `yaml:"url"`
+	// Secret signs the request body with HMAC-SHA256 (X-Signature header)
+	Secret         string            `yaml:"secret"`
+	Headers        map[string]string `yaml:"headers"`
+	TimeoutSeconds int               `yaml:"timeout_seconds"`
+}
+
+type EmailChannelConfig struct {
+	To []string `yaml:"to"`
+}
+
+type TelegramChannelConfig struct {
+	BotToken       string `yaml:"bot_token"`
+	ChatID         string `yaml:"chat_id"`
+	APIURL         string `yaml:"api_url"` // defaults to https://api.telegram.org
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+}
+
+// IngestConfig tunes the queue that coalesces agent events into batched ClickHouse inserts
+type IngestConfig struct {
+	BatchSize       int `yaml:"batch_size"`        // flush when this many rows are queued
+	FlushIntervalMS int `yaml:"flush_interval_ms"` // flush at least this often
+	MaxPendingRows  int `yaml:"max_pending_rows"`  // queued plus in-flight rows before requests are held back
+	// EnqueueTimeoutSeconds is how long a request waits for queue space before it is rejected with 503
+	EnqueueTimeoutSeconds int `yaml:"enqueue_timeout_seconds"`
+	FlushTimeoutSeconds   int `yaml:"flush_timeout_seconds"`
+	// MaxBodyMB caps an agent request body after gzip/zstd decoding
+	MaxBodyMB int `yaml:"max_body_mb"`
+}
+
+// UpdatesConfig controls agent builds served to the auto-updater
+type UpdatesConfig struct {
+	// SigningKeyFile holds the ed25519 key that signs uploaded builds, as a
+	// PKCS#8 PEM or a base64 seed. Uploads are refused without it.
+	SigningKeyFile string `yaml:"signing_key_file"`
+	MaxBuildMB     int    `yaml:"max_build_mb"`
+}
+
+// ReportsConfig controls report exports
+type ReportsConfig struct {
+	// PDFFont and PDFBoldFont are TrueType files with Cyrillic glyphs used in
+	// PDF exports. Installed DejaVu fonts are used when empty.
+	PDFFont     string `yaml:"pdf_font"`
+	PDFBoldFont string `yaml:"pdf_bold_font"`
+}
+
 type LoggingConfig struct {
 	Level      string `yaml:"level"`
 	File       string `yaml:"file"`
@@ -116,6 +230,67 @@ func Load(configPath string) (*Config, error) {
 	if cfg.Logging.File == "" {
 		cfg.Logging.File = "/app/logs/server.log"
 	}
+	if cfg.Security.AgentKeyCacheSeconds == 0 {
+		cfg.Security.AgentKeyCacheSeconds = 60
+	}
+	if cfg.Auth.SessionTTLMinutes == 0 {
+		cfg.Auth.SessionTTLMinutes = 720
+	}
+	if cfg.Auth.BootstrapAdminUser == "" {
+		cfg.Auth.BootstrapAdminUser = "admin"
+	}
+	if cfg.SMTP.Port == 0 {
+		cfg.SMTP.Port = 587
+	}
+	if cfg.SMTP.TimeoutSeconds == 0 {
+		cfg.SMTP.TimeoutSeconds = 30
+	}
+
+	in := &cfg.Ingest
+	if in.BatchSize == 0 {
+		in.BatchSize = 5000
+	}
+	if in.FlushIntervalMS == 0 {
+		in.FlushIntervalMS = 1000
+	}
+	if in.MaxPendingRows == 0 {
+		in.MaxPendingRows = 100000
+	}
+	if in.EnqueueTimeoutSeconds == 0 {
+		in.EnqueueTimeoutSeconds = 10
+	}
+	if in.FlushTimeoutSeconds == 0 {
+		in.FlushTimeoutSeconds = 30
+	}
+	if in.MaxBodyMB == 0 {
+		in.MaxBodyMB = 64
+	}
+
+	if cfg.Updates.MaxBuildMB == 0 {
+		cfg.Updates.MaxBuildMB = 100
+	}
+
+	n := &cfg.Alerts.Notifications
+	if n.QueueSize == 0 {
+		n.QueueSize = 1000
+	}
+	if n.Workers == 0 {
+		n.Workers = 2
+	}
+	if n.MaxAttempts == 0 {
+		n.MaxAttempts = 5
+	}
+	if n.InitialBackoffSeconds == 0 {
+		n.InitialBackoffSeconds = 2
+	}
+	if n.MaxBackoffSeconds == 0 {
+		n.MaxBackoffSeconds = 60
+	}
+	for i := range n.Channels {
+		if n.Channels[i].MinSeverity == "" {
+			n.Channels[i].MinSeverity = "low"
+		}
+	}
 
 	return &cfg, nil
 }
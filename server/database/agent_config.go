@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AgentConfigStatus is the config version an agent last reported as applied
+type AgentConfigStatus struct {
+	ComputerName   string    `json:"computer_name"`
+	AppliedVersion string    `json:"applied_version"`
+	AppliedAt      time.Time `json:"applied_at"`
+	Error          string    `json:"error"`
+}
+
+// GetEffectiveAgentConfig returns the stored config of a computer, or the
+// defaults if none is stored. configured is false for the defaults: nobody
+// set up the computer, so its agent keeps the settings of its config file.
+func (db *Database) GetEffectiveAgentConfig(ctx context.Context, computerName string) (cfg AgentConfig, configured bool, err error) {
+	row, err := db.loadAgentConfigRow(ctx, computerName)
+	if err != nil {
+		return AgentConfig{}, false, err
+	}
+	if row == nil {
+		return defaultAgentConfig(computerName), false, nil
+	}
+	// A row that only holds an API key has the defaults as well
+	return *row, row.Configured, nil
+}
+
+// ConfigUpdate converts the stored config to the dashboard representation
+func (c AgentConfig) ConfigUpdate() ConfigUpdate {
+	return ConfigUpdate{
+		ScreenshotInterval: c.ScreenshotIntervalMinutes * 60,
+		ActivityTracking:   c.ScreenshotEnabled,
+		KeyloggerEnabled:   c.KeyloggerEnabled,
+		USBMonitoring:      c.USBMonitoringEnabled,
+		FileMonitoring:     c.FileCopyMonitoringEnabled,
+		DLPEnabled:         c.FileCopyMonitoringEnabled,
+	}
+}
+
+// SaveAgentConfigStatus records the config version applied by an agent
+func (db *Database) SaveAgentConfigStatus(ctx context.Context, status AgentConfigStatus) error {
+	query := `
+		INSERT INTO monitoring.agent_config_status
+			(computer_name, applied_version, applied_at, error, updated_at)
+		VALUES (?, ?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query,
+		status.ComputerName, status.AppliedVersion, status.AppliedAt, status.Error, time.Now())
+}
+
+// GetAgentConfigStatus returns the last reported config status, or nil if the agent never reported
+func (db *Database) GetAgentConfigStatus(ctx context.Context, computerName string) (*AgentConfigStatus, error) {
+	query := `
+		SELECT computer_name, applied_version, applied_at, error
+		FROM monitoring.agent_config_status FINAL
+		WHERE computer_name = ?
+		LIMIT 1`
+
+	var s AgentConfigStatus
+	err := db.conn.QueryRow(ctx, query, computerName).Scan(&s.ComputerName, &s.AppliedVersion, &s.AppliedAt, &s.Error)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get agent config status: %w", err)
+	}
+	return &s, nil
+}
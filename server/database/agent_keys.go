@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+// defaultAgentConfig mirrors the column defaults of monitoring.agent_configs.
+// It is not marked configured: the defaults are never pushed to an agent.
+func defaultAgentConfig(computerName string) AgentConfig {
+	return AgentConfig{
+		ComputerName:              computerName,
+		ScreenshotEnabled:         false,
+		ScreenshotIntervalMinutes: 15,
+		KeyloggerEnabled:          false,
+		USBMonitoringEnabled:      true,
+		FileCopyMonitoringEnabled: true,
+		LargeCopyThresholdMB:      100,
+	}
+}
+
+// agentConfigColumns is the column list read by scanAgentConfig
+const agentConfigColumns = `
+			computer_name,
+			api_key,
+			screenshot_enabled,
+			screenshot_interval_minutes,
+			keylogger_enabled,
+			usb_monitoring_enabled,
+			file_copy_monitoring_enabled,
+			large_copy_threshold_mb,
+			last_seen,
+			agent_version,
+			configured`
+
+func scanAgentConfig(row rowScanner) (*AgentConfig, error) {
+	var cfg AgentConfig
+	var screenshotEnabled, keyloggerEnabled, usbEnabled, fileEnabled, configured uint8
+	var intervalMin, thresholdMB uint32
+
+	if err := row.Scan(
+		&cfg.ComputerName, &cfg.APIKey,
+		&screenshotEnabled, &intervalMin, &keyloggerEnabled,
+		&usbEnabled, &fileEnabled, &thresholdMB,
+		&cfg.LastSeen, &cfg.AgentVersion, &configured,
+	); err != nil {
+		return nil, err
+	}
+
+	cfg.ScreenshotEnabled = screenshotEnabled == 1
+	cfg.ScreenshotIntervalMinutes = int(intervalMin)
+	cfg.KeyloggerEnabled = keyloggerEnabled == 1
+	cfg.USBMonitoringEnabled = usbEnabled == 1
+	cfg.FileCopyMonitoringEnabled = fileEnabled == 1
+	cfg.LargeCopyThresholdMB = int(thresholdMB)
+	cfg.Configured = configured == 1
+
+	return &cfg, nil
+}
+
+// loadAgentConfigRow returns the latest agent_configs row for a computer, or nil if none exists
+func (db *Database) loadAgentConfigRow(ctx context.Context, computerName string) (*AgentConfig, error) {
+	query := `
+		SELECT` + agentConfigColumns + `
+		FROM monitoring.agent_configs FINAL
+		WHERE computer_name = ?
+		LIMIT 1`
+
+	cfg, err := scanAgentConfig(db.conn.QueryRow(ctx, query, computerName))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load agent config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// loadAgentConfigRows returns the latest agent_configs row of every computer, keyed by computer name
+func (db *Database) loadAgentConfigRows(ctx context.Context) (map[string]AgentConfig, error) {
+	query := `
+		SELECT` + agentConfigColumns + `
+		FROM monitoring.agent_configs FINAL`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent configs: %w", err)
+	}
+	defer rows.Close()
+
+	configs := make(map[string]AgentConfig)
+	for rows.Next() {
+		cfg, err := scanAgentConfig(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan agent config: %w", err)
+		}
+		configs[cfg.ComputerName] = *cfg
+	}
+
+	return configs, rows.Err()
+}
+
+// saveAgentConfigRow writes a new version of the agent_configs row.
+// ReplacingMergeTree(updated_at) keeps the latest version per computer_name.
+func (db *Database) saveAgentConfigRow(ctx context.Context, cfg AgentConfig) error {
+	query := `
+		INSERT INTO monitoring.agent_configs
+			(computer_name, api_key, screenshot_enabled, screenshot_interval_minutes, keylogger_enabled,
+			 usb_monitoring_enabled, file_copy_monitoring_enabled, large_copy_threshold_mb,
+			 last_seen, agent_version, configured, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	lastSeen := cfg.LastSeen
+	if lastSeen.IsZero() {
+		lastSeen = time.Now()
+	}
+
+	return db.conn.Exec(ctx, query,
+		cfg.ComputerName,
+		cfg.APIKey,
+		boolToUInt8(cfg.ScreenshotEnabled),
+		uint32(cfg.ScreenshotIntervalMinutes),
+		boolToUInt8(cfg.KeyloggerEnabled),
+		boolToUInt8(cfg.USBMonitoringEnabled),
+		boolToUInt8(cfg.FileCopyMonitoringEnabled),
+		uint32(cfg.LargeCopyThresholdMB),
+		lastSeen,
+		cfg.AgentVersion,
+		boolToUInt8(cfg.Configured),
+		time.Now(),
+	)
+}
+
+// FindAgentByAPIKeyHash returns the computer name owning the given key hash.
+// Returns an empty string (and no error) if no agent has this key.
+func (db *Database) FindAgentByAPIKeyHash(ctx context.Context, keyHash string) (string, error) {
+	if keyHash == "" {
+		return "", nil
+	}
+
+	query := `
+		SELECT computer_name
+		FROM monitoring.agent_configs FINAL
+		WHERE api_key = ?
+		LIMIT 1`
+
+	var computerName string
+	err := db.conn.QueryRow(ctx, query, keyHash).Scan(&computerName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to look up agent API key: %w", err)
+	}
+
+	return computerName, nil
+}
+
+// HasAgentAPIKey reports whether a per-agent key is currently issued for the computer
+func (db *Database) HasAgentAPIKey(ctx context.Context, computerName string) (bool, error) {
+	row, err := db.loadAgentConfigRow(ctx, computerName)
+	if err != nil {
+		return false, err
+	}
+	return row != nil && row.APIKey != "", nil
+}
+
+// SetAgentAPIKey stores the key hash for a computer, preserving the rest of its configuration.
+// A computer without settings gets a row that is not marked configured, so
+// issuing a key does not change what its agent monitors. An empty keyHash
+// revokes the key.
+func (db *Database) SetAgentAPIKey(ctx context.Context, computerName, keyHash string) error {
+	row, err := db.loadAgentConfigRow(ctx, computerName)
+	if err != nil {
+		return err
+	}
+	if row == nil {
+		defaults := defaultAgentConfig(computerName)
+		row = &defaults
+	}
+
+	row.APIKey = keyHash
+	if err := db.saveAgentConfigRow(ctx, *row); err != nil {
+		zapctx.Error(ctx, "Failed to save agent API key", zap.Error(err), zap.String("computer_name", computerName))
+		return err
+	}
+
+	return nil
+}
+
+func boolToUInt8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AgentLogEntry is a WARN or higher log line shipped by an agent
+type AgentLogEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	ComputerName string    `json:"computer_name"`
+	Level        string    `json:"level"`
+	Component    string    `json:"component"`
+	Message      string    `json:"message"`
+	Caller       string    `json:"caller"`
+	// Fields holds the structured fields of the line as a JSON object
+	Fields     string    `json:"fields"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// AgentLogFilter selects agent log lines; zero values match everything
+type AgentLogFilter struct {
+	ComputerName string
+	Level        string
+	Component    string
+	From, To     time.Time
+	Limit        int
+}
+
+// InsertAgentLogs stores a batch of agent log lines
+func (db *Database) InsertAgentLogs(ctx context.Context, entries []AgentLogEntry) error {
+	return db.sendBatch(ctx, `INSERT INTO monitoring.agent_logs
+		(timestamp, computer_name, level, component, message, caller, fields, received_at)`,
+		len(entries), func(i int) []any {
+			e := entries[i]
+			return []any{e.Timestamp, e.ComputerName, e.Level, e.Component, e.Message, e.Caller, e.Fields, e.ReceivedAt}
+		})
+}
+
+// GetAgentLogs returns the newest agent log lines matching the filter
+func (db *Database) GetAgentLogs(ctx context.Context, f AgentLogFilter) ([]AgentLogEntry, error) {
+	var where []string
+	var args []any
+	if f.ComputerName != "" {
+		where = append(where, "computer_name = ?")
+		args = append(args, f.ComputerName)
+	}
+	if f.Level != "" {
+		where = append(where, "level = ?")
+		args = append(args, f.Level)
+	}
+	if f.Component != "" {
+		where = append(where, "component = ?")
+		args = append(args, f.Component)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, f.To)
+	}
+
+	query := `
+		SELECT timestamp, computer_name, level, component, message, caller, fields, received_at
+		FROM monitoring.agent_logs`
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, " AND ")
+	}
+	query += "\n\t\tORDER BY timestamp DESC\n\t\tLIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query agent logs: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]AgentLogEntry, 0)
+	for rows.Next() {
+		var e AgentLogEntry
+		if err := rows.Scan(&e.Timestamp, &e.ComputerName, &e.Level, &e.Component, &e.Message, &e.Caller,
+			&e.Fields, &e.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan agent log entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,247 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Agent update statuses reported by the updater
+const (
+	AgentUpdateInstalled  = "installed"
+	AgentUpdateConfirmed  = "confirmed"
+	AgentUpdateRolledBack = "rolled_back"
+	AgentUpdateFailed     = "failed"
+)
+
+// AgentBuild is an uploaded agent binary with its signature
+type AgentBuild struct {
+	Version    string    `json:"version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	ObjectName string    `json:"-"`
+	Signature  string    `json:"signature"`
+	Notes      string    `json:"notes"`
+	UploadedBy string    `json:"uploaded_by"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// ReleaseChannel points a channel at an agent version
+type ReleaseChannel struct {
+	Channel   string    `json:"channel"`
+	Version   string    `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by"`
+}
+
+// AgentGroup assigns a release channel to a set of computers
+type AgentGroup struct {
+	Name          string    `json:"name"`
+	Channel       string    `json:"channel"`
+	ComputerNames []string  `json:"computer_names"`
+	IsDeleted     bool      `json:"-"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	UpdatedBy     string    `json:"updated_by"`
+}
+
+// AgentUpdateStatus is the last update outcome reported by an agent
+type AgentUpdateStatus struct {
+	ComputerName string    `json:"computer_name"`
+	FromVersion  string    `json:"from_version"`
+	Version      string    `json:"version"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const agentBuildColumns = `
+			version,
+			os,
+			arch,
+			sha256,
+			size,
+			object_name,
+			signature,
+			notes,
+			uploaded_by,
+			uploaded_at`
+
+func scanAgentBuild(row rowScanner) (*AgentBuild, error) {
+	var b AgentBuild
+	var size uint64
+	if err := row.Scan(&b.Version, &b.OS, &b.Arch, &b.SHA256, &size, &b.ObjectName,
+		&b.Signature, &b.Notes, &b.UploadedBy, &b.UploadedAt); err != nil {
+		return nil, err
+	}
+	b.Size = int64(size)
+	return &b, nil
+}
+
+// SaveAgentBuild stores a build; uploading the same version/os/arch replaces it
+func (db *Database) SaveAgentBuild(ctx context.Context, build *AgentBuild) error {
+	if build.UploadedAt.IsZero() {
+		build.UploadedAt = time.Now()
+	}
+	query := `
+		INSERT INTO monitoring.agent_builds
+			(version, os, arch, sha256, size, object_name, signature, notes, uploaded_by, uploaded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query,
+		build.Version, build.OS, build.Arch, build.SHA256, uint64(build.Size), build.ObjectName,
+		build.Signature, build.Notes, build.UploadedBy, build.UploadedAt)
+}
+
+// GetAgentBuilds returns all uploaded builds, newest first
+func (db *Database) GetAgentBuilds(ctx context.Context) ([]AgentBuild, error) {
+	query := `
+		SELECT` + agentBuildColumns + `
+		FROM monitoring.agent_builds FINAL
+		ORDER BY uploaded_at DESC, version, os, arch`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	builds := make([]AgentBuild, 0)
+	for rows.Next() {
+		b, err := scanAgentBuild(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan agent build: %w", err)
+		}
+		builds = append(builds, *b)
+	}
+
+	return builds, rows.Err()
+}
+
+// GetAgentBuild returns the build of a version for a platform, or nil if none was uploaded
+func (db *Database) GetAgentBuild(ctx context.Context, version, goos, arch string) (*AgentBuild, error) {
+	query := `
+		SELECT` + agentBuildColumns + `
+		FROM monitoring.agent_builds FINAL
+		WHERE version = ? AND os = ? AND arch = ?
+		LIMIT 1`
+
+	b, err := scanAgentBuild(db.conn.QueryRow(ctx, query, version, goos, arch))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get agent build: %w", err)
+	}
+	return b, nil
+}
+
+// GetReleaseChannels returns the version assigned to each channel
+func (db *Database) GetReleaseChannels(ctx context.Context) ([]ReleaseChannel, error) {
+	query := `
+		SELECT channel, version, updated_at, updated_by
+		FROM monitoring.agent_release_channels FINAL
+		ORDER BY channel`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := make([]ReleaseChannel, 0)
+	for rows.Next() {
+		var ch ReleaseChannel
+		if err := rows.Scan(&ch.Channel, &ch.Version, &ch.UpdatedAt, &ch.UpdatedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan release channel: %w", err)
+		}
+		channels = append(channels, ch)
+	}
+
+	return channels, rows.Err()
+}
+
+// SaveReleaseChannel assigns a version to a channel. An empty version stops updates on it.
+func (db *Database) SaveReleaseChannel(ctx context.Context, ch *ReleaseChannel) error {
+	ch.UpdatedAt = time.Now()
+	query := `
+		INSERT INTO monitoring.agent_release_channels (channel, version, updated_at, updated_by)
+		VALUES (?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query, ch.Channel, ch.Version, ch.UpdatedAt, ch.UpdatedBy)
+}
+
+// GetAgentGroups returns all groups that are not deleted
+func (db *Database) GetAgentGroups(ctx context.Context) ([]AgentGroup, error) {
+	query := `
+		SELECT name, channel, computer_names, updated_at, updated_by
+		FROM monitoring.agent_groups FINAL
+		WHERE is_deleted = 0
+		ORDER BY name`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]AgentGroup, 0)
+	for rows.Next() {
+		var g AgentGroup
+		if err := rows.Scan(&g.Name, &g.Channel, &g.ComputerNames, &g.UpdatedAt, &g.UpdatedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan agent group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+// SaveAgentGroup writes a new version of the group. Deletion is a save with IsDeleted=true.
+func (db *Database) SaveAgentGroup(ctx context.Context, group *AgentGroup) error {
+	group.UpdatedAt = time.Now()
+	if group.ComputerNames == nil {
+		group.ComputerNames = []string{}
+	}
+	query := `
+		INSERT INTO monitoring.agent_groups (name, channel, computer_names, is_deleted, updated_at, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query,
+		group.Name, group.Channel, group.ComputerNames, boolToUInt8(group.IsDeleted), group.UpdatedAt, group.UpdatedBy)
+}
+
+// SaveAgentUpdateStatus records an update outcome reported by an agent
+func (db *Database) SaveAgentUpdateStatus(ctx context.Context, status AgentUpdateStatus) error {
+	query := `
+		INSERT INTO monitoring.agent_update_status
+			(computer_name, from_version, version, status, error, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query,
+		status.ComputerName, status.FromVersion, status.Version, status.Status, status.Error, time.Now())
+}
+
+// GetAgentUpdateStatuses returns the last reported update of every agent
+func (db *Database) GetAgentUpdateStatuses(ctx context.Context) ([]AgentUpdateStatus, error) {
+	query := `
+		SELECT computer_name, from_version, version, toString(status), error, updated_at
+		FROM monitoring.agent_update_status FINAL
+		ORDER BY computer_name`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := make([]AgentUpdateStatus, 0)
+	for rows.Next() {
+		var s AgentUpdateStatus
+		if err := rows.Scan(&s.ComputerName, &s.FromVersion, &s.Version, &s.Status, &s.Error, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan agent update status: %w", err)
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses, rows.Err()
+}
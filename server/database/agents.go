@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AgentHeartbeat is the inventory and health snapshot an agent reports periodically
+type AgentHeartbeat struct {
+	ComputerName   string    `json:"computer_name"`
+	Username       string    `json:"username"`
+	AgentVersion   string    `json:"version"`
+	OSBuild        string    `json:"os_build"`
+	IPAddresses    []string  `json:"ip_addresses"`
+	UptimeSeconds  uint64    `json:"uptime_seconds"`
+	Monitors       []string  `json:"monitors"`
+	BufferSize     uint32    `json:"buffer_size"`
+	BufferDropped  uint64    `json:"buffer_dropped"`
+	CircuitBreaker string    `json:"circuit_breaker"`
+	ConfigVersion  string    `json:"config_version"`
+	ThrottleLevel  uint8     `json:"throttle_level"`
+	ThrottleReason string    `json:"throttle_reason"`
+	MemoryMB       uint32    `json:"memory_mb"`
+	CPUPercent     float32   `json:"cpu_percent"`
+	ReceivedAt     time.Time `json:"received_at"`
+	// Supervisor state of every configured monitor, stored as JSON
+	MonitorStatus []AgentMonitorStatus `json:"monitor_status"`
+}
+
+// AgentMonitorStatus is the supervisor state of one agent monitor.
+// State is running, restarting or stopped.
+type AgentMonitorStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// InsertAgentHeartbeat stores the latest heartbeat of an agent.
+// ReplacingMergeTree(last_heartbeat) keeps one row per computer.
+func (db *Database) InsertAgentHeartbeat(ctx context.Context, hb AgentHeartbeat) error {
+	if hb.ReceivedAt.IsZero() {
+		hb.ReceivedAt = time.Now()
+	}
+	if hb.IPAddresses == nil {
+		hb.IPAddresses = []string{}
+	}
+	if hb.Monitors == nil {
+		hb.Monitors = []string{}
+	}
+	monitorStatus := ""
+	if len(hb.MonitorStatus) > 0 {
+		data, err := json.Marshal(hb.MonitorStatus)
+		if err != nil {
+			return fmt.Errorf("failed to encode monitor status: %w", err)
+		}
+		monitorStatus = string(data)
+	}
+
+	query := `
+		INSERT INTO monitoring.agent_registry
+			(computer_name, username, agent_version, os_build, ip_addresses, uptime_seconds,
+			 monitors, buffer_size, buffer_dropped, circuit_breaker, config_version,
+			 throttle_level, throttle_reason, memory_mb, cpu_percent, monitor_status, last_heartbeat)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	return db.conn.Exec(ctx, query,
+		hb.ComputerName, hb.Username, hb.AgentVersion, hb.OSBuild, hb.IPAddresses, hb.UptimeSeconds,
+		hb.Monitors, hb.BufferSize, hb.BufferDropped, hb.CircuitBreaker, hb.ConfigVersion,
+		hb.ThrottleLevel, hb.ThrottleReason, hb.MemoryMB, hb.CPUPercent, monitorStatus, hb.ReceivedAt)
+}
+
+// getAgentHeartbeats returns the latest heartbeat of every registered agent
+func (db *Database) getAgentHeartbeats(ctx context.Context) ([]AgentHeartbeat, error) {
+	query := `
+		SELECT computer_name, username, agent_version, os_build, ip_addresses, uptime_seconds,
+		       monitors, buffer_size, buffer_dropped, circuit_breaker, config_version,
+		       throttle_level, throttle_reason, memory_mb, cpu_percent, monitor_status, last_heartbeat
+		FROM monitoring.agent_registry FINAL`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query agent registry: %w", err)
+	}
+	defer rows.Close()
+
+	heartbeats := make([]AgentHeartbeat, 0)
+	for rows.Next() {
+		var hb AgentHeartbeat
+		var monitorStatus string
+		if err := rows.Scan(&hb.ComputerName, &hb.Username, &hb.AgentVersion, &hb.OSBuild, &hb.IPAddresses,
+			&hb.UptimeSeconds, &hb.Monitors, &hb.BufferSize, &hb.BufferDropped, &hb.CircuitBreaker, &hb.ConfigVersion,
+			&hb.ThrottleLevel, &hb.ThrottleReason, &hb.MemoryMB, &hb.CPUPercent, &monitorStatus, &hb.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan agent heartbeat: %w", err)
+		}
+		// Agents older than the supervisor leave it empty
+		if monitorStatus != "" {
+			if err := json.Unmarshal([]byte(monitorStatus), &hb.MonitorStatus); err != nil {
+				return nil, fmt.Errorf("failed to decode monitor status of %s: %w", hb.ComputerName, err)
+			}
+		}
+		heartbeats = append(heartbeats, hb)
+	}
+
+	return heartbeats, rows.Err()
+}
+
+// agentOnlineWindow is how recently an agent must have been heard from to
+// count as online
+const agentOnlineWindow = 5 * time.Minute
+
+// agentStatus derives online/idle/offline from the time the agent was last heard from
+func agentStatus(lastSeen time.Time) string {
+	since := time.Since(lastSeen)
+	if since < agentOnlineWindow {
+		return "online"
+	} else if since < 30*time.Minute {
+		return "idle"
+	}
+	return "offline"
+}
+
+// GetAgents returns every known agent: all registered via heartbeat plus
+// computers that only produced activity in the last day. The status uses the
+// most recent of heartbeat and activity, so an agent that stops reporting is
+// shown offline even if it never sent activity.
+func (db *Database) GetAgents(ctx context.Context) ([]Agent, error) {
+	heartbeats, err := db.getAgentHeartbeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := db.loadAgentConfigRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT
+			computer_name,
+			argMax(username, timestamp) AS username,
+			MAX(timestamp) AS last_seen
+		FROM monitoring.activity_events
+		WHERE timestamp > now() - INTERVAL 1 DAY
+		GROUP BY computer_name`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type activity struct {
+		username string
+		lastSeen time.Time
+	}
+	recent := make(map[string]activity)
+	for rows.Next() {
+		var computerName string
+		var a activity
+		if err := rows.Scan(&computerName, &a.username, &a.lastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan agent activity: %w", err)
+		}
+		recent[computerName] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lastSeen := make(map[string]time.Time)
+	agents := make([]Agent, 0, len(heartbeats)+len(recent))
+	newAgent := func(computerName string) Agent {
+		cfg, ok := configs[computerName]
+		if !ok {
+			cfg = defaultAgentConfig(computerName)
+		}
+		return Agent{
+			ComputerName: computerName,
+			IPAddresses:  []string{},
+			Monitors:     []string{},
+			Config:       cfg.ConfigUpdate(),
+		}
+	}
+
+	for _, hb := range heartbeats {
+		a := newAgent(hb.ComputerName)
+		a.Username = hb.Username
+		a.AgentVersion = hb.AgentVersion
+		a.OSVersion = hb.OSBuild
+		a.IPAddresses = hb.IPAddresses
+		if len(hb.IPAddresses) > 0 {
+			a.IPAddress = hb.IPAddresses[0]
+		}
+		a.UptimeSeconds = hb.UptimeSeconds
+		a.Monitors = hb.Monitors
+		a.BufferSize = hb.BufferSize
+		a.BufferDropped = hb.BufferDropped
+		a.CircuitBreaker = hb.CircuitBreaker
+		a.ConfigVersion = hb.ConfigVersion
+		a.ThrottleLevel = hb.ThrottleLevel
+		a.ThrottleReason = hb.ThrottleReason
+		a.MemoryMB = hb.MemoryMB
+		a.CPUPercent = hb.CPUPercent
+		a.MonitorStatus = hb.MonitorStatus
+		heartbeatAt := hb.ReceivedAt.Format(time.RFC3339)
+		a.LastHeartbeat = &heartbeatAt
+
+		seen := hb.ReceivedAt
+		if act, ok := recent[hb.ComputerName]; ok {
+			if act.lastSeen.After(seen) {
+				seen = act.lastSeen
+			}
+			if a.Username == "" {
+				a.Username = act.username
+			}
+			delete(recent, hb.ComputerName)
+		}
+		lastSeen[a.ComputerName] = seen
+		agents = append(agents, a)
+	}
+
+	// Computers with activity but no heartbeat run an agent that predates heartbeats
+	for computerName, act := range recent {
+		a := newAgent(computerName)
+		a.Username = act.username
+		lastSeen[computerName] = act.lastSeen
+		agents = append(agents, a)
+	}
+
+	for i := range agents {
+		seen := lastSeen[agents[i].ComputerName]
+		agents[i].LastSeen = seen.Format(time.RFC3339)
+		agents[i].Status = agentStatus(seen)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return lastSeen[agents[i].ComputerName].After(lastSeen[agents[j].ComputerName])
+	})
+
+	return agents, nil
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AlertRule is a configurable condition that produces alerts
+type AlertRule struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	RuleType        string    `json:"rule_type"`
+	Severity        string    `json:"severity"`
+	Enabled         bool      `json:"enabled"`
+	CooldownMinutes int       `json:"cooldown_minutes"`
+	Params          string    `json:"params"` // JSON, depends on rule_type
+	IsDeleted       bool      `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	CreatedBy       string    `json:"created_by"`
+	UpdatedBy       string    `json:"updated_by"`
+}
+
+// UserProductivity is the active/productive time of a user on a computer in a period
+type UserProductivity struct {
+	ComputerName      string  `json:"computer_name"`
+	Username          string  `json:"username"`
+	ActiveSeconds     uint64  `json:"active_seconds"`
+	ProductiveSeconds uint64  `json:"productive_seconds"`
+	Productivity      float64 `json:"productivity"`
+}
+
+const alertRuleColumns = `
+			toString(id),
+			name,
+			description,
+			rule_type,
+			severity,
+			enabled,
+			cooldown_minutes,
+			params,
+			is_deleted,
+			created_at,
+			updated_at,
+			created_by,
+			updated_by`
+
+func scanAlertRule(row rowScanner) (*AlertRule, error) {
+	var r AlertRule
+	var enabled, deleted uint8
+	var cooldown uint32
+	if err := row.Scan(&r.ID, &r.Name, &r.Description, &r.RuleType, &r.Severity, &enabled,
+		&cooldown, &r.Params, &deleted, &r.CreatedAt, &r.UpdatedAt, &r.CreatedBy, &r.UpdatedBy); err != nil {
+		return nil, err
+	}
+	r.Enabled = enabled == 1
+	r.IsDeleted = deleted == 1
+	r.CooldownMinutes = int(cooldown)
+	return &r, nil
+}
+
+// GetAlertRules returns all alert rules that are not deleted
+func (db *Database) GetAlertRules(ctx context.Context) ([]AlertRule, error) {
+	query := `
+		SELECT` + alertRuleColumns + `
+		FROM monitoring.alert_rules FINAL
+		WHERE is_deleted = 0
+		ORDER BY name`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]AlertRule, 0)
+	for rows.Next() {
+		r, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+		}
+		rules = append(rules, *r)
+	}
+
+	return rules, rows.Err()
+}
+
+// GetAlertRule returns a rule by ID, or nil if it doesn't exist or was deleted
+func (db *Database) GetAlertRule(ctx context.Context, id string) (*AlertRule, error) {
+	query := `
+		SELECT` + alertRuleColumns + `
+		FROM monitoring.alert_rules FINAL
+		WHERE id = toUUIDOrZero(?) AND is_deleted = 0
+		LIMIT 1`
+
+	r, err := scanAlertRule(db.conn.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get alert rule: %w", err)
+	}
+	return r, nil
+}
+
+// SaveAlertRule writes a new version of the rule, assigning an ID to new rules.
+// Deletion is a save with IsDeleted=true.
+func (db *Database) SaveAlertRule(ctx context.Context, rule *AlertRule) error {
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	now := time.Now()
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+	if rule.Params == "" {
+		rule.Params = "{}"
+	}
+
+	query := `
+		INSERT INTO monitoring.alert_rules
+			(id, name, description, rule_type, severity, enabled, cooldown_minutes, params,
+			 is_deleted, created_at, updated_at, created_by, updated_by)
+		VALUES (toUUID(?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	return db.conn.Exec(ctx, query,
+		rule.ID, rule.Name, rule.Description, rule.RuleType, rule.Severity,
+		boolToUInt8(rule.Enabled), uint32(rule.CooldownMinutes), rule.Params,
+		boolToUInt8(rule.IsDeleted), rule.CreatedAt, rule.UpdatedAt, rule.CreatedBy, rule.UpdatedBy,
+	)
+}
+
+// GetNewUSBDevices returns the first appearance of the USB devices received
+// by the server after since that are not in known_usb_devices yet. The
+// receive time is used so devices from an agent's offline backlog are found
+// when it is replayed.
+func (db *Database) GetNewUSBDevices(ctx context.Context, since time.Time) ([]USBEvent, error) {
+	query := `
+		SELECT
+			min(timestamp) AS first_seen,
+			argMin(computer_name, timestamp),
+			argMin(username, timestamp),
+			device_id,
+			argMin(device_name, timestamp),
+			argMin(device_type, timestamp),
+			argMin(event_type, timestamp),
+			argMin(volume_serial, timestamp)
+		FROM monitoring.usb_events
+		WHERE received_at > ? AND device_id != ''
+		  AND device_id NOT IN (SELECT device_id FROM monitoring.known_usb_devices)
+		GROUP BY device_id
+		ORDER BY first_seen`
+
+	rows, err := db.conn.Query(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]USBEvent, 0)
+	for rows.Next() {
+		var e USBEvent
+		if err := rows.Scan(&e.Timestamp, &e.ComputerName, &e.Username, &e.DeviceID,
+			&e.DeviceName, &e.DeviceType, &e.EventType, &e.VolumeSerial); err != nil {
+			return nil, fmt.Errorf("failed to scan USB device: %w", err)
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// AddKnownUSBDevices records devices so they are not reported as new again
+func (db *Database) AddKnownUSBDevices(ctx context.Context, devices []USBEvent) error {
+	return db.sendBatch(ctx, `INSERT INTO monitoring.known_usb_devices
+		(device_id, first_seen, computer_name, username, device_name)`,
+		len(devices), func(i int) []any {
+			d := devices[i]
+			return []any{d.DeviceID, d.Timestamp, d.ComputerName, d.Username, d.DeviceName}
+		})
+}
+
+// GetUserProductivity returns productivity per user from activity segments in a time range.
+// Productivity is the share of active time spent in productive applications (0-100).
+func (db *Database) GetUserProductivity(ctx context.Context, start, end time.Time) ([]UserProductivity, error) {
+	query := `
+		SELECT
+			any(computer_name),
+			username,
+			sumIf(duration_sec, state = 'active') AS active_sec,
+			sumIf(duration_sec, state = 'active' AND category = 'productive') AS productive_sec
+		FROM monitoring.activity_segments
+		WHERE timestamp_start >= ? AND timestamp_start < ?
+		GROUP BY username
+		HAVING active_sec > 0`
+
+	rows, err := db.conn.Query(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]UserProductivity, 0)
+	for rows.Next() {
+		var p UserProductivity
+		if err := rows.Scan(&p.ComputerName, &p.Username, &p.ActiveSeconds, &p.ProductiveSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan productivity: %w", err)
+		}
+		p.Productivity = float64(p.ProductiveSeconds) / float64(p.ActiveSeconds) * 100.0
+		result = append(result, p)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alert workflow statuses stored in alert_states
+const (
+	AlertStatusOpen          = "open"
+	AlertStatusAcknowledged  = "acknowledged"
+	AlertStatusResolved      = "resolved"
+	AlertStatusFalsePositive = "false_positive"
+)
+
+// AlertFilter selects alerts for GetAlerts
+type AlertFilter struct {
+	Resolved   *bool  // resolved or false_positive vs. open or acknowledged
+	Status     string // exact workflow status
+	Severity   string
+	Department string // limits alerts to employees of this department
+	Assignee   string
+	Limit      int
+	Offset     int
+}
+
+// AlertState is one version of an alert's workflow state.
+// Every change inserts a new row; alert_states keeps the latest per alert.
+type AlertState struct {
+	AlertID         string
+	Status          string
+	Assignee        string
+	AcknowledgedBy  string
+	AcknowledgedAt  *time.Time
+	ResolvedBy      string
+	ResolvedAt      *time.Time
+	ResolutionNotes string
+	UpdatedBy       string
+}
+
+// State returns the current workflow state of the alert
+func (a *AlertFull) State() AlertState {
+	return AlertState{
+		AlertID:         a.ID,
+		Status:          a.Status,
+		Assignee:        a.Assignee,
+		AcknowledgedBy:  a.AcknowledgedBy,
+		AcknowledgedAt:  a.AcknowledgedAt,
+		ResolvedBy:      a.ResolvedBy,
+		ResolvedAt:      a.ResolvedAt,
+		ResolutionNotes: a.ResolutionNotes,
+	}
+}
+
+// IsClosedAlertStatus reports whether the status ends the workflow
+func IsClosedAlertStatus(status string) bool {
+	return status == AlertStatusResolved || status == AlertStatusFalsePositive
+}
+
+// alertSelectSQL joins alerts with their latest state. Alerts without a state row
+// are open, except legacy rows resolved through the old is_acknowledged flag.
+const alertSelectSQL = `
+		SELECT
+			toString(a.id),
+			a.timestamp,
+			a.computer_name,
+			a.username,
+			a.alert_type,
+			a.severity,
+			a.description,
+			a.metadata,
+			if(s.has_state = 1, s.state_status, if(a.is_acknowledged = 1, 'resolved', 'open')) AS status,
+			s.assignee,
+			s.acknowledged_by,
+			s.acknowledged_at,
+			s.resolved_by,
+			s.resolved_at,
+			s.resolution_notes
+		FROM monitoring.alerts AS a
+		LEFT JOIN (
+			SELECT
+				alert_id,
+				toString(status) AS state_status,
+				assignee,
+				acknowledged_by,
+				acknowledged_at,
+				resolved_by,
+				resolved_at,
+				resolution_notes,
+				toUInt8(1) AS has_state
+			FROM monitoring.alert_states FINAL
+		) AS s ON s.alert_id = a.id`
+
+func scanAlert(row rowScanner) (*AlertFull, error) {
+	var a AlertFull
+	var ts time.Time
+	if err := row.Scan(&a.ID, &ts, &a.ComputerName, &a.Username, &a.AlertType, &a.Severity,
+		&a.Description, &a.Details, &a.Status, &a.Assignee, &a.AcknowledgedBy, &a.AcknowledgedAt,
+		&a.ResolvedBy, &a.ResolvedAt, &a.ResolutionNotes); err != nil {
+		return nil, err
+	}
+	a.Timestamp = ts.Format(time.RFC3339)
+	a.Metadata = a.Details
+	a.IsResolved = IsClosedAlertStatus(a.Status)
+	a.IsAcknowledged = a.Status != AlertStatusOpen
+	return &a, nil
+}
+
+// InsertAlert stores a generated alert, assigning its ID
+func (db *Database) InsertAlert(ctx context.Context, alert *Alert) error {
+	if alert.ID == "" {
+		alert.ID = uuid.NewString()
+	}
+	query := `INSERT INTO monitoring.alerts
+		(id, timestamp, computer_name, username, alert_type, severity, description, metadata, is_acknowledged)
+		VALUES (toUUID(?), ?, ?, ?, ?, ?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query,
+		alert.ID, alert.Timestamp, alert.ComputerName, alert.Username, alert.AlertType,
+		alert.Severity, alert.Description, alert.Metadata, boolToUInt8(alert.IsAcknowledged),
+	)
+}
+
+// GetAlerts returns alerts with their workflow state, newest first
+func (db *Database) GetAlerts(ctx context.Context, filter AlertFilter) ([]AlertFull, error) {
+	query := alertSelectSQL + `
+		WHERE 1=1`
+	args := make([]interface{}, 0)
+
+	if filter.Resolved != nil {
+		if *filter.Resolved {
+			query += " AND status IN ('resolved', 'false_positive')"
+		} else {
+			query += " AND status NOT IN ('resolved', 'false_positive')"
+		}
+	}
+
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+
+	if filter.Severity != "" {
+		query += " AND a.severity = ?"
+		args = append(args, filter.Severity)
+	}
+
+	if filter.Department != "" {
+		query += " AND a.username IN (SELECT username FROM monitoring.employees FINAL WHERE department = ?)"
+		args = append(args, filter.Department)
+	}
+
+	if filter.Assignee != "" {
+		query += " AND s.assignee = ?"
+		args = append(args, filter.Assignee)
+	}
+
+	query += " ORDER BY a.timestamp DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]AlertFull, 0)
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		alerts = append(alerts, *a)
+	}
+
+	return alerts, rows.Err()
+}
+
+// GetAlert returns an alert with its workflow state, or nil if it doesn't exist
+func (db *Database) GetAlert(ctx context.Context, id string) (*AlertFull, error) {
+	query := alertSelectSQL + `
+		WHERE a.id = toUUIDOrZero(?)
+		LIMIT 1`
+
+	a, err := scanAlert(db.conn.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get alert: %w", err)
+	}
+	return a, nil
+}
+
+// SaveAlertState writes a new version of an alert's workflow state
+func (db *Database) SaveAlertState(ctx context.Context, state AlertState) error {
+	query := `
+		INSERT INTO monitoring.alert_states
+			(alert_id, status, assignee, acknowledged_by, acknowledged_at, resolved_by, resolved_at,
+			 resolution_notes, updated_at, updated_by)
+		VALUES (toUUID(?), ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	return db.conn.Exec(ctx, query,
+		state.AlertID, state.Status, state.Assignee, state.AcknowledgedBy, state.AcknowledgedAt,
+		state.ResolvedBy, state.ResolvedAt, state.ResolutionNotes, time.Now(), state.UpdatedBy,
+	)
+}
+
+// AddAlertComment appends a comment to an alert, assigning its ID and time
+func (db *Database) AddAlertComment(ctx context.Context, comment *AlertComment) error {
+	comment.ID = uuid.NewString()
+	comment.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO monitoring.alert_comments (id, alert_id, author, text, created_at)
+		VALUES (toUUID(?), toUUID(?), ?, ?, ?)`
+
+	return db.conn.Exec(ctx, query, comment.ID, comment.AlertID, comment.Author, comment.Text, comment.CreatedAt)
+}
+
+// GetAlertComments returns the comments of an alert, oldest first
+func (db *Database) GetAlertComments(ctx context.Context, alertID string) ([]AlertComment, error) {
+	query := `
+		SELECT toString(id), toString(alert_id), author, text, created_at
+		FROM monitoring.alert_comments
+		WHERE alert_id = toUUIDOrZero(?)
+		ORDER BY created_at`
+
+	rows, err := db.conn.Query(ctx, query, alertID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]AlertComment, 0)
+	for rows.Next() {
+		var c AlertComment
+		if err := rows.Scan(&c.ID, &c.AlertID, &c.Author, &c.Text, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alert comment: %w", err)
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// fakeRow scans a fixed status into the status column of alertSelectSQL
+type fakeRow struct{ status string }
+
+func (r fakeRow) Scan(dest ...any) error {
+	*dest[1].(*time.Time) = time.Date(2025, 3, 17, 9, 30, 0, 0, time.UTC)
+	*dest[8].(*string) = r.status
+	return nil
+}
+
+func TestScanAlertFlags(t *testing.T) {
+	tests := []struct {
+		status                 string
+		acknowledged, resolved bool
+	}{
+		{AlertStatusOpen, false, false},
+		{AlertStatusAcknowledged, true, false},
+		{AlertStatusResolved, true, true},
+		{AlertStatusFalsePositive, true, true},
+	}
+	for _, tt := range tests {
+		a, err := scanAlert(fakeRow{tt.status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Status != tt.status || a.IsAcknowledged != tt.acknowledged || a.IsResolved != tt.resolved {
+			t.Errorf("%s: status %q acknowledged=%v resolved=%v", tt.status, a.Status, a.IsAcknowledged, a.IsResolved)
+		}
+	}
+}
+
+// TestGetAlertLegacyAcknowledged runs against a ClickHouse with clickhouse/01-schema.sql
+// applied, e.g. CLICKHOUSE_TEST_ADDR=localhost:9000
+func TestGetAlertLegacyAcknowledged(t *testing.T) {
+	addr := os.Getenv("CLICKHOUSE_TEST_ADDR")
+	if addr == "" {
+		t.Skip("CLICKHOUSE_TEST_ADDR is not set")
+	}
+	ctx := context.Background()
+
+	conn, err := clickhouse.Open(&clickhouse.Options{Addr: []string{addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	db := &Database{conn: conn}
+	if err := db.AutoSyncAlertStatesTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(legacyAcknowledged bool) string {
+		t.Helper()
+		alert := &Alert{
+			Timestamp:      time.Now(),
+			ComputerName:   "TEST-PC",
+			Username:       "alert.test",
+			AlertType:      "usb_connection",
+			Severity:       "low",
+			Description:    "legacy acknowledged test",
+			IsAcknowledged: legacyAcknowledged,
+		}
+		if err := db.InsertAlert(ctx, alert); err != nil {
+			t.Fatal(err)
+		}
+		return alert.ID
+	}
+	legacyResolved := insert(true)
+	legacyOpen := insert(false)
+	reopened := insert(true)
+	t.Cleanup(func() {
+		ids := []string{legacyResolved, legacyOpen, reopened}
+		conn.Exec(ctx, "ALTER TABLE monitoring.alerts DELETE WHERE toString(id) IN ? SETTINGS mutations_sync = 1", ids)
+		conn.Exec(ctx, "ALTER TABLE monitoring.alert_states DELETE WHERE toString(alert_id) IN ? SETTINGS mutations_sync = 1", ids)
+	})
+
+	// A state row wins over the legacy flag
+	if err := db.SaveAlertState(ctx, AlertState{AlertID: reopened, Status: AlertStatusAcknowledged, Assignee: "hr.petrova"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, id, want string
+	}{
+		{"legacy acknowledged", legacyResolved, AlertStatusResolved},
+		{"legacy open", legacyOpen, AlertStatusOpen},
+		{"state overrides flag", reopened, AlertStatusAcknowledged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := db.GetAlert(ctx, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a == nil {
+				t.Fatalf("alert %s not found", tt.id)
+			}
+			if a.Status != tt.want {
+				t.Errorf("status = %q, want %q", a.Status, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/reports"
+)
+
+// attendanceSegmentLimit caps the segments of one employee's timesheet; a
+// month of window switches is a few tens of thousands
+const attendanceSegmentLimit = 500000
+
+// WorkSchedule overrides the company working hours for one employee
+type WorkSchedule struct {
+	Username  string    `json:"username"`
+	WorkStart string    `json:"work_start"` // HH:MM
+	WorkEnd   string    `json:"work_end"`
+	WorkDays  []int     `json:"work_days"` // 1 Monday .. 7 Sunday
+	IsDeleted bool      `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by"`
+}
+
+// Holiday is a day off on a working day or, with Workday, a working day
+// transferred to a weekend
+type Holiday struct {
+	Date      string    `json:"date"` // YYYY-MM-DD
+	Name      string    `json:"name"`
+	Workday   bool      `json:"workday"`
+	IsDeleted bool      `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by"`
+}
+
+// AttendanceEmployee is an employee listed in a group timesheet
+type AttendanceEmployee struct {
+	Username   string `json:"username"`
+	FullName   string `json:"full_name"`
+	Department string `json:"department"`
+	Team       string `json:"team"`
+}
+
+// AttendanceSegment is a stretch of an employee's active time
+type AttendanceSegment struct {
+	Username string
+	Start    time.Time
+	End      time.Time
+}
+
+func scanWorkSchedule(row rowScanner) (*WorkSchedule, error) {
+	var s WorkSchedule
+	var days []uint8
+	var deleted uint8
+	if err := row.Scan(&s.Username, &s.WorkStart, &s.WorkEnd, &days, &deleted, &s.UpdatedAt, &s.UpdatedBy); err != nil {
+		return nil, err
+	}
+	s.WorkDays = make([]int, len(days))
+	for i, d := range days {
+		s.WorkDays[i] = int(d)
+	}
+	s.IsDeleted = deleted == 1
+	return &s, nil
+}
+
+// GetWorkSchedules returns the per-employee schedule overrides
+func (db *Database) GetWorkSchedules(ctx context.Context) ([]WorkSchedule, error) {
+	query := `
+		SELECT username, work_start, work_end, work_days, is_deleted, updated_at, updated_by
+		FROM monitoring.work_schedules FINAL
+		WHERE is_deleted = 0
+		ORDER BY username`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make([]WorkSchedule, 0)
+	for rows.Next() {
+		s, err := scanWorkSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan work schedule: %w", err)
+		}
+		schedules = append(schedules, *s)
+	}
+
+	return schedules, rows.Err()
+}
+
+// GetWorkSchedule returns an employee's override, or nil if the employee
+// follows the company working hours
+func (db *Database) GetWorkSchedule(ctx context.Context, username string) (*WorkSchedule, error) {
+	query := `
+		SELECT username, work_start, work_end, work_days, is_deleted, updated_at, updated_by
+		FROM monitoring.work_schedules FINAL
+		WHERE username = ? AND is_deleted = 0
+		LIMIT 1`
+
+	s, err := scanWorkSchedule(db.conn.QueryRow(ctx, query, username))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get work schedule: %w", err)
+	}
+	return s, nil
+}
+
+// SaveWorkSchedule writes a new version of the override. Deletion is a save
+// with IsDeleted=true.
+func (db *Database) SaveWorkSchedule(ctx context.Context, s *WorkSchedule) error {
+	s.UpdatedAt = time.Now()
+	days := make([]uint8, len(s.WorkDays))
+	for i, d := range s.WorkDays {
+		days[i] = uint8(d)
+	}
+
+	query := `
+		INSERT INTO monitoring.work_schedules
+			(username, work_start, work_end, work_days, is_deleted, updated_at, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	return db.conn.Exec(ctx, query,
+		s.Username, s.WorkStart, s.WorkEnd, days, boolToUInt8(s.IsDeleted), s.UpdatedAt, s.UpdatedBy,
+	)
+}
+
+// GetHolidays returns the calendar entries from start to end, both inclusive
+func (db *Database) GetHolidays(ctx context.Context, start, end time.Time) ([]Holiday, error) {
+	query := `
+		SELECT toString(date), name, workday, is_deleted, updated_at, updated_by
+		FROM monitoring.holidays FINAL
+		WHERE date >= toDate(?) AND date <= toDate(?) AND is_deleted = 0
+		ORDER BY date`
+
+	rows, err := db.conn.Query(ctx, query, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holidays := make([]Holiday, 0)
+	for rows.Next() {
+		var h Holiday
+		var workday, deleted uint8
+		if err := rows.Scan(&h.Date, &h.Name, &workday, &deleted, &h.UpdatedAt, &h.UpdatedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan holiday: %w", err)
+		}
+		h.Workday = workday == 1
+		h.IsDeleted = deleted == 1
+		holidays = append(holidays, h)
+	}
+
+	return holidays, rows.Err()
+}
+
+// SaveHoliday writes a new version of a calendar entry. Deletion is a save
+// with IsDeleted=true.
+func (db *Database) SaveHoliday(ctx context.Context, h *Holiday) error {
+	h.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO monitoring.holidays (date, name, workday, is_deleted, updated_at, updated_by)
+		VALUES (toDate(?), ?, ?, ?, ?, ?)`
+
+	return db.conn.Exec(ctx, query,
+		h.Date, h.Name, boolToUInt8(h.Workday), boolToUInt8(h.IsDeleted), h.UpdatedAt, h.UpdatedBy,
+	)
+}
+
+// GetAttendanceEmployees returns the active employees matching the filter
+func (db *Database) GetAttendanceEmployees(ctx context.Context, f GroupFilter) ([]AttendanceEmployee, error) {
+	members, args := f.members()
+	rows, err := db.conn.Query(ctx, members+" ORDER BY full_name, username", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query employees: %w", err)
+	}
+	defer rows.Close()
+
+	employees := make([]AttendanceEmployee, 0)
+	for rows.Next() {
+		var e AttendanceEmployee
+		if err := rows.Scan(&e.Username, &e.FullName, &e.Department, &e.Team); err != nil {
+			return nil, fmt.Errorf("failed to scan employee: %w", err)
+		}
+		employees = append(employees, e)
+	}
+	return employees, rows.Err()
+}
+
+// GetAttendanceEmployee returns an employee's names, or nil if the username
+// is not in the employee directory. Inactive employees are included so past
+// months stay available.
+func (db *Database) GetAttendanceEmployee(ctx context.Context, username string) (*AttendanceEmployee, error) {
+	query := `
+		SELECT username, full_name, department, team
+		FROM monitoring.employees FINAL
+		WHERE username = ?
+		LIMIT 1`
+
+	var e AttendanceEmployee
+	if err := db.conn.QueryRow(ctx, query, username).Scan(&e.Username, &e.FullName, &e.Department, &e.Team); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get employee: %w", err)
+	}
+	return &e, nil
+}
+
+// GetAttendanceSegments returns an employee's active segments that overlap
+// the period, ordered by start. Segments starting before the period are
+// included so work past midnight is not lost. A month with more than
+// attendanceSegmentLimit segments is an error rather than a silently
+// truncated timesheet.
+func (db *Database) GetAttendanceSegments(ctx context.Context, username string, p reports.Period) ([]AttendanceSegment, error) {
+	query := `
+		SELECT username, timestamp_start, timestamp_end
+		FROM monitoring.activity_segments
+		WHERE username = ?
+		  AND state = 'active'
+		  AND timestamp_start >= ? AND timestamp_start < ?
+		  AND timestamp_end > ?
+		ORDER BY timestamp_start
+		LIMIT ?`
+
+	rows, err := db.conn.Query(ctx, query, username, p.Start.Add(-24*time.Hour), p.End, p.Start, attendanceSegmentLimit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attendance segments: %w", err)
+	}
+	defer rows.Close()
+
+	segments := make([]AttendanceSegment, 0)
+	for rows.Next() {
+		var s AttendanceSegment
+		if err := rows.Scan(&s.Username, &s.Start, &s.End); err != nil {
+			return nil, fmt.Errorf("failed to scan attendance segment: %w", err)
+		}
+		segments = append(segments, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(segments) > attendanceSegmentLimit {
+		return nil, fmt.Errorf("%s has more than %d active segments in the period", username, attendanceSegmentLimit)
+	}
+	return segments, nil
+}
@@ -140,3 +140,715 @@ ORDER BY id`
 	zapctx.Info(ctx, "✅ process_catalog table schema is up to date")
 	return nil
 }
+
+// AutoSyncOperatorUsersTable creates the operator_users table if it doesn't exist
+// This stores dashboard operators used by /api/auth endpoints
+func (db *Database) AutoSyncOperatorUsersTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing operator_users table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.operator_users (
+    username String,
+    password_hash String,
+    full_name String DEFAULT '',
+    role Enum8('admin' = 1, 'hr_manager' = 2, 'department_head' = 3),
+    department String DEFAULT '',
+    is_active UInt8 DEFAULT 1,
+    created_at DateTime DEFAULT now(),
+    updated_at DateTime DEFAULT now(),
+    created_by String DEFAULT '',
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY username
+SETTINGS index_granularity = 8192`
+
+	err := db.conn.Exec(ctx, createTableSQL)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to create operator_users table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ operator_users table schema is up to date")
+	return nil
+}
+
+// AutoSyncAlertRulesTable creates the alert_rules table and extends alerts.alert_type
+// with the types produced by the rules engine
+func (db *Database) AutoSyncAlertRulesTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing alert_rules table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.alert_rules (
+    id UUID DEFAULT generateUUIDv4(),
+    name String,
+    description String DEFAULT '',
+    rule_type String,
+    severity Enum8('low' = 1, 'medium' = 2, 'high' = 3, 'critical' = 4),
+    enabled UInt8 DEFAULT 1,
+    cooldown_minutes UInt32 DEFAULT 60,
+    params String DEFAULT '{}',
+    is_deleted UInt8 DEFAULT 0,
+    created_at DateTime DEFAULT now(),
+    updated_at DateTime DEFAULT now(),
+    created_by String DEFAULT '',
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create alert_rules table", zap.Error(err))
+		return err
+	}
+
+	// Appending enum values keeps existing numbering, so this is a metadata-only change
+	alterAlertTypeSQL := `
+ALTER TABLE monitoring.alerts MODIFY COLUMN alert_type Enum8(
+    'mass_file_copy' = 1,
+    'usb_connection' = 2,
+    'suspicious_process' = 3,
+    'large_upload' = 4,
+    'new_usb_device' = 5,
+    'large_file_copy' = 6,
+    'low_productivity' = 7
+)`
+
+	if err := db.conn.Exec(ctx, alterAlertTypeSQL); err != nil {
+		zapctx.Error(ctx, "Failed to extend alerts.alert_type", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ alert_rules table schema is up to date")
+	return nil
+}
+
+// AutoSyncKnownUSBDevicesTable adds the server receive time to usb_events and
+// creates the registry of USB devices already seen, seeded from usb_events,
+// for the new_usb_device rule
+func (db *Database) AutoSyncKnownUSBDevicesTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing known_usb_devices table schema...")
+
+	var hasReceivedAt uint64
+	err := db.conn.QueryRow(ctx, `
+SELECT count() FROM system.columns
+WHERE database = 'monitoring' AND table = 'usb_events' AND name = 'received_at'`).Scan(&hasReceivedAt)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to check usb_events.received_at column", zap.Error(err))
+		return err
+	}
+
+	if hasReceivedAt == 0 {
+		if err := db.conn.Exec(ctx, `ALTER TABLE monitoring.usb_events ADD COLUMN IF NOT EXISTS received_at DateTime DEFAULT now()`); err != nil {
+			zapctx.Error(ctx, "Failed to add usb_events.received_at column", zap.Error(err))
+			return err
+		}
+		// now() would be evaluated on every read of old parts, so existing rows
+		// get their receive time written once, synchronously
+		syncCtx := clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"mutations_sync": 1}))
+		if err := db.conn.Exec(syncCtx, `ALTER TABLE monitoring.usb_events MATERIALIZE COLUMN received_at`); err != nil {
+			zapctx.Error(ctx, "Failed to materialize usb_events.received_at column", zap.Error(err))
+			return err
+		}
+		zapctx.Info(ctx, "✅ Added received_at column to usb_events")
+	}
+
+	// Rows arrive in receive order, so a minmax index skips all but the newest granules
+	if err := db.conn.Exec(ctx, `ALTER TABLE monitoring.usb_events ADD INDEX IF NOT EXISTS idx_received_at received_at TYPE minmax GRANULARITY 1`); err != nil {
+		zapctx.Error(ctx, "Failed to add usb_events received_at index", zap.Error(err))
+		return err
+	}
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.known_usb_devices (
+    device_id String,
+    first_seen DateTime64(3),
+    computer_name String,
+    username String,
+    device_name String,
+    registered_at DateTime DEFAULT now()
+) ENGINE = ReplacingMergeTree(registered_at)
+ORDER BY device_id
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create known_usb_devices table", zap.Error(err))
+		return err
+	}
+
+	var known uint64
+	if err := db.conn.QueryRow(ctx, "SELECT count() FROM monitoring.known_usb_devices").Scan(&known); err != nil {
+		zapctx.Error(ctx, "Failed to check known USB devices count", zap.Error(err))
+		return err
+	}
+	if known == 0 {
+		// Devices seen before the registry existed are not new
+		seedSQL := `
+INSERT INTO monitoring.known_usb_devices (device_id, first_seen, computer_name, username, device_name)
+SELECT device_id, min(timestamp), argMin(computer_name, timestamp), argMin(username, timestamp), argMin(device_name, timestamp)
+FROM monitoring.usb_events
+WHERE device_id != ''
+GROUP BY device_id`
+
+		if err := db.conn.Exec(ctx, seedSQL); err != nil {
+			zapctx.Error(ctx, "Failed to seed known USB devices", zap.Error(err))
+			return err
+		}
+	}
+
+	zapctx.Info(ctx, "✅ known_usb_devices table schema is up to date")
+	return nil
+}
+
+// AutoLoadDefaultAlertRules loads default alert rules if the table is empty
+func (db *Database) AutoLoadDefaultAlertRules(ctx context.Context) error {
+	var count uint64
+	err := db.conn.QueryRow(ctx, "SELECT count(*) FROM monitoring.alert_rules").Scan(&count)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to check alert rules count", zap.Error(err))
+		return err
+	}
+
+	if count > 0 {
+		zapctx.Info(ctx, "✅ Alert rules already loaded", zap.Uint64("count", count))
+		return nil
+	}
+
+	zapctx.Info(ctx, "📥 Loading default alert rules...")
+
+	seedSQL := `
+INSERT INTO monitoring.alert_rules
+(name, description, rule_type, severity, enabled, cooldown_minutes, params, created_by, updated_by)
+VALUES
+('USB device connected', 'Any USB storage device connected', 'usb_connection', 'medium', 1, 30, '{"event_types":["connected"]}', 'system', 'system'),
+('New USB device', 'USB device never seen before', 'new_usb_device', 'high', 1, 0, '{}', 'system', 'system'),
+('Large file copy', 'Single copy operation of 100 MB or more', 'large_file_copy', 'high', 1, 30, '{"min_size_mb":100}', 'system', 'system'),
+('Mass file copy', 'Copy operation of 100 files or more', 'mass_file_copy', 'critical', 1, 30, '{"min_files":100}', 'system', 'system'),
+('Suspicious process', 'Process from the blocklist is running', 'suspicious_process', 'high', 0, 60, '{"processes":[]}', 'system', 'system'),
+('Low productivity', 'Daily productivity below productivity_threshold', 'low_productivity', 'low', 1, 1440, '{"min_active_minutes":120}', 'system', 'system')
+`
+
+	if err := db.conn.Exec(ctx, seedSQL); err != nil {
+		zapctx.Error(ctx, "Failed to load default alert rules", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ Default alert rules loaded successfully")
+	return nil
+}
+
+// AutoSyncAlertStatesTable adds a stable id to alerts and creates the alert_states
+// and alert_comments tables used by the acknowledge/resolve workflow
+func (db *Database) AutoSyncAlertStatesTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing alert_states table schema...")
+
+	var hasID uint64
+	err := db.conn.QueryRow(ctx, `
+SELECT count() FROM system.columns
+WHERE database = 'monitoring' AND table = 'alerts' AND name = 'id'`).Scan(&hasID)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to check alerts.id column", zap.Error(err))
+		return err
+	}
+
+	if hasID == 0 {
+		if err := db.conn.Exec(ctx, `ALTER TABLE monitoring.alerts ADD COLUMN IF NOT EXISTS id UUID DEFAULT generateUUIDv4() FIRST`); err != nil {
+			zapctx.Error(ctx, "Failed to add alerts.id column", zap.Error(err))
+			return err
+		}
+		// generateUUIDv4() would yield a new value on every read of old parts,
+		// so existing rows get their id written once, synchronously
+		syncCtx := clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"mutations_sync": 1}))
+		if err := db.conn.Exec(syncCtx, `ALTER TABLE monitoring.alerts MATERIALIZE COLUMN id`); err != nil {
+			zapctx.Error(ctx, "Failed to materialize alerts.id column", zap.Error(err))
+			return err
+		}
+		zapctx.Info(ctx, "✅ Added id column to alerts")
+	}
+
+	createStatesSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.alert_states (
+    alert_id UUID,
+    status Enum8('open' = 1, 'acknowledged' = 2, 'resolved' = 3, 'false_positive' = 4),
+    assignee String DEFAULT '',
+    acknowledged_by String DEFAULT '',
+    acknowledged_at Nullable(DateTime64(3)),
+    resolved_by String DEFAULT '',
+    resolved_at Nullable(DateTime64(3)),
+    resolution_notes String DEFAULT '',
+    updated_at DateTime64(3) DEFAULT now64(3),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY alert_id
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createStatesSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create alert_states table", zap.Error(err))
+		return err
+	}
+
+	createCommentsSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.alert_comments (
+    id UUID DEFAULT generateUUIDv4(),
+    alert_id UUID,
+    author String,
+    text String,
+    created_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = MergeTree()
+ORDER BY (alert_id, created_at)
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createCommentsSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create alert_comments table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ alert_states table schema is up to date")
+	return nil
+}
+
+// AutoSyncNotificationDeliveriesTable creates the delivery log of alert notifications
+func (db *Database) AutoSyncNotificationDeliveriesTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing notification_deliveries table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.notification_deliveries (
+    timestamp DateTime64(3),
+    alert_id String,
+    channel LowCardinality(String),
+    channel_type LowCardinality(String),
+    status Enum8('sent' = 1, 'failed' = 2, 'dropped' = 3),
+    attempts UInt8,
+    error String DEFAULT '',
+    duration_ms UInt32 DEFAULT 0,
+    event_date Date DEFAULT toDate(timestamp)
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(event_date)
+ORDER BY (timestamp, channel)
+TTL event_date + INTERVAL 90 DAY
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create notification_deliveries table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ notification_deliveries table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentConfigsTable creates the per-computer agent settings table and
+// adds the configured flag. Rows written before the flag count as configured,
+// as they were served to agents already.
+func (db *Database) AutoSyncAgentConfigsTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_configs table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_configs (
+    computer_name String,
+    api_key String,
+    screenshot_enabled UInt8 DEFAULT 0,
+    screenshot_interval_minutes UInt32 DEFAULT 15,
+    keylogger_enabled UInt8 DEFAULT 0,
+    usb_monitoring_enabled UInt8 DEFAULT 1,
+    file_copy_monitoring_enabled UInt8 DEFAULT 1,
+    large_copy_threshold_mb UInt32 DEFAULT 100,
+    last_seen DateTime,
+    agent_version String,
+    configured UInt8 DEFAULT 1,
+    updated_at DateTime DEFAULT now()
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY computer_name`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_configs table", zap.Error(err))
+		return err
+	}
+
+	if err := db.conn.Exec(ctx, `ALTER TABLE monitoring.agent_configs ADD COLUMN IF NOT EXISTS configured UInt8 DEFAULT 1 AFTER agent_version`); err != nil {
+		zapctx.Error(ctx, "Failed to add agent_configs.configured column", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ agent_configs table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentConfigStatusTable creates the table of config versions applied by agents
+func (db *Database) AutoSyncAgentConfigStatusTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_config_status table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_config_status (
+    computer_name String,
+    applied_version String,
+    applied_at DateTime,
+    error String DEFAULT '',
+    updated_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY computer_name
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_config_status table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ agent_config_status table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentRegistryTable creates the registry of agents and their last heartbeat
+func (db *Database) AutoSyncAgentRegistryTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_registry table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_registry (
+    computer_name String,
+    username String,
+    agent_version String,
+    os_build String,
+    ip_addresses Array(String),
+    uptime_seconds UInt64,
+    monitors Array(String),
+    buffer_size UInt32,
+    buffer_dropped UInt64 DEFAULT 0,
+    circuit_breaker LowCardinality(String),
+    config_version String DEFAULT '',
+    throttle_level UInt8 DEFAULT 0,
+    throttle_reason String DEFAULT '',
+    memory_mb UInt32 DEFAULT 0,
+    cpu_percent Float32 DEFAULT 0,
+    monitor_status String DEFAULT '',
+    last_heartbeat DateTime64(3)
+) ENGINE = ReplacingMergeTree(last_heartbeat)
+ORDER BY computer_name
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_registry table", zap.Error(err))
+		return err
+	}
+
+	if err := db.conn.Exec(ctx, `ALTER TABLE monitoring.agent_registry ADD COLUMN IF NOT EXISTS buffer_dropped UInt64 DEFAULT 0 AFTER buffer_size`); err != nil {
+		zapctx.Error(ctx, "Failed to add agent_registry.buffer_dropped column", zap.Error(err))
+		return err
+	}
+
+	// Resource governor and monitor supervisor state, added after the table shipped
+	for _, column := range []string{
+		"throttle_level UInt8 DEFAULT 0 AFTER config_version",
+		"throttle_reason String DEFAULT '' AFTER throttle_level",
+		"memory_mb UInt32 DEFAULT 0 AFTER throttle_reason",
+		"cpu_percent Float32 DEFAULT 0 AFTER memory_mb",
+		// Monitor supervisor state as JSON
+		"monitor_status String DEFAULT '' AFTER cpu_percent",
+	} {
+		if err := db.conn.Exec(ctx, "ALTER TABLE monitoring.agent_registry ADD COLUMN IF NOT EXISTS "+column); err != nil {
+			zapctx.Error(ctx, "Failed to add agent_registry column", zap.String("column", column), zap.Error(err))
+			return err
+		}
+	}
+
+	zapctx.Info(ctx, "✅ agent_registry table schema is up to date")
+	return nil
+}
+
+// AutoSyncIngestedEventsTable creates the table of stored client event IDs used to drop agent retries
+func (db *Database) AutoSyncIngestedEventsTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing ingested_events table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.ingested_events (
+    event_id String,
+    computer_name String,
+    seq UInt64,
+    event_type LowCardinality(String),
+    received_at DateTime
+) ENGINE = ReplacingMergeTree(received_at)
+ORDER BY event_id
+TTL received_at + INTERVAL 30 DAY
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create ingested_events table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ ingested_events table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentBuildsTable creates the table of uploaded agent binaries and their signatures
+func (db *Database) AutoSyncAgentBuildsTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_builds table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_builds (
+    version String,
+    os LowCardinality(String),
+    arch LowCardinality(String),
+    sha256 String,
+    size UInt64,
+    object_name String,
+    signature String,
+    notes String DEFAULT '',
+    uploaded_by String DEFAULT '',
+    uploaded_at DateTime DEFAULT now()
+) ENGINE = ReplacingMergeTree(uploaded_at)
+ORDER BY (version, os, arch)
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_builds table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ agent_builds table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentReleaseChannelsTable creates the table of the agent version assigned to each release channel
+func (db *Database) AutoSyncAgentReleaseChannelsTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_release_channels table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_release_channels (
+    channel LowCardinality(String),
+    version String,
+    updated_at DateTime64(3) DEFAULT now64(3),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY channel
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_release_channels table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ agent_release_channels table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentGroupsTable creates the table of the groups of computers that follow a release channel
+func (db *Database) AutoSyncAgentGroupsTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_groups table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_groups (
+    name String,
+    channel LowCardinality(String),
+    computer_names Array(String),
+    is_deleted UInt8 DEFAULT 0,
+    updated_at DateTime64(3) DEFAULT now64(3),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY name
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_groups table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ agent_groups table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentUpdateStatusTable creates the table of the last update outcome reported by each agent
+func (db *Database) AutoSyncAgentUpdateStatusTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_update_status table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_update_status (
+    computer_name String,
+    from_version String DEFAULT '',
+    version String,
+    status Enum8('installed' = 1, 'confirmed' = 2, 'rolled_back' = 3, 'failed' = 4),
+    error String DEFAULT '',
+    updated_at DateTime64(3) DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY computer_name
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_update_status table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ agent_update_status table schema is up to date")
+	return nil
+}
+
+// AutoSyncAgentLogsTable creates the table of warnings and errors shipped by agents
+func (db *Database) AutoSyncAgentLogsTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing agent_logs table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.agent_logs (
+    timestamp DateTime64(3),
+    computer_name String,
+    level LowCardinality(String),
+    component LowCardinality(String),
+    message String,
+    caller String DEFAULT '',
+    fields String DEFAULT '',
+    received_at DateTime
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (computer_name, timestamp)
+TTL toDateTime(timestamp) + INTERVAL 30 DAY
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create agent_logs table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ agent_logs table schema is up to date")
+	return nil
+}
+
+// AutoSyncEmployeesTable creates the employees table and adds the columns
+// the employee queries and group reports rely on
+func (db *Database) AutoSyncEmployeesTable(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing employees table schema...")
+
+	createTableSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.employees (
+    username String,
+    full_name String,
+    department String,
+    team String DEFAULT '',
+    position String,
+    email String,
+    consent_given UInt8 DEFAULT 0,
+    consent_date Nullable(DateTime),
+    is_active UInt8 DEFAULT 1,
+    created_at DateTime DEFAULT now(),
+    updated_at DateTime DEFAULT now()
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY username`
+
+	if err := db.conn.Exec(ctx, createTableSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create employees table", zap.Error(err))
+		return err
+	}
+
+	for _, column := range []string{
+		"team String DEFAULT '' AFTER department",
+		"consent_given UInt8 DEFAULT 0 AFTER email",
+		"consent_date Nullable(DateTime) AFTER consent_given",
+	} {
+		if err := db.conn.Exec(ctx, "ALTER TABLE monitoring.employees ADD COLUMN IF NOT EXISTS "+column); err != nil {
+			zapctx.Error(ctx, "Failed to add employees column", zap.String("column", column), zap.Error(err))
+			return err
+		}
+	}
+
+	zapctx.Info(ctx, "✅ employees table schema is up to date")
+	return nil
+}
+
+// AutoSyncReportSchedulesTables creates the report schedules and their run history
+func (db *Database) AutoSyncReportSchedulesTables(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing report_schedules table schema...")
+
+	createSchedulesSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.report_schedules (
+    id UUID DEFAULT generateUUIDv4(),
+    name String,
+    cron String,
+    report_type LowCardinality(String),
+    target String,
+    department String DEFAULT '',
+    period LowCardinality(String),
+    granularity LowCardinality(String) DEFAULT 'day',
+    recipients Array(String),
+    enabled UInt8 DEFAULT 1,
+    is_deleted UInt8 DEFAULT 0,
+    created_at DateTime DEFAULT now(),
+    updated_at DateTime DEFAULT now(),
+    created_by String DEFAULT '',
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createSchedulesSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create report_schedules table", zap.Error(err))
+		return err
+	}
+
+	createRunsSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.report_runs (
+    id UUID,
+    schedule_id String,
+    schedule_name String,
+    trigger LowCardinality(String),
+    status Enum8('success' = 1, 'failed' = 2),
+    started_at DateTime64(3),
+    finished_at DateTime64(3),
+    period_start DateTime,
+    period_end DateTime,
+    recipients Array(String),
+    error String DEFAULT '',
+    event_date Date DEFAULT toDate(started_at)
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(event_date)
+ORDER BY (schedule_id, started_at)
+TTL event_date + INTERVAL 365 DAY
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createRunsSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create report_runs table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ report_schedules table schema is up to date")
+	return nil
+}
+
+// AutoSyncAttendanceTables creates the per-employee working hours and the
+// holiday calendar used by timesheets
+func (db *Database) AutoSyncAttendanceTables(ctx context.Context) error {
+	zapctx.Info(ctx, "🔄 Auto-syncing attendance tables schema...")
+
+	createSchedulesSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.work_schedules (
+    username String,
+    work_start String,
+    work_end String,
+    work_days Array(UInt8),
+    is_deleted UInt8 DEFAULT 0,
+    updated_at DateTime DEFAULT now(),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY username
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createSchedulesSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create work_schedules table", zap.Error(err))
+		return err
+	}
+
+	createHolidaysSQL := `
+CREATE TABLE IF NOT EXISTS monitoring.holidays (
+    date Date,
+    name String,
+    workday UInt8 DEFAULT 0,
+    is_deleted UInt8 DEFAULT 0,
+    updated_at DateTime DEFAULT now(),
+    updated_by String DEFAULT ''
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY date
+SETTINGS index_granularity = 8192`
+
+	if err := db.conn.Exec(ctx, createHolidaysSQL); err != nil {
+		zapctx.Error(ctx, "Failed to create holidays table", zap.Error(err))
+		return err
+	}
+
+	zapctx.Info(ctx, "✅ attendance tables schema is up to date")
+	return nil
+}
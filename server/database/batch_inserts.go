@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// sendBatch inserts n rows with a single PrepareBatch round trip, so a batch
+// becomes one INSERT and one part instead of one per row
+func (db *Database) sendBatch(ctx context.Context, query string, n int, row func(i int) []any) error {
+	if n == 0 {
+		return nil
+	}
+
+	batch, err := db.conn.PrepareBatch(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare batch: %w", err)
+	}
+	defer batch.Abort()
+
+	for i := 0; i < n; i++ {
+		if err := batch.Append(row(i)...); err != nil {
+			return fmt.Errorf("failed to append row %d: %w", i, err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to send batch: %w", err)
+	}
+	return nil
+}
+
+// InsertKeyboardEventsBatch inserts keyboard events in one batch
+func (db *Database) InsertKeyboardEventsBatch(ctx context.Context, events []KeyboardEvent) error {
+	return db.sendBatch(ctx, `INSERT INTO monitoring.keyboard_events
+		(timestamp, computer_name, username, window_title, process_name, text_content)`,
+		len(events), func(i int) []any {
+			e := events[i]
+			return []any{e.Timestamp, e.ComputerName, e.Username, e.WindowTitle, e.ProcessName, e.TextContent}
+		})
+}
+
+// InsertUSBEventsBatch inserts USB events in one batch
+func (db *Database) InsertUSBEventsBatch(ctx context.Context, events []USBEvent) error {
+	return db.sendBatch(ctx, `INSERT INTO monitoring.usb_events
+		(timestamp, computer_name, username, device_id, device_name, device_type, event_type, volume_serial)`,
+		len(events), func(i int) []any {
+			e := events[i]
+			return []any{e.Timestamp, e.ComputerName, e.Username, e.DeviceID, e.DeviceName, e.DeviceType,
+				e.EventType, e.VolumeSerial}
+		})
+}
+
+// InsertFileCopyEventsBatch inserts file copy events in one batch
+func (db *Database) InsertFileCopyEventsBatch(ctx context.Context, events []FileCopyEvent) error {
+	return db.sendBatch(ctx, `INSERT INTO monitoring.file_copy_events
+		(timestamp, computer_name, username, source_path, destination_path, file_size, file_count, operation_type, is_usb_target)`,
+		len(events), func(i int) []any {
+			e := events[i]
+			return []any{e.Timestamp, e.ComputerName, e.Username, e.SourcePath, e.DestinationPath, e.FileSize,
+				e.FileCount, e.OperationType, e.IsUSBTarget}
+		})
+}
+
+// InsertActivitySegmentsBatch inserts activity segments in one batch
+func (db *Database) InsertActivitySegmentsBatch(ctx context.Context, segments []ActivitySegment) error {
+	return db.sendBatch(ctx, `INSERT INTO monitoring.activity_segments
+		(timestamp_start, timestamp_end, duration_sec, state, computer_name, username, process_name, window_title, session_id, category)`,
+		len(segments), func(i int) []any {
+			s := segments[i]
+			return []any{s.TimestampStart, s.TimestampEnd, s.DurationSec, s.State, s.ComputerName, s.Username,
+				s.ProcessName, s.WindowTitle, s.SessionID, s.Category}
+		})
+}
@@ -50,6 +50,110 @@ func New(ctx context.Context, host string, port int, database, username, passwor
                 // Don't fail startup - table might be created by migrations
         }
 
+        // Auto-sync operator_users table (used by /api/auth endpoints)
+        if err := db.AutoSyncOperatorUsersTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync operator_users table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync alert_rules table (used by the alert rules engine)
+        if err := db.AutoSyncAlertRulesTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync alert_rules table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        } else if err := db.AutoLoadDefaultAlertRules(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-load default alert rules", zap.Error(err))
+        }
+
+        // Auto-sync known_usb_devices table (used by the new_usb_device rule)
+        if err := db.AutoSyncKnownUSBDevicesTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync known_usb_devices table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync alert_states table (used by the alert acknowledge/resolve workflow)
+        if err := db.AutoSyncAlertStatesTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync alert_states table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync notification_deliveries table (delivery log of alert notifications)
+        if err := db.AutoSyncNotificationDeliveriesTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync notification_deliveries table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_configs table (per-computer monitor settings and API keys)
+        if err := db.AutoSyncAgentConfigsTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_configs table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_config_status table (config versions applied by agents)
+        if err := db.AutoSyncAgentConfigStatusTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_config_status table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_registry table (agent heartbeats and inventory)
+        if err := db.AutoSyncAgentRegistryTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_registry table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync ingested_events table (client event IDs for deduplication)
+        if err := db.AutoSyncIngestedEventsTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync ingested_events table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_builds table (agent builds)
+        if err := db.AutoSyncAgentBuildsTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_builds table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_release_channels table (release channel versions)
+        if err := db.AutoSyncAgentReleaseChannelsTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_release_channels table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_groups table (computer groups per release channel)
+        if err := db.AutoSyncAgentGroupsTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_groups table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_update_status table (agent update outcomes)
+        if err := db.AutoSyncAgentUpdateStatusTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_update_status table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync agent_logs table (warnings shipped by agents)
+        if err := db.AutoSyncAgentLogsTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync agent_logs table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync employees table (team and consent columns)
+        if err := db.AutoSyncEmployeesTable(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync employees table", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync report_schedules and report_runs tables (email digests)
+        if err := db.AutoSyncReportSchedulesTables(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync report_schedules tables", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
+        // Auto-sync work_schedules and holidays tables (attendance timesheets)
+        if err := db.AutoSyncAttendanceTables(ctx); err != nil {
+                zapctx.Warn(ctx, "Failed to auto-sync attendance tables", zap.Error(err))
+                // Don't fail startup - table might be created by migrations
+        }
+
         // Auto-load default categories if table is empty
         if err := db.AutoLoadDefaultCategories(ctx); err != nil {
                 zapctx.Warn(ctx, "Failed to auto-load default categories", zap.Error(err))
@@ -457,6 +561,11 @@ func (db *Database) Close() error {
         return db.conn.Close()
 }
 
+// Ping checks that ClickHouse is reachable
+func (db *Database) Ping(ctx context.Context) error {
+        return db.conn.Ping(ctx)
+}
+
 // GetUniqueUsernames returns list of unique usernames from activity segments
 func (db *Database) GetUniqueUsernames(ctx context.Context) ([]string, error) {
         // Use activity_segments as primary source (more up-to-date)
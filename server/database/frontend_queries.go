@@ -10,129 +10,31 @@ import (
         "go.uber.org/zap"
 )
 
-// GetAgents returns all agents with their status
-func (db *Database) GetAgents(ctx context.Context) ([]Agent, error) {
-        query := `
-                SELECT 
-                        computer_name,
-                        username,
-                        MAX(timestamp) as last_seen,
-                        '' as ip_address,
-                        '' as os_version,
-                        '' as agent_version
-                FROM monitoring.activity_events
-                WHERE timestamp > now() - INTERVAL 1 DAY
-                GROUP BY computer_name, username
-                ORDER BY last_seen DESC`
-
-        rows, err := db.conn.Query(ctx, query)
+// UpdateAgentConfig updates agent configuration
+// The issued API key and agent inventory fields are preserved
+func (db *Database) UpdateAgentConfig(ctx context.Context, computerName string, config ConfigUpdate) error {
+        row, err := db.loadAgentConfigRow(ctx, computerName)
         if err != nil {
-                return nil, err
+                return err
         }
-        defer rows.Close()
-
-        agents := make([]Agent, 0)
-        for rows.Next() {
-                var a Agent
-                var lastSeen time.Time
-                if err := rows.Scan(&a.ComputerName, &a.Username, &lastSeen, &a.IPAddress, &a.OSVersion, &a.AgentVersion); err != nil {
-                        continue
-                }
-
-                a.LastSeen = lastSeen.Format(time.RFC3339)
-
-                // Determine status based on last seen
-                minutesSince := int(time.Since(lastSeen).Minutes())
-                if minutesSince < 5 {
-                        a.Status = "online"
-                } else if minutesSince < 30 {
-                        a.Status = "idle"
-                } else {
-                        a.Status = "offline"
-                }
-
-                // Default config
-                a.Config = ConfigUpdate{
-                        ScreenshotInterval: 60,
-                        ActivityTracking:   true,
-                        KeyloggerEnabled:   false,
-                        USBMonitoring:      true,
-                        FileMonitoring:     true,
-                        DLPEnabled:         true,
-                }
-
-                agents = append(agents, a)
+        if row == nil {
+                defaults := defaultAgentConfig(computerName)
+                row = &defaults
         }
 
-        return agents, rows.Err()
-}
-
-// GetAgentConfig returns configuration for specific agent
-func (db *Database) GetAgentConfig(ctx context.Context, computerName string) (*ConfigUpdate, error) {
-        query := `
-                SELECT 
-                        screenshot_interval_minutes,
-                        screenshot_enabled,
-                        keylogger_enabled,
-                        usb_monitoring_enabled,
-                        file_copy_monitoring_enabled
-                FROM monitoring.agent_configs
-                WHERE computer_name = ?
-                LIMIT 1`
-
-        var config ConfigUpdate
-        var screenshotMin int
-        var activityEnabled, keyloggerEnabled, usbEnabled, fileEnabled bool
-
-        err := db.conn.QueryRow(ctx, query, computerName).Scan(
-                &screenshotMin, &activityEnabled, &keyloggerEnabled, &usbEnabled, &fileEnabled,
-        )
-
-        if err != nil {
-                // Return defaults if not found
-                return &ConfigUpdate{
-                        ScreenshotInterval: 60,
-                        ActivityTracking:   true,
-                        KeyloggerEnabled:   false,
-                        USBMonitoring:      true,
-                        FileMonitoring:     true,
-                        DLPEnabled:         true,
-                }, nil
-        }
-
-        config.ScreenshotInterval = screenshotMin * 60
-        config.ActivityTracking = activityEnabled
-        config.KeyloggerEnabled = keyloggerEnabled
-        config.USBMonitoring = usbEnabled
-        config.FileMonitoring = fileEnabled
-        config.DLPEnabled = fileEnabled
-
-        return &config, nil
-}
-
-// UpdateAgentConfig updates agent configuration
-func (db *Database) UpdateAgentConfig(ctx context.Context, computerName string, config ConfigUpdate) error {
-        query := `
-                INSERT INTO monitoring.agent_configs 
-                        (computer_name, screenshot_enabled, screenshot_interval_minutes, keylogger_enabled, 
-                         usb_monitoring_enabled, file_copy_monitoring_enabled, api_key, last_seen, agent_version)
-                VALUES (?, ?, ?, ?, ?, ?, ?, now(), '')
-                `
-
         screenshotMin := config.ScreenshotInterval / 60
         if screenshotMin < 1 {
                 screenshotMin = 1
         }
 
-        return db.conn.Exec(ctx, query,
-                computerName,
-                config.ActivityTracking,
-                screenshotMin,
-                config.KeyloggerEnabled,
-                config.USBMonitoring,
-                config.FileMonitoring,
-                "default-key",
-        )
+        row.ScreenshotEnabled = config.ActivityTracking
+        row.ScreenshotIntervalMinutes = screenshotMin
+        row.KeyloggerEnabled = config.KeyloggerEnabled
+        row.USBMonitoringEnabled = config.USBMonitoring
+        row.FileCopyMonitoringEnabled = config.FileMonitoring
+        row.Configured = true
+
+        return db.saveAgentConfigRow(ctx, *row)
 }
 
 // DeleteAgent removes agent configuration
@@ -174,6 +76,7 @@ func (db *Database) GetAllEmployees(ctx context.Context) ([]EmployeeFull, error)
                         username,
                         full_name,
                         department,
+                        team,
                         position,
                         email,
                         consent_given,
@@ -195,7 +98,7 @@ func (db *Database) GetAllEmployees(ctx context.Context) ([]EmployeeFull, error)
                 var consentDate *time.Time
                 var createdAt time.Time
 
-                if err := rows.Scan(&e.Username, &e.FullName, &e.Department, &e.Position,
+                if err := rows.Scan(&e.Username, &e.FullName, &e.Department, &e.Team, &e.Position,
                         &e.Email, &e.ConsentGiven, &consentDate, &createdAt, &e.IsActive); err != nil {
                         continue
                 }
@@ -217,8 +120,8 @@ func (db *Database) GetAllEmployees(ctx context.Context) ([]EmployeeFull, error)
 func (db *Database) CreateEmployee(ctx context.Context, emp EmployeeFull) error {
         query := `
                 INSERT INTO monitoring.employees 
-                        (username, full_name, department, position, email, consent_given, consent_date, created_at, is_active)
-                VALUES (?, ?, ?, ?, ?, ?, ?, now(), ?)`
+                        (username, full_name, department, team, position, email, consent_given, consent_date, created_at, is_active)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, now(), ?)`
 
         var consentDate *time.Time
         if emp.ConsentDate != nil {
@@ -227,7 +130,7 @@ func (db *Database) CreateEmployee(ctx context.Context, emp EmployeeFull) error
         }
 
         return db.conn.Exec(ctx, query,
-                emp.Username, emp.FullName, emp.Department, emp.Position,
+                emp.Username, emp.FullName, emp.Department, emp.Team, emp.Position,
                 emp.Email, emp.ConsentGiven, consentDate, emp.IsActive,
         )
 }
@@ -239,6 +142,7 @@ func (db *Database) UpdateEmployee(ctx context.Context, username string, emp Emp
                 UPDATE 
                         full_name = ?,
                         department = ?,
+                        team = ?,
                         position = ?,
                         email = ?,
                         consent_given = ?,
@@ -253,7 +157,7 @@ func (db *Database) UpdateEmployee(ctx context.Context, username string, emp Emp
         }
 
         return db.conn.Exec(ctx, query,
-                emp.FullName, emp.Department, emp.Position, emp.Email,
+                emp.FullName, emp.Department, emp.Team, emp.Position, emp.Email,
                 emp.ConsentGiven, consentDate, emp.IsActive, username,
         )
 }
@@ -264,10 +168,22 @@ func (db *Database) DeleteEmployee(ctx context.Context, username string) error {
         return db.conn.Exec(ctx, query, username)
 }
 
-// GetDashboardStats returns dashboard statistics
-func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, error) {
+// GetDashboardStats returns dashboard statistics. A non-empty department
+// limits every count to the employees of that department.
+func (db *Database) GetDashboardStats(ctx context.Context, department string) (*DashboardStats, error) {
         stats := &DashboardStats{}
 
+        // scope appends the department filter and its argument to a query's args
+        scope := ""
+        var scopeArgs []any
+        if department != "" {
+                scope = " AND username IN (SELECT username FROM monitoring.employees FINAL WHERE department = ?)"
+                scopeArgs = []any{department}
+        }
+        scoped := func(args ...any) []any {
+                return append(args, scopeArgs...)
+        }
+
         // Calculate time thresholds in Go
         now := time.Now()
         weekAgo := now.Add(-7 * 24 * time.Hour)
@@ -277,7 +193,7 @@ func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, err
         err := db.conn.QueryRow(ctx, `
                 SELECT count(DISTINCT username) 
                 FROM monitoring.activity_segments 
-                WHERE timestamp_start > ?`, weekAgo).Scan(&stats.TotalEmployees)
+                WHERE timestamp_start > ?`+scope, scoped(weekAgo)...).Scan(&stats.TotalEmployees)
         if err != nil {
                 zapctx.Warn(ctx, "Failed to get total employees", zap.Error(err))
         }
@@ -286,7 +202,7 @@ func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, err
         err = db.conn.QueryRow(ctx, `
                 SELECT count(DISTINCT username) 
                 FROM monitoring.activity_segments 
-                WHERE timestamp_start > ? AND state = 'active'`, fiveMinAgo).Scan(&stats.ActiveNow)
+                WHERE timestamp_start > ? AND state = 'active'`+scope, scoped(fiveMinAgo)...).Scan(&stats.ActiveNow)
         if err != nil {
                 zapctx.Warn(ctx, "Failed to get active now", zap.Error(err))
         }
@@ -305,16 +221,19 @@ func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, err
         err = db.conn.QueryRow(ctx, `
                 SELECT count(*) 
                 FROM monitoring.alerts 
-                WHERE timestamp >= ?`, todayStart).Scan(&stats.TotalAlerts)
+                WHERE timestamp >= ?`+scope, scoped(todayStart)...).Scan(&stats.TotalAlerts)
         if err != nil {
                 stats.TotalAlerts = 0
         }
 
         // Unresolved alerts
         err = db.conn.QueryRow(ctx, `
-                SELECT count(*) 
-                FROM monitoring.alerts 
-                WHERE is_acknowledged = 0`).Scan(&stats.UnresolvedAlerts)
+                SELECT count(*)
+                FROM monitoring.alerts
+                WHERE is_acknowledged = 0
+                  AND id NOT IN (
+                        SELECT alert_id FROM monitoring.alert_states FINAL
+                        WHERE status IN ('resolved', 'false_positive'))`+scope, scoped()...).Scan(&stats.UnresolvedAlerts)
         if err != nil {
                 stats.UnresolvedAlerts = 0
         }
@@ -323,7 +242,7 @@ func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, err
         err = db.conn.QueryRow(ctx, `
                 SELECT count(*) 
                 FROM monitoring.screenshot_metadata 
-                WHERE timestamp >= ?`, todayStart).Scan(&stats.TodayScreenshots)
+                WHERE timestamp >= ?`+scope, scoped(todayStart)...).Scan(&stats.TodayScreenshots)
         if err != nil {
                 stats.TodayScreenshots = 0
         }
@@ -332,7 +251,7 @@ func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, err
         err = db.conn.QueryRow(ctx, `
                 SELECT count(*) 
                 FROM monitoring.usb_events 
-                WHERE timestamp >= ?`, todayStart).Scan(&stats.TodayUSBEvents)
+                WHERE timestamp >= ?`+scope, scoped(todayStart)...).Scan(&stats.TodayUSBEvents)
         if err != nil {
                 stats.TodayUSBEvents = 0
         }
@@ -341,7 +260,7 @@ func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, err
         err = db.conn.QueryRow(ctx, `
                 SELECT count(*) 
                 FROM monitoring.file_copy_events 
-                WHERE timestamp >= ?`, todayStart).Scan(&stats.TodayFileEvents)
+                WHERE timestamp >= ?`+scope, scoped(todayStart)...).Scan(&stats.TodayFileEvents)
         if err != nil {
                 stats.TodayFileEvents = 0
         }
@@ -349,8 +268,8 @@ func (db *Database) GetDashboardStats(ctx context.Context) (*DashboardStats, err
         // Average productivity calculation
         // Get all active employees from last 7 days
         usernames := make([]string, 0)
-        userQuery := `SELECT DISTINCT username FROM monitoring.activity_events WHERE timestamp > ?`
-        userRows, err := db.conn.Query(ctx, userQuery, weekAgo)
+        userQuery := `SELECT DISTINCT username FROM monitoring.activity_events WHERE timestamp > ?` + scope
+        userRows, err := db.conn.Query(ctx, userQuery, scoped(weekAgo)...)
         if err == nil {
                 defer userRows.Close()
                 for userRows.Next() {
@@ -486,74 +405,6 @@ func (db *Database) GetApplicationUsage(ctx context.Context, username string, st
         return apps, nil
 }
 
-// GetAlerts returns alerts with optional filtering
-func (db *Database) GetAlerts(ctx context.Context, resolved *bool, severity string, limit, offset int) ([]AlertFull, error) {
-        query := `
-                SELECT 
-                        toString(timestamp) as id,
-                        timestamp,
-                        computer_name,
-                        username,
-                        alert_type,
-                        severity,
-                        description,
-                        metadata as details,
-                        is_acknowledged as is_resolved
-                FROM monitoring.alerts
-                WHERE 1=1`
-
-        args := make([]interface{}, 0)
-
-        if resolved != nil {
-                query += " AND is_acknowledged = ?"
-                args = append(args, *resolved)
-        }
-
-        if severity != "" {
-                query += " AND severity = ?"
-                args = append(args, severity)
-        }
-
-        query += " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
-        args = append(args, limit, offset)
-
-        rows, err := db.conn.Query(ctx, query, args...)
-        if err != nil {
-                return nil, err
-        }
-        defer rows.Close()
-
-        alerts := make([]AlertFull, 0)
-        for rows.Next() {
-                var a AlertFull
-                var ts time.Time
-                if err := rows.Scan(&a.ID, &ts, &a.ComputerName, &a.Username,
-                        &a.AlertType, &a.Severity, &a.Description, &a.Details, &a.IsResolved); err != nil {
-                        zapctx.Error(ctx, "Failed to scan alert row", zap.Error(err))
-                        continue
-                }
-                a.Timestamp = ts.Format(time.RFC3339)
-                alerts = append(alerts, a)
-        }
-
-        if err := rows.Err(); err != nil {
-                zapctx.Error(ctx, "Error iterating alert rows", zap.Error(err))
-                return nil, err
-        }
-
-        return alerts, nil
-}
-
-// ResolveAlert marks alert as resolved
-func (db *Database) ResolveAlert(ctx context.Context, alertID string, resolvedBy string) error {
-        query := `
-                ALTER TABLE monitoring.alerts 
-                UPDATE is_acknowledged = true
-                WHERE toString(timestamp) = ?`
-
-        return db.conn.Exec(ctx, query, alertID)
-}
-
 // GetUSBEventsByUsername returns USB events for user in time range
 func (db *Database) GetUSBEventsByUsername(ctx context.Context, username string, start, end time.Time) ([]USBEvent, error) {
         query := `
@@ -845,7 +696,7 @@ func (db *Database) GetDailyReport(ctx context.Context, username string, date ti
 
         // Get DLP alerts
         falseVal := false
-        dlpAlerts, err := db.GetAlerts(ctx, &falseVal, "critical", 100, 0)
+        dlpAlerts, err := db.GetAlerts(ctx, AlertFilter{Resolved: &falseVal, Severity: "critical", Limit: 100})
         if err != nil {
                 zapctx.Warn(ctx, "Failed to get DLP alerts", zap.Error(err))
         } else {
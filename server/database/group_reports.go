@@ -0,0 +1,378 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/reports"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+const groupReportTopApps = 10
+
+// GroupFilter selects the employees of an aggregate report: active
+// employees of a department and/or team. Empty fields match everyone.
+type GroupFilter struct {
+	Department string
+	Team       string
+}
+
+// GroupStats aggregates the employees of a department or team over a period
+type GroupStats struct {
+	Department string `json:"department"`
+	Team       string `json:"team"`
+	Headcount  int    `json:"headcount"`
+	OnlineNow  int    `json:"online_now"`
+	// ActiveEmployees had any activity in the period; averages and the
+	// productivity distribution only count them
+	ActiveEmployees int                      `json:"active_employees"`
+	TotalActiveTime uint64                   `json:"total_active_time"`
+	AvgActiveTime   uint64                   `json:"avg_active_time"`
+	TotalIdleTime   uint64                   `json:"total_idle_time"`
+	Productivity    ProductivityDistribution `json:"productivity"`
+}
+
+// ProductivityDistribution describes the productivity scores of a group
+type ProductivityDistribution struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+}
+
+// GroupReport is the full report of one department or team
+type GroupReport struct {
+	GroupStats
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	// Categories splits the active time by process category
+	Categories      map[string]uint64  `json:"categories"`
+	TopApplications []ApplicationUsage `json:"top_applications"`
+	Employees       []GroupEmployee    `json:"employees"`
+}
+
+// GroupEmployee is one employee's row of a group report
+type GroupEmployee struct {
+	Username          string  `json:"username"`
+	FullName          string  `json:"full_name"`
+	Department        string  `json:"department"`
+	Team              string  `json:"team"`
+	Online            bool    `json:"online"`
+	LastActivity      string  `json:"last_activity,omitempty"`
+	TotalActiveTime   uint64  `json:"total_active_time"`
+	TotalIdleTime     uint64  `json:"total_idle_time"`
+	ProductiveTime    uint64  `json:"productive_time"`
+	UnproductiveTime  uint64  `json:"unproductive_time"`
+	ProductivityScore float64 `json:"productivity_score"`
+}
+
+// members returns the subquery of the usernames matching the filter
+func (f GroupFilter) members() (string, []any) {
+	query := "SELECT username, full_name, department, team FROM monitoring.employees FINAL WHERE is_active = 1"
+	var args []any
+	if f.Department != "" {
+		query += " AND department = ?"
+		args = append(args, f.Department)
+	}
+	if f.Team != "" {
+		query += " AND team = ?"
+		args = append(args, f.Team)
+	}
+	return query, args
+}
+
+// groupSegments returns the subquery of the filter's segments in the period
+// with their process category
+func groupSegments(f GroupFilter, p reports.Period, cats processCategories) (string, []any) {
+	members, memberArgs := f.members()
+	query := `SELECT username, state, process_name,
+			transform(process_name, ?, ?, 'neutral') AS category, duration_sec, timestamp_end
+		FROM monitoring.activity_segments
+		WHERE timestamp_start >= toDateTime64(?, 3) AND timestamp_start < toDateTime64(?, 3)
+		  AND username IN (SELECT username FROM (` + members + `))`
+	args := []any{cats.names, cats.categories,
+		p.Start.Format("2006-01-02 15:04:05"), p.End.Format("2006-01-02 15:04:05")}
+	return query, append(args, memberArgs...)
+}
+
+// processCategories maps process names to catalog categories inside a query
+type processCategories struct {
+	names      []string
+	categories []string
+}
+
+// categorizeProcesses classifies the processes used by the group with the
+// same catalog matching as the per-employee reports. Neutral processes are
+// left out; transform falls back to neutral.
+func (db *Database) categorizeProcesses(ctx context.Context, f GroupFilter, p reports.Period) (processCategories, error) {
+	members, args := f.members()
+	query := `
+		SELECT DISTINCT process_name
+		FROM monitoring.activity_segments
+		WHERE timestamp_start >= toDateTime64(?, 3) AND timestamp_start < toDateTime64(?, 3)
+		  AND state = 'active'
+		  AND username IN (SELECT username FROM (` + members + `))`
+	args = append([]any{p.Start.Format("2006-01-02 15:04:05"), p.End.Format("2006-01-02 15:04:05")}, args...)
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return processCategories{}, fmt.Errorf("failed to query group processes: %w", err)
+	}
+	defer rows.Close()
+
+	catalog, err := db.GetProcessCatalog(ctx)
+	if err != nil {
+		zapctx.Warn(ctx, "Failed to load process catalog", zap.Error(err))
+		catalog = []ProcessCatalogEntry{}
+	}
+
+	// transform needs typed arrays, an empty one would be Array(Nothing)
+	cats := processCategories{names: []string{""}, categories: []string{"neutral"}}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return processCategories{}, fmt.Errorf("failed to scan group process: %w", err)
+		}
+		if category := matchProcessToCatalogInternal(name, catalog); category != "neutral" {
+			cats.names = append(cats.names, name)
+			cats.categories = append(cats.categories, category)
+		}
+	}
+	return cats, rows.Err()
+}
+
+// onlineUsernames selects the users whose agent was heard from within
+// agentOnlineWindow, by heartbeat or activity, as GetAgents decides online.
+// Takes the cutoff twice.
+const onlineUsernames = `
+		           SELECT username FROM monitoring.agent_registry FINAL WHERE last_heartbeat > ?
+		           UNION ALL
+		           SELECT username FROM monitoring.activity_events WHERE timestamp > ?
+		       `
+
+// groupEmployeesQuery returns the per-employee aggregation of the filter
+func groupEmployeesQuery(f GroupFilter, p reports.Period, cats processCategories) (string, []any) {
+	members, memberArgs := f.members()
+	segments, segmentArgs := groupSegments(f, p, cats)
+	query := `
+		SELECT e.username AS username, e.full_name AS full_name, e.department AS department, e.team AS team,
+		       e.username IN (` + onlineUsernames + `) AS online,
+		       sumIf(s.duration_sec, s.state = 'active') AS active,
+		       sumIf(s.duration_sec, s.state = 'idle') AS idle,
+		       sumIf(s.duration_sec, s.state = 'active' AND s.category = 'productive') AS productive,
+		       sumIf(s.duration_sec, s.state = 'active' AND s.category = 'unproductive') AS unproductive,
+		       if(active > 0, productive / active * 100, 0) AS score,
+		       max(s.timestamp_end) AS last_activity
+		FROM (` + members + `) AS e
+		LEFT JOIN (` + segments + `) AS s ON s.username = e.username
+		GROUP BY e.username, e.full_name, e.department, e.team`
+	since := time.Now().Add(-agentOnlineWindow)
+	args := append([]any{since, since}, memberArgs...)
+	return query, append(args, segmentArgs...)
+}
+
+// Group keys of groupStats
+const (
+	groupAll          = "'', ''"
+	groupByDepartment = "department, ''"
+	groupByTeam       = "department, team"
+)
+
+// groupStats aggregates the per-employee rows, one row per group key
+func (db *Database) groupStats(ctx context.Context, f GroupFilter, p reports.Period, cats processCategories, keys string) ([]GroupStats, error) {
+	employees, args := groupEmployeesQuery(f, p, cats)
+
+	query := `
+		SELECT ` + keys + `,
+		       count(), countIf(online), countIf(active > 0),
+		       sum(active), avgIf(active, active > 0), sum(idle),
+		       minIf(score, active > 0),
+		       quantileExactIf(0.5)(score, active > 0),
+		       quantileExactIf(0.9)(score, active > 0)
+		FROM (` + employees + `)`
+	if keys != groupAll {
+		query += "\n\t\tGROUP BY " + keys + "\n\t\tORDER BY " + keys
+	}
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]GroupStats, 0)
+	for rows.Next() {
+		var s GroupStats
+		var headcount, online, active uint64
+		var avgActive, minScore, median, p90 float64
+		if err := rows.Scan(&s.Department, &s.Team, &headcount, &online, &active,
+			&s.TotalActiveTime, &avgActive, &s.TotalIdleTime, &minScore, &median, &p90); err != nil {
+			return nil, fmt.Errorf("failed to scan group stats: %w", err)
+		}
+		s.Headcount, s.OnlineNow, s.ActiveEmployees = int(headcount), int(online), int(active)
+		// The -If aggregates return nan when no employee was active
+		s.AvgActiveTime = uint64(finite(avgActive))
+		s.Productivity = ProductivityDistribution{Min: finite(minScore), Median: finite(median), P90: finite(p90)}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// GetDepartmentStats returns one row per department of the filter
+func (db *Database) GetDepartmentStats(ctx context.Context, f GroupFilter, p reports.Period) ([]GroupStats, error) {
+	cats, err := db.categorizeProcesses(ctx, f, p)
+	if err != nil {
+		return nil, err
+	}
+	return db.groupStats(ctx, f, p, cats, groupByDepartment)
+}
+
+// GetTeamStats returns one row per department and team of the filter
+func (db *Database) GetTeamStats(ctx context.Context, f GroupFilter, p reports.Period) ([]GroupStats, error) {
+	cats, err := db.categorizeProcesses(ctx, f, p)
+	if err != nil {
+		return nil, err
+	}
+	return db.groupStats(ctx, f, p, cats, groupByTeam)
+}
+
+// GetGroupReport builds the report of the employees matching the filter:
+// totals, category split, top applications and per-employee rows
+func (db *Database) GetGroupReport(ctx context.Context, f GroupFilter, p reports.Period) (*GroupReport, error) {
+	cats, err := db.categorizeProcesses(ctx, f, p)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := db.groupStats(ctx, f, p, cats, groupAll)
+	if err != nil {
+		return nil, err
+	}
+	report := &GroupReport{
+		StartDate:       p.Start.Format(time.RFC3339),
+		EndDate:         p.End.Format(time.RFC3339),
+		Categories:      make(map[string]uint64),
+		TopApplications: make([]ApplicationUsage, 0),
+		Employees:       make([]GroupEmployee, 0),
+	}
+	if len(stats) > 0 {
+		report.GroupStats = stats[0]
+	}
+	report.Department, report.Team = f.Department, f.Team
+
+	if report.Employees, err = db.groupEmployees(ctx, f, p, cats); err != nil {
+		return nil, err
+	}
+	if report.Categories, err = db.groupCategories(ctx, f, p, cats); err != nil {
+		return nil, err
+	}
+	if report.TopApplications, err = db.groupTopApps(ctx, f, p, cats, report.TotalActiveTime); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// groupEmployees returns the drill-down rows, most active first
+func (db *Database) groupEmployees(ctx context.Context, f GroupFilter, p reports.Period, cats processCategories) ([]GroupEmployee, error) {
+	query, args := groupEmployeesQuery(f, p, cats)
+	query += "\n\t\tORDER BY active DESC, username"
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group employees: %w", err)
+	}
+	defer rows.Close()
+
+	employees := make([]GroupEmployee, 0)
+	for rows.Next() {
+		var e GroupEmployee
+		var lastActivity time.Time
+		if err := rows.Scan(&e.Username, &e.FullName, &e.Department, &e.Team, &e.Online,
+			&e.TotalActiveTime, &e.TotalIdleTime, &e.ProductiveTime, &e.UnproductiveTime,
+			&e.ProductivityScore, &lastActivity); err != nil {
+			return nil, fmt.Errorf("failed to scan group employee: %w", err)
+		}
+		// Employees without segments get the zero DateTime64 from the join
+		if e.TotalActiveTime+e.TotalIdleTime > 0 {
+			e.LastActivity = lastActivity.Format(time.RFC3339)
+		}
+		employees = append(employees, e)
+	}
+	return employees, rows.Err()
+}
+
+// groupCategories splits the group's active time by process category
+func (db *Database) groupCategories(ctx context.Context, f GroupFilter, p reports.Period, cats processCategories) (map[string]uint64, error) {
+	segments, args := groupSegments(f, p, cats)
+	query := `
+		SELECT category, sum(duration_sec)
+		FROM (` + segments + `)
+		WHERE state = 'active'
+		GROUP BY category`
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group categories: %w", err)
+	}
+	defer rows.Close()
+
+	split := make(map[string]uint64)
+	for rows.Next() {
+		var category string
+		var duration uint64
+		if err := rows.Scan(&category, &duration); err != nil {
+			return nil, fmt.Errorf("failed to scan group category: %w", err)
+		}
+		split[category] = duration
+	}
+	return split, rows.Err()
+}
+
+// groupTopApps returns the processes the group spent the most active time in
+func (db *Database) groupTopApps(ctx context.Context, f GroupFilter, p reports.Period, cats processCategories, totalActive uint64) ([]ApplicationUsage, error) {
+	segments, args := groupSegments(f, p, cats)
+	query := `
+		SELECT process_name, any(category), sum(duration_sec) AS total, count(), uniqExact(username)
+		FROM (` + segments + `)
+		WHERE state = 'active' AND process_name NOT IN ('', 'unknown')
+		GROUP BY process_name
+		ORDER BY total DESC
+		LIMIT ?`
+
+	rows, err := db.conn.Query(ctx, query, append(args, groupReportTopApps)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group applications: %w", err)
+	}
+	defer rows.Close()
+
+	catalog, err := db.GetProcessCatalog(ctx)
+	if err != nil {
+		catalog = []ProcessCatalogEntry{}
+	}
+
+	apps := make([]ApplicationUsage, 0)
+	for rows.Next() {
+		var app ApplicationUsage
+		var count, users uint64
+		if err := rows.Scan(&app.ProcessName, &app.Category, &app.Duration, &count, &users); err != nil {
+			return nil, fmt.Errorf("failed to scan group application: %w", err)
+		}
+		app.TotalDuration = app.Duration
+		app.Count, app.SessionCount, app.UniqueUsers = int(count), int(count), int(users)
+		app.ApplicationName = getFriendlyNameFromCatalog(app.ProcessName, catalog)
+		if totalActive > 0 {
+			app.Percentage = float64(app.Duration) / float64(totalActive) * 100
+		}
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
+
+// finite replaces the nan and inf ClickHouse returns for empty aggregates
+func finite(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/reports"
+)
+
+func TestGroupEmployeesQueryArgs(t *testing.T) {
+	p := reports.Period{
+		Start: time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC),
+	}
+	cats := processCategories{names: []string{"", "code.exe"}, categories: []string{"neutral", "productive"}}
+
+	tests := []struct {
+		name   string
+		filter GroupFilter
+	}{
+		{"everyone", GroupFilter{}},
+		{"department", GroupFilter{Department: "Sales"}},
+		{"team", GroupFilter{Department: "Sales", Team: "B2B"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := groupEmployeesQuery(tt.filter, p, cats)
+			if n := strings.Count(query, "?"); n != len(args) {
+				t.Fatalf("%d placeholders, %d args", n, len(args))
+			}
+			// Online is decided by the agent heartbeat like /dashboard/active-now
+			if !strings.Contains(query, "monitoring.agent_registry") {
+				t.Error("online must use the heartbeat registry")
+			}
+			if _, ok := args[0].(time.Time); !ok {
+				t.Errorf("first arg = %v, want the online cutoff", args[0])
+			}
+			// The member filter comes right after the two cutoffs
+			if tt.filter.Department != "" && args[2] != tt.filter.Department {
+				t.Errorf("department arg = %v, want %q", args[2], tt.filter.Department)
+			}
+		})
+	}
+}
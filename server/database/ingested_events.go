@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// IngestedEvent records a client event ID that has been stored, for deduplication of agent retries
+type IngestedEvent struct {
+	EventID      string
+	ComputerName string
+	Seq          uint64
+	EventType    string
+	ReceivedAt   time.Time
+}
+
+// InsertIngestedEventsBatch records stored event IDs in one batch
+func (db *Database) InsertIngestedEventsBatch(ctx context.Context, events []IngestedEvent) error {
+	return db.sendBatch(ctx, `INSERT INTO monitoring.ingested_events
+		(event_id, computer_name, seq, event_type, received_at)`,
+		len(events), func(i int) []any {
+			e := events[i]
+			return []any{e.EventID, e.ComputerName, e.Seq, e.EventType, e.ReceivedAt}
+		})
+}
+
+// FindIngestedEventIDs returns which of the given event IDs have already been stored
+func (db *Database) FindIngestedEventIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	rows, err := db.conn.Query(ctx, `
+		SELECT DISTINCT event_id
+		FROM monitoring.ingested_events
+		WHERE event_id IN (?)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up event IDs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan event ID: %w", err)
+		}
+		found[id] = true
+	}
+
+	return found, rows.Err()
+}
@@ -99,6 +99,7 @@ type ScreenshotMetadata struct {
 }
 
 type Alert struct {
+        ID             string    `json:"id"`
         Timestamp      time.Time `json:"timestamp"`
         ComputerName   string    `json:"computer_name"`
         Username       string    `json:"username"`
@@ -127,6 +128,8 @@ type AgentConfig struct {
         LargeCopyThresholdMB      int       `json:"large_copy_threshold_mb"`
         LastSeen                  time.Time `json:"last_seen"`
         AgentVersion              string    `json:"agent_version"`
+        // Configured is false until an admin saves settings for the computer
+        Configured                bool      `json:"configured"`
 }
 
 type Agent struct {
@@ -138,6 +141,23 @@ type Agent struct {
         OSVersion    string       `json:"os_version"`
         AgentVersion string       `json:"agent_version"`
         Config       ConfigUpdate `json:"config"`
+
+        // Reported by the agent heartbeat; empty for agents that never sent one
+        LastHeartbeat  *string  `json:"last_heartbeat"`
+        IPAddresses    []string `json:"ip_addresses"`
+        UptimeSeconds  uint64   `json:"uptime_seconds"`
+        Monitors       []string `json:"monitors"`
+        BufferSize     uint32   `json:"buffer_size"`
+        BufferDropped  uint64   `json:"buffer_dropped"`
+        CircuitBreaker string   `json:"circuit_breaker"`
+        ConfigVersion  string   `json:"config_version"`
+        ThrottleLevel  uint8    `json:"throttle_level"`
+        ThrottleReason string   `json:"throttle_reason"`
+        MemoryMB       uint32   `json:"memory_mb"`
+        CPUPercent     float32  `json:"cpu_percent"`
+
+        // Supervisor state of the agent monitors
+        MonitorStatus []AgentMonitorStatus `json:"monitor_status"`
 }
 
 type ConfigUpdate struct {
@@ -147,6 +167,12 @@ type ConfigUpdate struct {
         USBMonitoring      bool `json:"usb_monitoring"`
         FileMonitoring     bool `json:"file_monitoring"`
         DLPEnabled         bool `json:"dlp_enabled"`
+
+        // Read-only: version served to the agent and the version it reported as applied
+        Version        string     `json:"version,omitempty"`
+        AppliedVersion string     `json:"applied_version,omitempty"`
+        AppliedAt      *time.Time `json:"applied_at,omitempty"`
+        ApplyError     string     `json:"apply_error,omitempty"`
 }
 
 type EmployeeFull struct {
@@ -156,6 +182,7 @@ type EmployeeFull struct {
         FullName          string    `json:"full_name"`
         Email             string    `json:"email"`
         Department        string    `json:"department"`
+        Team              string    `json:"team"`
         Position          string    `json:"position"`
         LastSeen          time.Time `json:"last_seen"`
         Status            string    `json:"status"`
@@ -243,6 +270,22 @@ type AlertFull struct {
         IsResolved     bool       `json:"is_resolved"`
         AcknowledgedBy string     `json:"acknowledged_by"`
         AcknowledgedAt *time.Time `json:"acknowledged_at"`
+
+        // Workflow state from alert_states
+        Status          string         `json:"status"`
+        Assignee        string         `json:"assignee"`
+        ResolvedBy      string         `json:"resolved_by"`
+        ResolvedAt      *time.Time     `json:"resolved_at"`
+        ResolutionNotes string         `json:"resolution_notes"`
+        Comments        []AlertComment `json:"comments,omitempty"`
+}
+
+type AlertComment struct {
+        ID        string    `json:"id"`
+        AlertID   string    `json:"alert_id"`
+        Author    string    `json:"author"`
+        Text      string    `json:"text"`
+        CreatedAt time.Time `json:"created_at"`
 }
 
 type DailyReport struct {
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Notification delivery statuses
+const (
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusFailed  = "failed"
+	DeliveryStatusDropped = "dropped"
+)
+
+// NotificationDelivery is the outcome of pushing one alert to one channel
+type NotificationDelivery struct {
+	Timestamp   time.Time `json:"timestamp"`
+	AlertID     string    `json:"alert_id"` // empty for test messages
+	Channel     string    `json:"channel"`
+	ChannelType string    `json:"channel_type"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error"`
+	DurationMs  uint32    `json:"duration_ms"`
+}
+
+// InsertNotificationDelivery appends an entry to the delivery log
+func (db *Database) InsertNotificationDelivery(ctx context.Context, d NotificationDelivery) error {
+	query := `INSERT INTO monitoring.notification_deliveries
+		(timestamp, alert_id, channel, channel_type, status, attempts, error, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query,
+		d.Timestamp, d.AlertID, d.Channel, d.ChannelType, d.Status, uint8(d.Attempts), d.Error, d.DurationMs,
+	)
+}
+
+// GetNotificationDeliveries returns the delivery log, newest first.
+// Empty alertID, channel or status match everything.
+func (db *Database) GetNotificationDeliveries(ctx context.Context, alertID, channel, status string, limit, offset int) ([]NotificationDelivery, error) {
+	query := `
+		SELECT timestamp, alert_id, channel, channel_type, status, attempts, error, duration_ms
+		FROM monitoring.notification_deliveries
+		WHERE 1=1`
+	args := make([]interface{}, 0)
+
+	if alertID != "" {
+		query += " AND alert_id = ?"
+		args = append(args, alertID)
+	}
+	if channel != "" {
+		query += " AND channel = ?"
+		args = append(args, channel)
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+
+	query += " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]NotificationDelivery, 0)
+	for rows.Next() {
+		var d NotificationDelivery
+		var attempts uint8
+		if err := rows.Scan(&d.Timestamp, &d.AlertID, &d.Channel, &d.ChannelType, &d.Status,
+			&attempts, &d.Error, &d.DurationMs); err != nil {
+			return nil, fmt.Errorf("failed to scan notification delivery: %w", err)
+		}
+		d.Attempts = int(attempts)
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
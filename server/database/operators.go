@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OperatorUser is a dashboard operator (admin, HR manager or department head)
+type OperatorUser struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	FullName     string    `json:"full_name"`
+	Role         string    `json:"role"`
+	Department   string    `json:"department"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	CreatedBy    string    `json:"created_by"`
+	UpdatedBy    string    `json:"updated_by"`
+}
+
+const operatorColumns = `
+			username,
+			password_hash,
+			full_name,
+			role,
+			department,
+			is_active,
+			created_at,
+			updated_at,
+			created_by,
+			updated_by`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOperatorUser(row rowScanner) (*OperatorUser, error) {
+	var u OperatorUser
+	var isActive uint8
+	if err := row.Scan(&u.Username, &u.PasswordHash, &u.FullName, &u.Role, &u.Department,
+		&isActive, &u.CreatedAt, &u.UpdatedAt, &u.CreatedBy, &u.UpdatedBy); err != nil {
+		return nil, err
+	}
+	u.IsActive = isActive == 1
+	return &u, nil
+}
+
+// GetOperatorUser returns an operator by username, or nil if it doesn't exist
+func (db *Database) GetOperatorUser(ctx context.Context, username string) (*OperatorUser, error) {
+	query := `
+		SELECT` + operatorColumns + `
+		FROM monitoring.operator_users FINAL
+		WHERE username = ?
+		LIMIT 1`
+
+	u, err := scanOperatorUser(db.conn.QueryRow(ctx, query, username))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get operator: %w", err)
+	}
+	return u, nil
+}
+
+// ListOperatorUsers returns all active operators
+func (db *Database) ListOperatorUsers(ctx context.Context) ([]OperatorUser, error) {
+	query := `
+		SELECT` + operatorColumns + `
+		FROM monitoring.operator_users FINAL
+		WHERE is_active = 1
+		ORDER BY username`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]OperatorUser, 0)
+	for rows.Next() {
+		u, err := scanOperatorUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan operator: %w", err)
+		}
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
+
+// CountOperatorUsers returns the number of active operators
+func (db *Database) CountOperatorUsers(ctx context.Context) (uint64, error) {
+	var count uint64
+	err := db.conn.QueryRow(ctx, `SELECT count() FROM monitoring.operator_users FINAL WHERE is_active = 1`).Scan(&count)
+	return count, err
+}
+
+// SaveOperatorUser writes a new version of the operator row.
+// Deactivation is a save with IsActive=false, so no ALTER mutations are needed.
+func (db *Database) SaveOperatorUser(ctx context.Context, u OperatorUser) error {
+	query := `
+		INSERT INTO monitoring.operator_users
+			(username, password_hash, full_name, role, department, is_active,
+			 created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	now := time.Now()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+
+	return db.conn.Exec(ctx, query,
+		u.Username, u.PasswordHash, u.FullName, u.Role, u.Department,
+		boolToUInt8(u.IsActive), u.CreatedAt, now, u.CreatedBy, u.UpdatedBy,
+	)
+}
+
+// GetEmployeeDepartment returns the department of an employee, or "" if unknown
+func (db *Database) GetEmployeeDepartment(ctx context.Context, username string) (string, error) {
+	query := `
+		SELECT department
+		FROM monitoring.employees FINAL
+		WHERE username = ?
+		LIMIT 1`
+
+	var department string
+	if err := db.conn.QueryRow(ctx, query, username).Scan(&department); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get employee department: %w", err)
+	}
+	return department, nil
+}
+
+// GetDepartmentUsernames returns usernames of all employees in a department
+func (db *Database) GetDepartmentUsernames(ctx context.Context, department string) ([]string, error) {
+	query := `
+		SELECT username
+		FROM monitoring.employees FINAL
+		WHERE department = ?
+		ORDER BY username`
+
+	rows, err := db.conn.Query(ctx, query, department)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usernames := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+
+	return usernames, rows.Err()
+}
+
+// IsComputerInDepartment reports whether an employee of the department worked on the computer in the last 30 days
+func (db *Database) IsComputerInDepartment(ctx context.Context, computerName, department string) (bool, error) {
+	query := `
+		SELECT count()
+		FROM monitoring.activity_segments
+		WHERE computer_name = ?
+		  AND timestamp_start > now() - INTERVAL 30 DAY
+		  AND username IN (
+			SELECT username FROM monitoring.employees FINAL WHERE department = ?
+		  )`
+
+	var count uint64
+	if err := db.conn.QueryRow(ctx, query, computerName, department).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetScreenshotOwner returns the username a screenshot belongs to, or "" if unknown
+func (db *Database) GetScreenshotOwner(ctx context.Context, screenshotID string) (string, error) {
+	query := `
+		SELECT username
+		FROM monitoring.screenshot_metadata
+		WHERE screenshot_id = ?
+		LIMIT 1`
+
+	var username string
+	if err := db.conn.QueryRow(ctx, query, screenshotID).Scan(&username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get screenshot owner: %w", err)
+	}
+	return username, nil
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/reports"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+const (
+	rangeReportTopApps  = 10
+	rangeBucketTopApps  = 5
+	rangeReportRowLimit = 200000
+)
+
+// RangeReport summarizes an employee's activity over several days, split
+// into day, week or month buckets, and compares it with the period of the
+// same length right before
+type RangeReport struct {
+	Username        string             `json:"username"`
+	Granularity     string             `json:"granularity"`
+	Summary         ActivitySummary    `json:"summary"`
+	Previous        ActivitySummary    `json:"previous"`
+	Delta           ActivityDelta      `json:"delta"`
+	TopApplications []ApplicationUsage `json:"top_applications"`
+	Buckets         []RangeBucket      `json:"buckets"`
+}
+
+// RangeBucket is one day, week or month of a range report. Delta compares it
+// with the bucket before, the first one with the last bucket of the
+// previous period.
+type RangeBucket struct {
+	ActivitySummary
+	TopApplications []ApplicationUsage `json:"top_applications"`
+	Delta           ActivityDelta      `json:"delta"`
+}
+
+// ActivityDelta is the change of a summary against an earlier one. Times are
+// in seconds, the productivity score in percentage points.
+type ActivityDelta struct {
+	TotalActiveTime   int64   `json:"total_active_time"`
+	TotalIdleTime     int64   `json:"total_idle_time"`
+	ProductiveTime    int64   `json:"productive_time"`
+	UnproductiveTime  int64   `json:"unproductive_time"`
+	ProductivityScore float64 `json:"productivity_score"`
+	// ActiveTimePercent is the relative change of the active time, nil when
+	// there was no activity before
+	ActiveTimePercent *float64 `json:"active_time_percent"`
+}
+
+// segmentTotal is the time one process spent in one state on one day
+type segmentTotal struct {
+	day         time.Time
+	state       string
+	processName string
+	duration    uint64
+	first, last time.Time
+}
+
+// rangeAccumulator builds the summary and application list of one period
+type rangeAccumulator struct {
+	summary     ActivitySummary
+	first, last time.Time
+	apps        map[string]uint64
+}
+
+func newRangeAccumulator(username string, p reports.Period) *rangeAccumulator {
+	return &rangeAccumulator{
+		summary: ActivitySummary{
+			Username:  username,
+			StartDate: p.Start.Format(time.RFC3339),
+			EndDate:   p.End.Format(time.RFC3339),
+		},
+		apps: make(map[string]uint64),
+	}
+}
+
+// add counts a row the same way GetDailyReport counts segments
+func (a *rangeAccumulator) add(row segmentTotal, category string) {
+	switch row.state {
+	case "active":
+		a.summary.TotalActiveTime += row.duration
+		switch category {
+		case "productive":
+			a.summary.ProductiveTime += row.duration
+		case "unproductive":
+			a.summary.UnproductiveTime += row.duration
+		case "communication", "entertainment":
+			// Only part of the active time, as in the daily report
+		default:
+			a.summary.NeutralTime += row.duration
+		}
+		if row.processName != "" && row.processName != "unknown" {
+			a.apps[row.processName] += row.duration
+		}
+	case "idle":
+		a.summary.TotalIdleTime += row.duration
+	default:
+		return
+	}
+	if a.first.IsZero() || row.first.Before(a.first) {
+		a.first = row.first
+	}
+	if row.last.After(a.last) {
+		a.last = row.last
+	}
+}
+
+func (a *rangeAccumulator) result() ActivitySummary {
+	s := a.summary
+	if s.TotalActiveTime > 0 {
+		s.ProductivityScore = float64(s.ProductiveTime) / float64(s.TotalActiveTime) * 100
+	}
+	if !a.first.IsZero() {
+		s.FirstActivity = a.first.Format(time.RFC3339)
+		s.LastActivity = a.last.Format(time.RFC3339)
+	}
+	return s
+}
+
+// topApps returns the processes with the most active time
+func (a *rangeAccumulator) topApps(limit int, catalog []ProcessCatalogEntry) []ApplicationUsage {
+	apps := make([]ApplicationUsage, 0, len(a.apps))
+	for name, duration := range a.apps {
+		app := ApplicationUsage{
+			ProcessName:     name,
+			ApplicationName: getFriendlyNameFromCatalog(name, catalog),
+			Category:        matchProcessToCatalogInternal(name, catalog),
+			Duration:        duration,
+			TotalDuration:   duration,
+		}
+		if a.summary.TotalActiveTime > 0 {
+			app.Percentage = float64(duration) / float64(a.summary.TotalActiveTime) * 100
+		}
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Duration != apps[j].Duration {
+			return apps[i].Duration > apps[j].Duration
+		}
+		return apps[i].ProcessName < apps[j].ProcessName
+	})
+	if len(apps) > limit {
+		apps = apps[:limit]
+	}
+	return apps
+}
+
+// diffSummary compares cur with prev
+func diffSummary(cur, prev ActivitySummary) ActivityDelta {
+	d := ActivityDelta{
+		TotalActiveTime:   int64(cur.TotalActiveTime) - int64(prev.TotalActiveTime),
+		TotalIdleTime:     int64(cur.TotalIdleTime) - int64(prev.TotalIdleTime),
+		ProductiveTime:    int64(cur.ProductiveTime) - int64(prev.ProductiveTime),
+		UnproductiveTime:  int64(cur.UnproductiveTime) - int64(prev.UnproductiveTime),
+		ProductivityScore: cur.ProductivityScore - prev.ProductivityScore,
+	}
+	if prev.TotalActiveTime > 0 {
+		pct := float64(d.TotalActiveTime) / float64(prev.TotalActiveTime) * 100
+		d.ActiveTimePercent = &pct
+	}
+	return d
+}
+
+// GetRangeReport builds a range report for an aligned period (see
+// reports.Align). Buckets are cut in the period's location.
+func (db *Database) GetRangeReport(ctx context.Context, username string, g reports.Granularity, period reports.Period) (*RangeReport, error) {
+	prevPeriod := reports.Previous(g, period)
+	rows, err := db.getDailySegmentTotals(ctx, username, prevPeriod.Start, period.End)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := db.GetProcessCatalog(ctx)
+	if err != nil {
+		zapctx.Warn(ctx, "Failed to load process catalog", zap.Error(err))
+		catalog = []ProcessCatalogEntry{}
+	}
+
+	// Buckets of the previous period come first so a day maps to its bucket
+	// by the bucket start
+	prevBuckets := reports.Buckets(g, prevPeriod)
+	buckets := append(prevBuckets, reports.Buckets(g, period)...)
+	accs := make([]*rangeAccumulator, len(buckets))
+	index := make(map[int64]int, len(buckets))
+	for i, b := range buckets {
+		accs[i] = newRangeAccumulator(username, b)
+		index[b.Start.Unix()] = i
+	}
+	total := newRangeAccumulator(username, period)
+	previous := newRangeAccumulator(username, prevPeriod)
+
+	loc := period.Start.Location()
+	for _, row := range rows {
+		// toDate returns midnight UTC; the date itself is in server time
+		day := time.Date(row.day.Year(), row.day.Month(), row.day.Day(), 0, 0, 0, 0, loc)
+		i, ok := index[g.Truncate(day).Unix()]
+		if !ok {
+			continue
+		}
+		category := matchProcessToCatalogInternal(row.processName, catalog)
+		accs[i].add(row, category)
+		if i < len(prevBuckets) {
+			previous.add(row, category)
+		} else {
+			total.add(row, category)
+		}
+	}
+
+	report := &RangeReport{
+		Username:        username,
+		Granularity:     string(g),
+		Summary:         total.result(),
+		Previous:        previous.result(),
+		TopApplications: total.topApps(rangeReportTopApps, catalog),
+		Buckets:         make([]RangeBucket, 0, len(buckets)-len(prevBuckets)),
+	}
+	report.Delta = diffSummary(report.Summary, report.Previous)
+
+	for i := len(prevBuckets); i < len(buckets); i++ {
+		summary := accs[i].result()
+		before := ActivitySummary{}
+		if i > 0 {
+			before = accs[i-1].result()
+		}
+		report.Buckets = append(report.Buckets, RangeBucket{
+			ActivitySummary: summary,
+			TopApplications: accs[i].topApps(rangeBucketTopApps, catalog),
+			Delta:           diffSummary(summary, before),
+		})
+	}
+
+	zapctx.Info(ctx, "GetRangeReport completed",
+		zap.String("username", username),
+		zap.String("granularity", string(g)),
+		zap.Int("buckets", len(report.Buckets)),
+		zap.Int("rows", len(rows)),
+		zap.Uint64("total_active_time", report.Summary.TotalActiveTime))
+
+	return report, nil
+}
+
+// getDailySegmentTotals sums activity segments per day, state and process
+func (db *Database) getDailySegmentTotals(ctx context.Context, username string, start, end time.Time) ([]segmentTotal, error) {
+	query := `
+		SELECT toDate(timestamp_start) AS day, toString(state), process_name,
+		       sum(duration_sec), min(timestamp_start), max(timestamp_end)
+		FROM monitoring.activity_segments
+		WHERE username = ?
+		  AND timestamp_start >= toDateTime64(?, 3)
+		  AND timestamp_start < toDateTime64(?, 3)
+		GROUP BY day, state, process_name
+		LIMIT ?`
+
+	rows, err := db.conn.Query(ctx, query, username,
+		start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"), rangeReportRowLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activity totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make([]segmentTotal, 0)
+	for rows.Next() {
+		var t segmentTotal
+		if err := rows.Scan(&t.day, &t.state, &t.processName, &t.duration, &t.first, &t.last); err != nil {
+			return nil, fmt.Errorf("failed to scan activity totals: %w", err)
+		}
+		totals = append(totals, t)
+	}
+
+	return totals, rows.Err()
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report schedule types
+const (
+	ScheduleReportRange      = "range"      // one employee, Target is the username
+	ScheduleReportDepartment = "department" // Target is the department
+	ScheduleReportTeam       = "team"       // Target is the team, Department narrows it
+)
+
+// Report run triggers and statuses
+const (
+	ReportTriggerSchedule = "schedule"
+	ReportTriggerManual   = "manual"
+
+	ReportRunSuccess = "success"
+	ReportRunFailed  = "failed"
+)
+
+// ReportSchedule mails a report to recipients on a cron schedule
+type ReportSchedule struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Cron       string `json:"cron"` // evaluated in the timezone setting
+	ReportType string `json:"report_type"`
+	Target     string `json:"target"`
+	Department string `json:"department"`
+	// Period is day, week or month: the last complete one before the run
+	Period string `json:"period"`
+	// Granularity is the bucket size of range reports
+	Granularity string    `json:"granularity"`
+	Recipients  []string  `json:"recipients"`
+	Enabled     bool      `json:"enabled"`
+	IsDeleted   bool      `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CreatedBy   string    `json:"created_by"`
+	UpdatedBy   string    `json:"updated_by"`
+}
+
+// ReportRun is one generation and delivery of a scheduled report
+type ReportRun struct {
+	ID           string    `json:"id"`
+	ScheduleID   string    `json:"schedule_id"`
+	ScheduleName string    `json:"schedule_name"`
+	Trigger      string    `json:"trigger"`
+	Status       string    `json:"status"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end"` // exclusive
+	Recipients   []string  `json:"recipients"`
+	Error        string    `json:"error"`
+}
+
+const reportScheduleColumns = `
+			toString(id),
+			name,
+			cron,
+			report_type,
+			target,
+			department,
+			period,
+			granularity,
+			recipients,
+			enabled,
+			is_deleted,
+			created_at,
+			updated_at,
+			created_by,
+			updated_by`
+
+func scanReportSchedule(row rowScanner) (*ReportSchedule, error) {
+	var s ReportSchedule
+	var enabled, deleted uint8
+	if err := row.Scan(&s.ID, &s.Name, &s.Cron, &s.ReportType, &s.Target, &s.Department, &s.Period,
+		&s.Granularity, &s.Recipients, &enabled, &deleted, &s.CreatedAt, &s.UpdatedAt, &s.CreatedBy, &s.UpdatedBy); err != nil {
+		return nil, err
+	}
+	s.Enabled = enabled == 1
+	s.IsDeleted = deleted == 1
+	return &s, nil
+}
+
+// GetReportSchedules returns all report schedules that are not deleted
+func (db *Database) GetReportSchedules(ctx context.Context) ([]ReportSchedule, error) {
+	query := `
+		SELECT` + reportScheduleColumns + `
+		FROM monitoring.report_schedules FINAL
+		WHERE is_deleted = 0
+		ORDER BY name`
+
+	rows, err := db.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make([]ReportSchedule, 0)
+	for rows.Next() {
+		s, err := scanReportSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan report schedule: %w", err)
+		}
+		schedules = append(schedules, *s)
+	}
+
+	return schedules, rows.Err()
+}
+
+// GetReportSchedule returns a schedule by ID, or nil if it doesn't exist or was deleted
+func (db *Database) GetReportSchedule(ctx context.Context, id string) (*ReportSchedule, error) {
+	query := `
+		SELECT` + reportScheduleColumns + `
+		FROM monitoring.report_schedules FINAL
+		WHERE id = toUUIDOrZero(?) AND is_deleted = 0
+		LIMIT 1`
+
+	s, err := scanReportSchedule(db.conn.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get report schedule: %w", err)
+	}
+	return s, nil
+}
+
+// SaveReportSchedule writes a new version of the schedule, assigning an ID to
+// new schedules. Deletion is a save with IsDeleted=true.
+func (db *Database) SaveReportSchedule(ctx context.Context, s *ReportSchedule) error {
+	if s.ID == "" {
+		s.ID = uuid.NewString()
+	}
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	s.UpdatedAt = now
+	if s.Recipients == nil {
+		s.Recipients = []string{}
+	}
+
+	query := `
+		INSERT INTO monitoring.report_schedules
+			(id, name, cron, report_type, target, department, period, granularity, recipients,
+			 enabled, is_deleted, created_at, updated_at, created_by, updated_by)
+		VALUES (toUUID(?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	return db.conn.Exec(ctx, query,
+		s.ID, s.Name, s.Cron, s.ReportType, s.Target, s.Department, s.Period, s.Granularity, s.Recipients,
+		boolToUInt8(s.Enabled), boolToUInt8(s.IsDeleted), s.CreatedAt, s.UpdatedAt, s.CreatedBy, s.UpdatedBy,
+	)
+}
+
+// InsertReportRun appends an entry to the run history, assigning an ID
+func (db *Database) InsertReportRun(ctx context.Context, run *ReportRun) error {
+	if run.ID == "" {
+		run.ID = uuid.NewString()
+	}
+	if run.Recipients == nil {
+		run.Recipients = []string{}
+	}
+
+	query := `INSERT INTO monitoring.report_runs
+		(id, schedule_id, schedule_name, trigger, status, started_at, finished_at,
+		 period_start, period_end, recipients, error)
+		VALUES (toUUID(?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	return db.conn.Exec(ctx, query,
+		run.ID, run.ScheduleID, run.ScheduleName, run.Trigger, run.Status, run.StartedAt, run.FinishedAt,
+		run.PeriodStart, run.PeriodEnd, run.Recipients, run.Error,
+	)
+}
+
+// GetReportRuns returns the run history, newest first. Empty scheduleID
+// matches every schedule.
+func (db *Database) GetReportRuns(ctx context.Context, scheduleID string, limit, offset int) ([]ReportRun, error) {
+	query := `
+		SELECT toString(id), schedule_id, schedule_name, trigger, status, started_at, finished_at,
+			period_start, period_end, recipients, error
+		FROM monitoring.report_runs
+		WHERE 1=1`
+	args := make([]interface{}, 0)
+
+	if scheduleID != "" {
+		query += " AND schedule_id = ?"
+		args = append(args, scheduleID)
+	}
+
+	query += " ORDER BY started_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]ReportRun, 0)
+	for rows.Next() {
+		var r ReportRun
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.ScheduleName, &r.Trigger, &r.Status, &r.StartedAt,
+			&r.FinishedAt, &r.PeriodStart, &r.PeriodEnd, &r.Recipients, &r.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan report run: %w", err)
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
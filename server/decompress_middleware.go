@@ -0,0 +1,57 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decompressMiddleware decodes gzip and zstd request bodies sent by agents.
+// The decoded body is capped at maxBytes so a small compressed request
+// cannot expand into an unbounded amount of memory.
+func decompressMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+
+		var body io.ReadCloser
+		switch encoding {
+		case "", "identity":
+			body = c.Request.Body
+		case "gzip":
+			zr, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid gzip body"})
+				return
+			}
+			body = zr
+		case "zstd":
+			zr, err := zstd.NewReader(c.Request.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxBytes)))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid zstd body"})
+				return
+			}
+			body = zr.IOReadCloser()
+		default:
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported Content-Encoding: " + encoding})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, body, maxBytes)
+		if encoding != "" && encoding != "identity" {
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.ContentLength = -1
+		}
+		c.Next()
+	}
+}
+
+// isBodyTooLarge reports whether err came from the body size limit
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr) || errors.Is(err, zstd.ErrDecoderSizeExceeded)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decompressTestRouter decodes the body like the ingest handlers and answers
+// with the number of events
+func decompressTestRouter(maxBytes int64) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/batch", decompressMiddleware(maxBytes), func(c *gin.Context) {
+		var req BatchEventsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if isBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		c.String(http.StatusOK, strconv.Itoa(len(req.Events)))
+	})
+	return router
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+// batchBody returns a batch of n events
+func batchBody(n int) []byte {
+	events := make([]string, n)
+	for i := range events {
+		events[i] = `{"id":"e` + strconv.Itoa(i) + `","type":"activity","data":{"window_title":"` + strings.Repeat("x", 100) + `"}}`
+	}
+	return []byte(`{"events":[` + strings.Join(events, ",") + `]}`)
+}
+
+func TestDecompressMiddleware(t *testing.T) {
+	const limit = 64 << 10
+	small, large := batchBody(10), batchBody(1000)
+	if len(large) <= limit {
+		t.Fatalf("large body is only %d bytes", len(large))
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+		events   string
+	}{
+		{"plain", "", small, http.StatusOK, "10"},
+		{"identity", "identity", small, http.StatusOK, "10"},
+		{"gzip", "gzip", gzipBytes(t, small), http.StatusOK, "10"},
+		{"zstd", "zstd", zstdBytes(t, small), http.StatusOK, "10"},
+		{"encoding is case-insensitive", "GZip", gzipBytes(t, small), http.StatusOK, "10"},
+		{"unknown encoding", "br", small, http.StatusUnsupportedMediaType, ""},
+		{"not gzip", "gzip", small, http.StatusBadRequest, ""},
+		{"plain over the limit", "", large, http.StatusRequestEntityTooLarge, ""},
+		{"gzip expands over the limit", "gzip", gzipBytes(t, large), http.StatusRequestEntityTooLarge, ""},
+		{"zstd expands over the limit", "zstd", zstdBytes(t, large), http.StatusRequestEntityTooLarge, ""},
+	}
+	router := decompressTestRouter(limit)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+			if tt.events != "" && w.Body.String() != tt.events {
+				t.Errorf("events = %s, want %s", w.Body.String(), tt.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Package dedup drops agent events that were already stored. Agents resend a
+// batch when the response is lost and replay their disk buffer after a
+// restart; every event carries a client-generated ID so the server can tell.
+//
+// Recently claimed IDs are kept in memory, which also covers concurrent
+// retries of a batch that is still being written. Older IDs are looked up in
+// ClickHouse (monitoring.ingested_events).
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+// Store looks up IDs of stored events
+type Store interface {
+	FindIngestedEventIDs(ctx context.Context, ids []string) (map[string]bool, error)
+}
+
+// Deduper tracks event IDs across requests
+type Deduper struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time // ID -> expiry
+}
+
+// New creates a deduper that remembers claimed IDs in memory for ttl
+func New(store Store, ttl time.Duration) *Deduper {
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	return &Deduper{
+		store: store,
+		ttl:   ttl,
+		now:   time.Now,
+		seen:  make(map[string]time.Time),
+	}
+}
+
+// Claim returns the IDs that were already seen and claims the others, so a
+// concurrent request carrying the same IDs sees them as duplicates. IDs must
+// be unique within one call. If the store lookup fails, unknown IDs are
+// accepted: a possible duplicate is better than rejecting data.
+func (d *Deduper) Claim(ctx context.Context, ids []string) map[string]bool {
+	dups := make(map[string]bool)
+	if len(ids) == 0 {
+		return dups
+	}
+
+	now := d.now()
+	unknown := make([]string, 0, len(ids))
+
+	d.mu.Lock()
+	for _, id := range ids {
+		if exp, ok := d.seen[id]; ok && now.Before(exp) {
+			dups[id] = true
+			continue
+		}
+		d.seen[id] = now.Add(d.ttl)
+		unknown = append(unknown, id)
+	}
+	d.mu.Unlock()
+
+	if len(unknown) == 0 || d.store == nil {
+		return dups
+	}
+
+	stored, err := d.store.FindIngestedEventIDs(ctx, unknown)
+	if err != nil {
+		zapctx.Warn(ctx, "Failed to look up event IDs, accepting events without deduplication",
+			zap.Int("ids", len(unknown)), zap.Error(err))
+		return dups
+	}
+	for id := range stored {
+		dups[id] = true
+	}
+	return dups
+}
+
+// Release forgets claimed IDs whose events were not stored, so a retry is accepted
+func (d *Deduper) Release(ids []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range ids {
+		delete(d.seen, id)
+	}
+}
+
+// Run prunes expired IDs every interval until ctx is cancelled
+func (d *Deduper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.prune()
+		}
+	}
+}
+
+func (d *Deduper) prune() {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, exp := range d.seen {
+		if !now.Before(exp) {
+			delete(d.seen, id)
+		}
+	}
+}
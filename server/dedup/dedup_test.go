@@ -0,0 +1,93 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	stored  map[string]bool
+	err     error
+	lookups [][]string
+}
+
+func (f *fakeStore) FindIngestedEventIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	f.lookups = append(f.lookups, ids)
+	if f.err != nil {
+		return nil, f.err
+	}
+	found := make(map[string]bool)
+	for _, id := range ids {
+		if f.stored[id] {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+func testContext() context.Context {
+	return zapctx.WithLogger(context.Background(), zap.NewNop())
+}
+
+func TestClaimDetectsStoredAndInFlightIDs(t *testing.T) {
+	store := &fakeStore{stored: map[string]bool{"old": true}}
+	d := New(store, time.Minute)
+	ctx := testContext()
+
+	dups := d.Claim(ctx, []string{"old", "a", "b"})
+	if !dups["old"] || dups["a"] || dups["b"] {
+		t.Fatalf("unexpected duplicates: %v", dups)
+	}
+
+	// A retry while the first request is in flight is answered from memory
+	dups = d.Claim(ctx, []string{"a", "c"})
+	if !dups["a"] || dups["c"] {
+		t.Fatalf("unexpected duplicates: %v", dups)
+	}
+	if last := store.lookups[len(store.lookups)-1]; len(last) != 1 || last[0] != "c" {
+		t.Fatalf("known IDs must not be looked up again: %v", last)
+	}
+}
+
+func TestReleaseAllowsRetry(t *testing.T) {
+	d := New(&fakeStore{}, time.Minute)
+	ctx := testContext()
+
+	d.Claim(ctx, []string{"a"})
+	d.Release([]string{"a"})
+	if dups := d.Claim(ctx, []string{"a"}); dups["a"] {
+		t.Fatal("released ID must be accepted again")
+	}
+}
+
+func TestExpiredIDsFallBackToStore(t *testing.T) {
+	store := &fakeStore{stored: map[string]bool{}}
+	d := New(store, time.Minute)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	ctx := testContext()
+
+	d.Claim(ctx, []string{"a"})
+	store.stored["a"] = true
+
+	now = now.Add(2 * time.Minute)
+	d.prune()
+	if len(d.seen) != 0 {
+		t.Fatalf("expected expired IDs to be pruned, %d left", len(d.seen))
+	}
+	if dups := d.Claim(ctx, []string{"a"}); !dups["a"] {
+		t.Fatal("stored ID must be found after it expired from memory")
+	}
+}
+
+func TestStoreErrorAcceptsEvents(t *testing.T) {
+	d := New(&fakeStore{err: errors.New("clickhouse down")}, time.Minute)
+	if dups := d.Claim(testContext(), []string{"a"}); len(dups) != 0 {
+		t.Fatalf("lookup errors must not drop events: %v", dups)
+	}
+}
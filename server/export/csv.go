@@ -0,0 +1,62 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// utf8BOM makes Excel open the file as UTF-8
+const utf8BOM = "\ufeff"
+
+// WriteCSV writes the sheets one after another, each headed by its name and
+// separated by an empty line
+func WriteCSV(w io.Writer, doc Document) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+
+	for i, sheet := range doc.Sheets {
+		if i > 0 {
+			if err := cw.Write([]string{}); err != nil {
+				return err
+			}
+		}
+		if err := cw.Write([]string{sheet.Name}); err != nil {
+			return err
+		}
+		header := make([]string, len(sheet.Columns))
+		for j, col := range sheet.Columns {
+			header[j] = col.Title
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, row := range sheet.Rows {
+			record := make([]string, len(row))
+			for j, v := range row {
+				record[j] = text(v)
+				if _, ok := v.(string); ok {
+					record[j] = escapeFormula(record[j])
+				}
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeFormula keeps spreadsheets from evaluating text that starts like a
+// formula, such as a window title "=HYPERLINK(...)". Only strings are
+// escaped, so negative numbers stay numbers.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,342 @@
+package export
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+)
+
+const dateLayout = "02.01.2006"
+
+var categoryNames = map[string]string{
+	"productive":    "Продуктивное",
+	"unproductive":  "Непродуктивное",
+	"neutral":       "Нейтральное",
+	"communication": "Общение",
+	"entertainment": "Развлечения",
+	"system":        "Системное",
+	"idle":          "Простой",
+	"offline":       "Отключен",
+}
+
+var stateNames = map[string]string{
+	"active":  "Активен",
+	"idle":    "Простой",
+	"offline": "Отключен",
+}
+
+func label(names map[string]string, key string) string {
+	if name, ok := names[key]; ok {
+		return name
+	}
+	return key
+}
+
+// Daily flattens an employee's daily report. Times are shown in loc.
+func Daily(r *database.DailyReport, loc *time.Location) Document {
+	s := r.Summary
+	doc := Document{
+		Title:   "Ежедневный отчёт",
+		Subject: r.Username,
+		Period:  periodLabel(s.StartDate, s.EndDate, loc),
+	}
+	if doc.Period == "" {
+		doc.Period = r.Date
+	}
+
+	summary := [][]any{
+		{"Сотрудник", r.Username},
+		{"Компьютер", r.ComputerName},
+		{"Дата", doc.Period},
+		{"Активное время", Duration(r.TotalActiveTime)},
+		{"Простой", Duration(r.TotalIdleTime)},
+		{"Продуктивное время", Duration(s.ProductiveTime)},
+		{"Непродуктивное время", Duration(s.UnproductiveTime)},
+		{"Нейтральное время", Duration(s.NeutralTime)},
+		{"Продуктивность, %", Percent(r.ProductivityScore)},
+		{"Первая активность", parseTime(s.FirstActivity, loc)},
+		{"Последняя активность", parseTime(s.LastActivity, loc)},
+	}
+	doc.Sheets = append(doc.Sheets, keyValueSheet("Сводка", summary))
+
+	periods := make([][]any, 0, len(r.ActivityPeriods))
+	for _, p := range r.ActivityPeriods {
+		app := p.FriendlyName
+		if app == "" && p.State == "active" {
+			app = p.ProcessName
+		}
+		periods = append(periods, []any{
+			parseTime(p.Start, loc),
+			parseTime(p.End, loc),
+			Duration(p.DurationSec),
+			label(stateNames, p.State),
+			app,
+			label(categoryNames, p.Category),
+			strings.Join(p.WindowTitles, "; "),
+		})
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "Периоды активности",
+		Columns: []Column{
+			{Title: "Начало", Width: 1.4}, {Title: "Конец", Width: 1.4}, {Title: "Длительность"},
+			{Title: "Состояние"}, {Title: "Приложение", Width: 1.5}, {Title: "Категория", Width: 1.2},
+			{Title: "Окна", Width: 4},
+		},
+		Rows: periods,
+	})
+
+	doc.Sheets = append(doc.Sheets, applicationsSheet(r.Applications))
+
+	usb := make([][]any, 0, len(r.USBEvents))
+	for _, e := range r.USBEvents {
+		usb = append(usb, []any{
+			e.Timestamp.In(loc), e.ComputerName, e.EventType, e.DeviceName, e.DeviceType, e.DeviceID, e.VolumeSerial,
+		})
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "USB-устройства",
+		Columns: []Column{
+			{Title: "Время", Width: 1.4}, {Title: "Компьютер", Width: 1.2}, {Title: "Событие"},
+			{Title: "Устройство", Width: 2}, {Title: "Тип"}, {Title: "ID устройства", Width: 2.5},
+			{Title: "Серийный номер тома", Width: 1.3},
+		},
+		Rows: usb,
+	})
+
+	files := make([][]any, 0, len(r.FileEvents))
+	for _, e := range r.FileEvents {
+		files = append(files, []any{
+			e.Timestamp.In(loc), e.ComputerName, e.OperationType, e.SourcePath, e.DestinationPath,
+			uint64(e.FileCount), e.FileSize, e.IsUSBTarget == 1,
+		})
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "Файловые операции",
+		Columns: []Column{
+			{Title: "Время", Width: 1.4}, {Title: "Компьютер", Width: 1.2}, {Title: "Операция"},
+			{Title: "Источник", Width: 3}, {Title: "Назначение", Width: 3}, {Title: "Файлов", Width: 0.7},
+			{Title: "Размер, байт"}, {Title: "На USB", Width: 0.7},
+		},
+		Rows: files,
+	})
+
+	doc.Sheets = append(doc.Sheets, alertsSheet(r.Alerts, r.DLPAlerts, loc))
+	return doc
+}
+
+// Range flattens a range report
+func Range(r *database.RangeReport, loc *time.Location) Document {
+	doc := Document{
+		Title:   "Отчёт за период",
+		Subject: r.Username,
+		Period:  periodLabel(r.Summary.StartDate, r.Summary.EndDate, loc),
+	}
+
+	cur, prev, d := r.Summary, r.Previous, r.Delta
+	activePercent := any(nil)
+	if d.ActiveTimePercent != nil {
+		activePercent = Percent(*d.ActiveTimePercent)
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "Сводка",
+		Columns: []Column{
+			{Title: "Показатель", Width: 2}, {Title: "Период"}, {Title: "Предыдущий период"},
+			{Title: "Изменение"}, {Title: "Изменение, %"},
+		},
+		Rows: [][]any{
+			{"Активное время", Duration(cur.TotalActiveTime), Duration(prev.TotalActiveTime), Duration(d.TotalActiveTime), activePercent},
+			{"Простой", Duration(cur.TotalIdleTime), Duration(prev.TotalIdleTime), Duration(d.TotalIdleTime), nil},
+			{"Продуктивное время", Duration(cur.ProductiveTime), Duration(prev.ProductiveTime), Duration(d.ProductiveTime), nil},
+			{"Непродуктивное время", Duration(cur.UnproductiveTime), Duration(prev.UnproductiveTime), Duration(d.UnproductiveTime), nil},
+			{"Продуктивность, %", Percent(cur.ProductivityScore), Percent(prev.ProductivityScore), Percent(d.ProductivityScore), nil},
+		},
+	})
+
+	buckets := make([][]any, 0, len(r.Buckets))
+	for _, b := range r.Buckets {
+		buckets = append(buckets, []any{
+			periodLabel(b.StartDate, b.EndDate, loc),
+			Duration(b.TotalActiveTime), Duration(b.TotalIdleTime),
+			Duration(b.ProductiveTime), Duration(b.UnproductiveTime),
+			Percent(b.ProductivityScore), Duration(b.Delta.TotalActiveTime),
+		})
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "По периодам",
+		Columns: []Column{
+			{Title: "Период", Width: 2}, {Title: "Активное время"}, {Title: "Простой"},
+			{Title: "Продуктивное"}, {Title: "Непродуктивное"}, {Title: "Продуктивность, %"},
+			{Title: "Изменение активного"},
+		},
+		Rows: buckets,
+	})
+
+	doc.Sheets = append(doc.Sheets, applicationsSheet(r.TopApplications))
+	return doc
+}
+
+// Group flattens a department or team report
+func Group(r *database.GroupReport, loc *time.Location) Document {
+	doc := Document{
+		Title:  "Отчёт по отделу",
+		Period: periodLabel(r.StartDate, r.EndDate, loc),
+	}
+	subject := r.Department
+	if r.Team != "" {
+		doc.Title = "Отчёт по команде"
+		subject = strings.Join(nonEmpty(r.Department, r.Team), " / ")
+	}
+	if subject == "" {
+		subject = "Все сотрудники"
+	}
+	doc.Subject = subject
+
+	doc.Sheets = append(doc.Sheets, keyValueSheet("Сводка", [][]any{
+		{"Отдел", r.Department},
+		{"Команда", r.Team},
+		{"Сотрудников", uint64(r.Headcount)},
+		{"Были активны", uint64(r.ActiveEmployees)},
+		{"Сейчас в сети", uint64(r.OnlineNow)},
+		{"Активное время, всего", Duration(r.TotalActiveTime)},
+		{"Активное время, в среднем", Duration(r.AvgActiveTime)},
+		{"Простой, всего", Duration(r.TotalIdleTime)},
+		{"Продуктивность, минимум %", Percent(r.Productivity.Min)},
+		{"Продуктивность, медиана %", Percent(r.Productivity.Median)},
+		{"Продуктивность, P90 %", Percent(r.Productivity.P90)},
+	}))
+
+	categories := make([]string, 0, len(r.Categories))
+	for c := range r.Categories {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if r.Categories[categories[i]] != r.Categories[categories[j]] {
+			return r.Categories[categories[i]] > r.Categories[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+	catRows := make([][]any, 0, len(categories))
+	for _, c := range categories {
+		share := 0.0
+		if r.TotalActiveTime > 0 {
+			share = float64(r.Categories[c]) / float64(r.TotalActiveTime) * 100
+		}
+		catRows = append(catRows, []any{label(categoryNames, c), Duration(r.Categories[c]), Percent(share)})
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name:    "Категории",
+		Columns: []Column{{Title: "Категория", Width: 2}, {Title: "Время"}, {Title: "Доля, %"}},
+		Rows:    catRows,
+	})
+
+	doc.Sheets = append(doc.Sheets, applicationsSheet(r.TopApplications))
+
+	employees := make([][]any, 0, len(r.Employees))
+	for _, e := range r.Employees {
+		employees = append(employees, []any{
+			e.Username, e.FullName, e.Department, e.Team, e.Online,
+			Duration(e.TotalActiveTime), Duration(e.TotalIdleTime),
+			Duration(e.ProductiveTime), Duration(e.UnproductiveTime), Percent(e.ProductivityScore),
+		})
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "Сотрудники",
+		Columns: []Column{
+			{Title: "Логин", Width: 1.2}, {Title: "ФИО", Width: 2}, {Title: "Отдел", Width: 1.3},
+			{Title: "Команда", Width: 1.2}, {Title: "В сети", Width: 0.7}, {Title: "Активное время"},
+			{Title: "Простой"}, {Title: "Продуктивное"}, {Title: "Непродуктивное"},
+			{Title: "Продуктивность, %"},
+		},
+		Rows: employees,
+	})
+	return doc
+}
+
+func keyValueSheet(name string, rows [][]any) Sheet {
+	return Sheet{
+		Name:    name,
+		Columns: []Column{{Title: "Показатель", Width: 2}, {Title: "Значение", Width: 3}},
+		Rows:    rows,
+	}
+}
+
+func applicationsSheet(apps []database.ApplicationUsage) Sheet {
+	rows := make([][]any, 0, len(apps))
+	for _, a := range apps {
+		duration := a.Duration
+		if duration == 0 {
+			duration = a.TotalDuration
+		}
+		rows = append(rows, []any{
+			a.ApplicationName, a.ProcessName, label(categoryNames, a.Category), Duration(duration), Percent(a.Percentage),
+		})
+	}
+	return Sheet{
+		Name: "Приложения",
+		Columns: []Column{
+			{Title: "Приложение", Width: 2}, {Title: "Процесс", Width: 2}, {Title: "Категория", Width: 1.2},
+			{Title: "Время"}, {Title: "Доля, %"},
+		},
+		Rows: rows,
+	}
+}
+
+// alertsSheet lists the alerts and DLP alerts of a report without duplicates
+func alertsSheet(alerts, dlp []database.AlertFull, loc *time.Location) Sheet {
+	seen := make(map[string]bool)
+	rows := make([][]any, 0, len(alerts)+len(dlp))
+	for _, a := range append(append([]database.AlertFull{}, alerts...), dlp...) {
+		if a.ID != "" {
+			if seen[a.ID] {
+				continue
+			}
+			seen[a.ID] = true
+		}
+		status := a.Status
+		if status == "" && a.IsResolved {
+			status = "resolved"
+		}
+		rows = append(rows, []any{parseTime(a.Timestamp, loc), a.AlertType, a.Severity, a.Description, status, a.Assignee})
+	}
+	return Sheet{
+		Name: "Инциденты",
+		Columns: []Column{
+			{Title: "Время", Width: 1.4}, {Title: "Тип", Width: 1.3}, {Title: "Важность", Width: 0.9},
+			{Title: "Описание", Width: 4}, {Title: "Статус"}, {Title: "Ответственный"},
+		},
+		Rows: rows,
+	}
+}
+
+// parseTime reads an RFC3339 timestamp of a report; unparsable values are
+// kept as text
+func parseTime(s string, loc *time.Location) any {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return t.In(loc)
+}
+
+// periodLabel formats a half-open period [start, end) as dates
+func periodLabel(start, end string, loc *time.Location) string {
+	from, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return ""
+	}
+	to, err := time.Parse(time.RFC3339, end)
+	if err != nil || !to.After(from) {
+		return from.In(loc).Format(dateLayout)
+	}
+	first := from.In(loc).Format(dateLayout)
+	last := to.Add(-time.Second).In(loc).Format(dateLayout)
+	if first == last {
+		return first
+	}
+	return first + " — " + last
+}
@@ -0,0 +1,155 @@
+// Package export renders reports as CSV, XLSX and PDF files. A report is
+// first flattened into a Document of titled tables; every format renders the
+// same tables, so the files only differ in layout.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/reports"
+)
+
+// Format is an output format of the report endpoints
+type Format string
+
+const (
+	JSON Format = "json"
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+	PDF  Format = "pdf"
+)
+
+// ParseFormat accepts json, csv, xlsx and pdf; empty means json
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return JSON, nil
+	case JSON, CSV, XLSX, PDF:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, use json, csv, xlsx or pdf", s)
+}
+
+// ContentType is the MIME type of a file in this format
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case PDF:
+		return "application/pdf"
+	}
+	return "application/json"
+}
+
+// PeriodFileName names the export of a period report, e.g.
+// report_ivanov_2025-03-01_2025-03-31
+func PeriodFileName(subject string, period reports.Period) string {
+	last := period.End.AddDate(0, 0, -1)
+	return FileName(fmt.Sprintf("report_%s_%s_%s", subject, period.Start.Format("2006-01-02"), last.Format("2006-01-02")))
+}
+
+// FileName replaces characters that do not belong in a file name
+func FileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// Document is a report flattened into tables
+type Document struct {
+	Title   string // e.g. "Ежедневный отчёт"
+	Subject string // employee, department or team
+	Period  string
+	Sheets  []Sheet
+}
+
+// Sheet is one table: an XLSX sheet, a CSV section or a PDF section
+type Sheet struct {
+	Name    string
+	Columns []Column
+	Rows    [][]any
+}
+
+// Column is a table header. Width is the relative width in the PDF, 1 if
+// zero.
+type Column struct {
+	Title string
+	Width float64
+}
+
+// Cell values besides strings, numbers, bools and time.Time
+type (
+	// Duration is a number of seconds, shown as h:mm:ss
+	Duration int64
+	// Percent is shown with one decimal
+	Percent float64
+)
+
+// Write renders doc in format f. JSON is not a document format and is
+// rejected.
+func Write(w io.Writer, f Format, doc Document, opts PDFOptions) error {
+	switch f {
+	case CSV:
+		return WriteCSV(w, doc)
+	case XLSX:
+		return WriteXLSX(w, doc)
+	case PDF:
+		return WritePDF(w, doc, opts)
+	}
+	return fmt.Errorf("format %q cannot be exported", f)
+}
+
+const timeLayout = "02.01.2006 15:04:05"
+
+// text formats a cell for CSV and PDF
+func text(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case Duration:
+		return formatDuration(v)
+	case Percent:
+		return strconv.FormatFloat(float64(v), 'f', 1, 64)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case bool:
+		if v {
+			return "да"
+		}
+		return "нет"
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(timeLayout)
+	}
+	return fmt.Sprint(v)
+}
+
+func formatDuration(d Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	return fmt.Sprintf("%s%d:%02d:%02d", sign, d/3600, d/60%60, d%60)
+}
+
+// numeric reports whether a cell is right-aligned
+func numeric(v any) bool {
+	switch v.(type) {
+	case Duration, Percent, int, int64, uint32, uint64, float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/attendance"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/reports"
+	"github.com/xuri/excelize/v2"
+)
+
+var msk = time.FixedZone("MSK", 3*3600)
+
+func testDocument() Document {
+	return Document{
+		Title:   "Ежедневный отчёт",
+		Subject: "ivanov",
+		Period:  "17.03.2025",
+		Sheets: []Sheet{
+			{
+				Name:    "Сводка",
+				Columns: []Column{{Title: "Показатель"}, {Title: "Значение"}},
+				Rows: [][]any{
+					{"Активное время", Duration(3725)},
+					{"Продуктивность, %", Percent(87.26)},
+					{"Первая активность", time.Date(2025, 3, 17, 9, 3, 0, 0, msk)},
+				},
+			},
+			{
+				Name:    "Инциденты",
+				Columns: []Column{{Title: "Описание", Width: 4}, {Title: "На USB"}},
+				Rows:    [][]any{{"Копирование, \"отчёт\"", true}},
+			},
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": JSON, "json": JSON, "csv": CSV, "xlsx": XLSX, "pdf": PDF} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseFormat("docx"); err == nil {
+		t.Error("ParseFormat(docx) succeeded")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+	want := utf8BOM + `Сводка
+Показатель,Значение
+Активное время,1:02:05
+"Продуктивность, %",87.3
+Первая активность,17.03.2025 09:03:00
+
+Инциденты
+Описание,На USB
+"Копирование, ""отчёт""",да
+`
+	if got := buf.String(); got != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	doc := Document{Sheets: []Sheet{{
+		Name:    "Окна",
+		Columns: []Column{{Title: "Заголовок"}, {Title: "Число"}},
+		Rows: [][]any{
+			{`=HYPERLINK("http://evil","x")`, -1.5},
+			{"+1", nil},
+			{"-cmd", nil},
+			{"@SUM(A1)", nil},
+			{"\tTab", nil},
+			{"\rCR", nil},
+			{"a=b", nil},
+		},
+	}}}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	want := utf8BOM + `Окна
+Заголовок,Число
+"'=HYPERLINK(""http://evil"",""x"")",-1.50
+'+1,
+'-cmd,
+'@SUM(A1),
+'	Tab,
+` + "\"'\rCR\",\n" + `a=b,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("CSV =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if got := f.GetSheetList(); len(got) != 2 || got[0] != "Сводка" || got[1] != "Инциденты" {
+		t.Fatalf("sheets = %v", got)
+	}
+	if v, _ := f.GetCellValue("Сводка", "A1"); v != "Показатель" {
+		t.Errorf("A1 = %q", v)
+	}
+	// Durations are stored as fractions of a day so Excel can sum them
+	if v, _ := f.GetCellValue("Сводка", "B2", excelize.Options{RawCellValue: true}); !strings.HasPrefix(v, "0.0431") {
+		t.Errorf("duration cell = %q", v)
+	}
+	if v, _ := f.GetCellValue("Сводка", "B4"); v != "17.03.2025 09:03:00" {
+		t.Errorf("time cell = %q", v)
+	}
+}
+
+func TestSheetNameIsValidAndUnique(t *testing.T) {
+	used := make(map[string]bool)
+	long := strings.Repeat("Очень длинное имя ", 3)
+	first := sheetName(long, used)
+	second := sheetName(long, used)
+	if n := len([]rune(first)); n != maxSheetName {
+		t.Errorf("first name has %d runes", n)
+	}
+	if first == second || !strings.HasSuffix(second, " (2)") || len([]rune(second)) > maxSheetName {
+		t.Errorf("names = %q, %q", first, second)
+	}
+	if got := sheetName("USB/файлы [1]", used); got != "USB_файлы _1_" {
+		t.Errorf("sheetName = %q", got)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		logo.Set(x, 10, color.RGBA{200, 0, 0, 255})
+	}
+	doc := testDocument()
+	for i := 0; i < 120; i++ {
+		doc.Sheets[1].Rows = append(doc.Sheets[1].Rows, []any{strings.Repeat("длинное описание ", 20), false})
+	}
+
+	var buf bytes.Buffer
+	err := WritePDF(&buf, doc, PDFOptions{CompanyName: "ООО Ромашка", Logo: logo})
+	if errors.Is(err, ErrNoFont) {
+		t.Skip("no DejaVu font installed")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "%PDF-") {
+		t.Fatalf("not a PDF: %q", out[:min(len(out), 20)])
+	}
+	if pages := strings.Count(out, "/Type /Page\n"); pages < 2 {
+		t.Errorf("%d pages, want the long table to span several", pages)
+	}
+	if !strings.Contains(out, "/Subtype /Image") {
+		t.Error("logo not embedded")
+	}
+}
+
+func TestWritePDFMissingFont(t *testing.T) {
+	err := WritePDF(&bytes.Buffer{}, testDocument(), PDFOptions{Font: "/nonexistent/font.ttf"})
+	if err == nil {
+		t.Fatal("WritePDF succeeded without a font")
+	}
+}
+
+func TestDailyDocument(t *testing.T) {
+	report := &database.DailyReport{
+		Date:     "2025-03-17",
+		Username: "ivanov",
+		ActivityPeriods: []database.ActivityPeriod{{
+			Start: "2025-03-17T06:03:00Z", End: "2025-03-17T06:29:00Z", DurationSec: 1560,
+			State: "active", ProcessName: "1cv8.exe", FriendlyName: "1С", Category: "productive",
+			WindowTitles: []string{"Бухгалтерия", "Склад"},
+		}},
+		Alerts:    []database.AlertFull{{ID: "a1", Timestamp: "2025-03-17T07:00:00Z", AlertType: "usb_copy"}},
+		DLPAlerts: []database.AlertFull{{ID: "a1", Timestamp: "2025-03-17T07:00:00Z", AlertType: "usb_copy"}},
+		Summary: database.ActivitySummary{
+			StartDate: "2025-03-17T00:00:00+03:00",
+			EndDate:   "2025-03-18T00:00:00+03:00",
+		},
+	}
+	doc := Daily(report, msk)
+
+	if doc.Period != "17.03.2025" {
+		t.Errorf("period = %q", doc.Period)
+	}
+	sheets := make(map[string]Sheet)
+	for _, s := range doc.Sheets {
+		sheets[s.Name] = s
+	}
+	periods := sheets["Периоды активности"].Rows
+	if len(periods) != 1 || text(periods[0][0]) != "17.03.2025 09:03:00" || periods[0][5] != "Продуктивное" || periods[0][6] != "Бухгалтерия; Склад" {
+		t.Errorf("periods = %v", periods)
+	}
+	if alerts := sheets["Инциденты"].Rows; len(alerts) != 1 {
+		t.Errorf("alerts = %v, want the DLP duplicate dropped", alerts)
+	}
+	for _, name := range []string{"Сводка", "Приложения", "USB-устройства", "Файловые операции"} {
+		if _, ok := sheets[name]; !ok {
+			t.Errorf("sheet %q missing", name)
+		}
+	}
+}
+
+func TestPeriodLabel(t *testing.T) {
+	if got := periodLabel("2025-03-10T00:00:00+03:00", "2025-03-17T00:00:00+03:00", msk); got != "10.03.2025 — 16.03.2025" {
+		t.Errorf("periodLabel = %q", got)
+	}
+}
+
+func TestPeriodFileName(t *testing.T) {
+	period := reports.Period{
+		Start: time.Date(2025, 3, 10, 0, 0, 0, 0, msk),
+		End:   time.Date(2025, 3, 17, 0, 0, 0, 0, msk),
+	}
+	if got := PeriodFileName("Продажи / B2B", period); got != "report_Продажи___B2B_2025-03-10_2025-03-16" {
+		t.Errorf("PeriodFileName = %q", got)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	doc := testDocument()
+	doc.Sheets[1].Rows = append(doc.Sheets[1].Rows, []any{"<script>", false}, []any{"третья", false})
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, doc, MailOptions{CompanyName: "ООО Ромашка", MaxRows: 2}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"ООО Ромашка", "Ежедневный отчёт", "1:02:05", "87.3", "&lt;script&gt;", "ещё 1 строк"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML lacks %q", want)
+		}
+	}
+	if strings.Contains(out, "третья") || strings.Contains(out, "<script>") {
+		t.Error("HTML has rows past MaxRows or unescaped text")
+	}
+
+	buf.Reset()
+	if err := WriteText(&buf, doc, MailOptions{MaxRows: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "Активное время | 1:02:05") || strings.Contains(out, "третья") {
+		t.Errorf("text =\n%s", out)
+	}
+}
+
+func TestTimesheetDocuments(t *testing.T) {
+	arrived := time.Date(2025, 3, 3, 9, 20, 0, 0, msk)
+	left := time.Date(2025, 3, 3, 18, 5, 0, 0, msk)
+	ts := attendance.Timesheet{
+		AttendanceEmployee: database.AttendanceEmployee{Username: "ivanov", FullName: "Иванов И. И.", Department: "Продажи"},
+		Period:             "2025-03",
+		Schedule:           attendance.ScheduleInfo{Start: "09:00", End: "18:00", WorkDays: []int{1, 2, 3, 4, 5}},
+		Month: attendance.Month{
+			Days: []attendance.Day{
+				{Date: "2025-03-02", Status: attendance.StatusDayOff},
+				{Date: "2025-03-03", Status: attendance.StatusPresent, FirstActivity: &arrived, LastActivity: &left, PresenceSeconds: 29700, LateSeconds: 1200},
+				{Date: "2025-03-04", Status: attendance.StatusAbsent},
+			},
+			Totals: attendance.Totals{WorkDays: 2, PresentDays: 1, AbsentDays: 1, PresenceSeconds: 29700},
+		},
+	}
+
+	doc := Timesheet(&ts, msk)
+	if doc.Subject != "Иванов И. И." || doc.Period != "Март 2025" {
+		t.Errorf("document = %q, %q", doc.Subject, doc.Period)
+	}
+	if row := doc.Sheets[1].Rows[1]; row[0] != "03.03.2025" || row[1] != "Явка" || row[4] != "09:20" || row[5] != "18:05" || text(row[9]) != "0:20:00" {
+		t.Errorf("day row = %v", row)
+	}
+	if got := scheduleLabel(ts.Schedule); got != "09:00–18:00, пн–пт" {
+		t.Errorf("scheduleLabel = %q", got)
+	}
+
+	grid := Timesheets([]attendance.Timesheet{ts}, "Продажи", "", "2025-03").Sheets[0]
+	if len(grid.Columns) != 2+3+2 {
+		t.Fatalf("%d grid columns", len(grid.Columns))
+	}
+	if row := grid.Rows[0]; row[2] != "В" || row[3] != 8.25 || row[4] != "НН" || row[5] != uint64(1) {
+		t.Errorf("grid row = %v", row)
+	}
+}
@@ -0,0 +1,145 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// MailOptions configures the HTML and plain text mail bodies
+type MailOptions struct {
+	CompanyName string
+	Intro       string // paragraph above the tables
+	// MaxRows limits the rows of every table; the full report is attached.
+	// Zero means no limit.
+	MaxRows int
+}
+
+type htmlCell struct {
+	Text    string
+	Numeric bool
+}
+
+type htmlRow struct {
+	Odd   bool // shaded like the PDF tables
+	Cells []htmlCell
+}
+
+type htmlSheet struct {
+	Name    string
+	Columns []string
+	Rows    []htmlRow
+	Hidden  int // rows cut by MaxRows
+}
+
+// Mail clients ignore <style> blocks, so every element is styled inline
+var mailTemplate = template.Must(template.New("mail").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="margin:0;padding:16px;background:#f4f6f9;font-family:Arial,Helvetica,sans-serif;font-size:14px;color:#1f2933">
+<div style="max-width:900px;margin:0 auto;background:#ffffff;padding:20px;border:1px solid #dde4ee">
+{{- if .Company}}
+<div style="font-size:12px;color:#5a5a5a">{{.Company}}</div>
+{{- end}}
+<h1 style="font-size:20px;margin:4px 0">{{.Title}}</h1>
+{{- range .Lines}}
+<div style="font-size:14px;color:#3e4c59">{{.}}</div>
+{{- end}}
+{{- if .Intro}}
+<p>{{.Intro}}</p>
+{{- end}}
+{{- range .Sheets}}
+<h2 style="font-size:16px;margin:20px 0 6px">{{.Name}}</h2>
+<table cellpadding="4" cellspacing="0" style="border-collapse:collapse;width:100%;font-size:12px">
+<tr>{{range .Columns}}<th style="background:#dde4ee;border:1px solid #b4b4b4;text-align:left">{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr{{if .Odd}} style="background:#f5f7fa"{{end}}>{{range .Cells}}<td style="border:1px solid #b4b4b4{{if .Numeric}};text-align:right;white-space:nowrap{{end}}">{{.Text}}</td>{{end}}</tr>
+{{- else}}
+<tr><td colspan="{{len .Columns}}" style="border:1px solid #b4b4b4;text-align:center">Нет данных</td></tr>
+{{- end}}
+</table>
+{{- if .Hidden}}
+<div style="font-size:12px;color:#5a5a5a">…и ещё {{.Hidden}} строк во вложении</div>
+{{- end}}
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+// WriteHTML renders doc as an HTML mail body
+func WriteHTML(w io.Writer, doc Document, opts MailOptions) error {
+	sheets := make([]htmlSheet, 0, len(doc.Sheets))
+	for _, s := range doc.Sheets {
+		hs := htmlSheet{Name: s.Name}
+		for _, c := range s.Columns {
+			hs.Columns = append(hs.Columns, c.Title)
+		}
+		rows := limitRows(s.Rows, opts.MaxRows)
+		hs.Hidden = len(s.Rows) - len(rows)
+		for i, row := range rows {
+			cells := make([]htmlCell, len(s.Columns))
+			for j := range cells {
+				if j < len(row) {
+					cells[j] = htmlCell{Text: text(row[j]), Numeric: numeric(row[j])}
+				}
+			}
+			hs.Rows = append(hs.Rows, htmlRow{Odd: i%2 == 1, Cells: cells})
+		}
+		sheets = append(sheets, hs)
+	}
+
+	return mailTemplate.Execute(w, map[string]any{
+		"Title":   doc.Title,
+		"Company": opts.CompanyName,
+		"Lines":   nonEmpty(doc.Subject, doc.Period),
+		"Intro":   opts.Intro,
+		"Sheets":  sheets,
+	})
+}
+
+// WriteText renders doc as the plain text alternative of the HTML body
+func WriteText(w io.Writer, doc Document, opts MailOptions) error {
+	var b strings.Builder
+	for _, line := range nonEmpty(opts.CompanyName, doc.Title, doc.Subject, doc.Period) {
+		b.WriteString(line + "\n")
+	}
+	if opts.Intro != "" {
+		b.WriteString("\n" + opts.Intro + "\n")
+	}
+
+	for _, s := range doc.Sheets {
+		b.WriteString("\n" + s.Name + "\n")
+		titles := make([]string, len(s.Columns))
+		for i, c := range s.Columns {
+			titles[i] = c.Title
+		}
+		b.WriteString(strings.Join(titles, " | ") + "\n")
+
+		rows := limitRows(s.Rows, opts.MaxRows)
+		for _, row := range rows {
+			cells := make([]string, len(row))
+			for j, v := range row {
+				cells[j] = text(v)
+			}
+			b.WriteString(strings.Join(cells, " | ") + "\n")
+		}
+		if len(rows) == 0 {
+			b.WriteString("Нет данных\n")
+		}
+		if hidden := len(s.Rows) - len(rows); hidden > 0 {
+			fmt.Fprintf(&b, "…и ещё %d строк во вложении\n", hidden)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func limitRows(rows [][]any, max int) [][]any {
+	if max > 0 && len(rows) > max {
+		return rows[:max]
+	}
+	return rows
+}
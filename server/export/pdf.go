@@ -0,0 +1,314 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PDFOptions configures the PDF layout
+type PDFOptions struct {
+	CompanyName string
+	Logo        image.Image // optional
+	// Font and BoldFont are TrueType files with Cyrillic glyphs. When empty
+	// the DejaVu fonts of common distributions are used.
+	Font     string
+	BoldFont string
+	// Now is the generation time printed in the footer
+	Now time.Time
+}
+
+// ErrNoFont is returned when no TrueType font for the PDF is available
+var ErrNoFont = errors.New("no TrueType font for PDF export: install DejaVu fonts or set reports.pdf_font")
+
+var (
+	defaultFonts = []string{
+		"/usr/share/fonts/dejavu/DejaVuSans.ttf",            // Alpine
+		"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",   // Debian, Ubuntu
+		"/usr/share/fonts/dejavu-sans-fonts/DejaVuSans.ttf", // Fedora
+	}
+	defaultBoldFonts = []string{
+		"/usr/share/fonts/dejavu/DejaVuSans-Bold.ttf",
+		"/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf",
+		"/usr/share/fonts/dejavu-sans-fonts/DejaVuSans-Bold.ttf",
+	}
+)
+
+const (
+	pdfFont       = "report"
+	pdfMargin     = 10.0
+	pdfRowHeight  = 6.0
+	pdfHeaderSize = 18.0 // space taken by the page header
+	pdfFooterSize = 12.0
+)
+
+// WritePDF writes an A4 landscape document with the company name and logo on
+// every page, the sheets as tables and page numbers in the footer
+func WritePDF(w io.Writer, doc Document, opts PDFOptions) error {
+	regular, bold, err := loadFonts(opts.Font, opts.BoldFont)
+	if err != nil {
+		return err
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	// Must precede the fonts so the page count digits are embedded
+	pdf.AliasNbPages("{nb}")
+	pdf.AddUTF8FontFromBytes(pdfFont, "", regular)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", bold)
+	pdf.SetTitle(strings.TrimSpace(doc.Title+" "+doc.Subject), true)
+	pdf.SetCreator("Office Monitor", true)
+	pdf.SetMargins(pdfMargin, pdfMargin+pdfHeaderSize, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfFooterSize)
+
+	p := &pdfWriter{pdf: pdf, doc: doc, opts: opts}
+	if opts.Logo != nil {
+		p.registerLogo()
+	}
+	pdf.SetHeaderFunc(p.header)
+	pdf.SetFooterFunc(p.footer)
+
+	pdf.AddPage()
+	p.titleBlock()
+	for _, sheet := range doc.Sheets {
+		p.table(sheet)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("failed to render PDF: %w", err)
+	}
+	return pdf.Output(w)
+}
+
+// loadFonts reads the configured fonts or the first installed default.
+// Without a bold font the regular one is used for headings.
+func loadFonts(regularPath, boldPath string) (regular, bold []byte, err error) {
+	if regularPath == "" {
+		regularPath = firstExisting(defaultFonts)
+	}
+	if regularPath == "" {
+		return nil, nil, ErrNoFont
+	}
+	if regular, err = os.ReadFile(regularPath); err != nil {
+		return nil, nil, fmt.Errorf("failed to read PDF font: %w", err)
+	}
+
+	if boldPath == "" {
+		boldPath = firstExisting(defaultBoldFonts)
+	}
+	if boldPath == "" {
+		return regular, regular, nil
+	}
+	if bold, err = os.ReadFile(boldPath); err != nil {
+		return nil, nil, fmt.Errorf("failed to read PDF bold font: %w", err)
+	}
+	return regular, bold, nil
+}
+
+func firstExisting(paths []string) string {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+type pdfWriter struct {
+	pdf  *gofpdf.Fpdf
+	doc  Document
+	opts PDFOptions
+	logo string // registered image name, empty without a logo
+	// logoW and logoH fit the logo into the page header
+	logoW, logoH float64
+}
+
+// registerLogo re-encodes the logo as a plain 8-bit PNG, which gofpdf reads
+// regardless of the uploaded format
+func (p *pdfWriter) registerLogo() {
+	b := p.opts.Logo.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return
+	}
+	rgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), p.opts.Logo, b.Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return
+	}
+
+	p.pdf.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: "PNG"}, &buf)
+	if p.pdf.Err() {
+		// A broken logo must not break the report
+		p.pdf.ClearError()
+		return
+	}
+	p.logo = "logo"
+	p.logoH = 12.0
+	p.logoW = p.logoH * float64(b.Dx()) / float64(b.Dy())
+	if p.logoW > 40 {
+		p.logoW, p.logoH = 40, 40*float64(b.Dy())/float64(b.Dx())
+	}
+}
+
+func (p *pdfWriter) header() {
+	pdf := p.pdf
+	pageW, _ := pdf.GetPageSize()
+	x, y := pdfMargin, pdfMargin
+
+	if p.logo != "" {
+		pdf.ImageOptions(p.logo, x, y, p.logoW, p.logoH, false, gofpdf.ImageOptions{}, 0, "")
+		x += p.logoW + 4
+	}
+	pdf.SetXY(x, y)
+	pdf.SetFont(pdfFont, "B", 12)
+	pdf.CellFormat(pageW-pdfMargin-x, 6, p.opts.CompanyName, "", 2, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 9)
+	pdf.SetTextColor(90, 90, 90)
+	pdf.CellFormat(pageW-pdfMargin-x, 5, strings.Join(nonEmpty(p.doc.Title, p.doc.Subject, p.doc.Period), " · "), "", 0, "L", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	lineY := pdfMargin + pdfHeaderSize - 4
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.Line(pdfMargin, lineY, pageW-pdfMargin, lineY)
+	pdf.SetXY(pdfMargin, pdfMargin+pdfHeaderSize)
+}
+
+func (p *pdfWriter) footer() {
+	pdf := p.pdf
+	pageW, _ := pdf.GetPageSize()
+	pdf.SetY(-pdfFooterSize + 2)
+	pdf.SetFont(pdfFont, "", 8)
+	pdf.SetTextColor(90, 90, 90)
+	half := (pageW - 2*pdfMargin) / 2
+	pdf.CellFormat(half, 5, "Сформирован "+p.opts.Now.Format(timeLayout), "", 0, "L", false, 0, "")
+	pdf.CellFormat(half, 5, fmt.Sprintf("Страница %d из {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+}
+
+func (p *pdfWriter) titleBlock() {
+	pdf := p.pdf
+	pdf.SetFont(pdfFont, "B", 16)
+	pdf.CellFormat(0, 8, p.doc.Title, "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 11)
+	for _, line := range nonEmpty(p.doc.Subject, p.doc.Period) {
+		pdf.CellFormat(0, 6, line, "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(2)
+}
+
+// table draws a sheet, repeating the column headers on every page it spans
+func (p *pdfWriter) table(sheet Sheet) {
+	pdf := p.pdf
+	pageW, pageH := pdf.GetPageSize()
+	bottom := pageH - pdfFooterSize
+	widths := columnWidths(sheet.Columns, pageW-2*pdfMargin)
+
+	// Keep the section title with the header and first rows
+	if pdf.GetY()+8+3*pdfRowHeight > bottom {
+		pdf.AddPage()
+	}
+	pdf.Ln(2)
+	pdf.SetFont(pdfFont, "B", 12)
+	pdf.CellFormat(0, 8, sheet.Name, "", 1, "L", false, 0, "")
+	p.tableHeader(sheet.Columns, widths)
+
+	pdf.SetFont(pdfFont, "", 8)
+	if len(sheet.Rows) == 0 {
+		pdf.CellFormat(sum(widths), pdfRowHeight, "Нет данных", "1", 1, "C", false, 0, "")
+		return
+	}
+	for i, row := range sheet.Rows {
+		if pdf.GetY()+pdfRowHeight > bottom {
+			pdf.AddPage()
+			p.tableHeader(sheet.Columns, widths)
+			pdf.SetFont(pdfFont, "", 8)
+		}
+		fill := i%2 == 1
+		pdf.SetFillColor(245, 247, 250)
+		for j, w := range widths {
+			var v any
+			if j < len(row) {
+				v = row[j]
+			}
+			align := "L"
+			if numeric(v) {
+				align = "R"
+			}
+			pdf.CellFormat(w, pdfRowHeight, fit(pdf, text(v), w-2), "1", 0, align, fill, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+func (p *pdfWriter) tableHeader(columns []Column, widths []float64) {
+	pdf := p.pdf
+	pdf.SetFont(pdfFont, "B", 8)
+	pdf.SetFillColor(221, 228, 238)
+	pdf.SetDrawColor(180, 180, 180)
+	for i, col := range columns {
+		pdf.CellFormat(widths[i], pdfRowHeight+1, fit(pdf, col.Title, widths[i]-2), "1", 0, "L", true, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+// columnWidths spreads the page width by the relative column widths
+func columnWidths(columns []Column, total float64) []float64 {
+	widths := make([]float64, len(columns))
+	var weights float64
+	for i, col := range columns {
+		widths[i] = col.Width
+		if widths[i] <= 0 {
+			widths[i] = 1
+		}
+		weights += widths[i]
+	}
+	for i := range widths {
+		widths[i] *= total / weights
+	}
+	return widths
+}
+
+// fit shortens s with an ellipsis to fit into width
+func fit(pdf *gofpdf.Fpdf, s string, width float64) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	// Start from the proportional length; long window titles are common
+	runes = runes[:min(len(runes), int(float64(len(runes))*width/pdf.GetStringWidth(s))+1)]
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func sum(values []float64) float64 {
+	var s float64
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
+
+func nonEmpty(values ...string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
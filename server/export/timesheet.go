@@ -0,0 +1,208 @@
+package export
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/attendance"
+)
+
+var dayStatusNames = map[string]string{
+	attendance.StatusPresent:      "Явка",
+	attendance.StatusAbsent:       "Неявка",
+	attendance.StatusDayOff:       "Выходной",
+	attendance.StatusHoliday:      "Праздник",
+	attendance.StatusWorkedDayOff: "Работа в выходной",
+	attendance.StatusUpcoming:     "",
+}
+
+// dayStatusCodes mark days without hours in the timesheet grid, as in the
+// T-13 form
+var dayStatusCodes = map[string]string{
+	attendance.StatusAbsent:   "НН",
+	attendance.StatusDayOff:   "В",
+	attendance.StatusHoliday:  "В",
+	attendance.StatusUpcoming: "",
+}
+
+var monthNames = [...]string{
+	"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь",
+}
+
+// Timesheet flattens one employee's timesheet. Times are shown in loc.
+func Timesheet(t *attendance.Timesheet, loc *time.Location) Document {
+	doc := Document{
+		Title:   "Табель учёта рабочего времени",
+		Subject: employeeName(t),
+		Period:  monthLabel(t.Period),
+	}
+
+	tot := t.Totals
+	doc.Sheets = append(doc.Sheets, keyValueSheet("Сводка", [][]any{
+		{"Сотрудник", t.Username},
+		{"ФИО", t.FullName},
+		{"Отдел", t.Department},
+		{"Месяц", doc.Period},
+		{"График", scheduleLabel(t.Schedule)},
+		{"Рабочих дней", uint64(tot.WorkDays)},
+		{"Дней явки", uint64(tot.PresentDays)},
+		{"Неявок", uint64(tot.AbsentDays)},
+		{"Работа в выходные", uint64(tot.WorkedDaysOff)},
+		{"Опозданий", uint64(tot.LateDays)},
+		{"Уходов раньше", uint64(tot.EarlyLeaveDays)},
+		{"Норма времени", Duration(tot.ScheduledSeconds)},
+		{"Присутствие", Duration(tot.PresenceSeconds)},
+		{"Активное время", Duration(tot.ActiveSeconds)},
+		{"Перерывы", Duration(tot.BreakSeconds)},
+		{"Опоздания", Duration(tot.LateSeconds)},
+		{"Ранний уход", Duration(tot.EarlyLeaveSeconds)},
+		{"Переработка", Duration(tot.OvertimeSeconds)},
+	}))
+
+	days := make([][]any, 0, len(t.Days))
+	for _, d := range t.Days {
+		window := ""
+		if d.ScheduledStart != nil {
+			window = clockLabel(d.ScheduledStart, loc) + "–" + clockLabel(d.ScheduledEnd, loc)
+		}
+		days = append(days, []any{
+			dateLabel(d.Date), label(dayStatusNames, d.Status), d.Holiday, window,
+			clockLabel(d.FirstActivity, loc), clockLabel(d.LastActivity, loc),
+			Duration(d.PresenceSeconds), Duration(d.ActiveSeconds), Duration(d.BreakSeconds),
+			Duration(d.LateSeconds), Duration(d.EarlyLeaveSeconds), Duration(d.OvertimeSeconds),
+		})
+	}
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "По дням",
+		Columns: []Column{
+			{Title: "Дата"}, {Title: "Статус", Width: 1.3}, {Title: "Праздник", Width: 1.5}, {Title: "График"},
+			{Title: "Приход", Width: 0.7}, {Title: "Уход", Width: 0.7}, {Title: "Присутствие"},
+			{Title: "Активное время"}, {Title: "Перерывы"}, {Title: "Опоздание"}, {Title: "Ранний уход"},
+			{Title: "Переработка"},
+		},
+		Rows: days,
+	})
+	return doc
+}
+
+// Timesheets flattens the timesheets of a department or team into the grid
+// used for payroll: hours per day and the month totals per employee
+func Timesheets(list []attendance.Timesheet, department, team, month string) Document {
+	subject := strings.Join(nonEmpty(department, team), " / ")
+	if subject == "" {
+		subject = "Все сотрудники"
+	}
+	doc := Document{
+		Title:   "Табель учёта рабочего времени",
+		Subject: subject,
+		Period:  monthLabel(month),
+	}
+
+	days := 0
+	for _, t := range list {
+		days = max(days, len(t.Days))
+	}
+	gridColumns := []Column{{Title: "ФИО", Width: 2}, {Title: "Логин", Width: 1.2}}
+	for i := 1; i <= days; i++ {
+		gridColumns = append(gridColumns, Column{Title: fmt.Sprint(i), Width: 0.45})
+	}
+	gridColumns = append(gridColumns, Column{Title: "Дней", Width: 0.6}, Column{Title: "Часов", Width: 0.7})
+
+	grid := make([][]any, 0, len(list))
+	totals := make([][]any, 0, len(list))
+	for _, t := range list {
+		row := []any{t.FullName, t.Username}
+		for _, d := range t.Days {
+			if code, ok := dayStatusCodes[d.Status]; ok {
+				row = append(row, code)
+			} else {
+				row = append(row, hours(d.PresenceSeconds))
+			}
+		}
+		for i := len(t.Days); i < days; i++ {
+			row = append(row, nil)
+		}
+		tot := t.Totals
+		grid = append(grid, append(row, uint64(tot.PresentDays), hours(tot.PresenceSeconds)))
+
+		totals = append(totals, []any{
+			t.Username, t.FullName, t.Department, t.Team, scheduleLabel(t.Schedule),
+			uint64(tot.WorkDays), uint64(tot.PresentDays), uint64(tot.AbsentDays), uint64(tot.WorkedDaysOff),
+			uint64(tot.LateDays), uint64(tot.EarlyLeaveDays),
+			Duration(tot.ScheduledSeconds), Duration(tot.PresenceSeconds), Duration(tot.ActiveSeconds),
+			Duration(tot.BreakSeconds), Duration(tot.LateSeconds), Duration(tot.EarlyLeaveSeconds),
+			Duration(tot.OvertimeSeconds),
+		})
+	}
+
+	doc.Sheets = append(doc.Sheets, Sheet{Name: "Табель", Columns: gridColumns, Rows: grid})
+	doc.Sheets = append(doc.Sheets, Sheet{
+		Name: "Итоги",
+		Columns: []Column{
+			{Title: "Логин", Width: 1.2}, {Title: "ФИО", Width: 2}, {Title: "Отдел", Width: 1.3},
+			{Title: "Команда", Width: 1.2}, {Title: "График", Width: 1.3}, {Title: "Рабочих дней", Width: 0.8},
+			{Title: "Явок", Width: 0.6}, {Title: "Неявок", Width: 0.6}, {Title: "В выходные", Width: 0.8},
+			{Title: "Опозданий", Width: 0.8}, {Title: "Уходов раньше", Width: 0.8}, {Title: "Норма"},
+			{Title: "Присутствие"}, {Title: "Активное время"}, {Title: "Перерывы"}, {Title: "Опоздания"},
+			{Title: "Ранний уход"}, {Title: "Переработка"},
+		},
+		Rows: totals,
+	})
+	return doc
+}
+
+func employeeName(t *attendance.Timesheet) string {
+	if t.FullName != "" {
+		return t.FullName
+	}
+	return t.Username
+}
+
+// monthLabel formats YYYY-MM as "Март 2025"
+func monthLabel(month string) string {
+	m, err := time.Parse("2006-01", month)
+	if err != nil {
+		return month
+	}
+	return fmt.Sprintf("%s %d", monthNames[m.Month()-1], m.Year())
+}
+
+func dateLabel(date string) string {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return d.Format(dateLayout)
+}
+
+func clockLabel(t *time.Time, loc *time.Location) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(loc).Format("15:04")
+}
+
+var weekdayShort = [...]string{"", "пн", "вт", "ср", "чт", "пт", "сб", "вс"}
+
+// scheduleLabel formats a schedule as "09:00–18:00, пн–пт"
+func scheduleLabel(s attendance.ScheduleInfo) string {
+	days := make([]string, 0, len(s.WorkDays))
+	for _, d := range s.WorkDays {
+		if d >= 1 && d <= 7 {
+			days = append(days, weekdayShort[d])
+		}
+	}
+	week := strings.Join(days, ", ")
+	if n := len(days); n > 2 && n == len(s.WorkDays) && s.WorkDays[n-1]-s.WorkDays[0] == n-1 {
+		week = days[0] + "–" + days[n-1]
+	}
+	return s.Start + "–" + s.End + ", " + week
+}
+
+// hours converts seconds to hours rounded to hundredths
+func hours(seconds int64) float64 {
+	return math.Round(float64(seconds)/36) / 100
+}
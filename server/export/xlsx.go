@@ -0,0 +1,167 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const maxSheetName = 31
+
+// xlsxStyles are the cell styles shared by all sheets
+type xlsxStyles struct {
+	header, duration, percent, datetime int
+}
+
+// WriteXLSX writes a workbook with one sheet per document sheet. Durations
+// and times are stored as Excel values so they can be summed and sorted.
+func WriteXLSX(w io.Writer, doc Document) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	for i, sheet := range doc.Sheets {
+		name := sheetName(sheet.Name, used)
+		if i == 0 {
+			err = f.SetSheetName("Sheet1", name)
+		} else {
+			_, err = f.NewSheet(name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create sheet %q: %w", name, err)
+		}
+		if err := writeSheet(f, name, sheet, styles); err != nil {
+			return fmt.Errorf("failed to write sheet %q: %w", name, err)
+		}
+	}
+
+	return f.Write(w)
+}
+
+func newXLSXStyles(f *excelize.File) (xlsxStyles, error) {
+	var s xlsxStyles
+	formats := []struct {
+		dst   *int
+		style *excelize.Style
+	}{
+		{&s.header, &excelize.Style{
+			Font:      &excelize.Font{Bold: true},
+			Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"DDE4EE"}},
+			Alignment: &excelize.Alignment{Vertical: "center", WrapText: true},
+		}},
+		{&s.duration, &excelize.Style{CustomNumFmt: ptr("[h]:mm:ss")}},
+		{&s.percent, &excelize.Style{CustomNumFmt: ptr("0.0")}},
+		{&s.datetime, &excelize.Style{CustomNumFmt: ptr("dd.mm.yyyy hh:mm:ss")}},
+	}
+	for _, fm := range formats {
+		id, err := f.NewStyle(fm.style)
+		if err != nil {
+			return s, fmt.Errorf("failed to create cell style: %w", err)
+		}
+		*fm.dst = id
+	}
+	return s, nil
+}
+
+func writeSheet(f *excelize.File, name string, sheet Sheet, styles xlsxStyles) error {
+	sw, err := f.NewStreamWriter(name)
+	if err != nil {
+		return err
+	}
+
+	for i, col := range sheet.Columns {
+		width := col.Width
+		if width == 0 {
+			width = 1
+		}
+		if err := sw.SetColWidth(i+1, i+1, min(12*width, 80)); err != nil {
+			return err
+		}
+	}
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+
+	header := make([]any, len(sheet.Columns))
+	for i, col := range sheet.Columns {
+		header[i] = excelize.Cell{StyleID: styles.header, Value: col.Title}
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	for r, row := range sheet.Rows {
+		values := make([]any, len(row))
+		for i, v := range row {
+			values[i] = xlsxCell(v, styles)
+		}
+		cell, err := excelize.CoordinatesToCellName(1, r+2)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetRow(cell, values); err != nil {
+			return err
+		}
+	}
+
+	return sw.Flush()
+}
+
+func xlsxCell(v any, styles xlsxStyles) any {
+	switch v := v.(type) {
+	case Duration:
+		return excelize.Cell{StyleID: styles.duration, Value: float64(v) / 86400}
+	case Percent:
+		return excelize.Cell{StyleID: styles.percent, Value: float64(v)}
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		// Excel has no time zones; keep the wall clock of the report
+		wall := time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), 0, time.UTC)
+		return excelize.Cell{StyleID: styles.datetime, Value: wall}
+	case bool:
+		return text(v)
+	}
+	return v
+}
+
+// sheetName makes a valid, unique sheet name
+func sheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Лист"
+	}
+	name = truncateRunes(name, maxSheetName)
+
+	unique := name
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		unique = truncateRunes(name, maxSheetName-utf8.RuneCountInString(suffix)) + suffix
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func ptr[T any](v T) *T { return &v }
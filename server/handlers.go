@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ctolnik/Office-Monitor/server/auth"
 	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/export"
 	"github.com/ctolnik/Office-Monitor/zapctx"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -21,6 +26,23 @@ func getAgentsHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get agents"})
 		return
 	}
+
+	allowed, scoped, err := visibleUsernames(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get department users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get agents"})
+		return
+	}
+	if scoped {
+		visible := make([]database.Agent, 0, len(agents))
+		for _, agent := range agents {
+			if allowed[agent.Username] {
+				visible = append(visible, agent)
+			}
+		}
+		agents = visible
+	}
+
 	c.JSON(http.StatusOK, agents)
 }
 
@@ -28,13 +50,29 @@ func getAgentConfigHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	computerName := c.Param("computer_name")
 
-	config, err := db.GetAgentConfig(ctx, computerName)
+	row, configured, err := db.GetEffectiveAgentConfig(ctx, computerName)
 	if err != nil {
 		zapctx.Error(ctx, "Failed to get agent config", zap.Error(err), zap.String("computer_name", computerName))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configuration"})
 		return
 	}
 
+	// Version lets the dashboard show whether the agent has picked up the current config.
+	// Unconfigured computers are not served one.
+	config := row.ConfigUpdate()
+	if configured {
+		config.Version = newAgentRemoteConfig(row).Version
+	}
+
+	status, err := db.GetAgentConfigStatus(ctx, computerName)
+	if err != nil {
+		zapctx.Warn(ctx, "Failed to get agent config status", zap.Error(err), zap.String("computer_name", computerName))
+	} else if status != nil {
+		config.AppliedVersion = status.AppliedVersion
+		config.AppliedAt = &status.AppliedAt
+		config.ApplyError = status.Error
+	}
+
 	c.JSON(http.StatusOK, config)
 }
 
@@ -85,6 +123,18 @@ func getAllEmployeesHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get employees"})
 		return
 	}
+
+	// Department heads only see their own department
+	if p := auth.FromContext(ctx); p != nil && p.DepartmentScoped() {
+		visible := make([]database.EmployeeFull, 0, len(employees))
+		for _, e := range employees {
+			if p.CanViewDepartment(e.Department) {
+				visible = append(visible, e)
+			}
+		}
+		employees = visible
+	}
+
 	c.JSON(http.StatusOK, employees)
 }
 
@@ -145,11 +195,13 @@ func deleteEmployeeHandler(c *gin.Context) {
 
 // ========== Dashboard Handlers ==========
 
+// getDashboardStatsHandler returns the dashboard counters. Department heads
+// only get the counts of their own department.
 func getDashboardStatsHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	// Use cache to get stats
-	stats, err := dashCache.Get(ctx, db)
+	stats, err := dashCache.Get(ctx, db, alertDepartment(ctx))
 	if err != nil {
 		zapctx.Error(ctx, "Failed to get dashboard stats", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statistics"})
@@ -169,9 +221,19 @@ func getActiveNowHandler(c *gin.Context) {
 		return
 	}
 
+	allowed, scoped, err := visibleUsernames(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get department users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get active agents"})
+		return
+	}
+
 	// Filter only online agents
 	activeAgents := make([]database.Agent, 0)
 	for _, agent := range agents {
+		if scoped && !allowed[agent.Username] {
+			continue
+		}
 		if agent.Status == "online" {
 			activeAgents = append(activeAgents, agent)
 		}
@@ -182,6 +244,8 @@ func getActiveNowHandler(c *gin.Context) {
 
 // ========== Reports Handlers ==========
 
+// getDailyReportHandler returns an employee's report for one day.
+// Query: date (YYYY-MM-DD, today by default), format (json|csv|xlsx|pdf).
 func getDailyReportHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	username := c.Param("username")
@@ -197,6 +261,11 @@ func getDailyReportHandler(c *gin.Context) {
 		return
 	}
 
+	format, ok := reportFormat(c)
+	if !ok {
+		return
+	}
+
 	// Parse date or use today
 	var date time.Time
 	var err error
@@ -247,6 +316,11 @@ func getDailyReportHandler(c *gin.Context) {
 			zap.String("category", report.Applications[0].Category))
 	}
 
+	if format != export.JSON {
+		writeExport(c, format, export.Daily(report, appLocation), fmt.Sprintf("report_%s_%s", username, report.Date))
+		return
+	}
+
 	c.JSON(http.StatusOK, report)
 	zapctx.Info(ctx, "🔵 getDailyReportHandler - JSON response sent")
 }
@@ -398,7 +472,7 @@ func getAlertsHandler(c *gin.Context) {
 
 	// Parse query parameters
 	resolvedStr := c.Query("resolved")
-	severity := c.Query("severity")
+	status := c.Query("status")
 	pageStr := c.DefaultQuery("page", "1")
 	pageSizeStr := c.DefaultQuery("page_size", "50")
 
@@ -412,15 +486,25 @@ func getAlertsHandler(c *gin.Context) {
 		pageSize = 50
 	}
 
-	offset := (page - 1) * pageSize
+	if status != "" && !isAlertStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of: open, acknowledged, resolved, false_positive"})
+		return
+	}
 
-	var resolved *bool
+	filter := database.AlertFilter{
+		Status:     status,
+		Severity:   c.Query("severity"),
+		Department: alertDepartment(ctx),
+		Assignee:   c.Query("assignee"),
+		Limit:      pageSize,
+		Offset:     (page - 1) * pageSize,
+	}
 	if resolvedStr != "" {
 		r := resolvedStr == "true"
-		resolved = &r
+		filter.Resolved = &r
 	}
 
-	alerts, err := db.GetAlerts(ctx, resolved, severity, pageSize, offset)
+	alerts, err := db.GetAlerts(ctx, filter)
 	if err != nil {
 		zapctx.Error(ctx, "Failed to get alerts", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alerts"})
@@ -434,7 +518,11 @@ func getUnresolvedAlertsHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	falseVal := false
-	alerts, err := db.GetAlerts(ctx, &falseVal, "", 100, 0)
+	alerts, err := db.GetAlerts(ctx, database.AlertFilter{
+		Resolved:   &falseVal,
+		Department: alertDepartment(ctx),
+		Limit:      100,
+	})
 	if err != nil {
 		zapctx.Error(ctx, "Failed to get unresolved alerts", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alerts"})
@@ -444,13 +532,113 @@ func getUnresolvedAlertsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, alerts)
 }
 
+// getAlertHandler returns a single alert with its state and comments
+func getAlertHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	alert, ok := loadAlert(c)
+	if !ok {
+		return
+	}
+	if !authorizeEmployee(c, alert.Username) {
+		return
+	}
+
+	comments, err := db.GetAlertComments(ctx, alert.ID)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get alert comments", zap.Error(err), zap.String("alert_id", alert.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alert"})
+		return
+	}
+	alert.Comments = comments
+
+	c.JSON(http.StatusOK, alert)
+}
+
+func acknowledgeAlertHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	alert, ok := loadAlert(c)
+	if !ok {
+		return
+	}
+	if database.IsClosedAlertStatus(alert.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Alert is already resolved"})
+		return
+	}
+	if alert.Status == database.AlertStatusAcknowledged {
+		c.JSON(http.StatusOK, alert)
+		return
+	}
+
+	actor := currentActor(ctx)
+	now := time.Now()
+	state := alert.State()
+	state.Status = database.AlertStatusAcknowledged
+	state.AcknowledgedBy = actor
+	state.AcknowledgedAt = &now
+	if state.Assignee == "" {
+		state.Assignee = actor
+	}
+
+	if !saveAlertState(c, alert, state) {
+		return
+	}
+
+	zapctx.Info(ctx, "Alert acknowledged", zap.String("alert_id", alert.ID))
+	c.JSON(http.StatusOK, alert)
+}
+
+func assignAlertHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Assignee string `json:"assignee"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zapctx.Warn(ctx, "Invalid assign alert request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	alert, ok := loadAlert(c)
+	if !ok {
+		return
+	}
+
+	// Empty assignee unassigns the alert
+	if req.Assignee != "" {
+		operator, err := alertWorkflowStore().GetOperatorUser(ctx, req.Assignee)
+		if err != nil {
+			zapctx.Error(ctx, "Failed to load operator", zap.Error(err), zap.String("username", req.Assignee))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign alert"})
+			return
+		}
+		if operator == nil || !operator.IsActive {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee is not an active operator"})
+			return
+		}
+	}
+
+	state := alert.State()
+	state.Assignee = req.Assignee
+	state.UpdatedBy = currentActor(ctx)
+
+	if !saveAlertState(c, alert, state) {
+		return
+	}
+
+	zapctx.Info(ctx, "Alert assigned", zap.String("alert_id", alert.ID), zap.String("assignee", req.Assignee))
+	c.JSON(http.StatusOK, alert)
+}
+
+// resolveAlertHandler closes an alert as resolved or, with false_positive, as a false positive
 func resolveAlertHandler(c *gin.Context) {
 	ctx := c.Request.Context()
-	alertID := c.Param("id")
 
 	var req struct {
-		ResolvedBy string `json:"resolved_by"`
-		Notes      string `json:"notes"`
+		Notes         string `json:"notes"`
+		FalsePositive bool   `json:"false_positive"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -459,16 +647,139 @@ func resolveAlertHandler(c *gin.Context) {
 		return
 	}
 
-	if err := db.ResolveAlert(ctx, alertID, req.ResolvedBy); err != nil {
-		zapctx.Error(ctx, "Failed to resolve alert", zap.Error(err), zap.String("alert_id", alertID))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve alert"})
+	alert, ok := loadAlert(c)
+	if !ok {
+		return
+	}
+	if database.IsClosedAlertStatus(alert.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Alert is already resolved"})
 		return
 	}
 
-	zapctx.Info(ctx, "Alert resolved", zap.String("alert_id", alertID), zap.String("resolved_by", req.ResolvedBy))
+	// The acting operator resolves the alert, not whatever the client claims
+	actor := currentActor(ctx)
+	now := time.Now()
+	state := alert.State()
+	state.Status = database.AlertStatusResolved
+	if req.FalsePositive {
+		state.Status = database.AlertStatusFalsePositive
+	}
+	state.ResolvedBy = actor
+	state.ResolvedAt = &now
+	state.ResolutionNotes = req.Notes
+
+	if !saveAlertState(c, alert, state) {
+		return
+	}
+
+	zapctx.Info(ctx, "Alert resolved",
+		zap.String("alert_id", alert.ID),
+		zap.String("status", state.Status),
+		zap.String("resolved_by", actor))
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
+func addAlertCommentHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment text is required"})
+		return
+	}
+
+	alert, ok := loadAlert(c)
+	if !ok {
+		return
+	}
+
+	comment := database.AlertComment{
+		AlertID: alert.ID,
+		Author:  currentActor(ctx),
+		Text:    strings.TrimSpace(req.Text),
+	}
+	if err := alertWorkflowStore().AddAlertComment(ctx, &comment); err != nil {
+		zapctx.Error(ctx, "Failed to add alert comment", zap.Error(err), zap.String("alert_id", alert.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// alertStore is the part of the database used by the alert workflow handlers
+type alertStore interface {
+	GetAlert(ctx context.Context, id string) (*database.AlertFull, error)
+	SaveAlertState(ctx context.Context, state database.AlertState) error
+	AddAlertComment(ctx context.Context, comment *database.AlertComment) error
+	GetOperatorUser(ctx context.Context, username string) (*database.OperatorUser, error)
+}
+
+// alertWorkflowStore returns the store of the alert workflow; tests replace it
+var alertWorkflowStore = func() alertStore { return db }
+
+// loadAlert loads the alert from the :id route parameter and writes the error response on failure
+func loadAlert(c *gin.Context) (*database.AlertFull, bool) {
+	ctx := c.Request.Context()
+	alertID := c.Param("id")
+
+	alert, err := alertWorkflowStore().GetAlert(ctx, alertID)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get alert", zap.Error(err), zap.String("alert_id", alertID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alert"})
+		return nil, false
+	}
+	if alert == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return nil, false
+	}
+	return alert, true
+}
+
+// saveAlertState stores the new state and applies it to the alert returned to the client
+func saveAlertState(c *gin.Context, alert *database.AlertFull, state database.AlertState) bool {
+	ctx := c.Request.Context()
+	if state.UpdatedBy == "" {
+		state.UpdatedBy = currentActor(ctx)
+	}
+
+	if err := alertWorkflowStore().SaveAlertState(ctx, state); err != nil {
+		zapctx.Error(ctx, "Failed to save alert state", zap.Error(err), zap.String("alert_id", alert.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return false
+	}
+
+	alert.Status = state.Status
+	alert.Assignee = state.Assignee
+	alert.AcknowledgedBy = state.AcknowledgedBy
+	alert.AcknowledgedAt = state.AcknowledgedAt
+	alert.ResolvedBy = state.ResolvedBy
+	alert.ResolvedAt = state.ResolvedAt
+	alert.ResolutionNotes = state.ResolutionNotes
+	alert.IsResolved = database.IsClosedAlertStatus(state.Status)
+	alert.IsAcknowledged = state.Status != database.AlertStatusOpen
+	return true
+}
+
+func isAlertStatus(status string) bool {
+	switch status {
+	case database.AlertStatusOpen, database.AlertStatusAcknowledged,
+		database.AlertStatusResolved, database.AlertStatusFalsePositive:
+		return true
+	}
+	return false
+}
+
+// alertDepartment returns the department filter for alert lists ("" = all departments)
+func alertDepartment(ctx context.Context) string {
+	if p := auth.FromContext(ctx); p != nil && p.DepartmentScoped() {
+		return p.Department
+	}
+	return ""
+}
+
 // getUsersListHandler returns unique list of usernames for frontend
 func getUsersListHandler(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -480,6 +791,22 @@ func getUsersListHandler(c *gin.Context) {
 		return
 	}
 
+	allowed, scoped, err := visibleUsernames(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get department users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
+		return
+	}
+	if scoped {
+		visible := make([]string, 0, len(users))
+		for _, u := range users {
+			if allowed[u] {
+				visible = append(visible, u)
+			}
+		}
+		users = visible
+	}
+
 	c.JSON(http.StatusOK, users)
 }
 
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ========== Agent Remote Config Handlers ==========
+
+// agentRemoteConfig is the config pulled by agents. Section names match the agent config.yaml.
+type agentRemoteConfig struct {
+	Version     string `json:"version"`
+	Screenshots struct {
+		Enabled         bool `json:"enabled"`
+		IntervalMinutes int  `json:"interval_minutes"`
+	} `json:"screenshots"`
+	Keylogger struct {
+		Enabled bool `json:"enabled"`
+	} `json:"keylogger"`
+	USBMonitoring struct {
+		Enabled bool `json:"enabled"`
+	} `json:"usb_monitoring"`
+	FileMonitoring struct {
+		Enabled              bool `json:"enabled"`
+		LargeCopyThresholdMB int  `json:"large_copy_threshold_mb"`
+	} `json:"file_monitoring"`
+}
+
+// newAgentRemoteConfig builds the remote config from an agent_configs row.
+// The version is a hash of the content, so it only changes when a setting does.
+func newAgentRemoteConfig(row database.AgentConfig) agentRemoteConfig {
+	var rc agentRemoteConfig
+	rc.Screenshots.Enabled = row.ScreenshotEnabled
+	rc.Screenshots.IntervalMinutes = row.ScreenshotIntervalMinutes
+	rc.Keylogger.Enabled = row.KeyloggerEnabled
+	rc.USBMonitoring.Enabled = row.USBMonitoringEnabled
+	rc.FileMonitoring.Enabled = row.FileCopyMonitoringEnabled
+	rc.FileMonitoring.LargeCopyThresholdMB = row.LargeCopyThresholdMB
+
+	content, _ := json.Marshal(rc)
+	sum := sha256.Sum256(content)
+	rc.Version = hex.EncodeToString(sum[:8])
+	return rc
+}
+
+// getAgentRemoteConfigHandler serves the effective config of the calling agent.
+// Supports If-None-Match with the version as ETag. Answers 204 for a
+// computer without a stored config.
+func getAgentRemoteConfigHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	computerName, ok := agentComputerName(c, c.Query("computer_name"))
+	if !ok {
+		return
+	}
+
+	row, configured, err := db.GetEffectiveAgentConfig(ctx, computerName)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent config", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configuration"})
+		return
+	}
+	// Serving the defaults would switch the agent's monitors to settings nobody chose
+	if !configured {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	rc := newAgentRemoteConfig(row)
+	etag := `"` + rc.Version + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, rc)
+}
+
+// reportAgentConfigHandler records which config version an agent applied
+func reportAgentConfigHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		ComputerName string `json:"computer_name"`
+		Version      string `json:"version" binding:"required"`
+		Error        string `json:"error"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version is required"})
+		return
+	}
+
+	computerName, ok := agentComputerName(c, req.ComputerName)
+	if !ok {
+		return
+	}
+
+	status := database.AgentConfigStatus{
+		ComputerName:   computerName,
+		AppliedVersion: req.Version,
+		AppliedAt:      time.Now(),
+		Error:          req.Error,
+	}
+	if err := db.SaveAgentConfigStatus(ctx, status); err != nil {
+		zapctx.Error(ctx, "Failed to save agent config status", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save status"})
+		return
+	}
+
+	if req.Error != "" {
+		zapctx.Warn(ctx, "Agent failed to apply config",
+			zap.String("computer_name", computerName),
+			zap.String("version", req.Version),
+			zap.String("error", req.Error))
+	} else {
+		zapctx.Info(ctx, "Agent applied config",
+			zap.String("computer_name", computerName),
+			zap.String("version", req.Version))
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// agentComputerName resolves the computer an ingest request acts for.
+// A per-agent key pins the computer; with the master key the claimed name is used.
+func agentComputerName(c *gin.Context, claimed string) (string, bool) {
+	keyComputer := c.GetString(agentComputerKey)
+	switch {
+	case keyComputer != "" && claimed != "" && !strings.EqualFold(keyComputer, claimed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key does not belong to this computer"})
+		return "", false
+	case keyComputer != "":
+		return keyComputer, true
+	case claimed == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "computer_name is required"})
+		return "", false
+	}
+	return claimed, true
+}
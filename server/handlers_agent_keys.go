@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// issueAgentAPIKeyHandler issues a per-agent API key.
+// The plain key is returned only once; the server keeps its SHA-256 hash.
+func issueAgentAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	computerName := c.Param("computer_name")
+
+	exists, err := db.HasAgentAPIKey(ctx, computerName)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to check agent API key", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue API key"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "API key already issued, use rotate"})
+		return
+	}
+
+	key, ok := storeNewAgentAPIKey(c, computerName)
+	if !ok {
+		return
+	}
+
+	zapctx.Info(ctx, "Agent API key issued", zap.String("computer_name", computerName))
+	c.JSON(http.StatusCreated, gin.H{
+		"computer_name": computerName,
+		"api_key":       key,
+	})
+}
+
+// rotateAgentAPIKeyHandler replaces the agent's key; the old one stops working immediately
+func rotateAgentAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	computerName := c.Param("computer_name")
+
+	exists, err := db.HasAgentAPIKey(ctx, computerName)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to check agent API key", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No API key issued for this agent"})
+		return
+	}
+
+	key, ok := storeNewAgentAPIKey(c, computerName)
+	if !ok {
+		return
+	}
+
+	zapctx.Info(ctx, "Agent API key rotated", zap.String("computer_name", computerName))
+	c.JSON(http.StatusOK, gin.H{
+		"computer_name": computerName,
+		"api_key":       key,
+	})
+}
+
+// revokeAgentAPIKeyHandler removes the agent's key
+func revokeAgentAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	computerName := c.Param("computer_name")
+
+	if err := db.SetAgentAPIKey(ctx, computerName, ""); err != nil {
+		zapctx.Error(ctx, "Failed to revoke agent API key", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	agentKeys.InvalidateComputer(computerName)
+
+	zapctx.Info(ctx, "Agent API key revoked", zap.String("computer_name", computerName))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// storeNewAgentAPIKey generates a key, stores its hash and drops cached entries.
+// Writes the error response itself and returns false on failure.
+func storeNewAgentAPIKey(c *gin.Context, computerName string) (string, bool) {
+	ctx := c.Request.Context()
+
+	key, err := generateAPIKey()
+	if err != nil {
+		zapctx.Error(ctx, "Failed to generate API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return "", false
+	}
+
+	if err := db.SetAgentAPIKey(ctx, computerName, hashAPIKey(key)); err != nil {
+		zapctx.Error(ctx, "Failed to store agent API key", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store API key"})
+		return "", false
+	}
+	agentKeys.InvalidateComputer(computerName)
+
+	return key, true
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	maxAgentLogBatch      = 1000
+	defaultAgentLogsLimit = 200
+	maxAgentLogsLimit     = 1000
+)
+
+// receiveAgentLogsHandler stores the WARN and higher lines an agent ships
+// when logging.ship_to_server is on
+func receiveAgentLogsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		ComputerName string `json:"computer_name"`
+		Entries      []struct {
+			Timestamp time.Time              `json:"timestamp"`
+			Level     string                 `json:"level"`
+			Component string                 `json:"component"`
+			Message   string                 `json:"message"`
+			Caller    string                 `json:"caller"`
+			Fields    map[string]interface{} `json:"fields"`
+		} `json:"entries"`
+		Dropped uint64 `json:"dropped"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log batch"})
+		return
+	}
+	if len(req.Entries) > maxAgentLogBatch {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Too many log entries in one batch"})
+		return
+	}
+
+	computerName, ok := agentComputerName(c, req.ComputerName)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	entries := make([]database.AgentLogEntry, 0, len(req.Entries))
+	for _, e := range req.Entries {
+		entry := database.AgentLogEntry{
+			Timestamp:    e.Timestamp,
+			ComputerName: computerName,
+			Level:        e.Level,
+			Component:    e.Component,
+			Message:      e.Message,
+			Caller:       e.Caller,
+			ReceivedAt:   now,
+		}
+		if entry.Timestamp.IsZero() {
+			entry.Timestamp = now
+		}
+		if len(e.Fields) > 0 {
+			if data, err := json.Marshal(e.Fields); err == nil {
+				entry.Fields = string(data)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := db.InsertAgentLogs(ctx, entries); err != nil {
+		zapctx.Error(ctx, "Failed to save agent logs", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save logs"})
+		return
+	}
+
+	if req.Dropped > 0 {
+		zapctx.Warn(ctx, "Agent dropped log lines it could not ship",
+			zap.String("computer_name", computerName),
+			zap.Uint64("dropped", req.Dropped))
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "stored": len(entries)})
+}
+
+// getAgentLogsHandler lists shipped agent log lines, newest first.
+// Filters: computer_name, level, component, start_time and end_time (RFC3339), limit.
+func getAgentLogsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	filter := database.AgentLogFilter{
+		ComputerName: c.Query("computer_name"),
+		Level:        c.Query("level"),
+		Component:    c.Query("component"),
+		Limit:        defaultAgentLogsLimit,
+	}
+	for param, dst := range map[string]*time.Time{"start_time": &filter.From, "end_time": &filter.To} {
+		if s := c.Query(param); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " format"})
+				return
+			}
+			*dst = t
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		filter.Limit = min(limit, maxAgentLogsLimit)
+	}
+
+	entries, err := db.GetAgentLogs(ctx, filter)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get agent logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/release"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ========== Agent Update Handlers ==========
+
+var agentVersionPattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z.+_-]{0,63}$`)
+
+var agentPlatforms = map[string][]string{
+	"windows": {"amd64", "386", "arm64"},
+	"linux":   {"amd64", "arm64"},
+}
+
+func validAgentPlatform(goos, arch string) bool {
+	for _, a := range agentPlatforms[goos] {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// agentUpdateManifest tells an agent which build to install
+type agentUpdateManifest struct {
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Signature string `json:"signature"`
+	Channel   string `json:"channel"`
+	URL       string `json:"url"` // download path, relative to the server
+}
+
+// uploadAgentBuildHandler stores an agent binary and signs it
+func uploadAgentBuildHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if buildSigningKey == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Build signing is not configured (updates.signing_key_file)"})
+		return
+	}
+	if storageClient == nil {
+		zapctx.Error(ctx, "Storage client not initialized")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage service unavailable"})
+		return
+	}
+
+	version := strings.TrimSpace(c.PostForm("version"))
+	goos := strings.ToLower(c.PostForm("os"))
+	arch := strings.ToLower(c.PostForm("arch"))
+	if !agentVersionPattern.MatchString(version) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+	if !validAgentPlatform(goos, arch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported platform %s/%s", goos, arch)})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	maxSize := int64(cfg.Updates.MaxBuildMB) << 20
+	if file.Size > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File too large (max %dMB)", cfg.Updates.MaxBuildMB)})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		zapctx.Error(ctx, "Failed to open uploaded build", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process file"})
+		return
+	}
+	defer src.Close()
+
+	// Hash while spooling to disk so the upload to MinIO reads exactly what was signed
+	tmp, err := os.CreateTemp("", "agent-build-*")
+	if err != nil {
+		zapctx.Error(ctx, "Failed to create temp file for build", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process file"})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		zapctx.Error(ctx, "Failed to spool uploaded build", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process file"})
+		return
+	}
+	if size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+
+	build := database.AgentBuild{
+		Version:    version,
+		OS:         goos,
+		Arch:       arch,
+		SHA256:     hex.EncodeToString(hash.Sum(nil)),
+		Size:       size,
+		Notes:      c.PostForm("notes"),
+		UploadedBy: currentActor(ctx),
+	}
+	build.Signature = release.Sign(buildSigningKey, release.Build{
+		Version: build.Version, OS: build.OS, Arch: build.Arch, SHA256: build.SHA256, Size: build.Size,
+	})
+
+	build.ObjectName, err = storageClient.UploadAgentBuild(ctx, version, goos, arch, filepath.Base(file.Filename), tmp, size)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to upload agent build", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		return
+	}
+
+	if err := db.SaveAgentBuild(ctx, &build); err != nil {
+		zapctx.Error(ctx, "Failed to save agent build", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save build"})
+		return
+	}
+
+	zapctx.Info(ctx, "Agent build uploaded",
+		zap.String("version", version),
+		zap.String("os", goos),
+		zap.String("arch", arch),
+		zap.String("sha256", build.SHA256),
+		zap.Int64("size", size))
+	c.JSON(http.StatusCreated, build)
+}
+
+func getAgentBuildsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	builds, err := db.GetAgentBuilds(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent builds", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get agent builds"})
+		return
+	}
+	c.JSON(http.StatusOK, builds)
+}
+
+// getBuildPublicKeyHandler returns the key agents need in auto_update.public_key
+func getBuildPublicKeyHandler(c *gin.Context) {
+	if buildSigningKey == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build signing is not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "ed25519",
+		"public_key": release.PublicKeyString(buildSigningKey),
+	})
+}
+
+func getReleaseChannelsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	channels, err := db.GetReleaseChannels(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get release channels", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get release channels"})
+		return
+	}
+	c.JSON(http.StatusOK, channels)
+}
+
+// setReleaseChannelHandler points a channel at a version. Every platform
+// without a build of that version simply gets no update.
+func setReleaseChannelHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	channel := c.Param("channel")
+	if !release.ValidChannel(channel) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown channel"})
+		return
+	}
+
+	var req struct {
+		Version string `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Version != "" && !agentVersionPattern.MatchString(req.Version) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	if req.Version != "" {
+		builds, err := db.GetAgentBuilds(ctx)
+		if err != nil {
+			zapctx.Error(ctx, "Failed to get agent builds", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update release channel"})
+			return
+		}
+		found := false
+		for _, b := range builds {
+			if b.Version == req.Version {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No build uploaded for version " + req.Version})
+			return
+		}
+	}
+
+	ch := database.ReleaseChannel{Channel: channel, Version: req.Version, UpdatedBy: currentActor(ctx)}
+	if err := db.SaveReleaseChannel(ctx, &ch); err != nil {
+		zapctx.Error(ctx, "Failed to save release channel", zap.Error(err), zap.String("channel", channel))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update release channel"})
+		return
+	}
+
+	zapctx.Info(ctx, "Release channel updated", zap.String("channel", channel), zap.String("version", req.Version))
+	c.JSON(http.StatusOK, ch)
+}
+
+func getAgentGroupsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	groups, err := db.GetAgentGroups(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent groups", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get agent groups"})
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// saveAgentGroupHandler creates or replaces a group
+func saveAgentGroupHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group name is required"})
+		return
+	}
+
+	var req struct {
+		Channel   string   `json:"channel"`
+		Computers []string `json:"computer_names"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if !release.ValidChannel(req.Channel) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "channel must be stable or canary"})
+		return
+	}
+
+	group := database.AgentGroup{
+		Name:          name,
+		Channel:       req.Channel,
+		ComputerNames: release.NormalizeComputers(req.Computers),
+		UpdatedBy:     currentActor(ctx),
+	}
+	if err := db.SaveAgentGroup(ctx, &group); err != nil {
+		zapctx.Error(ctx, "Failed to save agent group", zap.Error(err), zap.String("group", name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save agent group"})
+		return
+	}
+
+	zapctx.Info(ctx, "Agent group saved",
+		zap.String("group", name),
+		zap.String("channel", group.Channel),
+		zap.Int("computers", len(group.ComputerNames)))
+	c.JSON(http.StatusOK, group)
+}
+
+func deleteAgentGroupHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := c.Param("name")
+
+	group := database.AgentGroup{Name: name, Channel: release.ChannelStable, IsDeleted: true, UpdatedBy: currentActor(ctx)}
+	if err := db.SaveAgentGroup(ctx, &group); err != nil {
+		zapctx.Error(ctx, "Failed to delete agent group", zap.Error(err), zap.String("group", name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete agent group"})
+		return
+	}
+
+	zapctx.Info(ctx, "Agent group deleted", zap.String("group", name))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func getAgentUpdateStatusesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	statuses, err := db.GetAgentUpdateStatuses(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent update statuses", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get update statuses"})
+		return
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
+// getAgentUpdateHandler serves the signed manifest of the build the calling
+// agent should run, or 204 when it is up to date or nothing is released
+func getAgentUpdateHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	computerName, ok := agentComputerName(c, c.Query("computer_name"))
+	if !ok {
+		return
+	}
+	goos, arch, current := c.Query("os"), c.Query("arch"), c.Query("version")
+	if !validAgentPlatform(goos, arch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "os and arch are required"})
+		return
+	}
+
+	groups, err := db.GetAgentGroups(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent groups", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for updates"})
+		return
+	}
+	channels, err := db.GetReleaseChannels(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get release channels", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for updates"})
+		return
+	}
+
+	relGroups := make([]release.Group, len(groups))
+	for i, g := range groups {
+		relGroups[i] = release.Group{Name: g.Name, Channel: g.Channel, Computers: g.ComputerNames}
+	}
+	channel := release.ChannelFor(computerName, relGroups)
+
+	versions := make(map[string]string, len(channels))
+	for _, ch := range channels {
+		versions[ch.Channel] = ch.Version
+	}
+	target := versions[channel]
+	if target == "" && channel == release.ChannelCanary {
+		// Canary follows stable until a canary version is set
+		target = versions[release.ChannelStable]
+	}
+	if target == "" || target == current {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	build, err := db.GetAgentBuild(ctx, target, goos, arch)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent build", zap.Error(err), zap.String("version", target))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for updates"})
+		return
+	}
+	if build == nil {
+		zapctx.Debug(ctx, "No build for agent platform",
+			zap.String("version", target), zap.String("os", goos), zap.String("arch", arch))
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	query := url.Values{"version": {build.Version}, "os": {build.OS}, "arch": {build.Arch}}
+	c.JSON(http.StatusOK, agentUpdateManifest{
+		Version:   build.Version,
+		OS:        build.OS,
+		Arch:      build.Arch,
+		SHA256:    build.SHA256,
+		Size:      build.Size,
+		Signature: build.Signature,
+		Channel:   channel,
+		URL:       "/api/agent/update/download?" + query.Encode(),
+	})
+}
+
+// downloadAgentBuildHandler streams a build binary from storage
+func downloadAgentBuildHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	build, err := db.GetAgentBuild(ctx, c.Query("version"), c.Query("os"), c.Query("arch"))
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent build", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get build"})
+		return
+	}
+	if build == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return
+	}
+	if storageClient == nil {
+		zapctx.Error(ctx, "Storage client not initialized")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage service unavailable"})
+		return
+	}
+
+	object, err := storageClient.GetObject(ctx, storageClient.AgentBuildsBucket(), build.ObjectName)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get agent build from storage", zap.Error(err), zap.String("object_name", build.ObjectName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get build"})
+		return
+	}
+	defer object.Close()
+
+	c.DataFromReader(http.StatusOK, build.Size, "application/octet-stream", object, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, filepath.Base(build.ObjectName)),
+	})
+}
+
+// reportAgentUpdateHandler records the outcome of an update on an agent
+func reportAgentUpdateHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		ComputerName string `json:"computer_name"`
+		FromVersion  string `json:"from_version"`
+		Version      string `json:"version" binding:"required"`
+		Status       string `json:"status" binding:"required"`
+		Error        string `json:"error"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version and status are required"})
+		return
+	}
+	switch req.Status {
+	case database.AgentUpdateInstalled, database.AgentUpdateConfirmed,
+		database.AgentUpdateRolledBack, database.AgentUpdateFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status"})
+		return
+	}
+
+	computerName, ok := agentComputerName(c, req.ComputerName)
+	if !ok {
+		return
+	}
+
+	status := database.AgentUpdateStatus{
+		ComputerName: computerName,
+		FromVersion:  req.FromVersion,
+		Version:      req.Version,
+		Status:       req.Status,
+		Error:        req.Error,
+	}
+	if err := db.SaveAgentUpdateStatus(ctx, status); err != nil {
+		zapctx.Error(ctx, "Failed to save agent update status", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save status"})
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("computer_name", computerName),
+		zap.String("from_version", req.FromVersion),
+		zap.String("version", req.Version),
+		zap.String("status", req.Status),
+	}
+	if req.Status == database.AgentUpdateRolledBack || req.Status == database.AgentUpdateFailed {
+		zapctx.Warn(ctx, "Agent update failed", append(fields, zap.String("error", req.Error))...)
+	} else {
+		zapctx.Info(ctx, "Agent update reported", fields...)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
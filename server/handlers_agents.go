@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// agentHeartbeatHandler registers an agent and refreshes its inventory and health.
+// Agents call it on startup and then periodically; the receive time is used as
+// the heartbeat time so agent clock skew does not affect the online status.
+func agentHeartbeatHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var hb database.AgentHeartbeat
+	if err := c.ShouldBindJSON(&hb); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid heartbeat"})
+		return
+	}
+
+	computerName, ok := agentComputerName(c, hb.ComputerName)
+	if !ok {
+		return
+	}
+	hb.ComputerName = computerName
+	hb.ReceivedAt = time.Now()
+
+	if err := db.InsertAgentHeartbeat(ctx, hb); err != nil {
+		zapctx.Error(ctx, "Failed to save agent heartbeat", zap.Error(err), zap.String("computer_name", computerName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save heartbeat"})
+		return
+	}
+
+	zapctx.Debug(ctx, "Agent heartbeat",
+		zap.String("computer_name", computerName),
+		zap.String("version", hb.AgentVersion),
+		zap.Uint32("buffer_size", hb.BufferSize),
+		zap.String("circuit_breaker", hb.CircuitBreaker),
+		zap.Uint8("throttle_level", hb.ThrottleLevel))
+	for _, m := range hb.MonitorStatus {
+		if m.State == "restarting" {
+			zapctx.Warn(ctx, "Agent monitor is restarting",
+				zap.String("computer_name", computerName),
+				zap.String("monitor", m.Name),
+				zap.Int("restarts", m.Restarts),
+				zap.String("last_error", m.LastError))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ctolnik/Office-Monitor/server/alerting"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ========== Alert Rules Handlers ==========
+
+type alertRuleRequest struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	RuleType        string `json:"rule_type"`
+	Severity        string `json:"severity"`
+	Enabled         *bool  `json:"enabled"`
+	CooldownMinutes int    `json:"cooldown_minutes"`
+	Params          any    `json:"params"` // JSON object or JSON-encoded string
+}
+
+func getAlertRulesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	rules, err := db.GetAlertRules(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get alert rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alert rules"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"rules":      rules,
+		"rule_types": alerting.RuleTypes,
+	})
+}
+
+func getAlertRuleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	rule, err := db.GetAlertRule(ctx, id)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get alert rule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alert rule"})
+		return
+	}
+	if rule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func createAlertRuleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req alertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zapctx.Warn(ctx, "Invalid alert rule request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	actor := currentActor(ctx)
+	rule := database.AlertRule{
+		Enabled:   true,
+		CreatedBy: actor,
+		UpdatedBy: actor,
+	}
+	if msg := applyAlertRuleRequest(&rule, req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := db.SaveAlertRule(ctx, &rule); err != nil {
+		zapctx.Error(ctx, "Failed to create alert rule", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert rule"})
+		return
+	}
+	alertEngine.Invalidate()
+
+	zapctx.Info(ctx, "Alert rule created", zap.String("id", rule.ID), zap.String("rule_type", rule.RuleType))
+	c.JSON(http.StatusCreated, rule)
+}
+
+func updateAlertRuleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	var req alertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zapctx.Warn(ctx, "Invalid alert rule request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	rule, err := db.GetAlertRule(ctx, id)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get alert rule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert rule"})
+		return
+	}
+	if rule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	if msg := applyAlertRuleRequest(rule, req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	rule.UpdatedBy = currentActor(ctx)
+
+	if err := db.SaveAlertRule(ctx, rule); err != nil {
+		zapctx.Error(ctx, "Failed to update alert rule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert rule"})
+		return
+	}
+	alertEngine.Invalidate()
+
+	zapctx.Info(ctx, "Alert rule updated", zap.String("id", id))
+	c.JSON(http.StatusOK, rule)
+}
+
+func deleteAlertRuleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	rule, err := db.GetAlertRule(ctx, id)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get alert rule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+	if rule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	rule.IsDeleted = true
+	rule.UpdatedBy = currentActor(ctx)
+	if err := db.SaveAlertRule(ctx, rule); err != nil {
+		zapctx.Error(ctx, "Failed to delete alert rule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+	alertEngine.Invalidate()
+
+	zapctx.Info(ctx, "Alert rule deleted", zap.String("id", id))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// applyAlertRuleRequest validates the request and copies it into the rule.
+// Returns a user-facing error message, or "" if the request is valid.
+func applyAlertRuleRequest(rule *database.AlertRule, req alertRuleRequest) string {
+	if strings.TrimSpace(req.Name) == "" {
+		return "name is required"
+	}
+	if !containsString(alerting.RuleTypes, req.RuleType) {
+		return "rule_type must be one of: " + strings.Join(alerting.RuleTypes, ", ")
+	}
+	if !containsString(alerting.Severities, req.Severity) {
+		return "severity must be one of: " + strings.Join(alerting.Severities, ", ")
+	}
+	if req.CooldownMinutes < 0 {
+		return "cooldown_minutes must not be negative"
+	}
+
+	params := "{}"
+	switch p := req.Params.(type) {
+	case nil:
+	case string:
+		if strings.TrimSpace(p) != "" {
+			params = p
+		}
+	default:
+		encoded, err := json.Marshal(p)
+		if err != nil {
+			return "params must be a JSON object"
+		}
+		params = string(encoded)
+	}
+	if _, err := alerting.ParseParams(req.RuleType, params); err != nil {
+		return err.Error()
+	}
+
+	rule.Name = strings.TrimSpace(req.Name)
+	rule.Description = req.Description
+	rule.RuleType = req.RuleType
+	rule.Severity = req.Severity
+	rule.CooldownMinutes = req.CooldownMinutes
+	rule.Params = params
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
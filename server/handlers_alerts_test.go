@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ctolnik/Office-Monitor/server/auth"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// fakeAlertStore keeps alerts in memory and records every saved state
+type fakeAlertStore struct {
+	alerts    map[string]*database.AlertFull
+	operators map[string]*database.OperatorUser
+	states    []database.AlertState
+	comments  []database.AlertComment
+}
+
+func (s *fakeAlertStore) GetAlert(ctx context.Context, id string) (*database.AlertFull, error) {
+	a, ok := s.alerts[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *a
+	return &copied, nil
+}
+
+func (s *fakeAlertStore) SaveAlertState(ctx context.Context, state database.AlertState) error {
+	s.states = append(s.states, state)
+	return nil
+}
+
+func (s *fakeAlertStore) AddAlertComment(ctx context.Context, comment *database.AlertComment) error {
+	comment.ID = "comment-1"
+	s.comments = append(s.comments, *comment)
+	return nil
+}
+
+func (s *fakeAlertStore) GetOperatorUser(ctx context.Context, username string) (*database.OperatorUser, error) {
+	return s.operators[username], nil
+}
+
+// alertTestRouter serves the alert workflow routes as the HR manager "hr.petrova"
+func alertTestRouter(t *testing.T, store *fakeAlertStore) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	prevStore := alertWorkflowStore
+	t.Cleanup(func() { alertWorkflowStore = prevStore })
+	alertWorkflowStore = func() alertStore { return store }
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := zapctx.WithLogger(c.Request.Context(), zap.NewNop())
+		ctx = auth.WithPrincipal(ctx, &auth.Principal{Username: "hr.petrova", Role: auth.RoleHRManager})
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.PUT("/alerts/:id/acknowledge", acknowledgeAlertHandler)
+	router.PUT("/alerts/:id/assign", assignAlertHandler)
+	router.PUT("/alerts/:id/resolve", resolveAlertHandler)
+	router.POST("/alerts/:id/comments", addAlertCommentHandler)
+	return router
+}
+
+func newAlertStore(status string) *fakeAlertStore {
+	return &fakeAlertStore{
+		alerts: map[string]*database.AlertFull{
+			"a1": {
+				ID:             "a1",
+				Status:         status,
+				IsResolved:     database.IsClosedAlertStatus(status),
+				IsAcknowledged: status != database.AlertStatusOpen,
+			},
+		},
+		operators: map[string]*database.OperatorUser{
+			"it.ivanov":  {Username: "it.ivanov", IsActive: true},
+			"ex.sidorov": {Username: "ex.sidorov", IsActive: false},
+		},
+	}
+}
+
+func doAlertRequest(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAlertStatusTransitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       string
+		path       string
+		body       string
+		wantCode   int
+		wantStatus string // saved status; empty when nothing may be saved
+	}{
+		{"acknowledge open", database.AlertStatusOpen, "/alerts/a1/acknowledge", "", http.StatusOK, database.AlertStatusAcknowledged},
+		{"acknowledge twice", database.AlertStatusAcknowledged, "/alerts/a1/acknowledge", "", http.StatusOK, ""},
+		{"acknowledge resolved", database.AlertStatusResolved, "/alerts/a1/acknowledge", "", http.StatusConflict, ""},
+		{"acknowledge false positive", database.AlertStatusFalsePositive, "/alerts/a1/acknowledge", "", http.StatusConflict, ""},
+		{"resolve open", database.AlertStatusOpen, "/alerts/a1/resolve", `{"notes":"checked"}`, http.StatusOK, database.AlertStatusResolved},
+		{"resolve acknowledged", database.AlertStatusAcknowledged, "/alerts/a1/resolve", `{}`, http.StatusOK, database.AlertStatusResolved},
+		{"false positive", database.AlertStatusOpen, "/alerts/a1/resolve", `{"false_positive":true}`, http.StatusOK, database.AlertStatusFalsePositive},
+		{"resolve resolved", database.AlertStatusResolved, "/alerts/a1/resolve", `{}`, http.StatusConflict, ""},
+		{"resolve false positive", database.AlertStatusFalsePositive, "/alerts/a1/resolve", `{}`, http.StatusConflict, ""},
+		{"unknown alert", database.AlertStatusOpen, "/alerts/missing/resolve", `{}`, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newAlertStore(tt.from)
+			w := doAlertRequest(alertTestRouter(t, store), http.MethodPut, tt.path, tt.body)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantStatus == "" {
+				if len(store.states) != 0 {
+					t.Fatalf("saved %+v, want no state change", store.states)
+				}
+				return
+			}
+			if len(store.states) != 1 {
+				t.Fatalf("saved %d states, want 1", len(store.states))
+			}
+			if got := store.states[0]; got.Status != tt.wantStatus || got.UpdatedBy != "hr.petrova" {
+				t.Errorf("saved status %q by %q, want %q by hr.petrova", got.Status, got.UpdatedBy, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAcknowledgeAlertAssignsActor(t *testing.T) {
+	store := newAlertStore(database.AlertStatusOpen)
+	w := doAlertRequest(alertTestRouter(t, store), http.MethodPut, "/alerts/a1/acknowledge", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", w.Code, w.Body.String())
+	}
+
+	var alert database.AlertFull
+	if err := json.Unmarshal(w.Body.Bytes(), &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Status != database.AlertStatusAcknowledged || !alert.IsAcknowledged || alert.IsResolved {
+		t.Errorf("alert = %q acknowledged=%v resolved=%v", alert.Status, alert.IsAcknowledged, alert.IsResolved)
+	}
+	if alert.AcknowledgedBy != "hr.petrova" || alert.Assignee != "hr.petrova" || alert.AcknowledgedAt == nil {
+		t.Errorf("acknowledged by %q at %v, assignee %q", alert.AcknowledgedBy, alert.AcknowledgedAt, alert.Assignee)
+	}
+}
+
+func TestResolveAlertIgnoresClientActor(t *testing.T) {
+	store := newAlertStore(database.AlertStatusOpen)
+	w := doAlertRequest(alertTestRouter(t, store), http.MethodPut, "/alerts/a1/resolve",
+		`{"notes":"printer driver","resolved_by":"someone.else"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d: %s", w.Code, w.Body.String())
+	}
+
+	got := store.states[0]
+	if got.ResolvedBy != "hr.petrova" || got.ResolvedAt == nil || got.ResolutionNotes != "printer driver" {
+		t.Errorf("resolved by %q at %v with %q", got.ResolvedBy, got.ResolvedAt, got.ResolutionNotes)
+	}
+}
+
+func TestAssignAlert(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"active operator", `{"assignee":"it.ivanov"}`, http.StatusOK},
+		{"unassign", `{"assignee":""}`, http.StatusOK},
+		{"inactive operator", `{"assignee":"ex.sidorov"}`, http.StatusBadRequest},
+		{"unknown operator", `{"assignee":"nobody"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newAlertStore(database.AlertStatusAcknowledged)
+			w := doAlertRequest(alertTestRouter(t, store), http.MethodPut, "/alerts/a1/assign", tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if saved := len(store.states) == 1; saved != (tt.wantCode == http.StatusOK) {
+				t.Fatalf("saved %d states", len(store.states))
+			}
+			if tt.wantCode == http.StatusOK && store.states[0].Status != database.AlertStatusAcknowledged {
+				t.Errorf("assigning changed status to %q", store.states[0].Status)
+			}
+		})
+	}
+}
+
+func TestAddAlertComment(t *testing.T) {
+	store := newAlertStore(database.AlertStatusOpen)
+	router := alertTestRouter(t, store)
+
+	if w := doAlertRequest(router, http.MethodPost, "/alerts/a1/comments", `{"text":"   "}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("blank comment: code = %d", w.Code)
+	}
+
+	w := doAlertRequest(router, http.MethodPost, "/alerts/a1/comments", `{"text":" called the user ","author":"someone.else"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("code = %d: %s", w.Code, w.Body.String())
+	}
+	if len(store.comments) != 1 {
+		t.Fatalf("stored %d comments, want 1", len(store.comments))
+	}
+	if got := store.comments[0]; got.AlertID != "a1" || got.Author != "hr.petrova" || got.Text != "called the user" {
+		t.Errorf("comment = %+v", got)
+	}
+	if len(store.states) != 0 {
+		t.Errorf("commenting changed the alert state: %+v", store.states)
+	}
+}
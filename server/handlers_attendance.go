@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/attendance"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/export"
+	"github.com/ctolnik/Office-Monitor/server/reports"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ========== Attendance Handlers ==========
+
+type workScheduleRequest struct {
+	WorkStart string `json:"work_start"`
+	WorkEnd   string `json:"work_end"`
+	WorkDays  []int  `json:"work_days"`
+}
+
+type holidayRequest struct {
+	Name    string `json:"name"`
+	Workday bool   `json:"workday"`
+}
+
+// parseTimesheetMonth reads ?month=YYYY-MM, by default the current month in
+// the app timezone. On error the response is already written.
+func parseTimesheetMonth(c *gin.Context) (time.Time, bool) {
+	now := time.Now().In(appLocation)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, appLocation)
+	if s := c.Query("month"); s != "" {
+		var err error
+		if month, err = time.ParseInLocation("2006-01", s, appLocation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format, use YYYY-MM"})
+			return time.Time{}, false
+		}
+	}
+	return month, true
+}
+
+// buildTimesheets derives the month of each employee against their schedule,
+// the company working hours and the holiday calendar
+func buildTimesheets(ctx context.Context, employees []database.AttendanceEmployee, month time.Time) ([]attendance.Timesheet, error) {
+	settings, err := db.GetSystemSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	overrides, err := db.GetWorkSchedules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get work schedules: %w", err)
+	}
+	period := reports.Period{Start: month, End: month.AddDate(0, 1, 0)}
+	holidays, err := db.GetHolidays(ctx, period.Start, period.End.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holidays: %w", err)
+	}
+
+	byOverride := make(map[string]*database.WorkSchedule, len(overrides))
+	for i := range overrides {
+		byOverride[overrides[i].Username] = &overrides[i]
+	}
+
+	company := attendance.DefaultSchedule(settings)
+	cal := attendance.NewCalendar(holidays)
+	opts := attendance.Options{MinBreak: attendance.MinBreak(settings), Now: time.Now()}
+
+	timesheets := make([]attendance.Timesheet, 0, len(employees))
+	for _, e := range employees {
+		// One query per employee keeps the memory bounded by the largest month
+		segments, err := db.GetAttendanceSegments(ctx, e.Username, period)
+		if err != nil {
+			return nil, err
+		}
+		schedule, custom := attendance.EmployeeSchedule(company, byOverride[e.Username])
+		timesheets = append(timesheets, attendance.Timesheet{
+			AttendanceEmployee: e,
+			Period:             month.Format("2006-01"),
+			Schedule:           schedule.Info(custom),
+			Month:              attendance.Build(month, segments, schedule, cal, opts),
+		})
+	}
+	return timesheets, nil
+}
+
+// getEmployeeTimesheetHandler returns an employee's monthly timesheet: each
+// day's arrival, departure, presence, breaks, late arrival, early departure
+// and overtime against the working schedule.
+// Query: month (YYYY-MM), format (json|csv|xlsx|pdf).
+func getEmployeeTimesheetHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+
+	format, ok := reportFormat(c)
+	if !ok {
+		return
+	}
+	month, ok := parseTimesheetMonth(c)
+	if !ok {
+		return
+	}
+
+	employee, err := db.GetAttendanceEmployee(ctx, username)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get employee", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate timesheet"})
+		return
+	}
+	if employee == nil {
+		employee = &database.AttendanceEmployee{Username: username}
+	}
+
+	timesheets, err := buildTimesheets(ctx, []database.AttendanceEmployee{*employee}, month)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to build timesheet", zap.Error(err),
+			zap.String("username", username),
+			zap.Time("month", month))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate timesheet"})
+		return
+	}
+	ts := &timesheets[0]
+
+	if format != export.JSON {
+		writeExport(c, format, export.Timesheet(ts, appLocation), "timesheet_"+username+"_"+ts.Period)
+		return
+	}
+	c.JSON(http.StatusOK, ts)
+}
+
+// getTimesheetsHandler returns the monthly timesheets of all active
+// employees, a department or a team, for payroll export.
+// Query: month (YYYY-MM), department, team, format (json|csv|xlsx|pdf).
+func getTimesheetsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	department, ok := groupDepartment(c, c.Query("department"))
+	if !ok {
+		return
+	}
+	filter := database.GroupFilter{Department: department, Team: c.Query("team")}
+
+	format, ok := reportFormat(c)
+	if !ok {
+		return
+	}
+	month, ok := parseTimesheetMonth(c)
+	if !ok {
+		return
+	}
+
+	employees, err := db.GetAttendanceEmployees(ctx, filter)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get employees", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate timesheet"})
+		return
+	}
+	timesheets, err := buildTimesheets(ctx, employees, month)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to build timesheets", zap.Error(err),
+			zap.String("department", filter.Department),
+			zap.String("team", filter.Team),
+			zap.Time("month", month))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate timesheet"})
+		return
+	}
+
+	if format != export.JSON {
+		name := strings.Trim(filter.Department+"_"+filter.Team, "_")
+		if name == "" {
+			name = "all"
+		}
+		doc := export.Timesheets(timesheets, filter.Department, filter.Team, month.Format("2006-01"))
+		writeExport(c, format, doc, "timesheet_"+name+"_"+month.Format("2006-01"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"month":      month.Format("2006-01"),
+		"department": filter.Department,
+		"team":       filter.Team,
+		"employees":  timesheets,
+	})
+}
+
+// getWorkSchedulesHandler returns the company working hours and the
+// per-employee overrides
+func getWorkSchedulesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	settings, err := db.GetSystemSettings(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get system settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get work schedules"})
+		return
+	}
+	schedules, err := db.GetWorkSchedules(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get work schedules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get work schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"default":   attendance.DefaultSchedule(settings).Info(false),
+		"schedules": schedules,
+	})
+}
+
+// saveWorkScheduleHandler sets an employee's working hours and days
+func saveWorkScheduleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+
+	var req workScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zapctx.Warn(ctx, "Invalid work schedule request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	s, err := attendance.NewSchedule(req.WorkStart, req.WorkEnd, req.WorkDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := database.WorkSchedule{
+		Username:  username,
+		WorkStart: attendance.FormatClock(s.Start),
+		WorkEnd:   attendance.FormatClock(s.End),
+		WorkDays:  s.WorkDays(),
+		UpdatedBy: currentActor(ctx),
+	}
+	if err := db.SaveWorkSchedule(ctx, &schedule); err != nil {
+		zapctx.Error(ctx, "Failed to save work schedule", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save work schedule"})
+		return
+	}
+
+	zapctx.Info(ctx, "Work schedule saved", zap.String("username", username))
+	c.JSON(http.StatusOK, schedule)
+}
+
+// deleteWorkScheduleHandler returns an employee to the company working hours
+func deleteWorkScheduleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+
+	schedule, err := db.GetWorkSchedule(ctx, username)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get work schedule", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete work schedule"})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Work schedule not found"})
+		return
+	}
+
+	schedule.IsDeleted = true
+	schedule.UpdatedBy = currentActor(ctx)
+	if err := db.SaveWorkSchedule(ctx, schedule); err != nil {
+		zapctx.Error(ctx, "Failed to delete work schedule", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete work schedule"})
+		return
+	}
+
+	zapctx.Info(ctx, "Work schedule deleted", zap.String("username", username))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// getHolidaysHandler returns the holiday calendar of a year.
+// Query: year (default the current year).
+func getHolidaysHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	year := time.Now().In(appLocation).Year()
+	if s := c.Query("year"); s != "" {
+		var err error
+		if year, err = strconv.Atoi(s); err != nil || year < 1970 || year > 9999 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+			return
+		}
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, appLocation)
+	holidays, err := db.GetHolidays(ctx, start, start.AddDate(1, 0, -1))
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get holidays", zap.Error(err), zap.Int("year", year))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get holidays"})
+		return
+	}
+	c.JSON(http.StatusOK, holidays)
+}
+
+// saveHolidayHandler marks a date as a holiday or, with workday, as a
+// working day transferred to a weekend
+func saveHolidayHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	date := c.Param("date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format, use YYYY-MM-DD"})
+		return
+	}
+
+	var req holidayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zapctx.Warn(ctx, "Invalid holiday request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	holiday := database.Holiday{
+		Date:      date,
+		Name:      strings.TrimSpace(req.Name),
+		Workday:   req.Workday,
+		UpdatedBy: currentActor(ctx),
+	}
+	if err := db.SaveHoliday(ctx, &holiday); err != nil {
+		zapctx.Error(ctx, "Failed to save holiday", zap.Error(err), zap.String("date", date))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save holiday"})
+		return
+	}
+
+	zapctx.Info(ctx, "Holiday saved", zap.String("date", date), zap.Bool("workday", holiday.Workday))
+	c.JSON(http.StatusOK, holiday)
+}
+
+// deleteHolidayHandler removes a date from the holiday calendar
+func deleteHolidayHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	date := c.Param("date")
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format, use YYYY-MM-DD"})
+		return
+	}
+
+	holidays, err := db.GetHolidays(ctx, day, day)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get holiday", zap.Error(err), zap.String("date", date))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete holiday"})
+		return
+	}
+	if len(holidays) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Holiday not found"})
+		return
+	}
+
+	holiday := holidays[0]
+	holiday.IsDeleted = true
+	holiday.UpdatedBy = currentActor(ctx)
+	if err := db.SaveHoliday(ctx, &holiday); err != nil {
+		zapctx.Error(ctx, "Failed to delete holiday", zap.Error(err), zap.String("date", date))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete holiday"})
+		return
+	}
+
+	zapctx.Info(ctx, "Holiday deleted", zap.String("date", date))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/auth"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ========== Auth Handlers ==========
+
+// loginHandler checks operator credentials and issues a session token.
+// The token is returned in the body and also set as an HttpOnly cookie.
+func loginHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		return
+	}
+
+	user, err := db.GetOperatorUser(ctx, req.Username)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to load operator", zap.Error(err), zap.String("username", req.Username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	if user == nil || !user.IsActive || auth.CheckPassword(user.PasswordHash, req.Password) != nil {
+		zapctx.Warn(ctx, "Failed login attempt",
+			zap.String("username", req.Username),
+			zap.String("remote_addr", c.ClientIP()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	principal := &auth.Principal{
+		Username:   user.Username,
+		FullName:   user.FullName,
+		Role:       user.Role,
+		Department: user.Department,
+	}
+	token, claims, err := sessions.Issue(principal)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to issue session token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookieName, token, int(sessions.TTL().Seconds()), "/", "", cfg.Auth.CookieSecure, true)
+
+	zapctx.Info(ctx, "Operator logged in", zap.String("username", user.Username), zap.String("role", user.Role))
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": time.Unix(claims.ExpiresAt, 0).Format(time.RFC3339),
+		"user":       principal,
+	})
+}
+
+// logoutHandler revokes the current session token and clears the cookie
+func logoutHandler(c *gin.Context) {
+	if v, ok := c.Get(sessionClaimsKey); ok {
+		sessions.Revoke(v.(*auth.Claims))
+	}
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookieName, "", -1, "/", "", cfg.Auth.CookieSecure, true)
+
+	zapctx.Info(c.Request.Context(), "Operator logged out")
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// meHandler returns the authenticated operator
+func meHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, auth.FromContext(c.Request.Context()))
+}
+
+// ========== Operators Management Handlers ==========
+
+type operatorRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	FullName   string `json:"full_name"`
+	Role       string `json:"role"`
+	Department string `json:"department"`
+}
+
+func getOperatorsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	users, err := db.ListOperatorUsers(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get operators", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get operators"})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func createOperatorHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req operatorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		return
+	}
+	if err := validateOperatorRole(req.Role, req.Department); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := db.GetOperatorUser(ctx, req.Username)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to check operator", zap.Error(err), zap.String("username", req.Username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create operator"})
+		return
+	}
+	if existing != nil && existing.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Operator already exists"})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create operator"})
+		return
+	}
+
+	actor := currentActor(ctx)
+	user := database.OperatorUser{
+		Username:     req.Username,
+		PasswordHash: hash,
+		FullName:     req.FullName,
+		Role:         req.Role,
+		Department:   req.Department,
+		IsActive:     true,
+		CreatedBy:    actor,
+		UpdatedBy:    actor,
+	}
+	if err := db.SaveOperatorUser(ctx, user); err != nil {
+		zapctx.Error(ctx, "Failed to create operator", zap.Error(err), zap.String("username", req.Username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create operator"})
+		return
+	}
+
+	zapctx.Info(ctx, "Operator created", zap.String("username", user.Username), zap.String("role", user.Role))
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "id": user.Username})
+}
+
+// updateOperatorHandler changes name, role, department and optionally the password.
+// Existing sessions of the operator are revoked.
+func updateOperatorHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+
+	var req operatorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, err := db.GetOperatorUser(ctx, username)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to load operator", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update operator"})
+		return
+	}
+	if user == nil || !user.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Operator not found"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = user.Role
+	}
+	if err := validateOperatorRole(req.Role, req.Department); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Password != "" {
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			zapctx.Error(ctx, "Failed to hash password", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update operator"})
+			return
+		}
+		user.PasswordHash = hash
+	}
+	user.FullName = req.FullName
+	user.Role = req.Role
+	user.Department = req.Department
+	user.UpdatedBy = currentActor(ctx)
+
+	if err := db.SaveOperatorUser(ctx, *user); err != nil {
+		zapctx.Error(ctx, "Failed to update operator", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update operator"})
+		return
+	}
+	sessions.RevokeSubject(username)
+
+	zapctx.Info(ctx, "Operator updated", zap.String("username", username), zap.String("role", user.Role))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// deleteOperatorHandler deactivates an operator and revokes its sessions
+func deleteOperatorHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+
+	if username == currentActor(ctx) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete yourself"})
+		return
+	}
+
+	user, err := db.GetOperatorUser(ctx, username)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to load operator", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete operator"})
+		return
+	}
+	if user == nil || !user.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Operator not found"})
+		return
+	}
+
+	user.IsActive = false
+	user.UpdatedBy = currentActor(ctx)
+	if err := db.SaveOperatorUser(ctx, *user); err != nil {
+		zapctx.Error(ctx, "Failed to delete operator", zap.Error(err), zap.String("username", username))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete operator"})
+		return
+	}
+	sessions.RevokeSubject(username)
+
+	zapctx.Info(ctx, "Operator deleted", zap.String("username", username))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func validateOperatorRole(role, department string) error {
+	if !auth.IsValidRole(role) {
+		return errors.New("role must be one of: admin, hr_manager, department_head")
+	}
+	if role == auth.RoleDepartmentHead && strings.TrimSpace(department) == "" {
+		return errors.New("department is required for department_head")
+	}
+	return nil
+}
+
+// ========== Auth Setup ==========
+
+// newSessionManager creates the session token manager from config
+func newSessionManager(ctx context.Context) (*auth.TokenManager, error) {
+	secret := []byte(cfg.Auth.JWTSecret)
+	if len(secret) == 0 {
+		zapctx.Warn(ctx, "auth.jwt_secret is not set, using a random secret (sessions will not survive restart)")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewTokenManager(secret, time.Duration(cfg.Auth.SessionTTLMinutes)*time.Minute), nil
+}
+
+// bootstrapAdmin creates the initial admin operator when no operators exist yet
+func bootstrapAdmin(ctx context.Context) error {
+	count, err := db.CountOperatorUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if cfg.Auth.BootstrapAdminPass == "" {
+		zapctx.Warn(ctx, "No operators exist and auth.bootstrap_admin_password is not set; only the API key can access the dashboard API")
+		return nil
+	}
+
+	hash, err := auth.HashPassword(cfg.Auth.BootstrapAdminPass)
+	if err != nil {
+		return err
+	}
+
+	err = db.SaveOperatorUser(ctx, database.OperatorUser{
+		Username:     cfg.Auth.BootstrapAdminUser,
+		PasswordHash: hash,
+		FullName:     "Administrator",
+		Role:         auth.RoleAdmin,
+		IsActive:     true,
+		CreatedBy:    "system",
+		UpdatedBy:    "system",
+	})
+	if err != nil {
+		return err
+	}
+
+	zapctx.Info(ctx, "Bootstrap admin operator created", zap.String("username", cfg.Auth.BootstrapAdminUser))
+	return nil
+}
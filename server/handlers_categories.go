@@ -57,10 +57,9 @@ func createAppCategoryHandler(c *gin.Context) {
 		return
 	}
 
-	// Set created_by and updated_by to "admin" for now
-	// TODO: Get from auth context when auth is implemented
-	cat.CreatedBy = "admin"
-	cat.UpdatedBy = "admin"
+	actor := currentActor(ctx)
+	cat.CreatedBy = actor
+	cat.UpdatedBy = actor
 
 	if err := db.CreateApplicationCategory(ctx, cat); err != nil {
 		zapctx.Error(ctx, "Failed to create category",
@@ -100,7 +99,7 @@ func updateAppCategoryHandler(c *gin.Context) {
 	}
 
 	// Set updated_by
-	cat.UpdatedBy = "admin" // TODO: Get from auth context
+	cat.UpdatedBy = currentActor(ctx)
 
 	if err := db.UpdateApplicationCategory(ctx, id, cat); err != nil {
 		zapctx.Error(ctx, "Failed to update category",
@@ -156,7 +155,7 @@ func bulkUpdateAppCategoriesHandler(c *gin.Context) {
 		return
 	}
 
-	updatedBy := "admin" // TODO: Get from auth context
+	updatedBy := currentActor(ctx)
 	count, err := db.BulkUpdateCategories(ctx, req.IDs, req.Category, updatedBy)
 	if err != nil {
 		zapctx.Error(ctx, "Failed to bulk update categories",
@@ -303,8 +302,6 @@ func importAppCategoriesHandler(c *gin.Context) {
 				ProcessName:    records[i][0],
 				ProcessPattern: records[i][1],
 				Category:       records[i][2],
-				CreatedBy:      "admin",
-				UpdatedBy:      "admin",
 			})
 		}
 	}
@@ -334,8 +331,8 @@ func importAppCategoriesHandler(c *gin.Context) {
 		}
 
 		// Set metadata
-		cat.CreatedBy = "admin"
-		cat.UpdatedBy = "admin"
+		cat.CreatedBy = currentActor(ctx)
+		cat.UpdatedBy = currentActor(ctx)
 
 		// Try to create
 		if err := db.CreateApplicationCategory(ctx, cat); err != nil {
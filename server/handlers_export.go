@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/export"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	maxLogoBytes     = 2 * 1024 * 1024 // same as the upload limit
+	logoFetchTimeout = 10 * time.Second
+)
+
+// reportFormat reads ?format= of a report endpoint; json is the default.
+// On error the response is already written.
+func reportFormat(c *gin.Context) (export.Format, bool) {
+	f, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Use 'json', 'csv', 'xlsx' or 'pdf'"})
+		return "", false
+	}
+	return f, true
+}
+
+// writeExport renders doc as a file download named name plus the format's
+// extension
+func writeExport(c *gin.Context, f export.Format, doc export.Document, name string) {
+	ctx := c.Request.Context()
+
+	var opts export.PDFOptions
+	if f == export.PDF {
+		opts = pdfOptions(ctx)
+	}
+
+	var buf bytes.Buffer
+	if err := export.Write(&buf, f, doc, opts); err != nil {
+		zapctx.Error(ctx, "Failed to export report", zap.Error(err),
+			zap.String("format", string(f)),
+			zap.String("file", name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export report"})
+		return
+	}
+
+	zapctx.Info(ctx, "Exporting report",
+		zap.String("format", string(f)),
+		zap.String("file", name),
+		zap.Int("size", buf.Len()))
+
+	filename := export.FileName(name) + "." + string(f)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, f.ContentType(), buf.Bytes())
+}
+
+// pdfOptions loads the company name and logo from system_settings. A
+// missing or unreadable logo leaves the PDF without one.
+func pdfOptions(ctx context.Context) export.PDFOptions {
+	opts := export.PDFOptions{
+		Font:     cfg.Reports.PDFFont,
+		BoldFont: cfg.Reports.PDFBoldFont,
+		Now:      time.Now().In(appLocation),
+	}
+
+	settings, err := db.GetSystemSettings(ctx)
+	if err != nil {
+		zapctx.Warn(ctx, "Failed to load settings for report export", zap.Error(err))
+		return opts
+	}
+	opts.CompanyName = settings["company_name"]
+
+	if logoURL := settings["company_logo_url"]; logoURL != "" {
+		logo, err := loadLogo(ctx, logoURL)
+		if err != nil {
+			zapctx.Warn(ctx, "Failed to load company logo for report export", zap.Error(err), zap.String("url", logoURL))
+		} else {
+			opts.Logo = logo
+		}
+	}
+	return opts
+}
+
+// loadLogo reads the logo saved by uploadLogoHandler: a local upload, an
+// object of the screenshots bucket (presigned or /storage/ URL, which may
+// have expired) or any other http(s) URL. SVG logos cannot be embedded.
+func loadLogo(ctx context.Context, logoURL string) (image.Image, error) {
+	u, err := url.Parse(logoURL)
+	if err != nil {
+		return nil, err
+	}
+	p := path.Clean("/" + u.Path)
+
+	var data []byte
+	switch {
+	case u.Host == "" && strings.HasPrefix(p, "/static/uploads/"):
+		data, err = os.ReadFile(filepath.Join("./web/static/uploads", filepath.FromSlash(strings.TrimPrefix(p, "/static/uploads/"))))
+	case storageClient != nil && (strings.HasPrefix(p, "/storage/") || strings.HasPrefix(p, "/"+storageClient.ScreenshotsBucket()+"/")):
+		bucket := storageClient.ScreenshotsBucket()
+		data, err = readObject(ctx, bucket, strings.TrimPrefix(strings.TrimPrefix(p, "/storage/"), "/"+bucket+"/"))
+	case u.Scheme == "http" || u.Scheme == "https":
+		data, err = fetchLogo(ctx, logoURL)
+	default:
+		return nil, fmt.Errorf("unsupported logo location")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo: %w", err)
+	}
+	return img, nil
+}
+
+func readObject(ctx context.Context, bucket, object string) ([]byte, error) {
+	obj, err := storageClient.GetObject(ctx, bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(io.LimitReader(obj, maxLogoBytes))
+}
+
+func fetchLogo(ctx context.Context, logoURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, logoFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("logo request returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxLogoBytes))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// healthHandler is the liveness probe: the process is up and serving HTTP
+func healthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyHandler is the readiness probe: ClickHouse and the MinIO buckets are reachable
+func readyHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+
+	if err := db.Ping(ctx); err != nil {
+		zapctx.Warn(ctx, "Readiness check failed: ClickHouse", zap.Error(err))
+		checks["clickhouse"] = err.Error()
+		ready = false
+	} else {
+		checks["clickhouse"] = "ok"
+	}
+
+	if err := st.Ping(ctx); err != nil {
+		zapctx.Warn(ctx, "Readiness check failed: MinIO", zap.Error(err))
+		checks["minio"] = err.Error()
+		ready = false
+	} else {
+		checks["minio"] = "ok"
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/notify"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ========== Notification Handlers ==========
+
+// getNotificationChannelsHandler lists the enabled notification channels (without secrets)
+func getNotificationChannelsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, notifier.Channels())
+}
+
+// testNotificationChannelHandler sends a sample alert to a channel and reports the result
+func testNotificationChannelHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	name := c.Param("name")
+
+	err := notifier.Test(ctx, name)
+	if errors.Is(err, notify.ErrUnknownChannel) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification channel not found or disabled"})
+		return
+	}
+	if err != nil {
+		zapctx.Warn(ctx, "Test notification failed", zap.Error(err), zap.String("channel", name))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Delivery failed: " + err.Error()})
+		return
+	}
+
+	zapctx.Info(ctx, "Test notification sent", zap.String("channel", name))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// getNotificationDeliveriesHandler returns the notification delivery log
+func getNotificationDeliveriesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	deliveries, err := db.GetNotificationDeliveries(ctx,
+		c.Query("alert_id"), c.Query("channel"), c.Query("status"),
+		pageSize, (page-1)*pageSize)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get notification deliveries", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notification deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
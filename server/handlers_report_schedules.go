@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/scheduler"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ========== Report Schedule Handlers ==========
+
+// reportRunTimeout bounds a manual run: report queries plus SMTP delivery
+const reportRunTimeout = 2 * time.Minute
+
+type reportScheduleRequest struct {
+	Name        string   `json:"name"`
+	Cron        string   `json:"cron"`
+	ReportType  string   `json:"report_type"`
+	Target      string   `json:"target"`
+	Department  string   `json:"department"`
+	Period      string   `json:"period"`
+	Granularity string   `json:"granularity"`
+	Recipients  []string `json:"recipients"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+func getReportSchedulesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	schedules, err := db.GetReportSchedules(ctx)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get report schedules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get report schedules"})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+func getReportScheduleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	schedule, err := db.GetReportSchedule(ctx, id)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get report schedule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get report schedule"})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func createReportScheduleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req reportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zapctx.Warn(ctx, "Invalid report schedule request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	actor := currentActor(ctx)
+	schedule := database.ReportSchedule{
+		Enabled:   true,
+		CreatedBy: actor,
+		UpdatedBy: actor,
+	}
+	if err := applyReportScheduleRequest(&schedule, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.SaveReportSchedule(ctx, &schedule); err != nil {
+		zapctx.Error(ctx, "Failed to create report schedule", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report schedule"})
+		return
+	}
+
+	zapctx.Info(ctx, "Report schedule created", zap.String("id", schedule.ID), zap.String("report_type", schedule.ReportType))
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func updateReportScheduleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	var req reportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zapctx.Warn(ctx, "Invalid report schedule request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	schedule, err := db.GetReportSchedule(ctx, id)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get report schedule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update report schedule"})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+
+	if err := applyReportScheduleRequest(schedule, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule.UpdatedBy = currentActor(ctx)
+
+	if err := db.SaveReportSchedule(ctx, schedule); err != nil {
+		zapctx.Error(ctx, "Failed to update report schedule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update report schedule"})
+		return
+	}
+
+	zapctx.Info(ctx, "Report schedule updated", zap.String("id", id))
+	c.JSON(http.StatusOK, schedule)
+}
+
+func deleteReportScheduleHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	schedule, err := db.GetReportSchedule(ctx, id)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get report schedule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete report schedule"})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+
+	schedule.IsDeleted = true
+	schedule.UpdatedBy = currentActor(ctx)
+	if err := db.SaveReportSchedule(ctx, schedule); err != nil {
+		zapctx.Error(ctx, "Failed to delete report schedule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete report schedule"})
+		return
+	}
+
+	zapctx.Info(ctx, "Report schedule deleted", zap.String("id", id))
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// runReportScheduleHandler generates and sends the report right away and
+// returns the run. A failed delivery is a recorded run, not an HTTP error.
+func runReportScheduleHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	// The run is recorded even if the client gives up waiting
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), reportRunTimeout)
+	defer cancel()
+
+	schedule, err := db.GetReportSchedule(ctx, id)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get report schedule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run report schedule"})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+
+	run, err := reportScheduler.RunNow(ctx, *schedule)
+	if errors.Is(err, scheduler.ErrRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Report schedule is already running"})
+		return
+	}
+	if err != nil {
+		zapctx.Error(ctx, "Failed to run report schedule", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run report schedule"})
+		return
+	}
+
+	zapctx.Info(ctx, "Report schedule run manually", zap.String("id", id), zap.String("status", run.Status))
+	c.JSON(http.StatusOK, run)
+}
+
+// getReportRunsHandler returns the run history of a schedule, newest first
+func getReportRunsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	runs, err := db.GetReportRuns(ctx, c.Param("id"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get report runs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get report runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// applyReportScheduleRequest validates the request and copies it into the
+// schedule. The error is user-facing.
+func applyReportScheduleRequest(schedule *database.ReportSchedule, req reportScheduleRequest) error {
+	updated := *schedule
+	updated.Name = req.Name
+	updated.Cron = req.Cron
+	updated.ReportType = req.ReportType
+	updated.Target = req.Target
+	updated.Department = req.Department
+	updated.Period = req.Period
+	updated.Granularity = req.Granularity
+	updated.Recipients = req.Recipients
+	if req.Enabled != nil {
+		updated.Enabled = *req.Enabled
+	}
+
+	if err := scheduler.Validate(&updated); err != nil {
+		return err
+	}
+	*schedule = updated
+	return nil
+}
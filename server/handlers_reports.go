@@ -0,0 +1,245 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/auth"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/export"
+	"github.com/ctolnik/Office-Monitor/server/reports"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxReportRangeDays caps a range report so a typo in the dates cannot scan years of segments
+const maxReportRangeDays = 366
+
+// parseReportDates reads from and to (YYYY-MM-DD, inclusive, in the app
+// timezone). to defaults to today, from to defaultFrom(to). On error the
+// response is already written.
+func parseReportDates(c *gin.Context, defaultFrom func(to time.Time) time.Time) (time.Time, time.Time, bool) {
+	to := time.Now().In(appLocation)
+	if s := c.Query("to"); s != "" {
+		var err error
+		if to, err = time.ParseInLocation("2006-01-02", s, appLocation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to format, use YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	from := defaultFrom(to)
+	if s := c.Query("from"); s != "" {
+		var err error
+		if from, err = time.ParseInLocation("2006-01-02", s, appLocation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from format, use YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// alignReportRange widens from..to to whole buckets and enforces the range limit
+func alignReportRange(c *gin.Context, g reports.Granularity, from, to time.Time) (reports.Period, bool) {
+	period := reports.Align(g, from, to)
+	if period.End.Sub(period.Start) > maxReportRangeDays*24*time.Hour+time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Report range is limited to one year"})
+		return reports.Period{}, false
+	}
+	return period, true
+}
+
+// parseReportRange reads from, to and granularity. Without from the range
+// covers the last 7 days, 4 weeks or 3 months up to to.
+// On error the response is already written.
+func parseReportRange(c *gin.Context) (reports.Granularity, reports.Period, bool) {
+	g, err := reports.ParseGranularity(c.Query("granularity"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", reports.Period{}, false
+	}
+
+	from, to, ok := parseReportDates(c, func(to time.Time) time.Time {
+		switch g {
+		case reports.Week:
+			return to.AddDate(0, 0, -27)
+		case reports.Month:
+			return to.AddDate(0, -2, 0)
+		}
+		return to.AddDate(0, 0, -6)
+	})
+	if !ok {
+		return "", reports.Period{}, false
+	}
+	period, ok := alignReportRange(c, g, from, to)
+	return g, period, ok
+}
+
+// getRangeReportHandler returns an employee's activity over several days in
+// day, week or month buckets with deltas against the previous period.
+// Query: from, to (YYYY-MM-DD, inclusive), granularity (day|week|month),
+// format (json|csv|xlsx|pdf).
+func getRangeReportHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	username := c.Param("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
+		return
+	}
+
+	format, ok := reportFormat(c)
+	if !ok {
+		return
+	}
+	g, period, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := db.GetRangeReport(ctx, username, g, period)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get range report", zap.Error(err),
+			zap.String("username", username),
+			zap.String("granularity", string(g)),
+			zap.Time("start", period.Start),
+			zap.Time("end", period.End))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate report"})
+		return
+	}
+
+	if format != export.JSON {
+		writeExport(c, format, export.Range(report, appLocation), export.PeriodFileName(username, period))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// parseGroupPeriod reads from and to of a department or team report,
+// by default the last 7 days
+func parseGroupPeriod(c *gin.Context) (reports.Period, bool) {
+	from, to, ok := parseReportDates(c, func(to time.Time) time.Time { return to.AddDate(0, 0, -6) })
+	if !ok {
+		return reports.Period{}, false
+	}
+	return alignReportRange(c, reports.Day, from, to)
+}
+
+// groupDepartment returns the department a group report is limited to.
+// Department heads always get their own; asking for another one is refused.
+// On error the response is already written.
+func groupDepartment(c *gin.Context, requested string) (string, bool) {
+	p := auth.FromContext(c.Request.Context())
+	if p == nil || !p.DepartmentScoped() {
+		return requested, true
+	}
+	if requested != "" && !p.CanViewDepartment(requested) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access to this department is not allowed"})
+		return "", false
+	}
+	return p.Department, true
+}
+
+// getDepartmentStatsHandler lists every department with headcount, online
+// employees, active time and productivity distribution.
+// Query: from, to (YYYY-MM-DD, inclusive).
+func getDepartmentStatsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	department, ok := groupDepartment(c, "")
+	if !ok {
+		return
+	}
+	period, ok := parseGroupPeriod(c)
+	if !ok {
+		return
+	}
+
+	stats, err := db.GetDepartmentStats(ctx, database.GroupFilter{Department: department}, period)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get department stats", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate report"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// getTeamStatsHandler lists the teams, optionally of one department.
+// Query: department, from, to.
+func getTeamStatsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	department, ok := groupDepartment(c, c.Query("department"))
+	if !ok {
+		return
+	}
+	period, ok := parseGroupPeriod(c)
+	if !ok {
+		return
+	}
+
+	stats, err := db.GetTeamStats(ctx, database.GroupFilter{Department: department}, period)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get team stats", zap.Error(err), zap.String("department", department))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate report"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// getDepartmentReportHandler returns the aggregate report of a department
+// with its category split, top applications and per-employee rows.
+// Query: from, to, format (json|csv|xlsx|pdf).
+func getDepartmentReportHandler(c *gin.Context) {
+	department, ok := groupDepartment(c, c.Param("department"))
+	if !ok {
+		return
+	}
+	writeGroupReport(c, database.GroupFilter{Department: department})
+}
+
+// getTeamReportHandler returns the aggregate report of a team.
+// Query: department (for team names used in several departments), from, to,
+// format.
+func getTeamReportHandler(c *gin.Context) {
+	department, ok := groupDepartment(c, c.Query("department"))
+	if !ok {
+		return
+	}
+	writeGroupReport(c, database.GroupFilter{Department: department, Team: c.Param("team")})
+}
+
+func writeGroupReport(c *gin.Context, filter database.GroupFilter) {
+	ctx := c.Request.Context()
+	format, ok := reportFormat(c)
+	if !ok {
+		return
+	}
+	period, ok := parseGroupPeriod(c)
+	if !ok {
+		return
+	}
+
+	report, err := db.GetGroupReport(ctx, filter, period)
+	if err != nil {
+		zapctx.Error(ctx, "Failed to get group report", zap.Error(err),
+			zap.String("department", filter.Department),
+			zap.String("team", filter.Team))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate report"})
+		return
+	}
+
+	if format != export.JSON {
+		name := strings.Trim(filter.Department+"_"+filter.Team, "_")
+		if name == "" {
+			name = "all"
+		}
+		writeExport(c, format, export.Group(report, appLocation), export.PeriodFileName(name, period))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
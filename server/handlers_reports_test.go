@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctolnik/Office-Monitor/server/auth"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGroupDepartment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	head := &auth.Principal{Username: "head", Role: auth.RoleDepartmentHead, Department: "Sales"}
+	hr := &auth.Principal{Username: "hr", Role: auth.RoleHRManager}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		requested string
+		want      string
+		status    int
+	}{
+		{"hr sees every department", hr, "", "", http.StatusOK},
+		{"hr picks a department", hr, "IT", "IT", http.StatusOK},
+		{"head is limited to own department", head, "", "Sales", http.StatusOK},
+		{"head asks for own department", head, "Sales", "Sales", http.StatusOK},
+		{"head asks for another department", head, "IT", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			req := httptest.NewRequest(http.MethodGet, "/reports/departments", nil)
+			c.Request = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+
+			got, ok := groupDepartment(c, tt.requested)
+			if ok != (tt.status == http.StatusOK) || w.Code != tt.status {
+				t.Fatalf("ok = %v, status = %d, want %d", ok, w.Code, tt.status)
+			}
+			if got != tt.want {
+				t.Errorf("department = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
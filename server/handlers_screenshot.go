@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/ctolnik/Office-Monitor/server/auth"
 	"github.com/ctolnik/Office-Monitor/zapctx"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -19,6 +20,23 @@ func getScreenshotHandler(c *gin.Context) {
 		return
 	}
 
+	// Department heads may only open screenshots of their department
+	if p := auth.FromContext(ctx); p != nil && p.DepartmentScoped() {
+		owner, err := db.GetScreenshotOwner(ctx, screenshotID)
+		if err != nil {
+			zapctx.Error(ctx, "Failed to get screenshot owner", zap.Error(err), zap.String("screenshot_id", screenshotID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get screenshot"})
+			return
+		}
+		if owner == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Screenshot not found"})
+			return
+		}
+		if !authorizeEmployee(c, owner) {
+			return
+		}
+	}
+
 	if storageClient == nil {
 		zapctx.Error(ctx, "Storage client not initialized")
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage service unavailable"})
@@ -53,7 +71,7 @@ func getScreenshotHandler(c *gin.Context) {
 	// Set headers
 	c.Header("Content-Type", "image/jpeg")
 	c.Header("Content-Length", fmt.Sprintf("%d", stat.Size))
-	c.Header("Cache-Control", "public, max-age=86400") // Cache for 1 day
+	c.Header("Cache-Control", "private, max-age=86400") // Cache for 1 day, browser only (authenticated content)
 
 	// Stream the file
 	c.DataFromReader(http.StatusOK, stat.Size, "image/jpeg", object, nil)
@@ -79,7 +79,7 @@ func updateGeneralSettingsHandler(c *gin.Context) {
 		}
 	}
 
-	updatedBy := "admin" // TODO: Get from auth context
+	updatedBy := currentActor(ctx)
 	if err := db.UpdateMultipleSettings(ctx, settings, updatedBy); err != nil {
 		zapctx.Error(ctx, "Failed to update settings", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
@@ -92,6 +92,9 @@ func updateGeneralSettingsHandler(c *gin.Context) {
 		zapctx.Debug(ctx, "Dashboard cache invalidated after settings update")
 	}
 
+	// alert_on_* and productivity_threshold are read by the alert engine
+	alertEngine.Invalidate()
+
 	zapctx.Info(ctx, "System settings updated",
 		zap.Int("count", len(settings)),
 		zap.String("updated_by", updatedBy))
@@ -165,7 +168,7 @@ func uploadLogoHandler(c *gin.Context) {
 		}
 
 		// Update company_logo_url setting
-		updatedBy := "admin" // TODO: Get from auth context
+		updatedBy := currentActor(ctx)
 		if err := db.UpdateSystemSetting(ctx, "company_logo_url", logoURL, updatedBy); err != nil {
 			zapctx.Error(ctx, "Failed to update logo URL setting", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save logo URL"})
@@ -194,7 +197,7 @@ func uploadLogoHandler(c *gin.Context) {
 	logoURL := "/static/uploads/" + filename
 
 	// Update setting
-	updatedBy := "admin"
+	updatedBy := currentActor(ctx)
 	if err := db.UpdateSystemSetting(ctx, "company_logo_url", logoURL, updatedBy); err != nil {
 		zapctx.Error(ctx, "Failed to update logo URL setting", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save logo URL"})
@@ -0,0 +1,310 @@
+// Package ingest coalesces agent events from many requests into batched
+// ClickHouse inserts. Requests wait until their events are stored, so a
+// successful response still means the data is durable, and they are held
+// back (backpressure) when too many rows are queued or in flight.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+// ErrBackpressure is returned by Enqueue when no queue space freed up in time
+var ErrBackpressure = errors.New("ingest queue is full")
+
+// ErrClosed is returned by Enqueue after the queue stopped
+var ErrClosed = errors.New("ingest queue is closed")
+
+// Store writes batches to ClickHouse
+type Store interface {
+	InsertActivityEventsBatch(ctx context.Context, events []database.ActivityEvent) error
+	InsertKeyboardEventsBatch(ctx context.Context, events []database.KeyboardEvent) error
+	InsertUSBEventsBatch(ctx context.Context, events []database.USBEvent) error
+	InsertFileCopyEventsBatch(ctx context.Context, events []database.FileCopyEvent) error
+	InsertActivitySegmentsBatch(ctx context.Context, segments []database.ActivitySegment) error
+	InsertIngestedEventsBatch(ctx context.Context, events []database.IngestedEvent) error
+}
+
+// Batch holds events grouped by table
+type Batch struct {
+	Activity []database.ActivityEvent
+	Keyboard []database.KeyboardEvent
+	USB      []database.USBEvent
+	Files    []database.FileCopyEvent
+	Segments []database.ActivitySegment
+
+	// EventIDs are recorded once the rows of their event type are stored
+	EventIDs []database.IngestedEvent
+}
+
+// Len returns the number of event rows in the batch
+func (b *Batch) Len() int {
+	return len(b.Activity) + len(b.Keyboard) + len(b.USB) + len(b.Files) + len(b.Segments)
+}
+
+// Event types, also used as the metric and error labels
+const (
+	TypeActivity = "activity"
+	TypeKeyboard = "keyboard"
+	TypeUSB      = "usb"
+	TypeFile     = "file"
+	TypeSegment  = "segment"
+)
+
+// types returns the event types present in the batch
+func (b *Batch) types() map[string]bool {
+	t := make(map[string]bool)
+	if len(b.Activity) > 0 {
+		t[TypeActivity] = true
+	}
+	if len(b.Keyboard) > 0 {
+		t[TypeKeyboard] = true
+	}
+	if len(b.USB) > 0 {
+		t[TypeUSB] = true
+	}
+	if len(b.Files) > 0 {
+		t[TypeFile] = true
+	}
+	if len(b.Segments) > 0 {
+		t[TypeSegment] = true
+	}
+	return t
+}
+
+func (b *Batch) append(o *Batch) {
+	b.Activity = append(b.Activity, o.Activity...)
+	b.Keyboard = append(b.Keyboard, o.Keyboard...)
+	b.USB = append(b.USB, o.USB...)
+	b.Files = append(b.Files, o.Files...)
+	b.Segments = append(b.Segments, o.Segments...)
+	b.EventIDs = append(b.EventIDs, o.EventIDs...)
+}
+
+// waiter is a request waiting for its rows to be written
+type waiter struct {
+	result chan error
+	types  map[string]bool
+}
+
+// Options configures a Queue
+type Options struct {
+	BatchSize      int           // flush when this many rows are queued
+	FlushInterval  time.Duration // flush at least this often
+	MaxPendingRows int           // queued plus in-flight rows before Enqueue blocks
+	EnqueueTimeout time.Duration // how long Enqueue waits for space
+	FlushTimeout   time.Duration // deadline of one flush
+
+	// OnFlush is called after every insert with the event type, row count and result
+	OnFlush func(eventType string, rows int, d time.Duration, err error)
+}
+
+// Queue coalesces batches and flushes them on size or time
+type Queue struct {
+	store Store
+	opts  Options
+
+	mu      sync.Mutex
+	cur     Batch
+	waiters []waiter
+	rows    int           // queued plus in-flight rows
+	freed   chan struct{} // closed when a flush completes
+	closed  bool
+
+	kick chan struct{}
+	done chan struct{}
+}
+
+// New creates a queue; call Run to start flushing
+func New(store Store, opts Options) *Queue {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 5000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxPendingRows < opts.BatchSize {
+		opts.MaxPendingRows = 20 * opts.BatchSize
+	}
+	if opts.EnqueueTimeout <= 0 {
+		opts.EnqueueTimeout = 10 * time.Second
+	}
+	if opts.FlushTimeout <= 0 {
+		opts.FlushTimeout = 30 * time.Second
+	}
+	return &Queue{
+		store: store,
+		opts:  opts,
+		freed: make(chan struct{}),
+		kick:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// Pending returns the number of queued and in-flight rows
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rows
+}
+
+// Enqueue adds the batch to the queue and waits until it has been written.
+// It returns ErrBackpressure if the queue stays full for EnqueueTimeout.
+func (q *Queue) Enqueue(ctx context.Context, b Batch) error {
+	n := b.Len()
+	if n == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(q.opts.EnqueueTimeout)
+	defer timer.Stop()
+
+	result := make(chan error, 1)
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return ErrClosed
+		}
+		// An oversized batch is accepted into an empty queue so it cannot block forever
+		if q.rows+n <= q.opts.MaxPendingRows || q.rows == 0 {
+			q.cur.append(&b)
+			q.waiters = append(q.waiters, waiter{result: result, types: b.types()})
+			q.rows += n
+			full := q.cur.Len() >= q.opts.BatchSize
+			q.mu.Unlock()
+
+			if full {
+				select {
+				case q.kick <- struct{}{}:
+				default:
+				}
+			}
+			break
+		}
+		freed := q.freed
+		q.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-timer.C:
+			return ErrBackpressure
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		// The rows stay queued and are still written
+		return ctx.Err()
+	}
+}
+
+// Run flushes on size or interval until ctx is cancelled, then flushes what is left
+func (q *Queue) Run(ctx context.Context) {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.closed = true
+			q.mu.Unlock()
+			q.flush(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			q.flush(ctx)
+		case <-q.kick:
+			q.flush(ctx)
+		}
+	}
+}
+
+// Done is closed when Run has returned
+func (q *Queue) Done() <-chan struct{} {
+	return q.done
+}
+
+// flush writes everything queued so far, one insert per table
+func (q *Queue) flush(ctx context.Context) {
+	q.mu.Lock()
+	b := q.cur
+	waiters := q.waiters
+	q.cur = Batch{}
+	q.waiters = nil
+	q.mu.Unlock()
+
+	n := b.Len()
+	if n == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.opts.FlushTimeout)
+	defer cancel()
+
+	errs := make(map[string]error)
+	insert := func(eventType string, rows int, fn func() error) {
+		if rows == 0 {
+			return
+		}
+		start := time.Now()
+		err := fn()
+		if q.opts.OnFlush != nil {
+			q.opts.OnFlush(eventType, rows, time.Since(start), err)
+		}
+		if err != nil {
+			zapctx.Error(ctx, "Failed to flush events", zap.String("type", eventType), zap.Int("rows", rows), zap.Error(err))
+			errs[eventType] = fmt.Errorf("%s: %w", eventType, err)
+		}
+	}
+
+	insert(TypeActivity, len(b.Activity), func() error { return q.store.InsertActivityEventsBatch(ctx, b.Activity) })
+	insert(TypeKeyboard, len(b.Keyboard), func() error { return q.store.InsertKeyboardEventsBatch(ctx, b.Keyboard) })
+	insert(TypeUSB, len(b.USB), func() error { return q.store.InsertUSBEventsBatch(ctx, b.USB) })
+	insert(TypeFile, len(b.Files), func() error { return q.store.InsertFileCopyEventsBatch(ctx, b.Files) })
+	insert(TypeSegment, len(b.Segments), func() error { return q.store.InsertActivitySegmentsBatch(ctx, b.Segments) })
+
+	// Only IDs of stored events are recorded, so a failed type is accepted again on retry
+	ids := make([]database.IngestedEvent, 0, len(b.EventIDs))
+	for _, e := range b.EventIDs {
+		if errs[e.EventType] == nil {
+			ids = append(ids, e)
+		}
+	}
+	if len(ids) > 0 {
+		if err := q.store.InsertIngestedEventsBatch(ctx, ids); err != nil {
+			// The events are stored; a retry may produce duplicates but nothing is lost
+			zapctx.Warn(ctx, "Failed to record event IDs", zap.Int("rows", len(ids)), zap.Error(err))
+		}
+	}
+
+	q.mu.Lock()
+	q.rows -= n
+	close(q.freed)
+	q.freed = make(chan struct{})
+	q.mu.Unlock()
+
+	// Each request only sees the errors of the tables it wrote to
+	for _, w := range waiters {
+		var werrs []error
+		for eventType, err := range errs {
+			if w.types[eventType] {
+				werrs = append(werrs, err)
+			}
+		}
+		w.result <- errors.Join(werrs...)
+	}
+}
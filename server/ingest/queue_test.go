@@ -0,0 +1,194 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	calls    map[string][]int // rows per insert call, by type
+	fail     map[string]error
+	blockUSB chan struct{}
+	ids      []database.IngestedEvent
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{calls: make(map[string][]int), fail: make(map[string]error)}
+}
+
+func (f *fakeStore) record(eventType string, rows int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[eventType] = append(f.calls[eventType], rows)
+	return f.fail[eventType]
+}
+
+func (f *fakeStore) InsertActivityEventsBatch(ctx context.Context, events []database.ActivityEvent) error {
+	return f.record(TypeActivity, len(events))
+}
+
+func (f *fakeStore) InsertKeyboardEventsBatch(ctx context.Context, events []database.KeyboardEvent) error {
+	return f.record(TypeKeyboard, len(events))
+}
+
+func (f *fakeStore) InsertUSBEventsBatch(ctx context.Context, events []database.USBEvent) error {
+	if f.blockUSB != nil {
+		<-f.blockUSB
+	}
+	return f.record(TypeUSB, len(events))
+}
+
+func (f *fakeStore) InsertFileCopyEventsBatch(ctx context.Context, events []database.FileCopyEvent) error {
+	return f.record(TypeFile, len(events))
+}
+
+func (f *fakeStore) InsertActivitySegmentsBatch(ctx context.Context, segments []database.ActivitySegment) error {
+	return f.record(TypeSegment, len(segments))
+}
+
+func (f *fakeStore) InsertIngestedEventsBatch(ctx context.Context, events []database.IngestedEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ids = append(f.ids, events...)
+	return nil
+}
+
+func testContext() context.Context {
+	return zapctx.WithLogger(context.Background(), zap.NewNop())
+}
+
+func segments(n int) []database.ActivitySegment {
+	return make([]database.ActivitySegment, n)
+}
+
+func TestQueueCoalescesRequests(t *testing.T) {
+	store := newFakeStore()
+	q := New(store, Options{BatchSize: 10, FlushInterval: time.Hour})
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+	go q.Run(ctx)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = q.Enqueue(ctx, Batch{Segments: segments(2)})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.calls[TypeSegment]; len(got) != 1 || got[0] != 10 {
+		t.Fatalf("expected one insert of 10 rows, got %v", got)
+	}
+	if q.Pending() != 0 {
+		t.Fatalf("expected empty queue, %d pending", q.Pending())
+	}
+}
+
+func TestQueueFlushesOnInterval(t *testing.T) {
+	store := newFakeStore()
+	q := New(store, Options{BatchSize: 1000, FlushInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+	go q.Run(ctx)
+
+	if err := q.Enqueue(ctx, Batch{Keyboard: make([]database.KeyboardEvent, 3)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.calls[TypeKeyboard]; len(got) != 1 || got[0] != 3 {
+		t.Fatalf("unexpected inserts: %v", got)
+	}
+}
+
+func TestQueueReportsErrorsPerType(t *testing.T) {
+	store := newFakeStore()
+	store.fail[TypeFile] = errors.New("table is read-only")
+
+	var flushed []string
+	q := New(store, Options{BatchSize: 1000, FlushInterval: time.Hour, OnFlush: func(eventType string, rows int, d time.Duration, err error) {
+		if err != nil {
+			flushed = append(flushed, eventType)
+		}
+	}})
+	ctx := testContext()
+
+	fileErr := make(chan error, 1)
+	go func() {
+		fileErr <- q.Enqueue(ctx, Batch{
+			Files:    make([]database.FileCopyEvent, 1),
+			EventIDs: []database.IngestedEvent{{EventID: "f1", EventType: TypeFile}},
+		})
+	}()
+	usbErr := make(chan error, 1)
+	go func() {
+		usbErr <- q.Enqueue(ctx, Batch{
+			USB:      make([]database.USBEvent, 1),
+			EventIDs: []database.IngestedEvent{{EventID: "u1", EventType: TypeUSB}},
+		})
+	}()
+
+	for q.Pending() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	q.flush(ctx)
+
+	if err := <-fileErr; err == nil {
+		t.Fatal("file request must see the file insert error")
+	}
+	if err := <-usbErr; err != nil {
+		t.Fatalf("usb request must not see other tables' errors: %v", err)
+	}
+	if len(flushed) != 1 || flushed[0] != TypeFile {
+		t.Fatalf("unexpected OnFlush failures: %v", flushed)
+	}
+	if len(store.ids) != 1 || store.ids[0].EventID != "u1" {
+		t.Fatalf("only IDs of stored events may be recorded: %+v", store.ids)
+	}
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	store := newFakeStore()
+	store.blockUSB = make(chan struct{})
+	q := New(store, Options{BatchSize: 2, MaxPendingRows: 2, FlushInterval: time.Hour, EnqueueTimeout: 20 * time.Millisecond})
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+	go q.Run(ctx)
+
+	// Fills the queue; the flush is stuck in the USB insert
+	first := make(chan error, 1)
+	go func() { first <- q.Enqueue(ctx, Batch{USB: make([]database.USBEvent, 2)}) }()
+	for q.Pending() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := q.Enqueue(ctx, Batch{Segments: segments(1)}); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("expected backpressure, got %v", err)
+	}
+
+	close(store.blockUSB)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+
+	// Space is free again
+	done := make(chan error, 1)
+	go func() { done <- q.Enqueue(ctx, Batch{Segments: segments(2)}) }()
+	if err := <-done; err != nil {
+		t.Fatalf("expected enqueue after flush to succeed: %v", err)
+	}
+}
@@ -2,14 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/ctolnik/Office-Monitor/server/alerting"
+	"github.com/ctolnik/Office-Monitor/server/auth"
 	"github.com/ctolnik/Office-Monitor/server/config"
 	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/dedup"
+	"github.com/ctolnik/Office-Monitor/server/ingest"
+	"github.com/ctolnik/Office-Monitor/server/notify"
+	"github.com/ctolnik/Office-Monitor/server/release"
+	"github.com/ctolnik/Office-Monitor/server/scheduler"
 	"github.com/ctolnik/Office-Monitor/server/storage"
 	"github.com/ctolnik/Office-Monitor/zapctx"
 
@@ -18,6 +30,9 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// shutdownTimeout bounds finishing the requests in flight on shutdown
+const shutdownTimeout = 30 * time.Second
+
 var (
 	db            *database.Database
 	st            *storage.Storage
@@ -25,7 +40,17 @@ var (
 	storageClient *storage.Storage
 	appLocation   *time.Location
 	dashCache     *DashboardCache
+	agentKeys     *agentKeyCache
+	sessions      *auth.TokenManager
+	alertEngine   *alerting.Engine
+	notifier      *notify.Notifier
+	ingestQueue   *ingest.Queue
+	deduper       *dedup.Deduper
 	logger        *zap.Logger
+	// buildSigningKey signs uploaded agent builds; nil disables uploads
+	buildSigningKey ed25519.PrivateKey
+	// reportScheduler mails the scheduled report digests
+	reportScheduler *scheduler.Scheduler
 )
 
 func main() {
@@ -60,6 +85,7 @@ func main() {
 
 	// Initialize cache with 30 second TTL
 	dashCache = NewDashboardCache(30 * time.Second)
+	agentKeys = newAgentKeyCache(time.Duration(cfg.Security.AgentKeyCacheSeconds) * time.Second)
 
 	// Create context with logger for database initialization
 	ctx := zapctx.WithLogger(context.Background(), logger)
@@ -89,6 +115,7 @@ func main() {
 		cfg.Storage.UseSSL,
 		cfg.Storage.Buckets.Screenshots,
 		cfg.Storage.Buckets.USBCopies,
+		cfg.Storage.Buckets.AgentBuilds,
 		cfg.Storage.PublicEndpoint,
 	)
 	if err != nil {
@@ -96,6 +123,56 @@ func main() {
 	}
 	storageClient = st
 
+	ingestQueue = ingest.New(db, ingest.Options{
+		BatchSize:      cfg.Ingest.BatchSize,
+		FlushInterval:  time.Duration(cfg.Ingest.FlushIntervalMS) * time.Millisecond,
+		MaxPendingRows: cfg.Ingest.MaxPendingRows,
+		EnqueueTimeout: time.Duration(cfg.Ingest.EnqueueTimeoutSeconds) * time.Second,
+		FlushTimeout:   time.Duration(cfg.Ingest.FlushTimeoutSeconds) * time.Second,
+		OnFlush:        observeFlush,
+	})
+	// The queue gets its own context: it is cancelled after the HTTP server
+	// stopped, so the rows of the last accepted requests are still written
+	queueCtx, stopQueue := context.WithCancel(ctx)
+	defer stopQueue()
+	go ingestQueue.Run(queueCtx)
+
+	deduper = dedup.New(db, 10*time.Minute)
+	go deduper.Run(ctx, time.Minute)
+
+	sessions, err = newSessionManager(ctx)
+	if err != nil {
+		logger.Fatal("Failed to initialize sessions", zap.Error(err))
+	}
+	if err := bootstrapAdmin(ctx); err != nil {
+		logger.Warn("Failed to bootstrap admin operator", zap.Error(err))
+	}
+
+	notifier, err = notify.FromConfig(cfg.Alerts.Notifications, cfg.SMTP, db)
+	if err != nil {
+		logger.Fatal("Invalid alert notification config", zap.Error(err))
+	}
+	go notifier.Run(ctx)
+
+	alertEngine = alerting.NewEngine(db, appLocation)
+	alertEngine.SetNotifier(notifier)
+	if err := alertEngine.Reload(ctx); err != nil {
+		logger.Warn("Failed to load alert rules", zap.Error(err))
+	}
+	go alertEngine.Run(ctx, time.Minute)
+
+	reportScheduler = scheduler.New(db, func(ctx context.Context, m notify.Mail) error {
+		return notify.SendMail(ctx, cfg.SMTP, m)
+	}, cfg.SMTP.From, appLocation)
+	go reportScheduler.Run(ctx, time.Minute)
+
+	if cfg.Updates.SigningKeyFile != "" {
+		buildSigningKey, err = release.LoadPrivateKey(cfg.Updates.SigningKeyFile)
+		if err != nil {
+			logger.Fatal("Failed to load agent build signing key", zap.Error(err))
+		}
+	}
+
 	if cfg.Server.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -104,91 +181,210 @@ func main() {
 
 	// Add logger middleware to all routes
 	router.Use(loggerMiddleware(logger))
+	router.Use(metricsMiddleware())
 
 	router.LoadHTMLGlob("web/templates/*")
 	router.Static("/static", "web/static")
 
 	router.GET("/", indexHandler)
 
+	// Probes and metrics are unauthenticated so orchestrators and Prometheus can scrape them
+	router.GET("/health", healthHandler)
+	router.GET("/ready", readyHandler)
+	router.GET("/metrics", metricsHandler)
+
 	api := router.Group("/api")
 	{
-		api.POST("/activity", receiveActivityHandler)
-		api.POST("/events/batch", receiveBatchEventsHandler)
-		api.GET("/employees", getEmployeesHandler)
-		api.GET("/activity/recent", getRecentActivityHandler)
-
-		api.POST("/activity/segment", receiveActivitySegmentHandler)
-		api.GET("/activity/summary", getDailyActivitySummaryHandler)
-		api.GET("/activity/segments", getActivitySegmentsHandler)
+		// Agent ingest endpoints: global or per-agent X-API-Key
+		ingest := api.Group("", agentAuthMiddleware(), decompressMiddleware(int64(cfg.Ingest.MaxBodyMB)<<20))
+		{
+			ingest.POST("/activity", receiveActivityHandler)
+			ingest.POST("/events/batch", receiveBatchEventsHandler)
+			ingest.POST("/activity/segment", receiveActivitySegmentHandler)
+			ingest.POST("/usb/event", receiveUSBEventHandler)
+			ingest.POST("/file/event", receiveFileEventHandler)
+			ingest.POST("/screenshot", receiveScreenshotHandler)
+			ingest.POST("/keyboard/event", receiveKeyboardEventHandler)
+			ingest.GET("/agent/config", getAgentRemoteConfigHandler)
+			ingest.POST("/agent/config/applied", reportAgentConfigHandler)
+			ingest.POST("/agents/heartbeat", agentHeartbeatHandler)
+			ingest.GET("/agent/update", getAgentUpdateHandler)
+			ingest.GET("/agent/update/download", downloadAgentBuildHandler)
+			ingest.POST("/agent/update/status", reportAgentUpdateHandler)
+			ingest.POST("/agent/logs", receiveAgentLogsHandler)
+		}
 
-		api.POST("/usb/event", receiveUSBEventHandler)
-		api.GET("/usb/events", getUSBEventsHandler)
+		api.POST("/auth/login", loginHandler)
 
-		api.POST("/file/event", receiveFileEventHandler)
-		api.GET("/file/events", getFileEventsHandler)
+		// Dashboard endpoints: operator session (or global X-API-Key as admin)
+		dash := api.Group("", operatorAuthMiddleware())
+		{
+			dash.GET("/auth/me", meHandler)
+			dash.POST("/auth/logout", logoutHandler)
 
-		api.POST("/screenshot", receiveScreenshotHandler)
+			dash.GET("/employees", getEmployeesHandler)
+			dash.GET("/activity/recent", getRecentActivityHandler)
+			dash.GET("/activity/summary", requireComputerAccess(), getDailyActivitySummaryHandler)
+			dash.GET("/activity/segments", requireComputerAccess(), getActivitySegmentsHandler)
+			dash.GET("/usb/events", requireComputerAccess(), getUSBEventsHandler)
+			dash.GET("/file/events", requireComputerAccess(), getFileEventsHandler)
+			dash.GET("/keyboard/events", requireComputerAccess(), getKeyboardEventsHandler)
 
-		api.POST("/keyboard/event", receiveKeyboardEventHandler)
-		api.GET("/keyboard/events", getKeyboardEventsHandler)
+			dash.GET("/process-catalog", getProcessCatalogHandler)
 
-		api.GET("/process-catalog", getProcessCatalogHandler)
-		api.POST("/process-catalog", createProcessCatalogHandler)
-		api.PUT("/process-catalog/:id", updateProcessCatalogHandler)
-		api.DELETE("/process-catalog/:id", deleteProcessCatalogHandler)
+			dash.GET("/dashboard/stats", getDashboardStatsHandler)
+			dash.GET("/dashboard/active-now", getActiveNowHandler)
+			dash.GET("/reports/daily/:username", requireEmployeeAccess("username"), getDailyReportHandler)
+			dash.GET("/reports/range/:username", requireEmployeeAccess("username"), getRangeReportHandler)
+			dash.GET("/reports/departments", getDepartmentStatsHandler)
+			dash.GET("/reports/departments/:department", getDepartmentReportHandler)
+			dash.GET("/reports/teams", getTeamStatsHandler)
+			dash.GET("/reports/teams/:team", getTeamReportHandler)
+			dash.GET("/attendance/timesheet", getTimesheetsHandler)
+			dash.GET("/attendance/timesheet/:username", requireEmployeeAccess("username"), getEmployeeTimesheetHandler)
+			dash.GET("/attendance/holidays", getHolidaysHandler)
+			dash.GET("/alerts/unresolved", getUnresolvedAlertsHandler)
 
-		api.GET("/dashboard/stats", getDashboardStatsHandler)
-		api.GET("/dashboard/active-now", getActiveNowHandler)
-		api.GET("/reports/daily/:username", getDailyReportHandler)
-		api.GET("/alerts/unresolved", getUnresolvedAlertsHandler)
+			dash.GET("/agents", getAgentsHandler)
 
-		api.GET("/agents", getAgentsHandler)
-		api.GET("/agents/:computer_name/config", getAgentConfigHandler)
-		api.POST("/agents/:computer_name/config", updateAgentConfigHandler)
-		api.DELETE("/agents/:computer_name", deleteAgentHandler)
+			dash.GET("/employees/all", getAllEmployeesHandler)
 
-		api.GET("/employees/all", getAllEmployeesHandler)
-		api.POST("/employees", createEmployeeHandler)
-		api.PUT("/employees/:id", updateEmployeeHandler)
-		api.DELETE("/employees/:id", deleteEmployeeHandler)
+			// Frontend compatibility - returns list of usernames
+			dash.GET("/users", getUsersListHandler)
 
-		// Users list (frontend compatibility - returns unique usernames)
-		api.GET("/users", getUsersListHandler)
+			dash.GET("/activity/applications/:username", requireEmployeeAccess("username"), getApplicationsHandler)
+			dash.GET("/keyboard/:username", requireEmployeeAccess("username"), getKeyboardEventsHandler2)
+			dash.GET("/usb/:username", requireEmployeeAccess("username"), getUSBEventsHandler2)
+			dash.GET("/files/:username", requireEmployeeAccess("username"), getFileEventsHandler2)
+			dash.GET("/screenshots/:username", requireEmployeeAccess("username"), getScreenshotsHandler)
 
-		api.GET("/activity/applications/:username", getApplicationsHandler)
-		api.GET("/keyboard/:username", getKeyboardEventsHandler2)
-		api.GET("/usb/:username", getUSBEventsHandler2)
-		api.GET("/files/:username", getFileEventsHandler2)
-		api.GET("/screenshots/:username", getScreenshotsHandler)
+			// Backward compatibility alias for frontend (screenshot → screenshots/file)
+			dash.GET("/screenshot/:id", getScreenshotHandler)
+			dash.GET("/screenshots/file/:id", getScreenshotHandler)
 
-		// Backward compatibility alias for frontend (screenshot → screenshots/file)
-		api.GET("/screenshot/:id", getScreenshotHandler)
+			dash.GET("/alerts", getAlertsHandler)
+			dash.GET("/alerts/:id", getAlertHandler)
 
-		api.GET("/alerts", getAlertsHandler)
-		api.PUT("/alerts/:id/resolve", resolveAlertHandler)
+			dash.GET("/categories", getAppCategoriesHandler)
+			dash.GET("/categories/export", exportAppCategoriesHandler)
 
-		api.GET("/categories", getAppCategoriesHandler)
-		api.POST("/categories", createAppCategoryHandler)
-		api.PUT("/categories/:id", updateAppCategoryHandler)
-		api.DELETE("/categories/:id", deleteAppCategoryHandler)
-		api.POST("/categories/bulk", bulkUpdateAppCategoriesHandler)
-		api.GET("/categories/export", exportAppCategoriesHandler)
-		api.POST("/categories/import", importAppCategoriesHandler)
+			// Frontend compatibility - alias for categories
+			dash.GET("/settings/app-categories", getAppCategoriesHandler)
 
-		// Frontend compatibility - alias for categories
-		api.GET("/settings/app-categories", getAppCategoriesHandler)
+			dash.GET("/settings", getGeneralSettingsHandler)
+		}
 
-		api.GET("/settings", getGeneralSettingsHandler)
-		api.PUT("/settings", updateGeneralSettingsHandler)
-		api.POST("/settings/logo", uploadLogoHandler)
+		// HR: employee records and alert handling
+		hr := dash.Group("", requireRole(auth.RoleAdmin, auth.RoleHRManager))
+		{
+			hr.POST("/employees", createEmployeeHandler)
+			hr.PUT("/employees/:id", updateEmployeeHandler)
+			hr.DELETE("/employees/:id", deleteEmployeeHandler)
+
+			hr.PUT("/alerts/:id/acknowledge", acknowledgeAlertHandler)
+			hr.PUT("/alerts/:id/assign", assignAlertHandler)
+			hr.PUT("/alerts/:id/resolve", resolveAlertHandler)
+			hr.POST("/alerts/:id/comments", addAlertCommentHandler)
+
+			hr.GET("/alert-rules", getAlertRulesHandler)
+			hr.GET("/alert-rules/:id", getAlertRuleHandler)
+			hr.GET("/notifications/deliveries", getNotificationDeliveriesHandler)
+
+			hr.GET("/report-schedules", getReportSchedulesHandler)
+			hr.GET("/report-schedules/:id", getReportScheduleHandler)
+			hr.GET("/report-schedules/:id/runs", getReportRunsHandler)
+
+			hr.GET("/attendance/schedules", getWorkSchedulesHandler)
+			hr.PUT("/attendance/schedules/:username", saveWorkScheduleHandler)
+			hr.DELETE("/attendance/schedules/:username", deleteWorkScheduleHandler)
+			hr.PUT("/attendance/holidays/:date", saveHolidayHandler)
+			hr.DELETE("/attendance/holidays/:date", deleteHolidayHandler)
+		}
 
-		api.GET("/screenshots/file/:id", getScreenshotHandler)
+		// Admin: agents, catalogs, settings and operators
+		admin := dash.Group("", requireRole(auth.RoleAdmin))
+		{
+			admin.POST("/process-catalog", createProcessCatalogHandler)
+			admin.PUT("/process-catalog/:id", updateProcessCatalogHandler)
+			admin.DELETE("/process-catalog/:id", deleteProcessCatalogHandler)
+
+			admin.GET("/agents/:computer_name/config", getAgentConfigHandler)
+			admin.POST("/agents/:computer_name/config", updateAgentConfigHandler)
+			admin.DELETE("/agents/:computer_name", deleteAgentHandler)
+
+			// Agent builds and release channels
+			admin.GET("/agent-builds", getAgentBuildsHandler)
+			admin.POST("/agent-builds", uploadAgentBuildHandler)
+			admin.GET("/agent-builds/public-key", getBuildPublicKeyHandler)
+			admin.GET("/agent-channels", getReleaseChannelsHandler)
+			admin.PUT("/agent-channels/:channel", setReleaseChannelHandler)
+			admin.GET("/agent-groups", getAgentGroupsHandler)
+			admin.PUT("/agent-groups/:name", saveAgentGroupHandler)
+			admin.DELETE("/agent-groups/:name", deleteAgentGroupHandler)
+			admin.GET("/agent-updates", getAgentUpdateStatusesHandler)
+			admin.GET("/agent-logs", getAgentLogsHandler)
+
+			// Per-agent key management
+			admin.POST("/agents/:computer_name/api-key", issueAgentAPIKeyHandler)
+			admin.POST("/agents/:computer_name/api-key/rotate", rotateAgentAPIKeyHandler)
+			admin.DELETE("/agents/:computer_name/api-key", revokeAgentAPIKeyHandler)
+
+			admin.POST("/categories", createAppCategoryHandler)
+			admin.PUT("/categories/:id", updateAppCategoryHandler)
+			admin.DELETE("/categories/:id", deleteAppCategoryHandler)
+			admin.POST("/categories/bulk", bulkUpdateAppCategoriesHandler)
+			admin.POST("/categories/import", importAppCategoriesHandler)
+
+			admin.PUT("/settings", updateGeneralSettingsHandler)
+			admin.POST("/settings/logo", uploadLogoHandler)
+
+			admin.POST("/alert-rules", createAlertRuleHandler)
+			admin.PUT("/alert-rules/:id", updateAlertRuleHandler)
+			admin.DELETE("/alert-rules/:id", deleteAlertRuleHandler)
+			admin.GET("/notifications/channels", getNotificationChannelsHandler)
+			admin.POST("/notifications/channels/:name/test", testNotificationChannelHandler)
+
+			admin.POST("/report-schedules", createReportScheduleHandler)
+			admin.PUT("/report-schedules/:id", updateReportScheduleHandler)
+			admin.DELETE("/report-schedules/:id", deleteReportScheduleHandler)
+			admin.POST("/report-schedules/:id/run", runReportScheduleHandler)
+
+			admin.GET("/operators", getOperatorsHandler)
+			admin.POST("/operators", createOperatorHandler)
+			admin.PUT("/operators/:username", updateOperatorHandler)
+			admin.DELETE("/operators/:username", deleteOperatorHandler)
+		}
 	}
 
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	logger.Info("Server starting", zap.String("address", addr))
-	if err := router.Run(addr); err != nil {
-		logger.Fatal("Failed to start server", zap.Error(err))
+	srv := &http.Server{Addr: addr, Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("Failed to start server", zap.Error(err))
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	logger.Info("Shutting down")
+
+	// Stop accepting requests, then write what the ingest queue still holds
+	// before the database connection is closed
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("HTTP server did not stop cleanly", zap.Error(err))
+	}
+	stopQueue()
+	// The final flush is bounded by the flush timeout
+	drainTimeout := time.Duration(cfg.Ingest.FlushTimeoutSeconds)*time.Second + 5*time.Second
+	select {
+	case <-ingestQueue.Done():
+		logger.Info("Ingest queue drained")
+	case <-time.After(drainTimeout):
+		logger.Error("Ingest queue not drained, queued events are lost", zap.Int("rows", ingestQueue.Pending()))
 	}
 }
 
@@ -230,22 +426,30 @@ func receiveActivityHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	computerName, ok := agentComputerName(c, event.ComputerName)
+	if !ok {
+		return
+	}
+	event.ComputerName = computerName
 
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
 
 	ctx := c.Request.Context()
-	if err := db.InsertActivityEvent(ctx, event); err != nil {
-		zapctx.Error(ctx, "Failed to insert activity", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save"})
+	if err := ingestQueue.Enqueue(ctx, ingest.Batch{Activity: []database.ActivityEvent{event}}); err != nil {
+		respondEnqueueError(c, err, 1)
 		return
 	}
+	alertEngine.ObserveProcess(ctx, event.Timestamp, event.ComputerName, event.Username, event.ProcessName, event.WindowTitle)
 
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
 type GenericEvent struct {
+	// ID is generated by the agent and identifies the event across retries
+	ID        string          `json:"id"`
+	Seq       uint64          `json:"seq"`
 	Type      string          `json:"type"`
 	Timestamp time.Time       `json:"timestamp"`
 	Data      json.RawMessage `json:"data"`
@@ -258,6 +462,10 @@ type BatchEventsRequest struct {
 func receiveBatchEventsHandler(c *gin.Context) {
 	var req BatchEventsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		if isBodyTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
@@ -267,21 +475,65 @@ func receiveBatchEventsHandler(c *gin.Context) {
 		return
 	}
 
+	// 413 tells agents to split the batch instead of dropping it
 	if len(req.Events) > 10000 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Batch too large (max 10000 events)"})
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Batch too large (max 10000 events)"})
 		return
 	}
 
+	// A per-agent key may only submit events of its own computer
+	owner := c.GetString(agentComputerKey)
+	if owner != "" {
+		for _, event := range req.Events {
+			var claimed struct {
+				ComputerName string `json:"computer_name"`
+			}
+			// Undecodable events are skipped below
+			_ = json.Unmarshal(event.Data, &claimed)
+			if _, ok := agentComputerName(c, claimed.ComputerName); !ok {
+				return
+			}
+		}
+	}
+	// pin replaces the claimed computer with the key's owner
+	pin := func(claimed string) string {
+		if owner != "" {
+			return owner
+		}
+		return claimed
+	}
+
 	ctx := c.Request.Context()
 	now := time.Now()
 
-	activityCount := 0
-	keyboardCount := 0
-	usbCount := 0
-	fileCount := 0
+	// Events already stored by an earlier attempt of the agent are skipped
+	ids := make([]string, 0, len(req.Events))
+	inRequest := make(map[string]bool, len(req.Events))
+	for _, event := range req.Events {
+		if event.ID != "" && !inRequest[event.ID] {
+			inRequest[event.ID] = true
+			ids = append(ids, event.ID)
+		}
+	}
+	dups := deduper.Claim(ctx, ids)
+	accepted := make(map[string]bool, len(ids))
+
+	// Group events by table so each type is written with a single batched insert
+	var batch ingest.Batch
 	unknownCount := 0
+	duplicateCount := 0
+	categories := make(map[string]string)
 
 	for _, event := range req.Events {
+		if dups[event.ID] || accepted[event.ID] {
+			duplicateEvents.Inc(event.Type)
+			duplicateCount++
+			continue
+		}
+
+		queued := batch.Len()
+		computerName := ""
+
 		switch event.Type {
 		case "activity":
 			var activityData struct {
@@ -302,7 +554,7 @@ func receiveBatchEventsHandler(c *gin.Context) {
 
 			activityEvent := database.ActivityEvent{
 				Timestamp:    event.Timestamp,
-				ComputerName: activityData.ComputerName,
+				ComputerName: pin(activityData.ComputerName),
 				Username:     activityData.Username,
 				WindowTitle:  activityData.WindowTitle,
 				ProcessName:  activityData.ProcessName,
@@ -323,11 +575,8 @@ func receiveBatchEventsHandler(c *gin.Context) {
 				continue
 			}
 
-			if err := db.InsertActivityEvent(ctx, activityEvent); err != nil {
-				zapctx.Warn(ctx, "Failed to insert activity event", zap.Error(err))
-				continue
-			}
-			activityCount++
+			batch.Activity = append(batch.Activity, activityEvent)
+			computerName = activityEvent.ComputerName
 
 		case "keyboard":
 			var keyboardData database.KeyboardEvent
@@ -343,11 +592,9 @@ func receiveBatchEventsHandler(c *gin.Context) {
 				keyboardData.Timestamp = now
 			}
 
-			if err := db.InsertKeyboardEvent(ctx, keyboardData); err != nil {
-				zapctx.Warn(ctx, "Failed to insert keyboard event", zap.Error(err))
-				continue
-			}
-			keyboardCount++
+			keyboardData.ComputerName = pin(keyboardData.ComputerName)
+			batch.Keyboard = append(batch.Keyboard, keyboardData)
+			computerName = keyboardData.ComputerName
 
 		case "usb":
 			var usbData database.USBEvent
@@ -363,11 +610,9 @@ func receiveBatchEventsHandler(c *gin.Context) {
 				usbData.Timestamp = now
 			}
 
-			if err := db.InsertUSBEvent(ctx, usbData); err != nil {
-				zapctx.Warn(ctx, "Failed to insert USB event", zap.Error(err))
-				continue
-			}
-			usbCount++
+			usbData.ComputerName = pin(usbData.ComputerName)
+			batch.USB = append(batch.USB, usbData)
+			computerName = usbData.ComputerName
 
 		case "file":
 			var fileData database.FileCopyEvent
@@ -383,39 +628,127 @@ func receiveBatchEventsHandler(c *gin.Context) {
 				fileData.Timestamp = now
 			}
 
-			if err := db.InsertFileCopyEvent(ctx, fileData); err != nil {
-				zapctx.Warn(ctx, "Failed to insert file event", zap.Error(err))
+			fileData.ComputerName = pin(fileData.ComputerName)
+			batch.Files = append(batch.Files, fileData)
+			computerName = fileData.ComputerName
+
+		case "segment":
+			var segment database.ActivitySegment
+			if err := json.Unmarshal(event.Data, &segment); err != nil {
+				zapctx.Warn(ctx, "Failed to unmarshal activity segment", zap.Error(err))
 				continue
 			}
-			fileCount++
+
+			if segment.TimestampStart.IsZero() {
+				segment.TimestampStart = event.Timestamp
+			}
+			if segment.TimestampStart.IsZero() {
+				segment.TimestampStart = now
+			}
+			if segment.TimestampEnd.IsZero() {
+				segment.TimestampEnd = segment.TimestampStart
+			}
+			segment.ComputerName = pin(segment.ComputerName)
+			applySegmentCategory(ctx, &segment, categories)
+
+			batch.Segments = append(batch.Segments, segment)
+			computerName = segment.ComputerName
 
 		default:
 			zapctx.Debug(ctx, "Unknown event type, ignoring", zap.String("type", event.Type))
 			unknownCount++
 		}
+
+		if event.ID != "" && batch.Len() > queued {
+			accepted[event.ID] = true
+			batch.EventIDs = append(batch.EventIDs, database.IngestedEvent{
+				EventID:      event.ID,
+				ComputerName: computerName,
+				Seq:          event.Seq,
+				EventType:    event.Type,
+				ReceivedAt:   now,
+			})
+		}
+	}
+
+	// Claims of events that were not queued are dropped so they are not reported as duplicates later
+	var release []string
+	for _, id := range ids {
+		if !dups[id] && !accepted[id] {
+			release = append(release, id)
+		}
 	}
+	deduper.Release(release)
 
-	totalProcessed := activityCount + keyboardCount + usbCount + fileCount
+	activityCount := len(batch.Activity)
+	keyboardCount := len(batch.Keyboard)
+	usbCount := len(batch.USB)
+	fileCount := len(batch.Files)
+	segmentCount := len(batch.Segments)
+	totalProcessed := batch.Len()
 
-	if totalProcessed == 0 && unknownCount == 0 {
+	if totalProcessed == 0 && unknownCount == 0 && duplicateCount == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid events in batch"})
 		return
 	}
 
+	// Nothing is acknowledged unless it was stored, so the agent keeps and retries the batch
+	if err := ingestQueue.Enqueue(ctx, batch); err != nil {
+		// Types that were stored are found in ingested_events on retry
+		released := make([]string, 0, len(batch.EventIDs))
+		for _, e := range batch.EventIDs {
+			released = append(released, e.EventID)
+		}
+		deduper.Release(released)
+		respondEnqueueError(c, err, totalProcessed)
+		return
+	}
+
+	for _, e := range batch.Activity {
+		alertEngine.ObserveProcess(ctx, e.Timestamp, e.ComputerName, e.Username, e.ProcessName, e.WindowTitle)
+	}
+	for _, e := range batch.USB {
+		alertEngine.ObserveUSB(ctx, e)
+	}
+	for _, e := range batch.Files {
+		alertEngine.ObserveFileCopy(ctx, e)
+	}
+	for _, s := range batch.Segments {
+		if s.State == "active" {
+			alertEngine.ObserveProcess(ctx, s.TimestampStart, s.ComputerName, s.Username, s.ProcessName, s.WindowTitle)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "success",
-		"submitted": len(req.Events),
-		"processed": totalProcessed,
-		"activity":  activityCount,
-		"keyboard":  keyboardCount,
-		"usb":       usbCount,
-		"file":      fileCount,
-		"ignored":   unknownCount,
-		"message": fmt.Sprintf("Processed %d events (%d activity, %d keyboard, %d usb, %d file)",
-			totalProcessed, activityCount, keyboardCount, usbCount, fileCount),
+		"status":     "success",
+		"submitted":  len(req.Events),
+		"processed":  totalProcessed,
+		"activity":   activityCount,
+		"keyboard":   keyboardCount,
+		"usb":        usbCount,
+		"file":       fileCount,
+		"segment":    segmentCount,
+		"ignored":    unknownCount,
+		"duplicates": duplicateCount,
+		"message": fmt.Sprintf("Processed %d events (%d activity, %d keyboard, %d usb, %d file, %d segment)",
+			totalProcessed, activityCount, keyboardCount, usbCount, fileCount, segmentCount),
 	})
 }
 
+// respondEnqueueError answers an ingest request whose events could not be stored.
+// A full queue returns 503 with Retry-After so agents back off and retry later.
+func respondEnqueueError(c *gin.Context, err error, rows int) {
+	ctx := c.Request.Context()
+	if errors.Is(err, ingest.ErrBackpressure) || errors.Is(err, ingest.ErrClosed) {
+		zapctx.Warn(ctx, "Ingest queue is not accepting events", zap.Int("rows", rows))
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is busy, retry later"})
+		return
+	}
+	zapctx.Error(ctx, "Failed to save events", zap.Int("rows", rows), zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save events"})
+}
+
 func getEmployeesHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	employees, err := db.GetActiveEmployees(ctx)
@@ -424,6 +757,21 @@ func getEmployeesHandler(c *gin.Context) {
 		return
 	}
 
+	allowed, scoped, err := visibleUsernames(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch employees"})
+		return
+	}
+	if scoped {
+		visible := make([]database.Employee, 0, len(employees))
+		for _, e := range employees {
+			if allowed[e.Username] {
+				visible = append(visible, e)
+			}
+		}
+		employees = visible
+	}
+
 	c.JSON(http.StatusOK, employees)
 }
 
@@ -435,6 +783,21 @@ func getRecentActivityHandler(c *gin.Context) {
 		return
 	}
 
+	allowed, scoped, err := visibleUsernames(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity"})
+		return
+	}
+	if scoped {
+		visible := make([]database.ActivityEvent, 0, len(records))
+		for _, r := range records {
+			if allowed[r.Username] {
+				visible = append(visible, r)
+			}
+		}
+		records = visible
+	}
+
 	c.JSON(http.StatusOK, records)
 }
 
@@ -444,17 +807,22 @@ func receiveUSBEventHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	computerName, ok := agentComputerName(c, event.ComputerName)
+	if !ok {
+		return
+	}
+	event.ComputerName = computerName
 
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
 
 	ctx := c.Request.Context()
-	if err := db.InsertUSBEvent(ctx, event); err != nil {
-		zapctx.Error(ctx, "Failed to insert USB event", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save"})
+	if err := ingestQueue.Enqueue(ctx, ingest.Batch{USB: []database.USBEvent{event}}); err != nil {
+		respondEnqueueError(c, err, 1)
 		return
 	}
+	alertEngine.ObserveUSB(ctx, event)
 
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
@@ -488,17 +856,22 @@ func receiveFileEventHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	computerName, ok := agentComputerName(c, event.ComputerName)
+	if !ok {
+		return
+	}
+	event.ComputerName = computerName
 
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
 
 	ctx := c.Request.Context()
-	if err := db.InsertFileCopyEvent(ctx, event); err != nil {
-		zapctx.Error(ctx, "Failed to insert file event", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save"})
+	if err := ingestQueue.Enqueue(ctx, ingest.Batch{Files: []database.FileCopyEvent{event}}); err != nil {
+		respondEnqueueError(c, err, 1)
 		return
 	}
+	alertEngine.ObserveFileCopy(ctx, event)
 
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
@@ -542,6 +915,11 @@ func receiveScreenshotHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	computerName, ok := agentComputerName(c, screenshot.ComputerName)
+	if !ok {
+		return
+	}
+	screenshot.ComputerName = computerName
 
 	if screenshot.Timestamp.IsZero() {
 		screenshot.Timestamp = time.Now()
@@ -551,10 +929,13 @@ func receiveScreenshotHandler(c *gin.Context) {
 
 	minioPath, err := st.UploadScreenshot(ctx, screenshot.ScreenshotID, screenshot.ImageData)
 	if err != nil {
+		screenshotUploads.Inc("failed")
 		zapctx.Error(ctx, "Failed to upload screenshot to MinIO", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save screenshot"})
 		return
 	}
+	screenshotUploads.Inc("success")
+	screenshotUploadBytes.Add(float64(len(screenshot.ImageData)))
 
 	meta := database.ScreenshotMetadata{
 		Timestamp:    screenshot.Timestamp,
@@ -568,10 +949,12 @@ func receiveScreenshotHandler(c *gin.Context) {
 	}
 
 	if err := db.InsertScreenshotMetadata(ctx, meta); err != nil {
+		insertFailures.Inc("screenshot")
 		zapctx.Error(ctx, "Failed to insert screenshot metadata", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metadata"})
 		return
 	}
+	eventsIngested.Inc("screenshot")
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "screenshot_id": screenshot.ScreenshotID})
 }
@@ -582,15 +965,19 @@ func receiveKeyboardEventHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	computerName, ok := agentComputerName(c, event.ComputerName)
+	if !ok {
+		return
+	}
+	event.ComputerName = computerName
 
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
 
 	ctx := c.Request.Context()
-	if err := db.InsertKeyboardEvent(ctx, event); err != nil {
-		zapctx.Error(ctx, "Failed to insert keyboard event", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save"})
+	if err := ingestQueue.Enqueue(ctx, ingest.Batch{Keyboard: []database.KeyboardEvent{event}}); err != nil {
+		respondEnqueueError(c, err, 1)
 		return
 	}
 
@@ -626,6 +1013,11 @@ func receiveActivitySegmentHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	computerName, ok := agentComputerName(c, segment.ComputerName)
+	if !ok {
+		return
+	}
+	segment.ComputerName = computerName
 
 	if segment.TimestampStart.IsZero() {
 		segment.TimestampStart = time.Now()
@@ -635,27 +1027,46 @@ func receiveActivitySegmentHandler(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
+	applySegmentCategory(ctx, &segment, nil)
 
-	// Determine category based on state and process catalog
+	if err := ingestQueue.Enqueue(ctx, ingest.Batch{Segments: []database.ActivitySegment{segment}}); err != nil {
+		respondEnqueueError(c, err, 1)
+		return
+	}
+	if segment.State == "active" {
+		alertEngine.ObserveProcess(ctx, segment.TimestampStart, segment.ComputerName, segment.Username,
+			segment.ProcessName, segment.WindowTitle)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// applySegmentCategory determines the category of a segment from its state or
+// the process catalog. memo, if not nil, caches catalog lookups within a batch.
+func applySegmentCategory(ctx context.Context, segment *database.ActivitySegment, memo map[string]string) {
 	if segment.State == "idle" || segment.State == "offline" {
 		segment.Category = segment.State
-	} else if segment.Category == "" {
-		// Try to match process to category from catalog
-		category, err := db.MatchProcessToCategory(ctx, segment.ProcessName, segment.WindowTitle)
-		if err != nil {
-			segment.Category = "neutral"
-		} else {
-			segment.Category = category
-		}
+		return
+	}
+	if segment.Category != "" {
+		return
 	}
 
-	if err := db.InsertActivitySegment(ctx, segment); err != nil {
-		zapctx.Error(ctx, "Failed to insert activity segment", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save"})
+	key := segment.ProcessName + "\x00" + segment.WindowTitle
+	if category, ok := memo[key]; ok {
+		segment.Category = category
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	// Try to match process to category from catalog
+	category, err := db.MatchProcessToCategory(ctx, segment.ProcessName, segment.WindowTitle)
+	if err != nil {
+		category = "neutral"
+	}
+	if memo != nil {
+		memo[key] = category
+	}
+	segment.Category = category
 }
 
 func getDailyActivitySummaryHandler(c *gin.Context) {
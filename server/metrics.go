@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Server metrics exported on GET /metrics
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	eventsIngested = metricsRegistry.NewCounterVec("officemonitor_events_ingested_total",
+		"Agent events stored, by event type.", "type")
+	insertFailures = metricsRegistry.NewCounterVec("officemonitor_insert_failures_total",
+		"Agent events that failed to be stored, by event type.", "type")
+	duplicateEvents = metricsRegistry.NewCounterVec("officemonitor_duplicate_events_total",
+		"Agent events skipped because they were already stored, by event type.", "type")
+	insertFlushDuration = metricsRegistry.NewHistogramVec("officemonitor_insert_flush_duration_seconds",
+		"Latency of batched ClickHouse inserts, by event type.", nil, "type")
+	_ = metricsRegistry.NewGaugeFunc("officemonitor_ingest_queue_rows",
+		"Agent events queued or being written to ClickHouse.", ingestQueueRows)
+	requestDuration = metricsRegistry.NewHistogramVec("officemonitor_http_request_duration_seconds",
+		"HTTP request latency by route.", nil, "method", "route", "status")
+	screenshotUploadBytes = metricsRegistry.NewCounterVec("officemonitor_screenshot_upload_bytes_total",
+		"Bytes of screenshot images uploaded to object storage.")
+	screenshotUploads = metricsRegistry.NewCounterVec("officemonitor_screenshot_uploads_total",
+		"Screenshot uploads to object storage, by result.", "result")
+	dashboardCacheRequests = metricsRegistry.NewCounterVec("officemonitor_dashboard_cache_requests_total",
+		"Dashboard statistics cache lookups, by result (hit or miss).", "result")
+	_ = metricsRegistry.NewGaugeFunc("officemonitor_dashboard_cache_hit_ratio",
+		"Share of dashboard statistics requests served from cache since startup.", dashboardCacheHitRatio)
+)
+
+// metricsMiddleware records the latency of every request by matched route
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestDuration.Observe(time.Since(start).Seconds(),
+			c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
+
+// observeFlush records the outcome of one batched insert of the ingest queue
+func observeFlush(eventType string, rows int, d time.Duration, err error) {
+	insertFlushDuration.Observe(d.Seconds(), eventType)
+	if err != nil {
+		insertFailures.Add(float64(rows), eventType)
+		return
+	}
+	eventsIngested.Add(float64(rows), eventType)
+}
+
+func ingestQueueRows() float64 {
+	if ingestQueue == nil {
+		return 0
+	}
+	return float64(ingestQueue.Pending())
+}
+
+// metricsHandler serves all metrics in the Prometheus text format
+func metricsHandler(c *gin.Context) {
+	metricsRegistry.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+func dashboardCacheHitRatio() float64 {
+	hits := dashboardCacheRequests.Value("hit")
+	misses := dashboardCacheRequests.Value("miss")
+	if hits+misses == 0 {
+		return 0
+	}
+	return hits / (hits + misses)
+}
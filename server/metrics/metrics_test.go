@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextExposition(t *testing.T) {
+	r := NewRegistry()
+	events := r.NewCounterVec("events_total", "Events by type", "type")
+	latency := r.NewHistogramVec("latency_seconds", "Latency", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("ratio", "Hit ratio", func() float64 { return 0.75 })
+
+	events.Inc("usb")
+	events.Add(3, "activity")
+	events.Add(-1, "activity")
+	latency.Observe(0.05, "/api/x")
+	latency.Observe(0.5, "/api/x")
+	latency.Observe(2, "/api/x")
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	want := `# HELP events_total Events by type
+# TYPE events_total counter
+events_total{type="activity"} 3
+events_total{type="usb"} 1
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/api/x",le="0.1"} 1
+latency_seconds_bucket{route="/api/x",le="1"} 2
+latency_seconds_bucket{route="/api/x",le="+Inf"} 3
+latency_seconds_sum{route="/api/x"} 2.55
+latency_seconds_count{route="/api/x"} 3
+# HELP ratio Hit ratio
+# TYPE ratio gauge
+ratio 0.75
+`
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("c_total", "Counter", "path")
+	c.Inc("a\"b\\c\nd")
+
+	var b strings.Builder
+	r.Write(&b)
+	if !strings.Contains(b.String(), `c_total{path="a\"b\\c\nd"} 1`) {
+		t.Fatalf("label not escaped:\n%s", b.String())
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup_total", "x")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate metric")
+		}
+	}()
+	r.NewCounterVec("dup_total", "x")
+}
@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/config"
+)
+
+// Mail is an outgoing email. HTML, when set, is sent as an alternative to
+// Text.
+type Mail struct {
+	From        string
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a mail
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Email sends alerts to a list of recipients over SMTP
+type Email struct {
+	to   []string
+	smtp config.SMTPConfig
+}
+
+// NewEmail creates an email channel using the shared SMTP server settings
+func NewEmail(cfg config.EmailChannelConfig, smtpCfg config.SMTPConfig) (*Email, error) {
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("email.to must list at least one recipient")
+	}
+	if smtpCfg.Host == "" || smtpCfg.From == "" {
+		return nil, fmt.Errorf("smtp.host and smtp.from must be set for email channels")
+	}
+	return &Email{to: cfg.To, smtp: smtpCfg}, nil
+}
+
+// Send implements Channel
+func (e *Email) Send(ctx context.Context, msg Message) error {
+	return SendMail(ctx, e.smtp, Mail{
+		From:    e.smtp.From,
+		To:      e.to,
+		Subject: msg.Subject(),
+		Text:    msg.Text(),
+	})
+}
+
+// SendMail delivers a mail through the configured SMTP server.
+// Authentication is only attempted when a username is set.
+func SendMail(ctx context.Context, cfg config.SMTPConfig, m Mail) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if cfg.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp connect: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if !cfg.TLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("smtp starttls: %w", err)
+			}
+		}
+	}
+
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return Permanent(fmt.Errorf("smtp auth: %w", err))
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, rcpt := range m.To {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(buildMessage(m)); err != nil {
+		w.Close()
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildMessage renders the mail as a MIME message: plain UTF-8 text, or
+// multipart when there is an HTML part or attachments
+func buildMessage(m Mail) []byte {
+	var buf bytes.Buffer
+	header := func(k, v string) {
+		buf.WriteString(k + ": " + v + "\r\n")
+	}
+
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" && len(m.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, m.Text)
+		return buf.Bytes()
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}))
+	buf.WriteString("\r\n")
+
+	writeBody(mixed, m)
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, _ := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64(part, a.Data)
+	}
+	mixed.Close()
+
+	return buf.Bytes()
+}
+
+// writeBody adds the text part, or text and HTML as alternatives
+func writeBody(mixed *multipart.Writer, m Mail) {
+	textHeader := textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+	if m.HTML == "" {
+		part, _ := mixed.CreatePart(textHeader)
+		writeQuotedPrintable(part, m.Text)
+		return
+	}
+
+	var alt bytes.Buffer
+	altWriter := multipart.NewWriter(&alt)
+	part, _ := altWriter.CreatePart(textHeader)
+	writeQuotedPrintable(part, m.Text)
+	part, _ = altWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	writeQuotedPrintable(part, m.HTML)
+	altWriter.Close()
+
+	part, _ = mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": altWriter.Boundary()})},
+	})
+	part.Write(alt.Bytes())
+}
+
+func writeQuotedPrintable(w io.Writer, text string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	qp.Close()
+}
+
+// writeBase64 writes data in lines of 76 characters as RFC 2045 requires
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
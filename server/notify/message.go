@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+)
+
+// Message is an alert prepared for delivery
+type Message struct {
+	Alert database.Alert
+	URL   string // link to the alert in the dashboard, empty if dashboard_url is not set
+}
+
+func newMessage(alert database.Alert, dashboardURL string) Message {
+	msg := Message{Alert: alert}
+	if dashboardURL != "" && alert.ID != "" {
+		msg.URL = strings.TrimRight(dashboardURL, "/") + "/alerts/" + alert.ID
+	}
+	return msg
+}
+
+// Subject is a one-line summary, e.g. "[HIGH] Large file copy on PC-01 (ivanov)"
+func (m Message) Subject() string {
+	a := m.Alert
+	subject := fmt.Sprintf("[%s] %s on %s", strings.ToUpper(a.Severity), alertTypeTitle(a.AlertType), a.ComputerName)
+	if a.Username != "" {
+		subject += " (" + a.Username + ")"
+	}
+	return subject
+}
+
+// Text is the plain text body used by email and Telegram
+func (m Message) Text() string {
+	a := m.Alert
+	var b strings.Builder
+	b.WriteString(m.Subject())
+	b.WriteString("\n\n")
+	b.WriteString(a.Description)
+	b.WriteString("\n\n")
+	fmt.Fprintf(&b, "Time: %s\n", a.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Computer: %s\n", a.ComputerName)
+	if a.Username != "" {
+		fmt.Fprintf(&b, "User: %s\n", a.Username)
+	}
+	fmt.Fprintf(&b, "Severity: %s\n", a.Severity)
+	if details := metadataLines(a.Metadata); details != "" {
+		b.WriteString(details)
+	}
+	if m.URL != "" {
+		fmt.Fprintf(&b, "\n%s\n", m.URL)
+	}
+	return b.String()
+}
+
+// metadataLines renders the flat alert metadata JSON as "key: value" lines
+func metadataLines(metadata string) string {
+	var fields map[string]any
+	if metadata == "" || json.Unmarshal([]byte(metadata), &fields) != nil || len(fields) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %v\n", k, fields[k])
+	}
+	return b.String()
+}
+
+func alertTypeTitle(alertType string) string {
+	title := strings.ReplaceAll(alertType, "_", " ")
+	if title == "" {
+		return "Alert"
+	}
+	return strings.ToUpper(title[:1]) + title[1:]
+}
@@ -0,0 +1,351 @@
+// Package notify pushes alerts to external channels (webhook, email, Telegram)
+// with per-channel severity filters, retries and a delivery log.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/config"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+// Channel types
+const (
+	ChannelWebhook  = "webhook"
+	ChannelEmail    = "email"
+	ChannelTelegram = "telegram"
+)
+
+// Channel delivers a single alert. Errors wrapped with Permanent are not retried.
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Store is the subset of the database used by the notifier
+type Store interface {
+	InsertNotificationDelivery(ctx context.Context, d database.NotificationDelivery) error
+}
+
+// Route is a configured channel with its severity filter
+type Route struct {
+	Name        string
+	Type        string
+	MinSeverity string
+	Channel     Channel
+}
+
+// ChannelInfo describes a configured channel without its secrets
+type ChannelInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	MinSeverity string `json:"min_severity"`
+}
+
+// Options control queueing and retries
+type Options struct {
+	QueueSize      int
+	Workers        int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	DashboardURL   string
+}
+
+type job struct {
+	route *Route
+	msg   Message
+}
+
+// Notifier queues alerts and delivers them in the background. It is safe for concurrent use.
+type Notifier struct {
+	routes []*Route
+	store  Store
+	opts   Options
+	queue  chan job
+
+	// sleep waits between attempts; replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// ErrUnknownChannel is returned by Test for a channel name that is not configured
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// New creates a notifier for the given routes
+func New(store Store, routes []Route, opts Options) *Notifier {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+
+	n := &Notifier{
+		store: store,
+		opts:  opts,
+		queue: make(chan job, opts.QueueSize),
+		sleep: sleepContext,
+	}
+	for i := range routes {
+		n.routes = append(n.routes, &routes[i])
+	}
+	return n
+}
+
+// FromConfig builds the enabled channels from config
+func FromConfig(cfg config.NotificationsConfig, smtpCfg config.SMTPConfig, store Store) (*Notifier, error) {
+	routes := make([]Route, 0, len(cfg.Channels))
+	seen := make(map[string]bool)
+
+	for _, ch := range cfg.Channels {
+		if ch.Name == "" {
+			return nil, fmt.Errorf("notification channel without name")
+		}
+		if seen[ch.Name] {
+			return nil, fmt.Errorf("duplicate notification channel %q", ch.Name)
+		}
+		seen[ch.Name] = true
+
+		if severityRank(ch.MinSeverity) == 0 {
+			return nil, fmt.Errorf("channel %q: min_severity must be one of: low, medium, high, critical", ch.Name)
+		}
+		if !ch.Enabled {
+			continue
+		}
+
+		var channel Channel
+		var err error
+		switch ch.Type {
+		case ChannelWebhook:
+			channel, err = NewWebhook(ch.Webhook)
+		case ChannelEmail:
+			channel, err = NewEmail(ch.Email, smtpCfg)
+		case ChannelTelegram:
+			channel, err = NewTelegram(ch.Telegram)
+		default:
+			err = fmt.Errorf("type must be one of: webhook, email, telegram")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: %w", ch.Name, err)
+		}
+
+		routes = append(routes, Route{Name: ch.Name, Type: ch.Type, MinSeverity: ch.MinSeverity, Channel: channel})
+	}
+
+	return New(store, routes, Options{
+		QueueSize:      cfg.QueueSize,
+		Workers:        cfg.Workers,
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.InitialBackoffSeconds) * time.Second,
+		MaxBackoff:     time.Duration(cfg.MaxBackoffSeconds) * time.Second,
+		DashboardURL:   cfg.DashboardURL,
+	}), nil
+}
+
+// Channels lists the enabled channels
+func (n *Notifier) Channels() []ChannelInfo {
+	infos := make([]ChannelInfo, 0, len(n.routes))
+	for _, r := range n.routes {
+		infos = append(infos, ChannelInfo{Name: r.Name, Type: r.Type, MinSeverity: r.MinSeverity})
+	}
+	return infos
+}
+
+// Notify queues the alert for every channel whose severity filter it passes.
+// It never blocks: when the queue is full the delivery is dropped and logged.
+func (n *Notifier) Notify(ctx context.Context, alert database.Alert) {
+	msg := newMessage(alert, n.opts.DashboardURL)
+	for _, r := range n.routes {
+		if severityRank(alert.Severity) < severityRank(r.MinSeverity) {
+			continue
+		}
+		select {
+		case n.queue <- job{route: r, msg: msg}:
+		default:
+			zapctx.Warn(ctx, "Notification queue is full, dropping delivery",
+				zap.String("channel", r.Name), zap.String("alert_id", alert.ID))
+			n.record(ctx, r, msg, database.DeliveryStatusDropped, 0, errors.New("queue full"), 0)
+		}
+	}
+}
+
+// Run delivers queued notifications until ctx is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	zapctx.Info(ctx, "Notifier started",
+		zap.Int("channels", len(n.routes)),
+		zap.Int("workers", n.opts.Workers))
+
+	done := make(chan struct{})
+	for i := 0; i < n.opts.Workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-n.queue:
+					n.deliver(ctx, j.route, j.msg)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n.opts.Workers; i++ {
+		<-done
+	}
+}
+
+// Test sends a sample alert to the named channel once, bypassing the queue,
+// the severity filter and retries
+func (n *Notifier) Test(ctx context.Context, name string) error {
+	for _, r := range n.routes {
+		if r.Name != name {
+			continue
+		}
+		msg := newMessage(database.Alert{
+			Timestamp:    time.Now(),
+			ComputerName: "TEST-PC",
+			Username:     "test",
+			AlertType:    "test",
+			Severity:     "low",
+			Description:  "Test notification from Office Monitor",
+			Metadata:     "{}",
+		}, n.opts.DashboardURL)
+
+		start := time.Now()
+		err := r.Channel.Send(ctx, msg)
+		status := database.DeliveryStatusSent
+		if err != nil {
+			status = database.DeliveryStatusFailed
+		}
+		n.record(ctx, r, msg, status, 1, err, time.Since(start))
+		return err
+	}
+	return ErrUnknownChannel
+}
+
+// deliver sends one message with retries and records the outcome
+func (n *Notifier) deliver(ctx context.Context, r *Route, msg Message) {
+	start := time.Now()
+	var err error
+	attempt := 0
+
+	for attempt < n.opts.MaxAttempts {
+		attempt++
+		if err = r.Channel.Send(ctx, msg); err == nil {
+			break
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt == n.opts.MaxAttempts {
+			break
+		}
+
+		delay := n.backoff(attempt)
+		zapctx.Warn(ctx, "Notification delivery failed, retrying",
+			zap.Error(err),
+			zap.String("channel", r.Name),
+			zap.String("alert_id", msg.Alert.ID),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay))
+		if n.sleep(ctx, delay) != nil {
+			break
+		}
+	}
+
+	status := database.DeliveryStatusSent
+	if err != nil {
+		status = database.DeliveryStatusFailed
+		zapctx.Error(ctx, "Notification delivery failed",
+			zap.Error(err),
+			zap.String("channel", r.Name),
+			zap.String("alert_id", msg.Alert.ID),
+			zap.Int("attempts", attempt))
+	} else {
+		zapctx.Debug(ctx, "Notification delivered",
+			zap.String("channel", r.Name),
+			zap.String("alert_id", msg.Alert.ID),
+			zap.Int("attempts", attempt))
+	}
+	n.record(ctx, r, msg, status, attempt, err, time.Since(start))
+}
+
+// backoff returns the delay after the given failed attempt: initial * 2^(attempt-1), capped
+func (n *Notifier) backoff(attempt int) time.Duration {
+	delay := n.opts.InitialBackoff
+	for i := 1; i < attempt && delay < n.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if n.opts.MaxBackoff > 0 && delay > n.opts.MaxBackoff {
+		delay = n.opts.MaxBackoff
+	}
+	return delay
+}
+
+func (n *Notifier) record(ctx context.Context, r *Route, msg Message, status string, attempts int, err error, elapsed time.Duration) {
+	if n.store == nil {
+		return
+	}
+	d := database.NotificationDelivery{
+		Timestamp:   time.Now(),
+		AlertID:     msg.Alert.ID,
+		Channel:     r.Name,
+		ChannelType: r.Type,
+		Status:      status,
+		Attempts:    attempts,
+		DurationMs:  uint32(elapsed.Milliseconds()),
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if err := n.store.InsertNotificationDelivery(context.WithoutCancel(ctx), d); err != nil {
+		zapctx.Error(ctx, "Failed to log notification delivery", zap.Error(err), zap.String("channel", r.Name))
+	}
+}
+
+// permanentError marks a failure that retrying cannot fix (bad credentials, 4xx)
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that it is not retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "low":
+		return 1
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	case "critical":
+		return 4
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
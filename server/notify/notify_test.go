@@ -0,0 +1,369 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/config"
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	mu         sync.Mutex
+	deliveries []database.NotificationDelivery
+}
+
+func (f *fakeStore) InsertNotificationDelivery(ctx context.Context, d database.NotificationDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries = append(f.deliveries, d)
+	return nil
+}
+
+func testContext() context.Context {
+	return zapctx.WithLogger(context.Background(), zap.NewNop())
+}
+
+func testAlert(severity string) database.Alert {
+	return database.Alert{
+		ID:           "0b7a3f2e-1111-4222-8333-444455556666",
+		Timestamp:    time.Date(2025, 3, 10, 14, 30, 0, 0, time.UTC),
+		ComputerName: "PC-01",
+		Username:     "ivanov",
+		AlertType:    "large_file_copy",
+		Severity:     severity,
+		Description:  "Large file copy: 512 MB",
+		Metadata:     `{"destination_path":"E:\\dump.zip","rule_name":"Large file copy"}`,
+	}
+}
+
+func TestWebhookSignsPayload(t *testing.T) {
+	secret := []byte("s3cret")
+	var got WebhookPayload
+	var sigOK bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sigOK = r.Header.Get(HeaderSignature) == Sign(secret, r.Header.Get(HeaderTimestamp), body)
+		json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(config.WebhookChannelConfig{URL: srv.URL, Secret: string(secret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wh.Send(testContext(), newMessage(testAlert("high"), "http://dash.local/")); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if !sigOK {
+		t.Fatal("signature does not match body")
+	}
+	if got.Alert.ID != testAlert("high").ID || got.URL != "http://dash.local/alerts/"+testAlert("high").ID {
+		t.Fatalf("unexpected payload: %+v", got)
+	}
+}
+
+func TestDeliverRetriesUntilSuccess(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	wh, _ := NewWebhook(config.WebhookChannelConfig{URL: srv.URL})
+	store := &fakeStore{}
+	n := New(store, []Route{{Name: "hook", Type: ChannelWebhook, MinSeverity: "low", Channel: wh}},
+		Options{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 4 * time.Second})
+
+	var delays []time.Duration
+	n.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	n.deliver(testContext(), n.routes[0], newMessage(testAlert("high"), ""))
+
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Fatalf("unexpected backoff: %v", delays)
+	}
+	if len(store.deliveries) != 1 || store.deliveries[0].Status != database.DeliveryStatusSent || store.deliveries[0].Attempts != 3 {
+		t.Fatalf("unexpected delivery log: %+v", store.deliveries)
+	}
+}
+
+func TestDeliverStopsOnPermanentError(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	wh, _ := NewWebhook(config.WebhookChannelConfig{URL: srv.URL})
+	store := &fakeStore{}
+	n := New(store, []Route{{Name: "hook", Type: ChannelWebhook, MinSeverity: "low", Channel: wh}},
+		Options{MaxAttempts: 5, InitialBackoff: time.Second})
+	n.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+	n.deliver(testContext(), n.routes[0], newMessage(testAlert("high"), ""))
+
+	if calls != 1 {
+		t.Fatalf("permanent error must not be retried, got %d calls", calls)
+	}
+	if len(store.deliveries) != 1 || store.deliveries[0].Status != database.DeliveryStatusFailed {
+		t.Fatalf("unexpected delivery log: %+v", store.deliveries)
+	}
+}
+
+func TestNotifyFiltersBySeverityAndDropsWhenFull(t *testing.T) {
+	store := &fakeStore{}
+	n := New(store, []Route{
+		{Name: "all", Type: ChannelWebhook, MinSeverity: "low"},
+		{Name: "critical", Type: ChannelWebhook, MinSeverity: "critical"},
+	}, Options{QueueSize: 2})
+
+	ctx := testContext()
+	n.Notify(ctx, testAlert("high"))
+	if len(n.queue) != 1 {
+		t.Fatalf("high alert must only reach the low channel, queued %d", len(n.queue))
+	}
+
+	n.Notify(ctx, testAlert("critical"))
+	if len(n.queue) != 2 {
+		t.Fatalf("expected full queue, got %d", len(n.queue))
+	}
+	if len(store.deliveries) != 1 || store.deliveries[0].Status != database.DeliveryStatusDropped {
+		t.Fatalf("expected one dropped delivery, got %+v", store.deliveries)
+	}
+}
+
+func TestTelegramSendMessage(t *testing.T) {
+	var path string
+	var req struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer srv.Close()
+
+	tg, err := NewTelegram(config.TelegramChannelConfig{BotToken: "123:abc", ChatID: "-100", APIURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tg.Send(testContext(), newMessage(testAlert("critical"), "")); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if path != "/bot123:abc/sendMessage" || req.ChatID != "-100" {
+		t.Fatalf("unexpected request: %s %+v", path, req)
+	}
+	if !strings.Contains(req.Text, "[CRITICAL] Large file copy on PC-01 (ivanov)") ||
+		!strings.Contains(req.Text, `destination_path: E:\dump.zip`) {
+		t.Fatalf("unexpected text:\n%s", req.Text)
+	}
+}
+
+// smtpStub is a minimal SMTP server that accepts one message without auth or TLS
+type smtpStub struct {
+	ln   net.Listener
+	from string
+	rcpt []string
+	data string
+	done chan struct{}
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStub) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt = append(s.rcpt, strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.data = b.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailThroughLocalSMTP(t *testing.T) {
+	stub := newSMTPStub(t)
+	defer stub.ln.Close()
+
+	host, portStr, _ := net.SplitHostPort(stub.ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	em, err := NewEmail(config.EmailChannelConfig{To: []string{"security@example.com"}},
+		config.SMTPConfig{Host: host, Port: port, From: "monitor@example.com", TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := em.Send(testContext(), newMessage(testAlert("critical"), "")); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	<-stub.done
+
+	if stub.from != "monitor@example.com" || len(stub.rcpt) != 1 || stub.rcpt[0] != "security@example.com" {
+		t.Fatalf("unexpected envelope: from=%s rcpt=%v", stub.from, stub.rcpt)
+	}
+	if !strings.Contains(stub.data, "Subject: [CRITICAL] Large file copy on PC-01 (ivanov)") ||
+		!strings.Contains(stub.data, "Large file copy: 512 MB") {
+		t.Fatalf("unexpected message:\n%s", stub.data)
+	}
+}
+
+func TestBuildMessageWithHTMLAndAttachment(t *testing.T) {
+	raw := buildMessage(Mail{
+		From:        "monitor@example.com",
+		To:          []string{"boss@example.com"},
+		Subject:     "Отчёт за неделю",
+		Text:        "Отчёт во вложении",
+		HTML:        "<p>Отчёт во вложении</p>",
+		Attachments: []Attachment{{Name: "отчёт.xlsx", ContentType: "application/vnd.ms-excel", Data: bytes.Repeat([]byte{1, 2, 3}, 100)}},
+	})
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %s", mediaType)
+	}
+	mixed := multipart.NewReader(msg.Body, params["boundary"])
+
+	body, err := mixed.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(body.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("body Content-Type = %s", mediaType)
+	}
+	alt := multipart.NewReader(body, params["boundary"])
+	var types []string
+	for {
+		part, err := alt.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		content, _ := io.ReadAll(part) // quoted-printable is decoded by the reader
+		if !strings.Contains(string(content), "Отчёт во вложении") {
+			t.Errorf("part %s = %q", types[len(types)-1], content)
+		}
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[1], "text/html") {
+		t.Errorf("alternatives = %v", types)
+	}
+
+	attachment, err := mixed.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.FileName() != "отчёт.xlsx" {
+		t.Errorf("file name = %q", attachment.FileName())
+	}
+	data, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	if !bytes.Equal(data, bytes.Repeat([]byte{1, 2, 3}, 100)) {
+		t.Error("attachment data differs")
+	}
+}
+
+func TestFromConfigValidatesChannels(t *testing.T) {
+	_, err := FromConfig(config.NotificationsConfig{Channels: []config.NotificationChannelConfig{
+		{Name: "hook", Type: ChannelWebhook, Enabled: true, MinSeverity: "urgent", Webhook: config.WebhookChannelConfig{URL: "http://x"}},
+	}}, config.SMTPConfig{}, nil)
+	if err == nil {
+		t.Fatal("expected error for invalid min_severity")
+	}
+
+	n, err := FromConfig(config.NotificationsConfig{Channels: []config.NotificationChannelConfig{
+		{Name: "hook", Type: ChannelWebhook, Enabled: true, MinSeverity: "high", Webhook: config.WebhookChannelConfig{URL: "http://x"}},
+		{Name: "mail", Type: ChannelEmail, Enabled: false, MinSeverity: "low"},
+	}}, config.SMTPConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Channels()) != 1 || n.Channels()[0].Name != "hook" {
+		t.Fatalf("disabled channels must be skipped: %+v", n.Channels())
+	}
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/config"
+)
+
+const defaultTelegramAPIURL = "https://api.telegram.org"
+
+// Telegram sends alerts through the Telegram Bot API (sendMessage)
+type Telegram struct {
+	endpoint string
+	chatID   string
+	client   *http.Client
+}
+
+// NewTelegram creates a Telegram channel
+func NewTelegram(cfg config.TelegramChannelConfig) (*Telegram, error) {
+	if cfg.BotToken == "" || cfg.ChatID == "" {
+		return nil, fmt.Errorf("telegram.bot_token and telegram.chat_id are required")
+	}
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = defaultTelegramAPIURL
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Telegram{
+		endpoint: strings.TrimRight(apiURL, "/") + "/bot" + cfg.BotToken + "/sendMessage",
+		chatID:   cfg.ChatID,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Send implements Channel
+func (t *Telegram) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  t.chatID,
+		"text":                     msg.Text(),
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// The request URL contains the bot token, keep it out of logs
+		return fmt.Errorf("telegram request failed: %w", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result)
+
+	if err := statusError(resp.StatusCode); err != nil {
+		if result.Description != "" {
+			return fmt.Errorf("%w: %s", err, result.Description)
+		}
+		return err
+	}
+	if !result.OK {
+		return Permanent(fmt.Errorf("telegram rejected message: %s", result.Description))
+	}
+	return nil
+}
+
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/config"
+	"github.com/ctolnik/Office-Monitor/server/database"
+)
+
+// Webhook request headers. The signature is HMAC-SHA256 over "<timestamp>.<body>"
+// with the channel secret, hex encoded with a "sha256=" prefix.
+const (
+	HeaderEvent     = "X-Event"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+// WebhookPayload is the JSON body posted to webhooks
+type WebhookPayload struct {
+	Event  string         `json:"event"`
+	SentAt time.Time      `json:"sent_at"`
+	Alert  database.Alert `json:"alert"`
+	URL    string         `json:"url,omitempty"`
+}
+
+// Webhook posts alerts as JSON to an HTTP endpoint
+type Webhook struct {
+	url     string
+	secret  []byte
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhook creates a webhook channel
+func NewWebhook(cfg config.WebhookChannelConfig) (*Webhook, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook.url must be an http(s) URL")
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Webhook{
+		url:     cfg.URL,
+		secret:  []byte(cfg.Secret),
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Send implements Channel
+func (w *Webhook) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(WebhookPayload{
+		Event:  "alert",
+		SentAt: time.Now().UTC(),
+		Alert:  msg.Alert,
+		URL:    msg.URL,
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderEvent, "alert")
+	req.Header.Set(HeaderTimestamp, ts)
+	if len(w.secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(w.secret, ts, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return statusError(resp.StatusCode)
+}
+
+// Sign returns the X-Signature value for a webhook body
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// statusError maps an HTTP status to nil, a retryable or a permanent error.
+// 408, 429 and 5xx are retried, other 4xx are not.
+func statusError(code int) error {
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	err := fmt.Errorf("unexpected status %d", code)
+	if code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500 {
+		return err
+	}
+	return Permanent(err)
+}
@@ -0,0 +1,130 @@
+// Package release signs agent builds and decides which release channel a
+// computer follows. The signed message format is shared with the agent's
+// updater and must not change without updating both sides.
+package release
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	ChannelStable = "stable"
+	ChannelCanary = "canary"
+)
+
+// Build identifies a signed agent binary
+type Build struct {
+	Version string
+	OS      string
+	Arch    string
+	SHA256  string // hex
+	Size    int64
+}
+
+// Message is the byte string signed for a build
+func Message(b Build) []byte {
+	return []byte(fmt.Sprintf("officemonitor-agent\n%s\n%s\n%s\n%s\n%d\n",
+		b.Version, b.OS, b.Arch, strings.ToLower(b.SHA256), b.Size))
+}
+
+// Sign returns the base64 ed25519 signature of the build
+func Sign(key ed25519.PrivateKey, b Build) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, Message(b)))
+}
+
+// Verify checks a base64 signature produced by Sign
+func Verify(pub ed25519.PublicKey, b Build, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, Message(b), sig)
+}
+
+// LoadPrivateKey reads an ed25519 key from a PKCS#8 PEM file (openssl genpkey
+// -algorithm ed25519) or a file holding the base64 32-byte seed
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	return ParsePrivateKey(data)
+}
+
+// ParsePrivateKey parses the formats accepted by LoadPrivateKey
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("signing key is not an ed25519 key")
+		}
+		return edKey, nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("signing key must be a PKCS#8 PEM or a base64 ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// PublicKeyString is the base64 public key agents are configured with
+func PublicKeyString(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// ValidChannel reports whether name is a known release channel
+func ValidChannel(name string) bool {
+	return name == ChannelStable || name == ChannelCanary
+}
+
+// Group assigns a channel to a set of computers
+type Group struct {
+	Name      string
+	Channel   string
+	Computers []string
+}
+
+// ChannelFor returns the channel of a computer: canary if any of its groups
+// is on canary, stable otherwise. Computer names compare case-insensitively.
+func ChannelFor(computerName string, groups []Group) string {
+	for _, g := range groups {
+		if g.Channel != ChannelCanary {
+			continue
+		}
+		for _, c := range g.Computers {
+			if strings.EqualFold(c, computerName) {
+				return ChannelCanary
+			}
+		}
+	}
+	return ChannelStable
+}
+
+// NormalizeComputers trims, deduplicates and sorts a group's computer list
+func NormalizeComputers(computers []string) []string {
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(computers))
+	for _, c := range computers {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[strings.ToUpper(c)] {
+			continue
+		}
+		seen[strings.ToUpper(c)] = true
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,100 @@
+package release
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"reflect"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Build{Version: "1.2.0", OS: "windows", Arch: "amd64", SHA256: "ABCDEF", Size: 42}
+
+	sig := Sign(key, b)
+	if !Verify(pub, b, sig) {
+		t.Fatal("valid signature rejected")
+	}
+
+	// The hash is compared in lower case
+	b.SHA256 = "abcdef"
+	if !Verify(pub, b, sig) {
+		t.Error("signature depends on hash case")
+	}
+
+	for _, tampered := range []Build{
+		{Version: "1.2.1", OS: "windows", Arch: "amd64", SHA256: "abcdef", Size: 42},
+		{Version: "1.2.0", OS: "linux", Arch: "amd64", SHA256: "abcdef", Size: 42},
+		{Version: "1.2.0", OS: "windows", Arch: "amd64", SHA256: "abcdee", Size: 42},
+		{Version: "1.2.0", OS: "windows", Arch: "amd64", SHA256: "abcdef", Size: 43},
+	} {
+		if Verify(pub, tampered, sig) {
+			t.Errorf("signature accepted for %+v", tampered)
+		}
+	}
+	if Verify(pub, b, "not base64!") {
+		t.Error("garbage signature accepted")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromPEM, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil || !fromPEM.Equal(key) {
+		t.Fatalf("PEM key: %v", err)
+	}
+
+	fromSeed, err := ParsePrivateKey([]byte(base64.StdEncoding.EncodeToString(key.Seed()) + "\n"))
+	if err != nil || !fromSeed.Equal(key) {
+		t.Fatalf("seed key: %v", err)
+	}
+
+	if _, err := ParsePrivateKey([]byte("c2hvcnQ=")); err == nil {
+		t.Error("short seed accepted")
+	}
+}
+
+func TestChannelFor(t *testing.T) {
+	groups := []Group{
+		{Name: "office", Channel: ChannelStable, Computers: []string{"PC-01", "PC-02"}},
+		{Name: "it", Channel: ChannelCanary, Computers: []string{"PC-02", "IT-01"}},
+	}
+
+	cases := map[string]string{
+		"it-01":   ChannelCanary,
+		"PC-02":   ChannelCanary, // canary wins over stable
+		"PC-01":   ChannelStable,
+		"UNKNOWN": ChannelStable,
+	}
+	for computer, want := range cases {
+		if got := ChannelFor(computer, groups); got != want {
+			t.Errorf("ChannelFor(%s) = %s, want %s", computer, got, want)
+		}
+	}
+}
+
+func TestNormalizeComputers(t *testing.T) {
+	got := NormalizeComputers([]string{" PC-02", "pc-02", "", "PC-01"})
+	if want := []string{"PC-01", "PC-02"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// The agent's updater builds the same message, keep both in sync
+func TestMessageFormat(t *testing.T) {
+	got := string(Message(Build{Version: "1.2.0", OS: "windows", Arch: "amd64", SHA256: "ABC", Size: 42}))
+	if want := "officemonitor-agent\n1.2.0\nwindows\namd64\nabc\n42\n"; got != want {
+		t.Fatalf("message = %q, want %q", got, want)
+	}
+}
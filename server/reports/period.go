@@ -0,0 +1,93 @@
+// Package reports splits report ranges into calendar buckets. Periods are
+// computed in the location of the times passed in, so a day always starts
+// at local midnight and weeks start on Monday.
+package reports
+
+import (
+	"fmt"
+	"time"
+)
+
+// Granularity is the size of one report bucket
+type Granularity string
+
+const (
+	Day   Granularity = "day"
+	Week  Granularity = "week"
+	Month Granularity = "month"
+)
+
+// ParseGranularity accepts day, week and month; empty means day
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case "":
+		return Day, nil
+	case Day, Week, Month:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown granularity %q, use day, week or month", s)
+}
+
+// Period is the half-open range [Start, End)
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Truncate returns the start of the bucket containing t
+func (g Granularity) Truncate(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch g {
+	case Week:
+		// time.Sunday is 0; Monday starts the week
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return day
+}
+
+// Next returns the start of the bucket after the one starting at start
+func (g Granularity) Next(start time.Time) time.Time {
+	switch g {
+	case Week:
+		return start.AddDate(0, 0, 7)
+	case Month:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Align widens the days from..to, both inclusive, to whole buckets
+func Align(g Granularity, from, to time.Time) Period {
+	return Period{Start: g.Truncate(from), End: g.Next(g.Truncate(to))}
+}
+
+// Buckets splits an aligned period into buckets
+func Buckets(g Granularity, p Period) []Period {
+	var out []Period
+	for start := p.Start; start.Before(p.End); {
+		next := g.Next(start)
+		out = append(out, Period{Start: start, End: next})
+		start = next
+	}
+	return out
+}
+
+// Previous returns the period of as many buckets right before p, e.g. the
+// previous three months for a quarter
+func Previous(g Granularity, p Period) Period {
+	n := len(Buckets(g, p))
+	start := p.Start
+	for i := 0; i < n; i++ {
+		switch g {
+		case Week:
+			start = start.AddDate(0, 0, -7)
+		case Month:
+			start = start.AddDate(0, -1, 0)
+		default:
+			start = start.AddDate(0, 0, -1)
+		}
+	}
+	return Period{Start: start, End: p.Start}
+}
@@ -0,0 +1,72 @@
+package reports
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestAlignAndBuckets(t *testing.T) {
+	tests := []struct {
+		g        Granularity
+		from, to string
+		start    string
+		end      string
+		buckets  int
+	}{
+		{Day, "2025-03-03", "2025-03-09", "2025-03-03", "2025-03-10", 7},
+		// Wednesday to the next Tuesday spans two Monday-based weeks
+		{Week, "2025-03-05", "2025-03-11", "2025-03-03", "2025-03-17", 2},
+		{Month, "2025-01-15", "2025-03-02", "2025-01-01", "2025-04-01", 3},
+	}
+	for _, tt := range tests {
+		p := Align(tt.g, date(tt.from), date(tt.to))
+		if !p.Start.Equal(date(tt.start)) || !p.End.Equal(date(tt.end)) {
+			t.Errorf("%s: Align = %v..%v, want %s..%s", tt.g, p.Start, p.End, tt.start, tt.end)
+		}
+		if n := len(Buckets(tt.g, p)); n != tt.buckets {
+			t.Errorf("%s: %d buckets, want %d", tt.g, n, tt.buckets)
+		}
+	}
+}
+
+func TestPrevious(t *testing.T) {
+	p := Previous(Month, Align(Month, date("2025-03-01"), date("2025-04-30")))
+	if !p.Start.Equal(date("2025-01-01")) || !p.End.Equal(date("2025-03-01")) {
+		t.Errorf("Previous(month) = %v..%v", p.Start, p.End)
+	}
+
+	p = Previous(Week, Align(Week, date("2025-03-03"), date("2025-03-09")))
+	if !p.Start.Equal(date("2025-02-24")) || !p.End.Equal(date("2025-03-03")) {
+		t.Errorf("Previous(week) = %v..%v", p.Start, p.End)
+	}
+}
+
+func TestDayStartsAtLocalMidnightAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	from := time.Date(2025, 3, 29, 12, 0, 0, 0, berlin)
+	buckets := Buckets(Day, Align(Day, from, from.AddDate(0, 0, 1)))
+	// The day clocks move forward has 23 hours
+	if len(buckets) != 2 || buckets[1].End.Sub(buckets[1].Start) != 23*time.Hour {
+		t.Fatalf("buckets = %v", buckets)
+	}
+}
+
+func TestParseGranularity(t *testing.T) {
+	if g, err := ParseGranularity(""); err != nil || g != Day {
+		t.Errorf("empty = %q, %v", g, err)
+	}
+	if _, err := ParseGranularity("year"); err == nil {
+		t.Error("year accepted")
+	}
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+var msk = time.FixedZone("MSK", 3*3600)
+
+func TestCronNext(t *testing.T) {
+	// Sunday
+	from := time.Date(2025, 3, 16, 12, 30, 0, 0, msk)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 8 * * 1", time.Date(2025, 3, 17, 8, 0, 0, 0, msk)},
+		{"0 8 * * MON", time.Date(2025, 3, 17, 8, 0, 0, 0, msk)},
+		{"@weekly", time.Date(2025, 3, 17, 0, 0, 0, 0, msk)},
+		{"*/15 * * * *", time.Date(2025, 3, 16, 12, 45, 0, 0, msk)},
+		{"0 9-18/3 * * *", time.Date(2025, 3, 16, 15, 0, 0, 0, msk)},
+		{"0 7 1 * *", time.Date(2025, 4, 1, 7, 0, 0, 0, msk)},
+		{"30 12 * * 7", time.Date(2025, 3, 23, 12, 30, 0, 0, msk)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, msk)},
+		// Day of month or day of week when both are restricted
+		{"0 6 20 * FRI", time.Date(2025, 3, 20, 6, 0, 0, 0, msk)},
+		{"0 6 1,31 * *", time.Date(2025, 3, 31, 6, 0, 0, 0, msk)},
+		{"0 0 1 JAN-MAR *", time.Date(2026, 1, 1, 0, 0, 0, 0, msk)},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q.Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextUsesLocation(t *testing.T) {
+	c, err := ParseCron("0 8 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 06:00 UTC is 09:00 in Moscow, past today's run there
+	from := time.Date(2025, 3, 17, 6, 0, 0, 0, time.UTC)
+	if got := c.Next(from.In(msk)); !got.Equal(time.Date(2025, 3, 18, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("Next in MSK = %v", got.UTC())
+	}
+	if got := c.Next(from); !got.Equal(time.Date(2025, 3, 17, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Next in UTC = %v", got)
+	}
+}
+
+func TestCronNeverMatches(t *testing.T) {
+	c, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Next(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %v, want zero", got)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@yearly"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
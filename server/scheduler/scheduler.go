@@ -0,0 +1,343 @@
+// Package scheduler generates reports on the cron schedules stored in
+// monitoring.report_schedules and mails them as an HTML digest with the full
+// report attached as XLSX.
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/export"
+	"github.com/ctolnik/Office-Monitor/server/notify"
+	"github.com/ctolnik/Office-Monitor/server/reports"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"go.uber.org/zap"
+)
+
+// mailRows limits the table rows in the mail body; the attachment has all
+const mailRows = 20
+
+// ErrRunning is returned by RunNow while the schedule is already running
+var ErrRunning = errors.New("report schedule is already running")
+
+// Store is the subset of the database used by the scheduler
+type Store interface {
+	GetReportSchedules(ctx context.Context) ([]database.ReportSchedule, error)
+	GetSystemSettings(ctx context.Context) (map[string]string, error)
+	GetRangeReport(ctx context.Context, username string, g reports.Granularity, period reports.Period) (*database.RangeReport, error)
+	GetGroupReport(ctx context.Context, f database.GroupFilter, p reports.Period) (*database.GroupReport, error)
+	InsertReportRun(ctx context.Context, run *database.ReportRun) error
+}
+
+// Sender delivers a mail, usually notify.SendMail with the server's SMTP config
+type Sender func(ctx context.Context, m notify.Mail) error
+
+// Scheduler runs due report schedules. It is safe for concurrent use.
+type Scheduler struct {
+	store Store
+	send  Sender
+	from  string
+	loc   *time.Location // used when the timezone setting is empty or invalid
+	now   func() time.Time
+
+	mu       sync.Mutex
+	running  map[string]bool
+	lastTick time.Time
+}
+
+// New creates a scheduler sending mail from the given address. Runs missed
+// while the server was down are not caught up.
+func New(store Store, send Sender, from string, loc *time.Location) *Scheduler {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Scheduler{
+		store:    store,
+		send:     send,
+		from:     from,
+		loc:      loc,
+		now:      time.Now,
+		running:  make(map[string]bool),
+		lastTick: time.Now(),
+	}
+}
+
+// Run checks for due schedules every interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Tick(ctx)
+		}
+	}
+}
+
+// Tick runs every enabled schedule due since the previous tick, once even if
+// several of its runs were missed. Not safe for concurrent calls; Run calls it
+// from a single goroutine.
+func (s *Scheduler) Tick(ctx context.Context) {
+	now := s.now()
+
+	schedules, err := s.store.GetReportSchedules(ctx)
+	if err != nil {
+		// Keep lastTick so the runs are caught up by the next tick
+		zapctx.Warn(ctx, "Failed to load report schedules", zap.Error(err))
+		return
+	}
+	since := s.lastTick
+	s.lastTick = now
+
+	settings, loc := s.settings(ctx)
+	for _, sch := range schedules {
+		if !sch.Enabled {
+			continue
+		}
+		c, err := ParseCron(sch.Cron)
+		if err != nil {
+			zapctx.Warn(ctx, "Skipping report schedule with invalid cron", zap.String("schedule_id", sch.ID), zap.Error(err))
+			continue
+		}
+		next := c.Next(since.In(loc))
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		if _, err := s.execute(ctx, sch, database.ReportTriggerSchedule, next, settings, loc); err != nil {
+			zapctx.Warn(ctx, "Skipping report schedule run", zap.String("schedule_id", sch.ID), zap.Error(err))
+		}
+	}
+}
+
+// RunNow generates and sends the report immediately, for the period the
+// schedule would cover if it ran now
+func (s *Scheduler) RunNow(ctx context.Context, sch database.ReportSchedule) (*database.ReportRun, error) {
+	settings, loc := s.settings(ctx)
+	return s.execute(ctx, sch, database.ReportTriggerManual, s.now(), settings, loc)
+}
+
+// settings loads system_settings and the report timezone
+func (s *Scheduler) settings(ctx context.Context) (map[string]string, *time.Location) {
+	settings, err := s.store.GetSystemSettings(ctx)
+	if err != nil {
+		zapctx.Warn(ctx, "Failed to load settings for scheduled reports", zap.Error(err))
+		return map[string]string{}, s.loc
+	}
+	name := settings["timezone"]
+	if name == "" {
+		return settings, s.loc
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		zapctx.Warn(ctx, "Invalid timezone setting, using the server timezone", zap.String("timezone", name), zap.Error(err))
+		return settings, s.loc
+	}
+	return settings, loc
+}
+
+// ReportPeriod returns the last complete day, week or month before at, in
+// at's location
+func ReportPeriod(period string, at time.Time) reports.Period {
+	g := reports.Granularity(period)
+	start := g.Truncate(at)
+	return reports.Previous(g, reports.Period{Start: start, End: g.Next(start)})
+}
+
+func (s *Scheduler) execute(ctx context.Context, sch database.ReportSchedule, trigger string, at time.Time, settings map[string]string, loc *time.Location) (*database.ReportRun, error) {
+	s.mu.Lock()
+	if s.running[sch.ID] {
+		s.mu.Unlock()
+		return nil, ErrRunning
+	}
+	s.running[sch.ID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, sch.ID)
+		s.mu.Unlock()
+	}()
+
+	period := ReportPeriod(sch.Period, at.In(loc))
+	run := &database.ReportRun{
+		ScheduleID:   sch.ID,
+		ScheduleName: sch.Name,
+		Trigger:      trigger,
+		StartedAt:    s.now(),
+		PeriodStart:  period.Start,
+		PeriodEnd:    period.End,
+		Recipients:   sch.Recipients,
+	}
+
+	err := s.deliver(ctx, sch, period, settings, loc)
+	run.FinishedAt = s.now()
+	if err != nil {
+		run.Status = database.ReportRunFailed
+		run.Error = err.Error()
+		zapctx.Warn(ctx, "Scheduled report failed", zap.String("schedule_id", sch.ID),
+			zap.String("trigger", trigger), zap.Error(err))
+	} else {
+		run.Status = database.ReportRunSuccess
+		zapctx.Info(ctx, "Scheduled report sent", zap.String("schedule_id", sch.ID),
+			zap.String("trigger", trigger), zap.Int("recipients", len(sch.Recipients)))
+	}
+
+	if err := s.store.InsertReportRun(ctx, run); err != nil {
+		zapctx.Warn(ctx, "Failed to record report run", zap.String("schedule_id", sch.ID), zap.Error(err))
+	}
+	return run, nil
+}
+
+func (s *Scheduler) deliver(ctx context.Context, sch database.ReportSchedule, period reports.Period, settings map[string]string, loc *time.Location) error {
+	if len(sch.Recipients) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	doc, err := s.document(ctx, sch, period, loc)
+	if err != nil {
+		return err
+	}
+
+	var xlsx bytes.Buffer
+	if err := export.WriteXLSX(&xlsx, doc); err != nil {
+		return fmt.Errorf("failed to render XLSX: %w", err)
+	}
+	opts := export.MailOptions{
+		CompanyName: settings["company_name"],
+		Intro:       "Полный отчёт во вложении.",
+		MaxRows:     mailRows,
+	}
+	var html, text bytes.Buffer
+	if err := export.WriteHTML(&html, doc, opts); err != nil {
+		return fmt.Errorf("failed to render mail: %w", err)
+	}
+	if err := export.WriteText(&text, doc, opts); err != nil {
+		return fmt.Errorf("failed to render mail: %w", err)
+	}
+
+	return s.send(ctx, notify.Mail{
+		From:    s.from,
+		To:      sch.Recipients,
+		Subject: strings.Join(nonEmpty(doc.Title, doc.Subject, doc.Period), ": "),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Attachments: []notify.Attachment{{
+			Name:        export.PeriodFileName(doc.Subject, period) + ".xlsx",
+			ContentType: export.XLSX.ContentType(),
+			Data:        xlsx.Bytes(),
+		}},
+	})
+}
+
+// document loads the report of a schedule. Range reports are widened to
+// whole buckets like the range report endpoint does.
+func (s *Scheduler) document(ctx context.Context, sch database.ReportSchedule, period reports.Period, loc *time.Location) (export.Document, error) {
+	switch sch.ReportType {
+	case database.ScheduleReportRange:
+		g, err := reports.ParseGranularity(sch.Granularity)
+		if err != nil {
+			return export.Document{}, err
+		}
+		r, err := s.store.GetRangeReport(ctx, sch.Target, g, reports.Align(g, period.Start, period.End.AddDate(0, 0, -1)))
+		if err != nil {
+			return export.Document{}, fmt.Errorf("failed to get range report: %w", err)
+		}
+		return export.Range(r, loc), nil
+	case database.ScheduleReportDepartment, database.ScheduleReportTeam:
+		f := database.GroupFilter{Department: sch.Target}
+		if sch.ReportType == database.ScheduleReportTeam {
+			f = database.GroupFilter{Department: sch.Department, Team: sch.Target}
+		}
+		r, err := s.store.GetGroupReport(ctx, f, period)
+		if err != nil {
+			return export.Document{}, fmt.Errorf("failed to get group report: %w", err)
+		}
+		return export.Group(r, loc), nil
+	}
+	return export.Document{}, fmt.Errorf("unknown report type %q", sch.ReportType)
+}
+
+// Validate checks a schedule and normalizes it: defaults the period to week
+// and the granularity to day, and reduces recipients to bare addresses
+func Validate(sch *database.ReportSchedule) error {
+	sch.Name = strings.TrimSpace(sch.Name)
+	if sch.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, err := ParseCron(sch.Cron); err != nil {
+		return fmt.Errorf("invalid cron: %w", err)
+	}
+
+	switch sch.ReportType {
+	case database.ScheduleReportRange, database.ScheduleReportTeam:
+		if strings.TrimSpace(sch.Target) == "" {
+			return fmt.Errorf("target is required for %s reports", sch.ReportType)
+		}
+	case database.ScheduleReportDepartment:
+		// An empty target reports on all employees
+	default:
+		return fmt.Errorf("report_type must be range, department or team")
+	}
+
+	if sch.Period == "" {
+		sch.Period = string(reports.Week)
+	}
+	period, err := reports.ParseGranularity(sch.Period)
+	if err != nil {
+		return fmt.Errorf("invalid period: %w", err)
+	}
+	g, err := reports.ParseGranularity(sch.Granularity)
+	if err != nil {
+		return err
+	}
+	if rank(g) > rank(period) {
+		return fmt.Errorf("granularity must not be coarser than the period")
+	}
+	sch.Granularity = string(g)
+
+	if len(sch.Recipients) == 0 {
+		return fmt.Errorf("at least one recipient is required")
+	}
+	recipients := make([]string, 0, len(sch.Recipients))
+	seen := make(map[string]bool)
+	for _, r := range sch.Recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q", r)
+		}
+		if key := strings.ToLower(addr.Address); !seen[key] {
+			seen[key] = true
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	sch.Recipients = recipients
+	return nil
+}
+
+func rank(g reports.Granularity) int {
+	switch g {
+	case reports.Week:
+		return 1
+	case reports.Month:
+		return 2
+	}
+	return 0
+}
+
+func nonEmpty(values ...string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
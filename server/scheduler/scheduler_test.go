@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ctolnik/Office-Monitor/server/database"
+	"github.com/ctolnik/Office-Monitor/server/notify"
+	"github.com/ctolnik/Office-Monitor/server/reports"
+	"github.com/ctolnik/Office-Monitor/zapctx"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	mu        sync.Mutex
+	schedules []database.ReportSchedule
+	settings  map[string]string
+	runs      []database.ReportRun
+	filters   []database.GroupFilter
+	periods   []reports.Period
+}
+
+func (f *fakeStore) GetReportSchedules(ctx context.Context) ([]database.ReportSchedule, error) {
+	return f.schedules, nil
+}
+
+func (f *fakeStore) GetSystemSettings(ctx context.Context) (map[string]string, error) {
+	return f.settings, nil
+}
+
+func (f *fakeStore) GetRangeReport(ctx context.Context, username string, g reports.Granularity, p reports.Period) (*database.RangeReport, error) {
+	f.periods = append(f.periods, p)
+	return &database.RangeReport{Username: username, Granularity: string(g)}, nil
+}
+
+func (f *fakeStore) GetGroupReport(ctx context.Context, filter database.GroupFilter, p reports.Period) (*database.GroupReport, error) {
+	f.filters = append(f.filters, filter)
+	f.periods = append(f.periods, p)
+	return &database.GroupReport{
+		GroupStats: database.GroupStats{Department: filter.Department, Team: filter.Team, Headcount: 2},
+		StartDate:  p.Start.Format(time.RFC3339),
+		EndDate:    p.End.Format(time.RFC3339),
+		Employees:  []database.GroupEmployee{{Username: "ivanov", TotalActiveTime: 3600}},
+	}, nil
+}
+
+func (f *fakeStore) InsertReportRun(ctx context.Context, run *database.ReportRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runs = append(f.runs, *run)
+	return nil
+}
+
+type outbox struct {
+	mails []notify.Mail
+	err   error
+}
+
+func (o *outbox) send(ctx context.Context, m notify.Mail) error {
+	o.mails = append(o.mails, m)
+	return o.err
+}
+
+func testContext() context.Context {
+	return zapctx.WithLogger(context.Background(), zap.NewNop())
+}
+
+func weeklySchedule() database.ReportSchedule {
+	return database.ReportSchedule{
+		ID: "s1", Name: "Продажи", Cron: "0 8 * * 1", ReportType: database.ScheduleReportDepartment,
+		Target: "Продажи", Period: "week", Granularity: "day",
+		Recipients: []string{"head@example.com"}, Enabled: true,
+	}
+}
+
+func TestTickSendsDueScheduleOnce(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	ctx := testContext()
+	store := &fakeStore{
+		schedules: []database.ReportSchedule{weeklySchedule()},
+		settings:  map[string]string{"timezone": "Europe/Moscow", "company_name": "ООО Ромашка"},
+	}
+	out := &outbox{}
+	s := New(store, out.send, "monitor@example.com", time.UTC)
+
+	// Monday 07:59 and 08:00 in Moscow
+	s.lastTick = time.Date(2025, 3, 17, 4, 58, 0, 0, time.UTC)
+	s.now = func() time.Time { return time.Date(2025, 3, 17, 4, 59, 30, 0, time.UTC) }
+	s.Tick(ctx)
+	if len(out.mails) != 0 {
+		t.Fatalf("sent %d mails before 08:00", len(out.mails))
+	}
+
+	s.now = func() time.Time { return time.Date(2025, 3, 17, 5, 0, 30, 0, time.UTC) }
+	s.Tick(ctx)
+	s.Tick(ctx)
+	if len(out.mails) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(out.mails))
+	}
+
+	m := out.mails[0]
+	if m.From != "monitor@example.com" || len(m.To) != 1 || m.To[0] != "head@example.com" {
+		t.Errorf("envelope = %s -> %v", m.From, m.To)
+	}
+	if !strings.Contains(m.Subject, "Продажи") || !strings.Contains(m.Subject, "10.03.2025 — 16.03.2025") {
+		t.Errorf("subject = %q", m.Subject)
+	}
+	if !strings.Contains(m.HTML, "ООО Ромашка") || !strings.Contains(m.HTML, "ivanov") || m.Text == "" {
+		t.Errorf("body lacks company or employees:\n%s", m.HTML)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Name != "report_Продажи_2025-03-10_2025-03-16.xlsx" {
+		t.Fatalf("attachments = %+v", m.Attachments)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(m.Attachments[0].Data))
+	if err != nil {
+		t.Fatalf("attachment is not XLSX: %v", err)
+	}
+	f.Close()
+
+	// The previous Monday to Sunday in Moscow
+	want := reports.Period{Start: time.Date(2025, 3, 10, 0, 0, 0, 0, moscow), End: time.Date(2025, 3, 17, 0, 0, 0, 0, moscow)}
+	if p := store.periods[0]; !p.Start.Equal(want.Start) || !p.End.Equal(want.End) {
+		t.Errorf("period = %v - %v", p.Start, p.End)
+	}
+	if store.filters[0].Department != "Продажи" {
+		t.Errorf("filter = %+v", store.filters[0])
+	}
+
+	if len(store.runs) != 1 {
+		t.Fatalf("%d runs recorded", len(store.runs))
+	}
+	if r := store.runs[0]; r.Status != database.ReportRunSuccess || r.Trigger != database.ReportTriggerSchedule || !r.PeriodStart.Equal(want.Start) {
+		t.Errorf("run = %+v", r)
+	}
+}
+
+func TestTickSkipsDisabledAndInvalid(t *testing.T) {
+	disabled := weeklySchedule()
+	disabled.Enabled = false
+	invalid := weeklySchedule()
+	invalid.ID, invalid.Cron = "s2", "bogus"
+
+	store := &fakeStore{schedules: []database.ReportSchedule{disabled, invalid}, settings: map[string]string{}}
+	out := &outbox{}
+	s := New(store, out.send, "monitor@example.com", time.UTC)
+	s.lastTick = time.Date(2025, 3, 17, 7, 59, 0, 0, time.UTC)
+	s.now = func() time.Time { return time.Date(2025, 3, 17, 8, 1, 0, 0, time.UTC) }
+	s.Tick(testContext())
+
+	if len(out.mails) != 0 || len(store.runs) != 0 {
+		t.Errorf("sent %d mails, recorded %d runs", len(out.mails), len(store.runs))
+	}
+}
+
+func TestRunNowRecordsFailure(t *testing.T) {
+	sch := weeklySchedule()
+	sch.ReportType, sch.Target, sch.Period, sch.Granularity = database.ScheduleReportRange, "ivanov", "month", "week"
+
+	store := &fakeStore{settings: map[string]string{}}
+	out := &outbox{err: errors.New("smtp connect: connection refused")}
+	s := New(store, out.send, "monitor@example.com", msk)
+	s.now = func() time.Time { return time.Date(2025, 3, 17, 10, 0, 0, 0, msk) }
+
+	run, err := s.RunNow(testContext(), sch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != database.ReportRunFailed || run.Trigger != database.ReportTriggerManual || !strings.Contains(run.Error, "connection refused") {
+		t.Errorf("run = %+v", run)
+	}
+	if len(store.runs) != 1 {
+		t.Errorf("%d runs recorded", len(store.runs))
+	}
+
+	// February, widened to whole weeks for the range report
+	want := reports.Period{Start: time.Date(2025, 1, 27, 0, 0, 0, 0, msk), End: time.Date(2025, 3, 3, 0, 0, 0, 0, msk)}
+	if p := store.periods[0]; !p.Start.Equal(want.Start) || !p.End.Equal(want.End) {
+		t.Errorf("period = %v - %v", p.Start, p.End)
+	}
+}
+
+func TestRunNowRejectsConcurrentRun(t *testing.T) {
+	s := New(&fakeStore{settings: map[string]string{}}, (&outbox{}).send, "", time.UTC)
+	s.running["s1"] = true
+	if _, err := s.RunNow(testContext(), weeklySchedule()); !errors.Is(err, ErrRunning) {
+		t.Errorf("err = %v, want ErrRunning", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	sch := weeklySchedule()
+	sch.Period, sch.Granularity = "", ""
+	sch.Recipients = []string{"Начальник <Head@Example.com>", "head@example.com", "hr@example.com"}
+	if err := Validate(&sch); err != nil {
+		t.Fatal(err)
+	}
+	if sch.Period != "week" || sch.Granularity != "day" {
+		t.Errorf("defaults = %q, %q", sch.Period, sch.Granularity)
+	}
+	if len(sch.Recipients) != 2 || sch.Recipients[0] != "Head@Example.com" || sch.Recipients[1] != "hr@example.com" {
+		t.Errorf("recipients = %v", sch.Recipients)
+	}
+
+	for name, mutate := range map[string]func(*database.ReportSchedule){
+		"cron":        func(s *database.ReportSchedule) { s.Cron = "0 25 * * *" },
+		"type":        func(s *database.ReportSchedule) { s.ReportType = "daily" },
+		"target":      func(s *database.ReportSchedule) { s.ReportType, s.Target = database.ScheduleReportRange, "" },
+		"period":      func(s *database.ReportSchedule) { s.Period = "year" },
+		"granularity": func(s *database.ReportSchedule) { s.Period, s.Granularity = "week", "month" },
+		"recipients":  func(s *database.ReportSchedule) { s.Recipients = nil },
+		"address":     func(s *database.ReportSchedule) { s.Recipients = []string{"not an address"} },
+	} {
+		s := weeklySchedule()
+		mutate(&s)
+		if err := Validate(&s); err == nil {
+			t.Errorf("%s: Validate succeeded", name)
+		}
+	}
+}
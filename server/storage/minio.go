@@ -16,10 +16,11 @@ type Storage struct {
 	client            *minio.Client
 	screenshotsBucket string
 	usbCopiesBucket   string
+	agentBuildsBucket string
 	publicEndpoint    string // Public URL to replace in presigned URLs
 }
 
-func New(endpoint, accessKey, secretKey string, useSSL bool, screenshotsBucket, usbCopiesBucket, publicEndpoint string) (*Storage, error) {
+func New(endpoint, accessKey, secretKey string, useSSL bool, screenshotsBucket, usbCopiesBucket, agentBuildsBucket, publicEndpoint string) (*Storage, error) {
 	client, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: useSSL,
@@ -35,17 +36,21 @@ func New(endpoint, accessKey, secretKey string, useSSL bool, screenshotsBucket,
 	if usbCopiesBucket == "" {
 		usbCopiesBucket = "usb-copies"
 	}
+	if agentBuildsBucket == "" {
+		agentBuildsBucket = "agent-builds"
+	}
 
 	s := &Storage{
 		client:            client,
 		screenshotsBucket: screenshotsBucket,
 		usbCopiesBucket:   usbCopiesBucket,
+		agentBuildsBucket: agentBuildsBucket,
 		publicEndpoint:    publicEndpoint,
 	}
 
 	ctx := context.Background()
 
-	buckets := []string{s.screenshotsBucket, s.usbCopiesBucket}
+	buckets := []string{s.screenshotsBucket, s.usbCopiesBucket, s.agentBuildsBucket}
 	for _, bucket := range buckets {
 		exists, err := client.BucketExists(ctx, bucket)
 		if err != nil {
@@ -61,6 +66,20 @@ func New(endpoint, accessKey, secretKey string, useSSL bool, screenshotsBucket,
 	return s, nil
 }
 
+// Ping checks that MinIO is reachable and the configured buckets exist
+func (s *Storage) Ping(ctx context.Context) error {
+	for _, bucket := range []string{s.screenshotsBucket, s.usbCopiesBucket, s.agentBuildsBucket} {
+		exists, err := s.client.BucketExists(ctx, bucket)
+		if err != nil {
+			return fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+		}
+		if !exists {
+			return fmt.Errorf("bucket %s does not exist", bucket)
+		}
+	}
+	return nil
+}
+
 func (s *Storage) UploadScreenshot(ctx context.Context, screenshotID string, data []byte) (string, error) {
 	// Object is stored in bucket root with name: COMPUTER_USERNAME_TIMESTAMP.jpg
 	objectName := fmt.Sprintf("%s.jpg", screenshotID)
@@ -98,6 +117,35 @@ func (s *Storage) UploadUSBFile(ctx context.Context, computerName, relativePath
 	return objectName, nil
 }
 
+// ScreenshotsBucket is the bucket holding screenshots and uploaded logos
+func (s *Storage) ScreenshotsBucket() string {
+	return s.screenshotsBucket
+}
+
+// AgentBuildsBucket is the bucket holding uploaded agent binaries
+func (s *Storage) AgentBuildsBucket() string {
+	return s.agentBuildsBucket
+}
+
+// UploadAgentBuild stores an agent binary as <version>/<os>-<arch>/<file>
+func (s *Storage) UploadAgentBuild(ctx context.Context, version, goos, arch, fileName string, data io.Reader, size int64) (string, error) {
+	objectName := fmt.Sprintf("%s/%s-%s/%s", version, goos, arch, fileName)
+
+	_, err := s.client.PutObject(
+		ctx,
+		s.agentBuildsBucket,
+		objectName,
+		data,
+		size,
+		minio.PutObjectOptions{ContentType: "application/octet-stream"},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload agent build: %w", err)
+	}
+
+	return objectName, nil
+}
+
 func (s *Storage) GetObject(ctx context.Context, bucket, objectName string) (*minio.Object, error) {
 	// Get object from MinIO
 	object, err := s.client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})